@@ -0,0 +1,54 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// allocationTimer 返回存储后端的分配时间查询接口
+func (g *CIDRGuardian) allocationTimer() (AllocationTimeStorage, error) {
+	timer, ok := storageAs[AllocationTimeStorage](g.storage)
+	if !ok {
+		return nil, fmt.Errorf("存储后端不支持分配时间查询")
+	}
+	return timer, nil
+}
+
+// GetAllocationsBefore 获取分配时间早于 t 的已分配IP及描述，用于清理长期滞留的分配
+// 需要存储后端实现 AllocationTimeStorage
+func (g *CIDRGuardian) GetAllocationsBefore(ctx context.Context, t time.Time) (map[string]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	timer, err := g.allocationTimer()
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := timer.GetAllocationsBefore(ctx, t)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "GetAllocationsBefore", err)
+	}
+	return allocations, nil
+}
+
+// GetAllocationsAfter 获取分配时间晚于 t 的已分配IP及描述
+// 需要存储后端实现 AllocationTimeStorage
+func (g *CIDRGuardian) GetAllocationsAfter(ctx context.Context, t time.Time) (map[string]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	timer, err := g.allocationTimer()
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := timer.GetAllocationsAfter(ctx, t)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "GetAllocationsAfter", err)
+	}
+	return allocations, nil
+}
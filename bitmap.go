@@ -0,0 +1,163 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// maxBitmapBits 是可用性位图允许覆盖的最大地址数量（对应 2 MiB 的位图）
+const maxBitmapBits = 1 << 24
+
+// bitmapPrefix 解析位图对应的 CIDR 并返回其地址数量
+func bitmapPrefix(cidr string) (netip.Prefix, int, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, 0, fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+	prefix = prefix.Masked()
+
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 24 {
+		return netip.Prefix{}, 0, fmt.Errorf("CIDR %s 包含的地址超过位图上限 %d", cidr, maxBitmapBits)
+	}
+	return prefix, 1 << hostBits, nil
+}
+
+// AvailabilityBitmap 导出 CIDR 中每个地址是否可用的位图
+// 第 i 个地址（从网络地址开始计数）对应第 i/8 个字节的第 7-i%8 位，即每个字节内高位在前；
+// 地址数量不足 8 的倍数时末尾的填充位为 0。CIDR 可以只覆盖管理 CIDR 的一部分，
+// 不在可用池中的地址（包括不受管理的地址）对应位为 0
+func (g *CIDRGuardian) AvailabilityBitmap(ctx context.Context, cidr string) ([]byte, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	prefix, size, err := bitmapPrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "AvailabilityBitmap", err)
+	}
+
+	// 只需遍历可用IP，直接计算其在位图中的下标
+	bitmap := make([]byte, (size+7)/8)
+	start := prefix.Addr()
+	for _, ipStr := range availableIPs {
+		addr, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			continue
+		}
+		addr = addr.Unmap()
+		if !prefix.Contains(addr) {
+			continue
+		}
+		i := addrOffset(start, addr)
+		bitmap[i/8] |= 0x80 >> (i % 8)
+	}
+
+	return bitmap, nil
+}
+
+// ImportAvailabilityBitmap 按 AvailabilityBitmap 导出的位图设置 CIDR 中地址的可用状态
+// 位为 1 的地址加入可用池，位为 0 的地址从可用池中移除；已分配的地址不会改变。
+// 位为 1 的地址必须在管理池中且未被分配，否则整体失败；应用过程中出错时回滚已做的修改
+func (g *CIDRGuardian) ImportAvailabilityBitmap(ctx context.Context, cidr string, bitmap []byte) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	prefix, size, err := bitmapPrefix(cidr)
+	if err != nil {
+		return err
+	}
+	if len(bitmap) != (size+7)/8 {
+		return fmt.Errorf("位图长度 %d 与 CIDR %s 不匹配，应为 %d 字节", len(bitmap), cidr, (size+7)/8)
+	}
+	for i := size; i < len(bitmap)*8; i++ {
+		if bitmap[i/8]&(0x80>>(i%8)) != 0 {
+			return fmt.Errorf("位图的填充位必须为 0")
+		}
+	}
+
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return g.wrapErr(ctx, "ImportAvailabilityBitmap", err)
+	}
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return g.wrapErr(ctx, "ImportAvailabilityBitmap", err)
+	}
+	available := make(map[string]bool, len(availableIPs))
+	for _, ip := range availableIPs {
+		available[ip] = true
+	}
+
+	// 先计算需要的修改并检查冲突，保证整体成功或整体失败
+	var toAdd, toRemove []string
+	addr := prefix.Addr()
+	for i := 0; i < size; i, addr = i+1, addr.Next() {
+		ipStr := addr.String()
+		if bitmap[i/8]&(0x80>>(i%8)) != 0 {
+			if available[ipStr] {
+				continue
+			}
+			if _, exists := allocated[ipStr]; exists {
+				return fmt.Errorf("IP %s 已被分配", ipStr)
+			}
+			if !g.isManagedIP(net.IP(addr.AsSlice())) {
+				return fmt.Errorf("IP %s 不在管理池中", ipStr)
+			}
+			toAdd = append(toAdd, ipStr)
+		} else if available[ipStr] {
+			toRemove = append(toRemove, ipStr)
+		}
+	}
+
+	var added, removed []string
+	rollback := func() {
+		for _, ipStr := range added {
+			_ = g.storage.RemoveIP(ctx, ipStr)
+		}
+		for _, ipStr := range removed {
+			_ = g.storage.AddIP(ctx, ipStr)
+		}
+	}
+
+	for _, ipStr := range toAdd {
+		if err := g.storage.AddIP(ctx, ipStr); err != nil {
+			rollback()
+			return g.wrapErr(ctx, "ImportAvailabilityBitmap", err)
+		}
+		added = append(added, ipStr)
+	}
+	for _, ipStr := range toRemove {
+		if err := g.storage.RemoveIP(ctx, ipStr); err != nil {
+			rollback()
+			return g.wrapErr(ctx, "ImportAvailabilityBitmap", err)
+		}
+		removed = append(removed, ipStr)
+	}
+
+	return nil
+}
+
+// addrOffset 返回 addr 相对于 start 的偏移量，调用方需保证两者位于同一个不超过 2^24 个地址的块中
+func addrOffset(start, addr netip.Addr) int {
+	a, b := start.AsSlice(), addr.AsSlice()
+	offset := 0
+	for i := len(a) - 3; i < len(a); i++ {
+		offset = offset<<8 | int(b[i]-a[i])
+	}
+	return offset
+}
@@ -0,0 +1,61 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// packBlockDescription 生成不支持块记录的存储中块网络地址上 "cidr - 描述" 格式的描述
+func packBlockDescription(cidr, description string) string {
+	return fmt.Sprintf("%s - %s", cidr, description)
+}
+
+// allocatedBlock 是一个已分配的 CIDR 块
+type allocatedBlock struct {
+	cidr string // 块的 CIDR
+	desc string // 块的描述
+}
+
+// blockIndex 以网络地址为键索引存储中以块记录的分配
+type blockIndex map[string]allocatedBlock
+
+// blockIndex 读取存储中以块记录的分配，存储不支持块记录时返回空索引
+func (g *CIDRGuardian) blockIndex(ctx context.Context, op string) (blockIndex, error) {
+	bs, ok := storageAs[BlockAllocationStorage](g.storage)
+	if !ok {
+		return blockIndex{}, nil
+	}
+
+	blocks, err := bs.GetBlockAllocations(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, op, err)
+	}
+
+	index := make(blockIndex, len(blocks))
+	for cidr, desc := range blocks {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		index[ipNet.IP.String()] = allocatedBlock{cidr: ipNet.String(), desc: desc}
+	}
+	return index, nil
+}
+
+// lookup 判断已分配的 ip 是否为块的网络地址，返回块的 CIDR 和描述
+// 先查块记录，再兼容解析旧版 "cidr - 描述" 格式的描述
+func (b blockIndex) lookup(ip, desc string) (cidr, description string, ok bool) {
+	if block, found := b[ip]; found {
+		return block.cidr, block.desc, true
+	}
+	return splitBlockDescription(desc)
+}
+
+// storeBlock 将块的网络地址写入已分配池，存储支持时记录为块，否则使用 "cidr - 描述" 格式的描述
+func (g *CIDRGuardian) storeBlock(ctx context.Context, ipNet *net.IPNet, description string) error {
+	if bs, ok := storageAs[BlockAllocationStorage](g.storage); ok {
+		return bs.AllocateBlock(ctx, ipNet.String(), description)
+	}
+	return g.storage.AllocateIP(ctx, ipNet.IP.String(), packBlockDescription(ipNet.String(), description))
+}
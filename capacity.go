@@ -0,0 +1,114 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"time"
+)
+
+// InfiniteRunway 表示按给定速率可用池永远不会耗尽
+const InfiniteRunway = time.Duration(math.MaxInt64)
+
+// CapacityProjection 按每小时分配 ratePerHour 个IP的速率估算可用池耗尽前的剩余时间
+// 速率为 0 或结果超出 time.Duration 范围时返回 InfiniteRunway；速率为负数或非有限值时返回错误
+func (g *CIDRGuardian) CapacityProjection(ctx context.Context, ratePerHour float64) (time.Duration, error) {
+	if math.IsNaN(ratePerHour) || math.IsInf(ratePerHour, 0) || ratePerHour < 0 {
+		return 0, fmt.Errorf("无效的分配速率: %v", ratePerHour)
+	}
+
+	available, err := g.AvailableCount(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if ratePerHour == 0 {
+		return InfiniteRunway, nil
+	}
+
+	runway := float64(available) / ratePerHour * float64(time.Hour)
+	if runway >= float64(InfiniteRunway) {
+		return InfiniteRunway, nil
+	}
+	return time.Duration(runway), nil
+}
+
+// CountAllocatableCIDRs 计算当前可用池中还能划分出多少个 /bits 的对齐块
+// 按合并后的空闲前缀逐个计算，对齐造成的碎片不计入，因此结果可能小于可用IP数除以块大小；
+// 与 AllocateCIDR 一致，只统计 IPv4 地址，并跳过只允许分配单个IP的 CIDR
+func (g *CIDRGuardian) CountAllocatableCIDRs(ctx context.Context, bits int) (int, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if bits < 0 || bits > 32 {
+		return 0, fmt.Errorf("无效的子网掩码位数: %d", bits)
+	}
+
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return 0, g.wrapErr(ctx, "CountAllocatableCIDRs", err)
+	}
+
+	count := 0
+	for _, prefix := range coalesceAddrs(g.excludePolicy(availableIPs, PolicySingleIPOnly)) {
+		if !prefix.Addr().Is4() || prefix.Bits() > bits {
+			continue
+		}
+		count += 1 << (bits - prefix.Bits())
+	}
+	return count, nil
+}
+
+// FreeBlockHistogram 统计可用池的碎片情况：键为前缀长度，值为合并后该大小的最大空闲块数量
+// 空闲IP先合并为最大的对齐前缀，每个前缀只计入其自身的长度；IPv4 与 IPv6 的块按前缀长度一起计数，
+// 可用池为空时返回空映射
+func (g *CIDRGuardian) FreeBlockHistogram(ctx context.Context) (map[int]int, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "FreeBlockHistogram", err)
+	}
+
+	histogram := make(map[int]int)
+	for _, prefix := range coalesceAddrs(availableIPs) {
+		histogram[prefix.Bits()]++
+	}
+	return histogram, nil
+}
+
+// TotalCapacity 返回所有管理 CIDR 包含的地址总数，即理论上限，重叠部分只计一次
+// 与 AvailableCount 加 AllocatedCount 不同，它不受排除、预留或存储中实际条目的影响
+func (g *CIDRGuardian) TotalCapacity(ctx context.Context) (*big.Int, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	managed := g.managedCIDRs.load()
+	cidrs := make([]string, 0, len(managed))
+	for cidr := range managed {
+		cidrs = append(cidrs, cidr)
+	}
+	merged, err := MergeCIDRs(cidrs)
+	if err != nil {
+		return nil, err
+	}
+
+	total := new(big.Int)
+	for _, cidr := range merged {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+		}
+		total.Add(total, cidrSize(ipNet))
+	}
+	return total, nil
+}
@@ -0,0 +1,199 @@
+package CIDRGuardian
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// parseSortedAddrs 将 IP 字符串解析为按数值排序的地址列表，忽略无法解析的条目
+func parseSortedAddrs(ips []string) []netip.Addr {
+	addrs := make([]netip.Addr, 0, len(ips))
+	for _, ipStr := range ips {
+		addr, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addr.Unmap())
+	}
+
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Less(addrs[j])
+	})
+	return addrs
+}
+
+// lastAddr 返回前缀中的最后一个地址
+func lastAddr(p netip.Prefix) netip.Addr {
+	p = p.Masked()
+	if p.Addr().Is4() {
+		b := p.Addr().As4()
+		for i := p.Bits(); i < 32; i++ {
+			b[i/8] |= 1 << (7 - uint(i%8))
+		}
+		return netip.AddrFrom4(b)
+	}
+
+	b := p.Addr().As16()
+	for i := p.Bits(); i < 128; i++ {
+		b[i/8] |= 1 << (7 - uint(i%8))
+	}
+	return netip.AddrFrom16(b)
+}
+
+// rangeToPrefixes 将闭区间 [start, end] 拆分为最少数量的对齐前缀
+func rangeToPrefixes(start, end netip.Addr) []netip.Prefix {
+	var result []netip.Prefix
+	for start.IsValid() && !end.Less(start) {
+		// 从最大的块开始尝试，找到以 start 为起点且不超过 end 的最大对齐块
+		chosen := netip.PrefixFrom(start, start.BitLen())
+		for bits := 0; bits <= start.BitLen(); bits++ {
+			p := netip.PrefixFrom(start, bits)
+			if p.Masked().Addr() != start {
+				continue
+			}
+			if lastAddr(p).Compare(end) <= 0 {
+				chosen = p
+				break
+			}
+		}
+
+		result = append(result, chosen)
+		last := lastAddr(chosen)
+		if last == end {
+			break
+		}
+		start = last.Next()
+	}
+	return result
+}
+
+// coalesceAddrs 将 IP 集合合并为最大的对齐前缀，按地址排序返回
+func coalesceAddrs(ips []string) []netip.Prefix {
+	addrs := parseSortedAddrs(ips)
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	var result []netip.Prefix
+	runStart, runEnd := addrs[0], addrs[0]
+	for _, addr := range addrs[1:] {
+		if addr == runEnd {
+			continue // 跳过重复地址
+		}
+		if runEnd.Next() == addr {
+			runEnd = addr
+			continue
+		}
+		result = append(result, rangeToPrefixes(runStart, runEnd)...)
+		runStart, runEnd = addr, addr
+	}
+	result = append(result, rangeToPrefixes(runStart, runEnd)...)
+
+	return result
+}
+
+// MergeCIDRs 将一组 CIDR 合并为覆盖相同地址的最少数量的对齐 CIDR，按网络地址数值顺序返回
+// 相邻或重叠的 CIDR 只有在能组成对齐的超网时才合并，例如 10.0.0.0/30 和 10.0.0.4/30 合并为 10.0.0.0/29
+func MergeCIDRs(cidrs []string) ([]string, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("无效的CIDR %s: %v", cidr, err)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	if len(prefixes) == 0 {
+		return []string{}, nil
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool {
+		return prefixes[i].Addr().Less(prefixes[j].Addr())
+	})
+
+	// 按地址顺序合并相接或重叠的区间，再将每个区间拆分为对齐前缀
+	var merged []netip.Prefix
+	runStart, runEnd := prefixes[0].Addr(), lastAddr(prefixes[0])
+	for _, p := range prefixes[1:] {
+		next := runEnd.Next()
+		if p.Addr().BitLen() == runStart.BitLen() && (!next.IsValid() || p.Addr().Compare(next) <= 0) {
+			if last := lastAddr(p); runEnd.Less(last) {
+				runEnd = last
+			}
+			continue
+		}
+		merged = append(merged, rangeToPrefixes(runStart, runEnd)...)
+		runStart, runEnd = p.Addr(), lastAddr(p)
+	}
+	merged = append(merged, rangeToPrefixes(runStart, runEnd)...)
+
+	result := make([]string, len(merged))
+	for i, p := range merged {
+		result[i] = p.String()
+	}
+	return result, nil
+}
+
+// sortIPStrings 按数值顺序排序 IP 字符串，无法解析的条目按字典序排在最后
+func sortIPStrings(ips []string) {
+	type entry struct {
+		s    string
+		addr netip.Addr
+		ok   bool
+	}
+
+	// 只解析一次，避免在比较函数中重复解析
+	entries := make([]entry, len(ips))
+	for i, ipStr := range ips {
+		addr, err := netip.ParseAddr(ipStr)
+		entries[i] = entry{s: ipStr, addr: addr.Unmap(), ok: err == nil}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case !a.ok && !b.ok:
+			return a.s < b.s
+		case !a.ok:
+			return false
+		case !b.ok:
+			return true
+		}
+		return a.addr.Less(b.addr)
+	})
+
+	for i, e := range entries {
+		ips[i] = e.s
+	}
+}
+
+// sortCIDRStrings 按网络地址数值顺序排序 CIDR 字符串，地址相同时前缀短的在前
+func sortCIDRStrings(cidrs []string) {
+	sort.SliceStable(cidrs, func(i, j int) bool {
+		a, errA := netip.ParsePrefix(cidrs[i])
+		b, errB := netip.ParsePrefix(cidrs[j])
+		switch {
+		case errA != nil && errB != nil:
+			return cidrs[i] < cidrs[j]
+		case errA != nil:
+			return false
+		case errB != nil:
+			return true
+		}
+		if cmp := a.Addr().Unmap().Compare(b.Addr().Unmap()); cmp != 0 {
+			return cmp < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+}
+
+// sortedCIDRKeys 返回按数值顺序排序的 CIDR 映射键
+func sortedCIDRKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sortCIDRStrings(keys)
+	return keys
+}
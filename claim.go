@@ -0,0 +1,194 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultClaimTTL 是 ClaimIP 的认领在未确认时的默认有效期
+const defaultClaimTTL = time.Minute
+
+// ErrClaimExpired 表示认领已过期，不能再确认
+var ErrClaimExpired = errors.New("认领已过期")
+
+// claimer 返回存储后端的认领接口
+func (g *CIDRGuardian) claimer() (IPClaimStorage, error) {
+	claimer, ok := storageAs[IPClaimStorage](g.storage)
+	if !ok {
+		return nil, fmt.Errorf("存储后端不支持认领")
+	}
+	return claimer, nil
+}
+
+// newClaimToken 生成一个随机的认领令牌
+func newClaimToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成认领令牌失败: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ClaimIP 两阶段分配的第一步：像 GetNextAvailableIP 一样分配下一个可用IP，并记录一个待确认的认领
+// 认领在 WithClaimTTL 设置的时长（默认 1 分钟）后到期，需要在此之前通过 ConfirmClaim 确认或 CancelClaim 取消；
+// 到期未确认的认领由 ReapExpiredClaims 释放，避免调用方在分配和使用之间崩溃时泄漏IP
+func (g *CIDRGuardian) ClaimIP(ctx context.Context, description string) (ip, token string, err error) {
+	if g.readOnly {
+		return "", "", ErrReadOnly
+	}
+
+	claimer, err := g.claimer()
+	if err != nil {
+		return "", "", err
+	}
+	if token, err = newClaimToken(); err != nil {
+		return "", "", err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return "", "", err
+	}
+
+	ip, err = g.nextAvailableIP(ctx, "ClaimIP", description, false)
+	if err != nil {
+		return "", "", err
+	}
+
+	// 记录认领失败时回滚分配
+	ttl := g.claimTTL
+	if ttl <= 0 {
+		ttl = defaultClaimTTL
+	}
+	if err := claimer.SetClaim(ctx, ip, token, g.clock.Now().Add(ttl)); err != nil {
+		_ = g.storage.DeallocateIP(ctx, ip)
+		return "", "", g.wrapErr(ctx, "ClaimIP", err)
+	}
+	return ip, token, nil
+}
+
+// ConfirmClaim 两阶段分配的第二步：确认认领，IP 保持分配且不再到期
+// 认领不存在（已确认、已取消或已被回收）时返回错误，已过期时错误包装 ErrClaimExpired
+func (g *CIDRGuardian) ConfirmClaim(ctx context.Context, token string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	claimer, err := g.claimer()
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	claim, ok, err := claimer.GetClaim(ctx, token)
+	if err != nil {
+		return g.wrapErr(ctx, "ConfirmClaim", err)
+	}
+	if !ok {
+		return fmt.Errorf("认领 %s 不存在", token)
+	}
+	if !g.clock.Now().Before(claim.ExpiresAt) {
+		return fmt.Errorf("IP %s 的%w（到期时间 %s）", claim.IP, ErrClaimExpired, claim.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return g.wrapErr(ctx, "ConfirmClaim", claimer.ClearClaim(ctx, token))
+}
+
+// CancelClaim 取消一个尚未确认的认领并释放其IP，认领不存在时返回错误
+func (g *CIDRGuardian) CancelClaim(ctx context.Context, token string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	claimer, err := g.claimer()
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	claim, ok, err := claimer.GetClaim(ctx, token)
+	if err != nil {
+		return g.wrapErr(ctx, "CancelClaim", err)
+	}
+	if !ok {
+		return fmt.Errorf("认领 %s 不存在", token)
+	}
+
+	// 释放IP时存储一并删除认领
+	return g.releaseIP(ctx, "CancelClaim", claim.IP)
+}
+
+// ReapExpiredClaims 释放所有到期未确认的认领的IP，返回按数值排序的被释放的IP
+// 任一释放失败时停止并返回已释放的IP和错误
+func (g *CIDRGuardian) ReapExpiredClaims(ctx context.Context) ([]string, error) {
+	if g.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	claimer, err := g.claimer()
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	expired, err := claimer.GetExpiredClaims(ctx, g.clock.Now())
+	if err != nil {
+		return nil, g.wrapErr(ctx, "ReapExpiredClaims", err)
+	}
+
+	released := []string{}
+	for _, claim := range expired {
+		if err := g.releaseIP(ctx, "ReapExpiredClaims", claim.IP); err != nil {
+			sortIPStrings(released)
+			return released, err
+		}
+		released = append(released, claim.IP)
+	}
+	sortIPStrings(released)
+	return released, nil
+}
+
+// RunClaimReaper 每隔 interval 调用一次 ReapExpiredClaims，直到上下文被取消，返回上下文的错误
+// 单次回收失败不会停止循环，配置了日志记录器时记录错误；通常在单独的 goroutine 中运行
+func (g *CIDRGuardian) RunClaimReaper(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("无效的回收间隔: %v", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := g.ReapExpiredClaims(ctx); err != nil && ctx.Err() == nil && g.logger != nil {
+				g.logger.ErrorContext(ctx, "回收到期认领失败", "error", err)
+			}
+		}
+	}
+}
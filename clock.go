@@ -0,0 +1,52 @@
+package CIDRGuardian
+
+import (
+	"sync"
+	"time"
+)
+
+// clock 提供当前时间，租约、认领、近期释放等与时间相关的功能都从这里读取，便于在测试中控制时间
+type clock interface {
+	Now() time.Time
+}
+
+// realClock 使用系统时间，是默认的时钟
+type realClock struct{}
+
+// Now 返回当前的系统时间
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock 是只在手动推进时才走动的时钟，通过 WithClock 注入后可以确定性地测试租约和认领到期；
+// CIDRGuardian 使用的 MemoryIPStorage 会自动以同一个时钟记录分配时间；其他场景下 Now 方法也可以传给 WithMemoryClock。可以并发使用
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock 创建一个停在 start 的时钟
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now 返回时钟的当前时间
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance 将时钟向前推进 d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set 将时钟设置为 t
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
@@ -0,0 +1,185 @@
+package CIDRGuardian
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// orphanPolicyNames 是配置文件中 orphan_policy 可用的名称
+var orphanPolicyNames = map[string]OrphanPolicy{
+	"drop":  OrphanDrop,
+	"error": OrphanError,
+}
+
+// fileConfig 是配置文件的结构，未知字段会被拒绝
+type fileConfig struct {
+	SQL      *sqlFileConfig     `json:"sql"`
+	Guardian guardianFileConfig `json:"guardian"`
+}
+
+// sqlFileConfig 对应 SQLConfig，时长使用 time.ParseDuration 的格式（如 "5m"）
+type sqlFileConfig struct {
+	Driver            string `json:"driver"`
+	DSN               string `json:"dsn"`
+	MaxOpenConns      int    `json:"max_open_conns"`
+	MaxIdleConns      int    `json:"max_idle_conns"`
+	ConnMaxLifetime   string `json:"conn_max_lifetime"`
+	ConnMaxIdleTime   string `json:"conn_max_idle_time"`
+	HistoryLimit      int    `json:"history_limit"`
+	SkipTableCreation bool   `json:"skip_table_creation"`
+	StrictAdd         bool   `json:"strict_add"`
+}
+
+// guardianFileConfig 对应 CIDRGuardian 的可选配置项
+type guardianFileConfig struct {
+	InitialCIDRs         []string `json:"initial_cidrs"`
+	SpareCIDRs           []string `json:"spare_cidrs"`
+	OrphanPolicy         string   `json:"orphan_policy"`
+	SoftDelete           bool     `json:"soft_delete"`
+	StrictCIDR           bool     `json:"strict_cidr"`
+	ReadOnly             bool     `json:"read_only"`
+	DescriptionTemplate  bool     `json:"description_template"`
+	RejectControlChars   bool     `json:"reject_control_chars"`
+	StorageSelfTest      bool     `json:"storage_self_test"`
+	CaseInsensitiveDesc  bool     `json:"case_insensitive_descriptions"`
+	AllowOverlay         bool     `json:"allow_overlay_allocated"`
+	MaxConcurrency       *int     `json:"max_concurrency"`
+	MaxDescriptionLength int      `json:"max_description_length"`
+	AllocateRetries      *int     `json:"allocate_retries"`
+	Source               string   `json:"source"`
+}
+
+// LoadConfig 从 JSON 读取 SQL 存储配置和 CIDRGuardian 的可选配置项
+// 配置分为 "sql" 和 "guardian" 两部分，缺少 "sql" 时返回零值 SQLConfig；
+// 未知字段、无效的时长、CIDR 或 orphan_policy 名称（支持 drop、error）都会返回错误
+func LoadConfig(r io.Reader) (SQLConfig, []Option, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var fc fileConfig
+	if err := decoder.Decode(&fc); err != nil {
+		return SQLConfig{}, nil, fmt.Errorf("解析配置失败: %v", err)
+	}
+
+	var sqlConfig SQLConfig
+	if fc.SQL != nil {
+		var err error
+		if sqlConfig, err = fc.SQL.toSQLConfig(); err != nil {
+			return SQLConfig{}, nil, err
+		}
+	}
+
+	opts, err := fc.Guardian.toOptions()
+	if err != nil {
+		return SQLConfig{}, nil, err
+	}
+	return sqlConfig, opts, nil
+}
+
+// toSQLConfig 将配置文件中的 SQL 部分转换为 SQLConfig
+func (c *sqlFileConfig) toSQLConfig() (SQLConfig, error) {
+	config := SQLConfig{
+		DriverName:        c.Driver,
+		DataSourceName:    c.DSN,
+		MaxOpenConns:      c.MaxOpenConns,
+		MaxIdleConns:      c.MaxIdleConns,
+		HistoryLimit:      c.HistoryLimit,
+		SkipTableCreation: c.SkipTableCreation,
+		StrictAdd:         c.StrictAdd,
+	}
+
+	if c.Driver != "mysql" && c.Driver != "postgres" {
+		return SQLConfig{}, fmt.Errorf("不支持的数据库驱动: %s (支持: mysql, postgres)", c.Driver)
+	}
+
+	var err error
+	if config.ConnMaxLifetime, err = parseConfigDuration("conn_max_lifetime", c.ConnMaxLifetime); err != nil {
+		return SQLConfig{}, err
+	}
+	if config.ConnMaxIdleTime, err = parseConfigDuration("conn_max_idle_time", c.ConnMaxIdleTime); err != nil {
+		return SQLConfig{}, err
+	}
+	return config, nil
+}
+
+// parseConfigDuration 解析配置中的时长，空字符串表示 0
+func parseConfigDuration(field, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的 %s: %v", field, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("无效的 %s: 不能为负数", field)
+	}
+	return d, nil
+}
+
+// toOptions 将配置文件中的 guardian 部分转换为 Option 列表
+func (c *guardianFileConfig) toOptions() ([]Option, error) {
+	var opts []Option
+
+	for _, cidrs := range [][]string{c.InitialCIDRs, c.SpareCIDRs} {
+		for _, cidr := range cidrs {
+			if _, _, _, err := ParseAndValidateCIDR(cidr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(c.InitialCIDRs) > 0 {
+		opts = append(opts, WithInitialCIDRs(c.InitialCIDRs...))
+	}
+	if len(c.SpareCIDRs) > 0 {
+		opts = append(opts, WithAutoExpand(c.SpareCIDRs))
+	}
+
+	if c.OrphanPolicy != "" {
+		policy, ok := orphanPolicyNames[c.OrphanPolicy]
+		if !ok {
+			return nil, fmt.Errorf("未知的 orphan_policy: %s (支持: drop, error)", c.OrphanPolicy)
+		}
+		opts = append(opts, WithOrphanPolicy(policy))
+	}
+
+	if c.SoftDelete {
+		opts = append(opts, WithSoftDelete())
+	}
+	if c.StrictCIDR {
+		opts = append(opts, WithStrictCIDR())
+	}
+	if c.ReadOnly {
+		opts = append(opts, WithReadOnly())
+	}
+	if c.DescriptionTemplate {
+		opts = append(opts, WithDescriptionTemplate())
+	}
+	if c.RejectControlChars {
+		opts = append(opts, WithRejectControlChars())
+	}
+	if c.StorageSelfTest {
+		opts = append(opts, WithStorageSelfTest())
+	}
+	if c.CaseInsensitiveDesc {
+		opts = append(opts, WithCaseInsensitiveDescriptions())
+	}
+	if c.AllowOverlay {
+		opts = append(opts, WithAllowOverlayAllocated())
+	}
+	if c.MaxConcurrency != nil {
+		opts = append(opts, WithMaxConcurrency(*c.MaxConcurrency))
+	}
+	if c.MaxDescriptionLength > 0 {
+		opts = append(opts, WithMaxDescriptionLength(c.MaxDescriptionLength))
+	}
+	if c.AllocateRetries != nil {
+		opts = append(opts, WithAllocateRetries(*c.AllocateRetries))
+	}
+	if c.Source != "" {
+		opts = append(opts, WithSource(c.Source))
+	}
+	return opts, nil
+}
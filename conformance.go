@@ -0,0 +1,280 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// TestingT 是 RunStorageConformance 使用的 *testing.T 方法子集
+// 通过接口传入，使本包的非测试代码不依赖 testing 包
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+	Fatalf(format string, args ...any)
+}
+
+// conformanceIPs 是一致性测试使用的地址（RFC 5737 文档保留地址）
+var conformanceIPs = []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+
+// RunStorageConformance 对自定义的 IPStorage 实现运行一致性测试，覆盖添加、移除、分配、释放、
+// 批量操作、计数以及上下文取消时的行为；每个用例都调用 newStorage 获取一个新的空存储
+// 在测试中调用：CIDRGuardian.RunStorageConformance(t, func() CIDRGuardian.IPStorage { return NewMyStorage() })
+func RunStorageConformance(t TestingT, newStorage func() IPStorage) {
+	t.Helper()
+
+	cases := []struct {
+		name string
+		run  func(c *conformanceCase)
+	}{
+		{"AddRemove", conformanceAddRemove},
+		{"AllocateDeallocate", conformanceAllocateDeallocate},
+		{"UpdateDescription", conformanceUpdateDescription},
+		{"ImportAllocations", conformanceImportAllocations},
+		{"BulkAllocateIP", conformanceBulkAllocate},
+		{"BulkAddIP", conformanceBulkAdd},
+		{"ContextCancel", conformanceContextCancel},
+	}
+	for _, tc := range cases {
+		tc.run(&conformanceCase{t: t, name: tc.name, ctx: context.Background(), s: newStorage()})
+	}
+}
+
+// conformanceCase 是一个一致性测试用例的运行环境，错误信息带有用例名
+type conformanceCase struct {
+	t    TestingT
+	name string
+	ctx  context.Context
+	s    IPStorage
+}
+
+func (c *conformanceCase) errorf(format string, args ...any) {
+	c.t.Helper()
+	c.t.Errorf("%s: %s", c.name, fmt.Sprintf(format, args...))
+}
+
+// must 在 err 不为 nil 时终止测试
+func (c *conformanceCase) must(op string, err error) {
+	c.t.Helper()
+	if err != nil {
+		c.t.Fatalf("%s: %s 失败: %v", c.name, op, err)
+	}
+}
+
+// expectState 检查 IP 的可用和已分配状态，已分配时同时检查描述
+func (c *conformanceCase) expectState(ip string, available, allocated bool, desc string) {
+	c.t.Helper()
+	got, err := c.s.IsIPAvailable(c.ctx, ip)
+	c.must("IsIPAvailable", err)
+	if got != available {
+		c.errorf("IP %s 可用状态应为 %v，实际为 %v", ip, available, got)
+	}
+	all, err := c.s.GetAllocatedIPs(c.ctx)
+	c.must("GetAllocatedIPs", err)
+	gotDesc, gotAllocated := all[ip]
+	if gotAllocated != allocated {
+		c.errorf("IP %s 已分配状态应为 %v，实际为 %v", ip, allocated, gotAllocated)
+	}
+	if allocated && gotAllocated && gotDesc != desc {
+		c.errorf("IP %s 的描述应为 %q，实际为 %q", ip, desc, gotDesc)
+	}
+}
+
+// expectCounts 检查可用和已分配数量
+func (c *conformanceCase) expectCounts(available, allocated int) {
+	c.t.Helper()
+	gotAvailable, err := c.s.AvailableCount(c.ctx)
+	c.must("AvailableCount", err)
+	gotAllocated, err := c.s.AllocatedCount(c.ctx)
+	c.must("AllocatedCount", err)
+	if gotAvailable != available || gotAllocated != allocated {
+		c.errorf("可用/已分配数量应为 %d/%d，实际为 %d/%d", available, allocated, gotAvailable, gotAllocated)
+	}
+}
+
+// expectUnavailable 检查错误包装了 ErrIPUnavailable
+func (c *conformanceCase) expectUnavailable(op string, err error) {
+	c.t.Helper()
+	if !errors.Is(err, ErrIPUnavailable) {
+		c.errorf("%s 应返回包装了 ErrIPUnavailable 的错误，实际为 %v", op, err)
+	}
+}
+
+func conformanceAddRemove(c *conformanceCase) {
+	a, b := conformanceIPs[0], conformanceIPs[1]
+	c.must("AddIP", c.s.AddIP(c.ctx, a))
+	c.must("AddIP", c.s.AddIP(c.ctx, b))
+	c.expectState(a, true, false, "")
+	c.expectCounts(2, 0)
+
+	ips, err := c.s.GetAvailableIPs(c.ctx)
+	c.must("GetAvailableIPs", err)
+	sortIPStrings(ips)
+	if !reflect.DeepEqual(ips, []string{a, b}) {
+		c.errorf("GetAvailableIPs 应返回 %v，实际为 %v", []string{a, b}, ips)
+	}
+
+	// 默认重复添加是幂等的
+	c.must("重复 AddIP", c.s.AddIP(c.ctx, a))
+	c.expectCounts(2, 0)
+
+	c.must("RemoveIP", c.s.RemoveIP(c.ctx, a))
+	c.expectState(a, false, false, "")
+	c.expectCounts(1, 0)
+	c.expectUnavailable("重复 RemoveIP", c.s.RemoveIP(c.ctx, a))
+}
+
+func conformanceAllocateDeallocate(c *conformanceCase) {
+	a, b := conformanceIPs[0], conformanceIPs[1]
+	c.must("AddIP", c.s.AddIP(c.ctx, a))
+
+	c.must("AllocateIP", c.s.AllocateIP(c.ctx, a, "web"))
+	c.expectState(a, false, true, "web")
+	c.expectCounts(0, 1)
+	c.expectUnavailable("重复 AllocateIP", c.s.AllocateIP(c.ctx, a, "web"))
+	c.expectUnavailable("AllocateIP 未添加的 IP", c.s.AllocateIP(c.ctx, b, "web"))
+	if err := c.s.AddIP(c.ctx, a); err == nil {
+		c.errorf("AddIP 已分配的 IP 应返回错误")
+	}
+	c.expectState(a, false, true, "web")
+
+	c.must("DeallocateIP", c.s.DeallocateIP(c.ctx, a))
+	c.expectState(a, true, false, "")
+	c.expectCounts(1, 0)
+	if err := c.s.DeallocateIP(c.ctx, a); err == nil {
+		c.errorf("DeallocateIP 未分配的 IP 应返回错误")
+	}
+}
+
+func conformanceUpdateDescription(c *conformanceCase) {
+	a, b := conformanceIPs[0], conformanceIPs[1]
+	c.must("AddIP", c.s.AddIP(c.ctx, a))
+	c.must("AllocateIP", c.s.AllocateIP(c.ctx, a, "old"))
+
+	c.must("UpdateDescription", c.s.UpdateDescription(c.ctx, a, "new"))
+	c.expectState(a, false, true, "new")
+	if err := c.s.UpdateDescription(c.ctx, b, "new"); err == nil {
+		c.errorf("UpdateDescription 未分配的 IP 应返回错误")
+	}
+}
+
+func conformanceImportAllocations(c *conformanceCase) {
+	a, b, x := conformanceIPs[0], conformanceIPs[1], conformanceIPs[2]
+	c.must("ImportAllocations", c.s.ImportAllocations(c.ctx, map[string]string{a: "a", b: "b"}))
+	c.expectState(a, false, true, "a")
+	c.expectState(b, false, true, "b")
+	c.expectCounts(0, 2)
+
+	// 任一 IP 已分配时整体失败
+	if err := c.s.ImportAllocations(c.ctx, map[string]string{a: "again", x: "x"}); err == nil {
+		c.errorf("ImportAllocations 已分配的 IP 应返回错误")
+	}
+	c.expectState(a, false, true, "a")
+	c.expectState(x, false, false, "")
+}
+
+func conformanceBulkAllocate(c *conformanceCase) {
+	a, b, x := conformanceIPs[0], conformanceIPs[1], conformanceIPs[2]
+	c.must("AddIP", c.s.AddIP(c.ctx, a))
+	c.must("AddIP", c.s.AddIP(c.ctx, b))
+
+	// 任一 IP 不可用时整体失败
+	_, err := c.s.BulkAllocateIP(c.ctx, map[string]string{a: "a", x: "x"}, false)
+	c.expectUnavailable("BulkAllocateIP 包含不可用的 IP", err)
+	c.expectState(a, true, false, "")
+	c.expectCounts(2, 0)
+
+	// 跳过不可用的 IP
+	allocated, err := c.s.BulkAllocateIP(c.ctx, map[string]string{a: "a", x: "x"}, true)
+	c.must("BulkAllocateIP", err)
+	if !reflect.DeepEqual(allocated, []string{a}) {
+		c.errorf("BulkAllocateIP 应返回 %v，实际为 %v", []string{a}, allocated)
+	}
+	c.expectState(a, false, true, "a")
+
+	allocated, err = c.s.BulkAllocateIP(c.ctx, map[string]string{b: "b"}, false)
+	c.must("BulkAllocateIP", err)
+	if !reflect.DeepEqual(allocated, []string{b}) {
+		c.errorf("BulkAllocateIP 应返回 %v，实际为 %v", []string{b}, allocated)
+	}
+	c.expectCounts(0, 2)
+}
+
+func conformanceBulkAdd(c *conformanceCase) {
+	a, b, x := conformanceIPs[0], conformanceIPs[1], conformanceIPs[2]
+	c.must("AddIP", c.s.AddIP(c.ctx, a))
+	c.must("AddIP", c.s.AddIP(c.ctx, x))
+	c.must("AllocateIP", c.s.AllocateIP(c.ctx, x, "x"))
+
+	// 已可用的 IP 不计入新增，已分配的 IP 被跳过
+	added, err := c.s.BulkAddIP(c.ctx, []string{a, b, x})
+	c.must("BulkAddIP", err)
+	if !reflect.DeepEqual(added, []string{b}) {
+		c.errorf("BulkAddIP 应返回 %v，实际为 %v", []string{b}, added)
+	}
+	c.expectState(b, true, false, "")
+	c.expectState(x, false, true, "x")
+	c.expectCounts(2, 1)
+}
+
+func conformanceContextCancel(c *conformanceCase) {
+	a, b := conformanceIPs[0], conformanceIPs[1]
+	c.must("AddIP", c.s.AddIP(c.ctx, a))
+	c.must("AddIP", c.s.AddIP(c.ctx, b))
+	c.must("AllocateIP", c.s.AllocateIP(c.ctx, b, "b"))
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	cancel()
+
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"AddIP", func() error { return c.s.AddIP(ctx, conformanceIPs[2]) }},
+		{"RemoveIP", func() error { return c.s.RemoveIP(ctx, a) }},
+		{"AllocateIP", func() error { return c.s.AllocateIP(ctx, a, "a") }},
+		{"DeallocateIP", func() error { return c.s.DeallocateIP(ctx, b) }},
+		{"UpdateDescription", func() error { return c.s.UpdateDescription(ctx, b, "new") }},
+		{"ImportAllocations", func() error { return c.s.ImportAllocations(ctx, map[string]string{conformanceIPs[2]: "x"}) }},
+		{"IsIPAvailable", func() error {
+			_, err := c.s.IsIPAvailable(ctx, a)
+			return err
+		}},
+		{"GetAvailableIPs", func() error {
+			_, err := c.s.GetAvailableIPs(ctx)
+			return err
+		}},
+		{"GetAllocatedIPs", func() error {
+			_, err := c.s.GetAllocatedIPs(ctx)
+			return err
+		}},
+		{"AvailableCount", func() error {
+			_, err := c.s.AvailableCount(ctx)
+			return err
+		}},
+		{"AllocatedCount", func() error {
+			_, err := c.s.AllocatedCount(ctx)
+			return err
+		}},
+		{"BulkAllocateIP", func() error {
+			_, err := c.s.BulkAllocateIP(ctx, map[string]string{a: "a"}, false)
+			return err
+		}},
+		{"BulkAddIP", func() error {
+			_, err := c.s.BulkAddIP(ctx, []string{conformanceIPs[2]})
+			return err
+		}},
+	}
+	for _, tc := range calls {
+		if err := tc.call(); !errors.Is(err, context.Canceled) {
+			c.errorf("%s 在上下文取消后应返回 context.Canceled，实际为 %v", tc.name, err)
+		}
+	}
+
+	// 取消的调用不应修改状态
+	c.expectState(a, true, false, "")
+	c.expectState(b, false, true, "b")
+	c.expectState(conformanceIPs[2], false, false, "")
+	c.expectCounts(1, 1)
+}
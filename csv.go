@@ -0,0 +1,145 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// csvHeader 是 ExportAllocationsCSV 写出的表头
+var csvHeader = []string{"ip", "description", "allocated_at"}
+
+// ExportAllocationsCSV 将所有分配按 IP 数值顺序写为 CSV，列为 ip、description、allocated_at，首行为表头
+// allocated_at 为 RFC 3339 格式的 UTC 时间，存储未实现 AllocationTimestampStorage 或没有记录时为空；
+// 块的网络地址以 "cidr - 描述" 格式的描述导出，ImportAllocationsCSV 导入后仍被识别为块
+func (g *CIDRGuardian) ExportAllocationsCSV(ctx context.Context, w io.Writer) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	blocks, err := g.blockIndex(ctx, "ExportAllocationsCSV")
+	if err != nil {
+		return err
+	}
+	times := map[string]time.Time{}
+	if timer, ok := storageAs[AllocationTimestampStorage](g.storage); ok {
+		if times, err = timer.GetAllocationTimes(ctx); err != nil {
+			return g.wrapErr(ctx, "ExportAllocationsCSV", err)
+		}
+	}
+
+	allocations := make(map[string]string)
+	err = g.forEachAllocated(ctx, "ExportAllocationsCSV", func(ip, desc string) error {
+		if cidr, blockDesc, ok := blocks.lookup(ip, desc); ok {
+			desc = packBlockDescription(cidr, blockDesc)
+		}
+		allocations[ip] = desc
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ips := make([]string, 0, len(allocations))
+	for ip := range allocations {
+		ips = append(ips, ip)
+	}
+	sortIPStrings(ips)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("写入 CSV 失败: %v", err)
+	}
+	for _, ip := range ips {
+		allocatedAt := ""
+		if at, ok := times[ip]; ok {
+			allocatedAt = at.UTC().Format(time.RFC3339)
+		}
+		if err := cw.Write([]string{g.formatIP(ip), allocations[ip], allocatedAt}); err != nil {
+			return fmt.Errorf("写入 CSV 失败: %v", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("写入 CSV 失败: %v", err)
+	}
+	return nil
+}
+
+// ImportAllocationsCSV 读取 ExportAllocationsCSV 格式的 CSV，通过 ImportAllocations 整体导入已分配池
+// 首行为表头（第一列为 "ip"）时跳过；allocated_at 列可以省略或为空，存储实现 AllocationTimestampStorage 时
+// 导入后恢复分配时间，否则忽略。任一行格式错误时返回带行号的错误且不导入任何记录
+func (g *CIDRGuardian) ImportAllocationsCSV(ctx context.Context, r io.Reader) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // 列数在下面逐行检查，以便给出更明确的错误
+
+	allocations := make(map[string]string)
+	times := make(map[string]time.Time)
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("解析 CSV 失败: %v", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), csvHeader[0]) {
+			continue
+		}
+		if len(record) < 2 || len(record) > len(csvHeader) {
+			return fmt.Errorf("CSV 第 %d 行: 应为 2 或 3 列，实际为 %d 列", line, len(record))
+		}
+
+		parsedIP := net.ParseIP(strings.TrimSpace(record[0]))
+		if parsedIP == nil {
+			return fmt.Errorf("CSV 第 %d 行: 无效的IP地址格式: %s", line, record[0])
+		}
+		ip := parsedIP.String()
+		if _, exists := allocations[ip]; exists {
+			return fmt.Errorf("CSV 第 %d 行: IP %s 重复", line, ip)
+		}
+		if err := g.validateDescription(record[1]); err != nil {
+			return fmt.Errorf("CSV 第 %d 行: IP %s: %w", line, ip, err)
+		}
+		if len(record) == 3 && strings.TrimSpace(record[2]) != "" {
+			at, err := time.Parse(time.RFC3339, strings.TrimSpace(record[2]))
+			if err != nil {
+				return fmt.Errorf("CSV 第 %d 行: 无效的分配时间 %s: %v", line, record[2], err)
+			}
+			times[ip] = at
+		}
+		allocations[ip] = record[1]
+	}
+
+	if err := g.ImportAllocations(ctx, allocations); err != nil {
+		return err
+	}
+
+	timer, ok := storageAs[AllocationTimestampStorage](g.storage)
+	if !ok {
+		return nil
+	}
+	for ip, at := range times {
+		if err := timer.SetAllocationTime(ctx, ip, at); err != nil {
+			return g.wrapErr(ctx, "ImportAllocationsCSV", err)
+		}
+	}
+	return nil
+}
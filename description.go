@@ -0,0 +1,34 @@
+package CIDRGuardian
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// ErrDescriptionTooLong 表示描述超过 WithMaxDescriptionLength 设置的长度
+	ErrDescriptionTooLong = errors.New("描述过长")
+	// ErrDescriptionInvalid 表示描述包含控制字符
+	ErrDescriptionInvalid = errors.New("描述包含控制字符")
+)
+
+// validateDescription 按配置校验分配描述，长度按字符（rune）计算
+func (g *CIDRGuardian) validateDescription(description string) error {
+	if g.maxDescLen > 0 {
+		if n := utf8.RuneCountInString(description); n > g.maxDescLen {
+			return fmt.Errorf("%w: %d 个字符，上限为 %d", ErrDescriptionTooLong, n, g.maxDescLen)
+		}
+	}
+
+	if g.rejectCtrl {
+		for _, r := range description {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("%w: %q", ErrDescriptionInvalid, r)
+			}
+		}
+	}
+
+	return nil
+}
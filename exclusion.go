@@ -0,0 +1,125 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// excluder 返回存储后端的排除列表接口
+func (g *CIDRGuardian) excluder() (IPExclusionStorage, error) {
+	excluder, ok := storageAs[IPExclusionStorage](g.storage)
+	if !ok {
+		return nil, fmt.Errorf("存储后端不支持 IP 排除列表")
+	}
+	return excluder, nil
+}
+
+// exclusions 返回排除列表，存储后端不支持时返回空集合
+func (g *CIDRGuardian) exclusions(ctx context.Context, op string) (map[string]bool, error) {
+	excluder, ok := storageAs[IPExclusionStorage](g.storage)
+	if !ok {
+		return nil, nil
+	}
+	ips, err := excluder.GetExclusions(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, op, err)
+	}
+	result := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		result[ip] = true
+	}
+	return result, nil
+}
+
+// AddExclusion 将IP加入全局排除列表，排除列表保存在存储后端中
+// 被排除的IP不会被 AddCIDR、ExpandPool、AddSingleIP 或释放操作加入可用池；
+// 已在可用池中的IP会被移出，已分配的IP保持分配，释放后不再放回可用池
+func (g *CIDRGuardian) AddExclusion(ctx context.Context, ip string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	excluder, err := g.excluder()
+	if err != nil {
+		return err
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return fmt.Errorf("无效的IP地址格式: %s", ip)
+	}
+	ipStr := parsedIP.String()
+
+	if err := excluder.AddExclusion(ctx, ipStr); err != nil {
+		return g.wrapErr(ctx, "AddExclusion", err)
+	}
+
+	// 先保存排除记录再移出可用池，移出失败时重新调用即可
+	if err := g.storage.RemoveIP(ctx, ipStr); err != nil && !errors.Is(err, ErrIPUnavailable) {
+		return g.wrapErr(ctx, "AddExclusion", err)
+	}
+	return nil
+}
+
+// RemoveExclusion 将IP移出全局排除列表
+// IP 属于管理的 CIDR 且未被分配或预留时重新加入可用池
+func (g *CIDRGuardian) RemoveExclusion(ctx context.Context, ip string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	excluder, err := g.excluder()
+	if err != nil {
+		return err
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return fmt.Errorf("无效的IP地址格式: %s", ip)
+	}
+	ipStr := parsedIP.String()
+
+	if err := excluder.RemoveExclusion(ctx, ipStr); err != nil {
+		return g.wrapErr(ctx, "RemoveExclusion", err)
+	}
+	if !g.isManagedIP(parsedIP) {
+		return nil
+	}
+
+	if reserver, ok := storageAs[IPReservationStorage](g.storage); ok {
+		reserved, err := reserver.GetReservedIPs(ctx)
+		if err != nil {
+			return g.wrapErr(ctx, "RemoveExclusion", err)
+		}
+		if _, exists := reserved[ipStr]; exists {
+			return nil
+		}
+	}
+
+	// 已分配的IP在释放时才回到可用池
+	if err := g.storage.AddIP(ctx, ipStr); err != nil {
+		if !errors.Is(err, ErrIPAlreadyAvailable) &&
+			!strings.Contains(err.Error(), "已被分配") && !strings.Contains(err.Error(), "already allocated") {
+			return g.wrapErr(ctx, "RemoveExclusion", err)
+		}
+	}
+	return nil
+}
+
+// GetExclusions 获取全局排除列表中的所有IP，按数值顺序排列
+func (g *CIDRGuardian) GetExclusions(ctx context.Context) ([]string, error) {
+	excluder, err := g.excluder()
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := excluder.GetExclusions(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "GetExclusions", err)
+	}
+	sortIPStrings(ips)
+	return ips, nil
+}
@@ -0,0 +1,158 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// hintSpreadBits 决定新提示首次分配时避开的父块大小：父块比请求块大 2^hintSpreadBits 倍
+const hintSpreadBits = 4
+
+// AllocateCIDRWithHint 按放置提示分配一个指定大小的 CIDR
+// 共享同一提示的分配会尽量紧挨着放置：已有记录时选择离该提示上一次分配的块最近的候选块；
+// 新提示的首次分配会优先选择不含其他提示块的父块，为后续分配留出连续空间。
+// hint 为空时与 AllocateCIDR 相同
+func (g *CIDRGuardian) AllocateCIDRWithHint(ctx context.Context, bits int, description, hint string) (string, error) {
+	if g.readOnly {
+		return "", ErrReadOnly
+	}
+
+	if hint == "" {
+		return g.AllocateCIDR(ctx, bits, description)
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return "", err
+	}
+
+	// 验证位数参数
+	if bits < 0 || bits > 32 {
+		return "", fmt.Errorf("无效的子网掩码位数: %d", bits)
+	}
+
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return "", g.wrapErr(ctx, "AllocateCIDRWithHint", err)
+	}
+	available := make(map[string]bool, len(availableIPs))
+	for _, ip := range availableIPs {
+		available[ip] = true
+	}
+	sortIPStrings(availableIPs)
+
+	// 收集所有成员都可用的对齐候选块
+	mask := net.CIDRMask(bits, 32)
+	candidates := []*net.IPNet{}
+	for _, ipStr := range availableIPs {
+		ip := net.ParseIP(ipStr).To4()
+		if ip == nil || !ip.Equal(ip.Mask(mask)) {
+			continue
+		}
+		ipNet := &net.IPNet{IP: ip, Mask: mask}
+		if blockAvailable(ipNet, available) && g.checkBlockPolicy(ipNet) == nil {
+			candidates = append(candidates, ipNet)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("没有足够的IP可以分配 /%d 子网", bits)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var chosen *net.IPNet
+	if last, ok := g.hints[hint]; ok {
+		chosen = nearestBlock(candidates, last)
+	} else {
+		chosen = g.freshParentBlock(candidates, bits, hint)
+	}
+
+	if err := g.allocateBlock(ctx, "AllocateCIDRWithHint", chosen, description); err != nil {
+		return "", err
+	}
+	g.hints[hint] = chosen
+
+	return chosen.String(), nil
+}
+
+// blockAvailable 检查块内的所有地址是否都在可用集合中
+func blockAvailable(ipNet *net.IPNet, available map[string]bool) bool {
+	for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+		if !available[ip.String()] {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestBlock 返回与 last 间隔最小的候选块，距离相同时优先选择位于 last 之后的块
+func nearestBlock(candidates []*net.IPNet, last *net.IPNet) *net.IPNet {
+	lastStart := ipv4ToUint(last.IP)
+	lastEnd := lastStart + blockSpan(last) - 1
+
+	var best *net.IPNet
+	var bestGap uint64
+	bestAfter := false
+	for _, c := range candidates {
+		start := ipv4ToUint(c.IP)
+		end := start + blockSpan(c) - 1
+
+		// 上一次的块已释放时候选块可能与其重叠，此时视为距离为 0
+		var gap uint64
+		after := start > lastEnd
+		switch {
+		case after:
+			gap = start - lastEnd
+		case end < lastStart:
+			gap = lastStart - end
+		}
+
+		if best == nil || gap < bestGap || (gap == bestGap && after && !bestAfter) {
+			best, bestGap, bestAfter = c, gap, after
+		}
+	}
+	return best
+}
+
+// freshParentBlock 为没有记录的提示选择候选块，优先选择父块中没有其他提示块的候选，
+// 都不满足时退回到数值最小的候选
+func (g *CIDRGuardian) freshParentBlock(candidates []*net.IPNet, bits int, hint string) *net.IPNet {
+	parentBits := bits - hintSpreadBits
+	if parentBits < 0 {
+		parentBits = 0
+	}
+	parentMask := net.CIDRMask(parentBits, 32)
+
+	for _, c := range candidates {
+		parent := &net.IPNet{IP: c.IP.Mask(parentMask), Mask: parentMask}
+		occupied := false
+		for other, block := range g.hints {
+			if other != hint && parent.Contains(block.IP) {
+				occupied = true
+				break
+			}
+		}
+		if !occupied {
+			return c
+		}
+	}
+	return candidates[0]
+}
+
+// ipv4ToUint 将 IPv4 地址转换为整数，便于计算块之间的距离
+func ipv4ToUint(ip net.IP) uint64 {
+	return uint64(binary.BigEndian.Uint32(ip.To4()))
+}
+
+// blockSpan 返回 IPv4 块包含的地址数量
+func blockSpan(ipNet *net.IPNet) uint64 {
+	ones, total := ipNet.Mask.Size()
+	return 1 << uint(total-ones)
+}
@@ -0,0 +1,97 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// defaultIdempotencyTTL 是 AllocateIdempotent 记录的键在未设置 WithIdempotencyTTL 时的默认保留时长
+const defaultIdempotencyTTL = 10 * time.Minute
+
+// idempotencyKeys 记录 AllocateIdempotent 的请求键及其分配结果
+// mu 在整个幂等分配期间持有，保证同一个键的并发请求只分配一次
+type idempotencyKeys struct {
+	mu      sync.Mutex
+	entries map[string]idempotentResult
+}
+
+// idempotentResult 是一个请求键的分配结果
+type idempotentResult struct {
+	ip          string    // 分配的IP
+	description string    // 分配时写入的描述（已展开模板）
+	expiresAt   time.Time // 记录到期的时间
+}
+
+// lookup 返回键未到期的分配结果，并清理所有已到期的记录，避免无限增长；调用方需持有 mu
+func (k *idempotencyKeys) lookup(key string, now time.Time) (idempotentResult, bool) {
+	for other, result := range k.entries {
+		if !now.Before(result.expiresAt) {
+			delete(k.entries, other)
+		}
+	}
+	result, ok := k.entries[key]
+	return result, ok
+}
+
+// store 记录键的分配结果；调用方需持有 mu
+func (k *idempotencyKeys) store(key string, result idempotentResult) {
+	if k.entries == nil {
+		k.entries = make(map[string]idempotentResult)
+	}
+	k.entries[key] = result
+}
+
+// AllocateIdempotent 像 GetNextAvailableIP 一样分配下一个可用IP，并记录请求键到IP的映射，
+// 在 WithIdempotencyTTL 设置的时长（默认 10 分钟）内以相同的键重试时返回同一个IP而不再分配新的IP。
+// 记录的IP已被释放，或已被释放后以其他描述重新分配时，视为记录失效并重新分配。映射只保存在当前 CIDRGuardian 的内存中
+func (g *CIDRGuardian) AllocateIdempotent(ctx context.Context, key, description string) (string, error) {
+	if g.readOnly {
+		return "", ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if key == "" {
+		return "", fmt.Errorf("幂等键不能为空")
+	}
+
+	g.idemKeys.mu.Lock()
+	defer g.idemKeys.mu.Unlock()
+
+	// 记录的IP仍以本次请求的描述分配时直接返回，否则删除失效的记录
+	if result, ok := g.idemKeys.lookup(key, g.clock.Now()); ok {
+		allocated, err := g.storage.GetAllocatedIPs(ctx)
+		if err != nil {
+			return "", g.wrapErr(ctx, "AllocateIdempotent", err)
+		}
+		if desc, ok := allocated[result.ip]; ok && desc == result.description {
+			return result.ip, nil
+		}
+		delete(g.idemKeys.entries, key)
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return "", err
+	}
+
+	ip, err := g.nextAvailableIP(ctx, "AllocateIdempotent", description, false)
+	if err != nil {
+		return "", err
+	}
+
+	ttl := g.idemTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	g.idemKeys.store(key, idempotentResult{
+		ip:          ip,
+		description: g.expandIPDescription(description, ip),
+		expiresAt:   g.clock.Now().Add(ttl),
+	})
+	return ip, nil
+}
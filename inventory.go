@@ -0,0 +1,152 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+)
+
+// InventorySource 是外部 IP 台账（如已有的资产管理服务）的适配接口，供 SyncFrom 读取期望状态
+type InventorySource interface {
+	// ListManagedCIDRs 返回应当管理的 CIDR 及其描述
+	ListManagedCIDRs(ctx context.Context) (map[string]string, error)
+
+	// ListAllocations 返回应当处于已分配状态的单个 IP 及其描述
+	ListAllocations(ctx context.Context) (map[string]string, error)
+}
+
+// SyncReport 记录一次 SyncFrom 所做的修改，各列表均按数值顺序排列
+type SyncReport struct {
+	AddedCIDRs   []string // 新加入管理池的 CIDR
+	RemovedCIDRs []string // 从管理池移除的 CIDR
+	UpdatedCIDRs []string // 更新了描述的 CIDR
+	Allocated    []string // 新分配的 IP
+	Released     []string // 释放的 IP
+	Updated      []string // 更新了描述的 IP
+}
+
+// SyncFrom 将管理池和单个 IP 的分配调整为与 src 一致，返回所做的修改
+// 依次添加缺少的 CIDR、同步 IP 分配、移除多余的 CIDR；通过 AllocateCIDR 等分配的 CIDR 块不做处理。
+// 任一步骤失败时立即返回错误和已完成的修改，已完成的修改不会回滚，修正问题后再次调用即可继续同步
+func (g *CIDRGuardian) SyncFrom(ctx context.Context, src InventorySource) (SyncReport, error) {
+	if g.readOnly {
+		return SyncReport{}, ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return SyncReport{}, err
+	}
+
+	wantCIDRs, err := src.ListManagedCIDRs(ctx)
+	if err != nil {
+		return SyncReport{}, fmt.Errorf("读取台账 CIDR 失败: %w", err)
+	}
+	wantAllocations, err := src.ListAllocations(ctx)
+	if err != nil {
+		return SyncReport{}, fmt.Errorf("读取台账分配失败: %w", err)
+	}
+
+	// 规范化台账中的 CIDR 和 IP，便于与当前状态比较
+	cidrs := make(map[string]string, len(wantCIDRs))
+	for cidr, desc := range wantCIDRs {
+		if _, _, _, err := ParseAndValidateCIDR(cidr); err != nil {
+			return SyncReport{}, err
+		}
+		cidrs[canonicalCIDR(cidr)] = desc
+	}
+	allocations := make(map[string]string, len(wantAllocations))
+	for ip, desc := range wantAllocations {
+		if _, err := ValidateIP(ip); err != nil {
+			return SyncReport{}, err
+		}
+		allocations[normalizeIP(ip)] = desc
+	}
+
+	report := SyncReport{}
+	managed, err := g.GetManagedCIDRs(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	// 1. 添加缺少的 CIDR，更新描述不同的 CIDR
+	for _, cidr := range sortedCIDRKeys(cidrs) {
+		desc := cidrs[cidr]
+		current, exists := managed[cidr]
+		switch {
+		case !exists:
+			if err := g.AddCIDR(ctx, cidr, desc); err != nil {
+				return report, err
+			}
+			report.AddedCIDRs = append(report.AddedCIDRs, cidr)
+		case current != desc:
+			if err := g.UpdateCIDRDescription(ctx, cidr, desc); err != nil {
+				return report, err
+			}
+			report.UpdatedCIDRs = append(report.UpdatedCIDRs, cidr)
+		}
+	}
+
+	// 2. 同步单个 IP 的分配，CIDR 块的网络地址不参与比较
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return report, g.wrapErr(ctx, "SyncFrom", err)
+	}
+	blocks, err := g.blockIndex(ctx, "SyncFrom")
+	if err != nil {
+		return report, err
+	}
+	current := make(map[string]string, len(allocated))
+	var stale []string
+	for ip, desc := range allocated {
+		if _, _, isBlock := blocks.lookup(ip, desc); isBlock {
+			continue
+		}
+		current[ip] = desc
+		if _, wanted := allocations[ip]; !wanted {
+			stale = append(stale, ip)
+		}
+	}
+
+	sortIPStrings(stale)
+	for _, ip := range stale {
+		if err := g.releaseIP(ctx, "SyncFrom", ip); err != nil {
+			return report, err
+		}
+		report.Released = append(report.Released, ip)
+	}
+
+	ips := make([]string, 0, len(allocations))
+	for ip := range allocations {
+		ips = append(ips, ip)
+	}
+	sortIPStrings(ips)
+	for _, ip := range ips {
+		desc := allocations[ip]
+		currentDesc, exists := current[ip]
+		switch {
+		case !exists:
+			if err := g.AllocateIP(ctx, ip, desc); err != nil {
+				return report, err
+			}
+			report.Allocated = append(report.Allocated, ip)
+		case currentDesc != desc:
+			if err := g.UpdateDescription(ctx, ip, desc); err != nil {
+				return report, err
+			}
+			report.Updated = append(report.Updated, ip)
+		}
+	}
+
+	// 3. 移除台账中没有的 CIDR，其中的IP已在上一步释放
+	for _, cidr := range sortedCIDRKeys(managed) {
+		if _, wanted := cidrs[cidr]; wanted {
+			continue
+		}
+		if err := g.RemoveCIDR(ctx, cidr); err != nil {
+			return report, err
+		}
+		report.RemovedCIDRs = append(report.RemovedCIDRs, cidr)
+	}
+
+	return report, nil
+}
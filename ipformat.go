@@ -0,0 +1,54 @@
+package CIDRGuardian
+
+import "strings"
+
+// IPFormat 控制列表和报告类方法输出IP的格式，可以按位组合；存储中始终保存规范形式
+type IPFormat int
+
+const (
+	// IPFormatCanonical 按存储中的规范形式输出（IPv6 为小写十六进制），这是默认格式
+	IPFormatCanonical IPFormat = 0
+	// IPFormatUpperIPv6 IPv6 地址使用大写十六进制
+	IPFormatUpperIPv6 IPFormat = 1
+	// IPFormatStripZone 去掉 IPv6 地址的区域标识（如 fe80::1%eth0 中的 %eth0）
+	// 内置存储和 CIDRGuardian 保存的地址都不带区域标识，此格式只是防护，用于返回带区域标识地址的自定义存储
+	IPFormatStripZone IPFormat = 2
+)
+
+// formatIP 按配置的输出格式渲染单个IP或 CIDR
+func (g *CIDRGuardian) formatIP(s string) string {
+	if g.ipFormat == IPFormatCanonical || !strings.Contains(s, ":") {
+		return s
+	}
+
+	// 拆分地址、区域标识和前缀长度
+	addr, suffix := s, ""
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		addr, suffix = addr[:i], addr[i:]
+	}
+	zone := ""
+	if i := strings.IndexByte(addr, '%'); i >= 0 {
+		addr, zone = addr[:i], addr[i:]
+	}
+
+	if g.ipFormat&IPFormatUpperIPv6 != 0 {
+		addr = strings.ToUpper(addr)
+	}
+	if g.ipFormat&IPFormatStripZone != 0 {
+		zone = ""
+	}
+	return addr + zone + suffix
+}
+
+// formatIPs 按配置的输出格式渲染一组IP或 CIDR，返回新的切片
+func (g *CIDRGuardian) formatIPs(ips []string) []string {
+	if g.ipFormat == IPFormatCanonical {
+		return ips
+	}
+
+	result := make([]string, len(ips))
+	for i, ip := range ips {
+		result[i] = g.formatIP(ip)
+	}
+	return result
+}
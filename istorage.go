@@ -1,6 +1,21 @@
 package CIDRGuardian
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrIPUnavailable 表示 IP 不在可用池中（已被分配、预留或移除）
+// 内置存储在 AllocateIP、RemoveIP 和 BulkAllocateIP 遇到这种情况时返回包装了它的错误，
+// 自定义存储也应如此，以便 AllocateCIDR 识别并发冲突并重试
+var ErrIPUnavailable = errors.New("不在可用池中")
+
+// ErrIPAlreadyAvailable 表示 IP 已在可用池中
+// 默认情况下重复添加可用 IP 是幂等的；启用严格添加（MemoryIPStorage 的 WithMemoryStrictAdd、
+// SQLConfig.StrictAdd）后 AddIP 返回包装了它的错误，便于调用方发现重复
+var ErrIPAlreadyAvailable = errors.New("已在可用池中")
 
 // IPStorage 是 IP 池存储的接口
 type IPStorage interface {
@@ -30,4 +45,198 @@ type IPStorage interface {
 
 	// AllocatedCount 获取已分配 IP 数量
 	AllocatedCount(ctx context.Context) (int, error)
+
+	// ImportAllocations 将 IP 及描述直接写入已分配池，任一 IP 已分配则整体失败
+	ImportAllocations(ctx context.Context, allocations map[string]string) error
+
+	// BulkAllocateIP 将一批可用 IP 移入已分配池，返回成功分配的 IP（按顺序排列）
+	// skipUnavailable 为 false 时任一 IP 不可用则整体失败，为 true 时跳过不可用的 IP
+	BulkAllocateIP(ctx context.Context, allocations map[string]string, skipUnavailable bool) ([]string, error)
+
+	// UpdateDescription 更新已分配 IP 的描述，IP 未分配时返回错误
+	UpdateDescription(ctx context.Context, ip string, description string) error
+
+	// BulkAddIP 将一批 IP 整体加入可用池，返回此前不在可用池中的 IP（按顺序排列）
+	// 已分配的 IP 会被跳过；任一 IP 添加失败时整体失败
+	BulkAddIP(ctx context.Context, ips []string) ([]string, error)
+}
+
+// CIDRArchive 记录一个被软删除的 CIDR，用于后续恢复
+type CIDRArchive struct {
+	CIDR         string            // CIDR 字符串表示
+	Description  string            // CIDR 描述
+	AvailableIPs []string          // 移除时处于可用池中的 IP
+	AllocatedIPs map[string]string // 移除时已分配的 IP 及描述
+}
+
+// CIDRArchiveStorage 是支持归档被移除 CIDR 的可选存储接口
+type CIDRArchiveStorage interface {
+	// ArchiveCIDR 保存一个 CIDR 的归档记录，已存在时覆盖
+	ArchiveCIDR(ctx context.Context, archive CIDRArchive) error
+
+	// GetArchivedCIDR 获取一个 CIDR 的归档记录
+	GetArchivedCIDR(ctx context.Context, cidr string) (CIDRArchive, error)
+
+	// DeleteArchivedCIDR 删除一个 CIDR 的归档记录
+	DeleteArchivedCIDR(ctx context.Context, cidr string) error
+}
+
+// 历史记录中的操作类型
+const (
+	HistoryAllocate   = "allocate"   // IP 被分配
+	HistoryDeallocate = "deallocate" // IP 被释放
+)
+
+// HistoryEntry 是一个 IP 的一条分配历史
+type HistoryEntry struct {
+	Action      string    // 操作类型，HistoryAllocate 或 HistoryDeallocate
+	Description string    // 分配时的描述，释放时为释放前的描述
+	Time        time.Time // 操作时间
+}
+
+// IPHistoryStorage 是支持记录 IP 分配历史的可选存储接口
+type IPHistoryStorage interface {
+	// GetIPHistory 获取 IP 最近的分配历史，按时间从早到晚排列
+	GetIPHistory(ctx context.Context, ip string) ([]HistoryEntry, error)
+}
+
+// IPReservationStorage 是支持预留 IP 的可选存储接口
+// 预留的 IP 既不在可用池中也不在已分配池中，不会被分配
+type IPReservationStorage interface {
+	// ReserveIP 将一个可用 IP 移入预留状态
+	ReserveIP(ctx context.Context, ip string, reason string) error
+
+	// UnreserveIP 将一个预留的 IP 放回可用池
+	UnreserveIP(ctx context.Context, ip string) error
+
+	// GetReservedIPs 获取所有预留的 IP 及预留原因
+	GetReservedIPs(ctx context.Context) (map[string]string, error)
+}
+
+// IPExclusionStorage 是支持持久保存全局排除列表的可选存储接口
+// 存储只负责保存列表，CIDRGuardian 负责保证被排除的 IP 不会进入可用池
+type IPExclusionStorage interface {
+	// AddExclusion 将 IP 加入排除列表，已存在时不报错
+	AddExclusion(ctx context.Context, ip string) error
+
+	// RemoveExclusion 将 IP 移出排除列表，IP 未被排除时返回错误
+	RemoveExclusion(ctx context.Context, ip string) error
+
+	// GetExclusions 获取排除列表中的所有 IP
+	GetExclusions(ctx context.Context) ([]string, error)
+}
+
+// AllocationSourceStorage 是支持记录分配来源（如进程或主机名）的可选存储接口
+// 来源与分配记录一起保存，IP 被释放时一并删除
+type AllocationSourceStorage interface {
+	// SetAllocationSource 设置已分配 IP 的来源，IP 未分配时返回错误
+	SetAllocationSource(ctx context.Context, ip string, source string) error
+
+	// GetAllocationSources 获取所有带来源的已分配 IP 及其来源
+	GetAllocationSources(ctx context.Context) (map[string]string, error)
+}
+
+// LeaseStorage 是支持为已分配 IP 记录租约到期时间的可选存储接口
+// 到期时间与分配记录一起保存，IP 被释放时一并删除
+type LeaseStorage interface {
+	// SetLeaseExpiry 设置已分配 IP 的租约到期时间，IP 未分配时返回错误
+	SetLeaseExpiry(ctx context.Context, ip string, expiresAt time.Time) error
+
+	// GetLeaseExpiry 获取已分配 IP 的租约到期时间，IP 没有租约时 ok 为 false；IP 未分配时返回错误
+	GetLeaseExpiry(ctx context.Context, ip string) (expiresAt time.Time, ok bool, err error)
+}
+
+// IPClaim 是两阶段分配中一个待确认的认领
+type IPClaim struct {
+	Token     string    // 认领令牌
+	IP        string    // 被认领的 IP
+	ExpiresAt time.Time // 未确认时的到期时间
+}
+
+// IPClaimStorage 是支持两阶段分配中待确认认领的可选存储接口
+// 认领与分配记录一起保存，IP 被释放时一并删除
+type IPClaimStorage interface {
+	// SetClaim 为已分配 IP 记录一个以 token 标识的待确认认领，IP 未分配时返回错误
+	SetClaim(ctx context.Context, ip, token string, expiresAt time.Time) error
+
+	// GetClaim 按令牌获取认领，不存在时 ok 为 false
+	GetClaim(ctx context.Context, token string) (claim IPClaim, ok bool, err error)
+
+	// ClearClaim 删除令牌对应的认领并保留分配，认领不存在时返回错误
+	ClearClaim(ctx context.Context, token string) error
+
+	// GetExpiredClaims 获取到期时间不晚于 t 的所有认领
+	GetExpiredClaims(ctx context.Context, t time.Time) ([]IPClaim, error)
+}
+
+// AllocationStreamStorage 是支持逐条遍历已分配 IP 的可选存储接口，避免已分配记录很多时一次性构建完整的映射
+type AllocationStreamStorage interface {
+	// ForEachAllocatedIP 依次对每个已分配 IP 及其描述调用 fn，顺序不确定
+	// fn 返回错误或上下文被取消时停止遍历并返回该错误；fn 中不应再调用同一存储
+	ForEachAllocatedIP(ctx context.Context, fn func(ip, desc string) error) error
+}
+
+// BlockAllocationStorage 是将 CIDR 块分配保存为独立类型记录的可选存储接口
+// 块记录在其网络地址上，并标记为块及其 CIDR，描述保持原样；
+// 不支持时 CIDRGuardian 以 "CIDR - 描述" 的形式将块写入网络地址的描述
+type BlockAllocationStorage interface {
+	// AllocateBlock 将块的网络地址从可用池移入已分配池，并记录为 cidr 块；网络地址不可用时错误包装 ErrIPUnavailable
+	AllocateBlock(ctx context.Context, cidr string, description string) error
+
+	// GetBlockAllocations 获取所有以块记录的分配，键为块的 CIDR，值为描述；块被释放时记录一并删除
+	GetBlockAllocations(ctx context.Context) (map[string]string, error)
+}
+
+// AllocationPageStorage 是支持分页读取已分配 IP 的可选存储接口，避免为读取一页而加载全部分配记录
+type AllocationPageStorage interface {
+	// ListAllocations 按 IP 排序返回从第 offset 条开始的至多 limit 条分配记录，包括描述和来源
+	// 顺序由存储决定，但必须稳定，使连续的分页不重不漏
+	ListAllocations(ctx context.Context, offset, limit int) ([]Allocation, error)
+}
+
+// IPSwapStorage 是支持原子地将分配从一个 IP 移到另一个 IP 的可选存储接口
+type IPSwapStorage interface {
+	// SwapIP 释放 oldIP 并以 description 分配 newIP，两步作为一个整体完成
+	// oldIP 未分配或 newIP 不可用时返回错误，不做任何修改；newIP 不可用时错误包装 ErrIPUnavailable
+	SwapIP(ctx context.Context, oldIP, newIP, description string) error
+}
+
+// AllocationMetadataStorage 是支持为已分配 IP 保存任意 JSON 元数据（如云主机信息）的可选存储接口
+// 元数据与分配记录一起保存，IP 被释放时一并删除
+type AllocationMetadataStorage interface {
+	// SetAllocationMetadata 设置已分配 IP 的元数据，IP 未分配时返回错误
+	SetAllocationMetadata(ctx context.Context, ip string, meta json.RawMessage) error
+
+	// GetAllocationMetadata 获取已分配 IP 的元数据，没有元数据时返回 nil，IP 未分配时返回错误
+	GetAllocationMetadata(ctx context.Context, ip string) (json.RawMessage, error)
+}
+
+// AllocationTimeStorage 是支持按分配时间查询已分配 IP 的可选存储接口
+type AllocationTimeStorage interface {
+	// GetAllocationsBefore 获取分配时间早于 t 的已分配 IP 及描述
+	GetAllocationsBefore(ctx context.Context, t time.Time) (map[string]string, error)
+
+	// GetAllocationsAfter 获取分配时间晚于 t 的已分配 IP 及描述
+	GetAllocationsAfter(ctx context.Context, t time.Time) (map[string]string, error)
+}
+
+// BulkAvailabilityStorage 是支持一次检查多个 IP 是否可用的可选存储接口，避免逐个查询
+type BulkAvailabilityStorage interface {
+	// AreIPsAvailable 返回每个传入的 IP 是否在可用池中，结果包含所有传入的 IP
+	AreIPsAvailable(ctx context.Context, ips []string) (map[string]bool, error)
+}
+
+// AllocationTimestampStorage 是支持逐个读取和设置分配时间的可选存储接口，用于导出和导入分配记录
+type AllocationTimestampStorage interface {
+	// GetAllocationTimes 获取所有记录了分配时间的已分配 IP 及其分配时间
+	GetAllocationTimes(ctx context.Context) (map[string]time.Time, error)
+
+	// SetAllocationTime 设置已分配 IP 的分配时间，IP 未分配时返回错误
+	SetAllocationTime(ctx context.Context, ip string, t time.Time) error
+}
+
+// DescriptionCountStorage 是支持直接统计不同描述数量的可选存储接口，避免读取全部分配记录
+type DescriptionCountStorage interface {
+	// DistinctDescriptionCount 返回已分配 IP 中不同描述的数量，描述按原样比较
+	DistinctDescriptionCount(ctx context.Context) (int, error)
 }
@@ -0,0 +1,69 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+// AllocateByKey 按键（如服务名）的哈希从按数值排序的可用IP中选择一个并分配
+// 可用集合相同时，同一个键总是映射到同一个IP；选中的IP被并发分配占用时依次尝试其后的IP，
+// 到末尾后从头继续，直到所有可用IP都尝试过。哈希函数可通过 WithKeyHash 替换
+func (g *CIDRGuardian) AllocateByKey(ctx context.Context, key, description string) (string, error) {
+	if g.readOnly {
+		return "", ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return "", err
+	}
+
+	ips, err := g.availableIPs(ctx, "AllocateByKey")
+	if err != nil {
+		return "", err
+	}
+	if ips, err = g.excludeCapped(g.excludePolicy(ips, PolicyBlockOnly)); err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("没有可用的IP")
+	}
+
+	start := int(g.hashKey(key) % uint64(len(ips)))
+	for i := 0; i < len(ips); i++ {
+		ip := ips[(start+i)%len(ips)]
+		desc := g.expandIPDescription(description, ip)
+		if err := g.validateDescription(desc); err != nil {
+			return "", err
+		}
+
+		err := g.storage.AllocateIP(ctx, ip, desc)
+		if errors.Is(err, ErrIPUnavailable) {
+			// 查找之后被其他调用占用，继续探测下一个IP
+			continue
+		}
+		if err != nil {
+			return "", g.wrapErr(ctx, "AllocateByKey", err)
+		}
+		g.stampSource(ctx, "AllocateByKey", ip)
+		return ip, nil
+	}
+
+	return "", fmt.Errorf("没有可用的IP")
+}
+
+// hashKey 使用 WithKeyHash 设置的哈希函数计算键的哈希值，未设置时使用 64 位 FNV-1a
+func (g *CIDRGuardian) hashKey(key string) uint64 {
+	if g.keyHash != nil {
+		return g.keyHash(key)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
@@ -0,0 +1,85 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLeaseExpired 表示租约已过期，不能再续期
+var ErrLeaseExpired = errors.New("租约已过期")
+
+// leaser 返回存储后端的租约接口
+func (g *CIDRGuardian) leaser() (LeaseStorage, error) {
+	leaser, ok := storageAs[LeaseStorage](g.storage)
+	if !ok {
+		return nil, fmt.Errorf("存储后端不支持租约")
+	}
+	return leaser, nil
+}
+
+// AllocateIPWithTTL 分配一个指定的IP并设置租约，租约在 ttl 之后到期
+// 到期的分配不会被自动释放，需要在到期前通过 RenewLease 续期
+func (g *CIDRGuardian) AllocateIPWithTTL(ctx context.Context, ip, description string, ttl time.Duration) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	if ttl <= 0 {
+		return fmt.Errorf("无效的租约时长: %v", ttl)
+	}
+	leaser, err := g.leaser()
+	if err != nil {
+		return err
+	}
+
+	ip = normalizeIP(ip)
+	if err := g.AllocateIP(ctx, ip, description); err != nil {
+		return err
+	}
+
+	// 设置租约失败时回滚分配
+	if err := leaser.SetLeaseExpiry(ctx, ip, g.clock.Now().Add(ttl)); err != nil {
+		_ = g.storage.DeallocateIP(ctx, ip)
+		return g.wrapErr(ctx, "AllocateIPWithTTL", err)
+	}
+	return nil
+}
+
+// RenewLease 将仍在分配中的IP的租约延长到当前时间之后 ttl
+// IP 未分配（包括已被回收）或租约已过期时返回错误，已过期时错误包装 ErrLeaseExpired
+func (g *CIDRGuardian) RenewLease(ctx context.Context, ip string, ttl time.Duration) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if ttl <= 0 {
+		return fmt.Errorf("无效的租约时长: %v", ttl)
+	}
+	leaser, err := g.leaser()
+	if err != nil {
+		return err
+	}
+
+	ip = normalizeIP(ip)
+	expiresAt, ok, err := leaser.GetLeaseExpiry(ctx, ip)
+	if err != nil {
+		return g.wrapErr(ctx, "RenewLease", err)
+	}
+	if !ok {
+		return fmt.Errorf("IP %s 没有租约", ip)
+	}
+
+	now := g.clock.Now()
+	if !now.Before(expiresAt) {
+		return fmt.Errorf("IP %s 的%w（到期时间 %s）", ip, ErrLeaseExpired, expiresAt.Format(time.RFC3339))
+	}
+
+	return g.wrapErr(ctx, "RenewLease", leaser.SetLeaseExpiry(ctx, ip, now.Add(ttl)))
+}
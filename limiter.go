@@ -0,0 +1,142 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// clockPollInterval 是使用注入的时钟时 rateLimiter 检查令牌是否可用的间隔
+const clockPollInterval = 5 * time.Millisecond
+
+// rateLimiter 是容量为 1 的令牌桶限速器，每隔 every 产生一个令牌，不允许突发
+type rateLimiter struct {
+	mu    sync.Mutex
+	every time.Duration // 两个令牌之间的间隔
+	next  time.Time     // 下一个令牌可用的时间
+}
+
+// newRateLimiter 创建每秒产生 rps 个令牌的限速器
+func newRateLimiter(rps float64) *rateLimiter {
+	return &rateLimiter{every: time.Duration(float64(time.Second) / rps)}
+}
+
+// wait 预订一个令牌并等待其可用，令牌按时钟 c 的时间产生；上下文被取消时放弃等待，尚无后续预订时归还该令牌
+func (l *rateLimiter) wait(ctx context.Context, c clock) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	now := c.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.every)
+	l.mu.Unlock()
+
+	// 醒来后按时钟重新判断令牌是否可用；注入的时钟不随系统时间走动，每隔 clockPollInterval 检查一次，推进时钟即可放行等待者
+	_, system := c.(realClock)
+	for {
+		delay := at.Sub(c.Now())
+		if delay <= 0 {
+			return nil
+		}
+		if !system && delay > clockPollInterval {
+			delay = clockPollInterval
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.mu.Lock()
+			if l.next.Equal(at.Add(l.every)) {
+				l.next = at
+			}
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+}
+
+// throttle 在配置了 WithRateLimit 时等待一个分配或释放的令牌
+func (g *CIDRGuardian) throttle(ctx context.Context) error {
+	if g.rateLimit == nil {
+		return nil
+	}
+	return g.rateLimit.wait(ctx, g.clock)
+}
+
+// forEachBounded 对 items 中的每个元素调用 fn，同时进行的调用不超过 maxConcurrency 个
+// 等待空位时响应上下文取消；任一调用失败后不再派发新的调用，并返回遇到的第一个错误
+func (g *CIDRGuardian) forEachBounded(ctx context.Context, items []string, fn func(item string) error) error {
+	// 默认按顺序执行，与未设置并发上限时的行为一致
+	if g.sem == nil || cap(g.sem) <= 1 {
+		for _, item := range items {
+			// 检查上下文是否已取消
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	for _, item := range items {
+		if failed() {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			setErr(err)
+			break
+		}
+
+		// 等待空位，同时响应上下文取消
+		select {
+		case g.sem <- struct{}{}:
+		case <-ctx.Done():
+			setErr(ctx.Err())
+			continue
+		}
+		if failed() {
+			// 获取到空位后发现已失败时需要归还
+			<-g.sem
+			break
+		}
+
+		wg.Add(1)
+		go func(item string) {
+			defer wg.Done()
+			defer func() { <-g.sem }()
+			if err := fn(item); err != nil {
+				setErr(err)
+			}
+		}(item)
+	}
+
+	wg.Wait()
+	return firstErr
+}
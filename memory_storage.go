@@ -2,9 +2,12 @@ package CIDRGuardian
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
 	"sort"
 	"sync"
+	"time"
 )
 
 // MemoryIPStorage 是 IP 池存储的内存实现
@@ -12,14 +15,74 @@ type MemoryIPStorage struct {
 	mu        sync.RWMutex
 	available map[string]bool
 	allocated map[string]string
+	archived  map[string]CIDRArchive
+	reserved  map[string]string
+	excluded  map[string]bool            // 全局排除列表
+	blocks    map[string]string          // CIDR 块的网络地址 -> 块的 CIDR
+	sources   map[string]string          // 已分配 IP 的来源
+	leases    map[string]time.Time       // 已分配 IP 的租约到期时间
+	metadata  map[string]json.RawMessage // 已分配 IP 的 JSON 元数据
+	allocTime map[string]time.Time       // 已分配 IP 的分配时间
+	claims    map[string]IPClaim         // 已分配 IP 的待确认认领
+	now       func() time.Time           // 记录分配时间和历史使用的时钟
+
+	history      map[string][]HistoryEntry
+	historyLimit int  // 每个 IP 保留的历史条数，0 表示不记录
+	strictAdd    bool // AddIP 遇到已可用的 IP 时是否返回 ErrIPAlreadyAvailable
+}
+
+// MemoryOption 是 MemoryIPStorage 的可选配置项
+type MemoryOption func(*MemoryIPStorage)
+
+// WithMemoryHistory 为每个 IP 保留最近 k 条分配历史
+func WithMemoryHistory(k int) MemoryOption {
+	return func(s *MemoryIPStorage) {
+		s.historyLimit = k
+	}
+}
+
+// WithMemoryStrictAdd 使 AddIP 遇到已在可用池中的 IP 时返回 ErrIPAlreadyAvailable，默认幂等
+func WithMemoryStrictAdd() MemoryOption {
+	return func(s *MemoryIPStorage) {
+		s.strictAdd = true
+	}
+}
+
+// WithMemoryClock 设置记录分配时间和历史使用的时钟，默认为 time.Now，便于测试
+func WithMemoryClock(now func() time.Time) MemoryOption {
+	return func(s *MemoryIPStorage) {
+		s.now = now
+	}
+}
+
+// setClock 替换记录分配时间和历史使用的时钟
+func (s *MemoryIPStorage) setClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
 }
 
 // NewMemoryIPStorage 创建一个新的内存 IP 存储
-func NewMemoryIPStorage() *MemoryIPStorage {
-	return &MemoryIPStorage{
+func NewMemoryIPStorage(opts ...MemoryOption) *MemoryIPStorage {
+	s := &MemoryIPStorage{
 		available: make(map[string]bool),
 		allocated: make(map[string]string),
+		archived:  make(map[string]CIDRArchive),
+		reserved:  make(map[string]string),
+		excluded:  make(map[string]bool),
+		blocks:    make(map[string]string),
+		sources:   make(map[string]string),
+		leases:    make(map[string]time.Time),
+		metadata:  make(map[string]json.RawMessage),
+		allocTime: make(map[string]time.Time),
+		claims:    make(map[string]IPClaim),
+		now:       time.Now,
+		history:   make(map[string][]HistoryEntry),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // AddIP 实现 IPStorage 接口
@@ -36,6 +99,13 @@ func (s *MemoryIPStorage) AddIP(ctx context.Context, ip string) error {
 	if _, exists := s.allocated[ip]; exists {
 		return fmt.Errorf("IP %s 已被分配", ip)
 	}
+	// 已预留的 IP 保持预留，不加入可用池
+	if _, exists := s.reserved[ip]; exists {
+		return nil
+	}
+	if s.strictAdd && s.available[ip] {
+		return fmt.Errorf("IP %s %w", ip, ErrIPAlreadyAvailable)
+	}
 
 	s.available[ip] = true
 	return nil
@@ -52,7 +122,7 @@ func (s *MemoryIPStorage) RemoveIP(ctx context.Context, ip string) error {
 	defer s.mu.Unlock()
 
 	if _, exists := s.available[ip]; !exists {
-		return fmt.Errorf("IP %s 不在可用池中", ip)
+		return fmt.Errorf("IP %s %w", ip, ErrIPUnavailable)
 	}
 
 	delete(s.available, ip)
@@ -73,6 +143,23 @@ func (s *MemoryIPStorage) IsIPAvailable(ctx context.Context, ip string) (bool, e
 	return exists, nil
 }
 
+// AreIPsAvailable 实现 BulkAvailabilityStorage 接口
+func (s *MemoryIPStorage) AreIPsAvailable(ctx context.Context, ips []string) (map[string]bool, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		result[ip] = s.available[ip]
+	}
+	return result, nil
+}
+
 // GetAvailableIPs 实现 IPStorage 接口
 func (s *MemoryIPStorage) GetAvailableIPs(ctx context.Context) ([]string, error) {
 	// 检查上下文是否已取消
@@ -103,12 +190,19 @@ func (s *MemoryIPStorage) AllocateIP(ctx context.Context, ip string, description
 	defer s.mu.Unlock()
 
 	if _, exists := s.available[ip]; !exists {
-		return fmt.Errorf("IP %s 不在可用池中", ip)
+		return fmt.Errorf("IP %s %w", ip, ErrIPUnavailable)
 	}
 
+	s.allocateLocked(ip, description)
+	return nil
+}
+
+// allocateLocked 将可用的 IP 移入已分配池，调用方需持有写锁并已检查 IP 可用
+func (s *MemoryIPStorage) allocateLocked(ip, description string) {
 	delete(s.available, ip)
 	s.allocated[ip] = description
-	return nil
+	s.allocTime[ip] = s.now()
+	s.recordHistory(ip, HistoryAllocate, description)
 }
 
 // DeallocateIP 实现 IPStorage 接口
@@ -125,8 +219,84 @@ func (s *MemoryIPStorage) DeallocateIP(ctx context.Context, ip string) error {
 		return fmt.Errorf("IP %s 不在已分配池中", ip)
 	}
 
+	s.deallocateLocked(ip)
+	return nil
+}
+
+// deallocateLocked 将已分配的 IP 放回可用池并删除其附属信息，调用方需持有写锁并已检查 IP 已分配
+func (s *MemoryIPStorage) deallocateLocked(ip string) {
+	s.recordHistory(ip, HistoryDeallocate, s.allocated[ip])
 	delete(s.allocated, ip)
+	delete(s.sources, ip)
+	delete(s.leases, ip)
+	delete(s.metadata, ip)
+	delete(s.allocTime, ip)
+	delete(s.blocks, ip)
+	delete(s.claims, ip)
 	s.available[ip] = true
+}
+
+// AllocateBlock 实现 BlockAllocationStorage 接口
+func (s *MemoryIPStorage) AllocateBlock(ctx context.Context, cidr string, description string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+	networkAddr := ipNet.IP.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.available[networkAddr]; !exists {
+		return fmt.Errorf("IP %s %w", networkAddr, ErrIPUnavailable)
+	}
+
+	s.allocateLocked(networkAddr, description)
+	s.blocks[networkAddr] = ipNet.String()
+	return nil
+}
+
+// GetBlockAllocations 实现 BlockAllocationStorage 接口
+func (s *MemoryIPStorage) GetBlockAllocations(ctx context.Context) (map[string]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]string, len(s.blocks))
+	for networkAddr, cidr := range s.blocks {
+		result[cidr] = s.allocated[networkAddr]
+	}
+	return result, nil
+}
+
+// SwapIP 实现 IPSwapStorage 接口，先检查两个前提条件，都满足时才修改
+func (s *MemoryIPStorage) SwapIP(ctx context.Context, oldIP, newIP, description string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.allocated[oldIP]; !exists {
+		return fmt.Errorf("IP %s 不在已分配池中", oldIP)
+	}
+	if _, exists := s.available[newIP]; !exists {
+		return fmt.Errorf("IP %s %w", newIP, ErrIPUnavailable)
+	}
+
+	s.deallocateLocked(oldIP)
+	s.allocateLocked(newIP, description)
 	return nil
 }
 
@@ -148,6 +318,26 @@ func (s *MemoryIPStorage) GetAllocatedIPs(ctx context.Context) (map[string]strin
 	return result, nil
 }
 
+// ForEachAllocatedIP 实现 AllocationStreamStorage 接口
+// 先在锁内复制一份快照再遍历，fn 中调用存储不会死锁
+func (s *MemoryIPStorage) ForEachAllocatedIP(ctx context.Context, fn func(ip, desc string) error) error {
+	allocated, err := s.GetAllocatedIPs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for ip, desc := range allocated {
+		// 检查上下文是否已取消
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(ip, desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // AvailableCount 实现 IPStorage 接口
 func (s *MemoryIPStorage) AvailableCount(ctx context.Context) (int, error) {
 	// 检查上下文是否已取消
@@ -173,3 +363,600 @@ func (s *MemoryIPStorage) AllocatedCount(ctx context.Context) (int, error) {
 
 	return len(s.allocated), nil
 }
+
+// DistinctDescriptionCount 实现 DescriptionCountStorage 接口
+func (s *MemoryIPStorage) DistinctDescriptionCount(ctx context.Context) (int, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	descriptions := make(map[string]struct{}, len(s.allocated))
+	for _, desc := range s.allocated {
+		descriptions[desc] = struct{}{}
+	}
+	return len(descriptions), nil
+}
+
+// ImportAllocations 实现 IPStorage 接口
+func (s *MemoryIPStorage) ImportAllocations(ctx context.Context, allocations map[string]string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 先检查所有冲突，保证整体成功或整体失败
+	for ip := range allocations {
+		if _, exists := s.allocated[ip]; exists {
+			return fmt.Errorf("IP %s 已被分配", ip)
+		}
+	}
+
+	now := s.now()
+	for ip, desc := range allocations {
+		delete(s.available, ip)
+		s.allocated[ip] = desc
+		s.allocTime[ip] = now
+		s.recordHistory(ip, HistoryAllocate, desc)
+	}
+	return nil
+}
+
+// UpdateDescription 实现 IPStorage 接口
+func (s *MemoryIPStorage) UpdateDescription(ctx context.Context, ip string, description string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.allocated[ip]; !exists {
+		return fmt.Errorf("IP %s 不在已分配池中", ip)
+	}
+
+	s.allocated[ip] = description
+	return nil
+}
+
+// BulkAllocateIP 实现 IPStorage 接口
+func (s *MemoryIPStorage) BulkAllocateIP(ctx context.Context, allocations map[string]string, skipUnavailable bool) ([]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ips := make([]string, 0, len(allocations))
+	for ip := range allocations {
+		if _, exists := s.available[ip]; !exists {
+			if skipUnavailable {
+				continue
+			}
+			return nil, fmt.Errorf("IP %s %w", ip, ErrIPUnavailable)
+		}
+		ips = append(ips, ip)
+	}
+
+	now := s.now()
+	for _, ip := range ips {
+		delete(s.available, ip)
+		s.allocated[ip] = allocations[ip]
+		s.allocTime[ip] = now
+		s.recordHistory(ip, HistoryAllocate, allocations[ip])
+	}
+
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// BulkAddIP 实现 IPStorage 接口
+func (s *MemoryIPStorage) BulkAddIP(ctx context.Context, ips []string) ([]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		// 已分配、已预留或已在可用池中的 IP 不需要添加
+		if _, exists := s.allocated[ip]; exists {
+			continue
+		}
+		if _, exists := s.reserved[ip]; exists {
+			continue
+		}
+		if s.available[ip] {
+			continue
+		}
+		s.available[ip] = true
+		added = append(added, ip)
+	}
+
+	sort.Strings(added)
+	return added, nil
+}
+
+// ArchiveCIDR 实现 CIDRArchiveStorage 接口
+func (s *MemoryIPStorage) ArchiveCIDR(ctx context.Context, archive CIDRArchive) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 复制切片和映射，避免调用方修改归档内容
+	record := CIDRArchive{
+		CIDR:         archive.CIDR,
+		Description:  archive.Description,
+		AvailableIPs: append([]string(nil), archive.AvailableIPs...),
+		AllocatedIPs: make(map[string]string, len(archive.AllocatedIPs)),
+	}
+	for ip, desc := range archive.AllocatedIPs {
+		record.AllocatedIPs[ip] = desc
+	}
+
+	s.archived[archive.CIDR] = record
+	return nil
+}
+
+// GetArchivedCIDR 实现 CIDRArchiveStorage 接口
+func (s *MemoryIPStorage) GetArchivedCIDR(ctx context.Context, cidr string) (CIDRArchive, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return CIDRArchive{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	archive, exists := s.archived[cidr]
+	if !exists {
+		return CIDRArchive{}, fmt.Errorf("CIDR %s 没有归档记录", cidr)
+	}
+	return archive, nil
+}
+
+// DeleteArchivedCIDR 实现 CIDRArchiveStorage 接口
+func (s *MemoryIPStorage) DeleteArchivedCIDR(ctx context.Context, cidr string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.archived[cidr]; !exists {
+		return fmt.Errorf("CIDR %s 没有归档记录", cidr)
+	}
+
+	delete(s.archived, cidr)
+	return nil
+}
+
+// recordHistory 追加一条历史记录，超过上限时丢弃最早的记录，调用方需持有写锁
+func (s *MemoryIPStorage) recordHistory(ip, action, description string) {
+	if s.historyLimit <= 0 {
+		return
+	}
+
+	entries := append(s.history[ip], HistoryEntry{
+		Action:      action,
+		Description: description,
+		Time:        s.now(),
+	})
+	if len(entries) > s.historyLimit {
+		entries = append([]HistoryEntry(nil), entries[len(entries)-s.historyLimit:]...)
+	}
+	s.history[ip] = entries
+}
+
+// GetIPHistory 实现 IPHistoryStorage 接口
+func (s *MemoryIPStorage) GetIPHistory(ctx context.Context, ip string) ([]HistoryEntry, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]HistoryEntry{}, s.history[ip]...), nil
+}
+
+// ReserveIP 实现 IPReservationStorage 接口
+func (s *MemoryIPStorage) ReserveIP(ctx context.Context, ip string, reason string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.available[ip]; !exists {
+		return fmt.Errorf("IP %s %w", ip, ErrIPUnavailable)
+	}
+
+	delete(s.available, ip)
+	s.reserved[ip] = reason
+	return nil
+}
+
+// UnreserveIP 实现 IPReservationStorage 接口
+func (s *MemoryIPStorage) UnreserveIP(ctx context.Context, ip string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.reserved[ip]; !exists {
+		return fmt.Errorf("IP %s 未被预留", ip)
+	}
+
+	delete(s.reserved, ip)
+	s.available[ip] = true
+	return nil
+}
+
+// GetReservedIPs 实现 IPReservationStorage 接口
+func (s *MemoryIPStorage) GetReservedIPs(ctx context.Context) (map[string]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]string, len(s.reserved))
+	for ip, reason := range s.reserved {
+		result[ip] = reason
+	}
+	return result, nil
+}
+
+// ListAllocations 实现 AllocationPageStorage 接口，按IP数值顺序分页
+func (s *MemoryIPStorage) ListAllocations(ctx context.Context, offset, limit int) ([]Allocation, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ips := make([]string, 0, len(s.allocated))
+	for ip := range s.allocated {
+		ips = append(ips, ip)
+	}
+	sortIPStrings(ips)
+
+	if offset >= len(ips) {
+		return []Allocation{}, nil
+	}
+	ips = ips[offset:]
+	if len(ips) > limit {
+		ips = ips[:limit]
+	}
+
+	result := make([]Allocation, 0, len(ips))
+	for _, ip := range ips {
+		result = append(result, Allocation{IP: ip, Description: s.allocated[ip], Source: s.sources[ip], CIDR: s.blocks[ip]})
+	}
+	return result, nil
+}
+
+// AddExclusion 实现 IPExclusionStorage 接口
+func (s *MemoryIPStorage) AddExclusion(ctx context.Context, ip string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.excluded[ip] = true
+	return nil
+}
+
+// RemoveExclusion 实现 IPExclusionStorage 接口
+func (s *MemoryIPStorage) RemoveExclusion(ctx context.Context, ip string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.excluded[ip] {
+		return fmt.Errorf("IP %s 未被排除", ip)
+	}
+	delete(s.excluded, ip)
+	return nil
+}
+
+// GetExclusions 实现 IPExclusionStorage 接口
+func (s *MemoryIPStorage) GetExclusions(ctx context.Context) ([]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]string, 0, len(s.excluded))
+	for ip := range s.excluded {
+		result = append(result, ip)
+	}
+	return result, nil
+}
+
+// SetAllocationSource 实现 AllocationSourceStorage 接口
+func (s *MemoryIPStorage) SetAllocationSource(ctx context.Context, ip string, source string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.allocated[ip]; !exists {
+		return fmt.Errorf("IP %s 不在已分配池中", ip)
+	}
+	if source == "" {
+		delete(s.sources, ip)
+	} else {
+		s.sources[ip] = source
+	}
+	return nil
+}
+
+// GetAllocationSources 实现 AllocationSourceStorage 接口
+func (s *MemoryIPStorage) GetAllocationSources(ctx context.Context) (map[string]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]string, len(s.sources))
+	for ip, source := range s.sources {
+		result[ip] = source
+	}
+	return result, nil
+}
+
+// SetLeaseExpiry 实现 LeaseStorage 接口
+func (s *MemoryIPStorage) SetLeaseExpiry(ctx context.Context, ip string, expiresAt time.Time) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.allocated[ip]; !exists {
+		return fmt.Errorf("IP %s 不在已分配池中", ip)
+	}
+	s.leases[ip] = expiresAt
+	return nil
+}
+
+// GetLeaseExpiry 实现 LeaseStorage 接口
+func (s *MemoryIPStorage) GetLeaseExpiry(ctx context.Context, ip string) (time.Time, bool, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.allocated[ip]; !exists {
+		return time.Time{}, false, fmt.Errorf("IP %s 不在已分配池中", ip)
+	}
+	expiresAt, ok := s.leases[ip]
+	return expiresAt, ok, nil
+}
+
+// SetClaim 实现 IPClaimStorage 接口
+func (s *MemoryIPStorage) SetClaim(ctx context.Context, ip, token string, expiresAt time.Time) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.allocated[ip]; !exists {
+		return fmt.Errorf("IP %s 不在已分配池中", ip)
+	}
+	s.claims[ip] = IPClaim{Token: token, IP: ip, ExpiresAt: expiresAt}
+	return nil
+}
+
+// GetClaim 实现 IPClaimStorage 接口
+func (s *MemoryIPStorage) GetClaim(ctx context.Context, token string) (IPClaim, bool, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return IPClaim{}, false, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, claim := range s.claims {
+		if claim.Token == token {
+			return claim, true, nil
+		}
+	}
+	return IPClaim{}, false, nil
+}
+
+// ClearClaim 实现 IPClaimStorage 接口
+func (s *MemoryIPStorage) ClearClaim(ctx context.Context, token string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ip, claim := range s.claims {
+		if claim.Token == token {
+			delete(s.claims, ip)
+			return nil
+		}
+	}
+	return fmt.Errorf("认领 %s 不存在", token)
+}
+
+// GetExpiredClaims 实现 IPClaimStorage 接口
+func (s *MemoryIPStorage) GetExpiredClaims(ctx context.Context, t time.Time) ([]IPClaim, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []IPClaim{}
+	for _, claim := range s.claims {
+		if !claim.ExpiresAt.After(t) {
+			result = append(result, claim)
+		}
+	}
+	return result, nil
+}
+
+// SetAllocationMetadata 实现 AllocationMetadataStorage 接口
+func (s *MemoryIPStorage) SetAllocationMetadata(ctx context.Context, ip string, meta json.RawMessage) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.allocated[ip]; !exists {
+		return fmt.Errorf("IP %s 不在已分配池中", ip)
+	}
+	// 保存副本，避免调用方之后修改传入的切片
+	s.metadata[ip] = append(json.RawMessage(nil), meta...)
+	return nil
+}
+
+// GetAllocationMetadata 实现 AllocationMetadataStorage 接口
+func (s *MemoryIPStorage) GetAllocationMetadata(ctx context.Context, ip string) (json.RawMessage, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.allocated[ip]; !exists {
+		return nil, fmt.Errorf("IP %s 不在已分配池中", ip)
+	}
+	meta, ok := s.metadata[ip]
+	if !ok {
+		return nil, nil
+	}
+	return append(json.RawMessage(nil), meta...), nil
+}
+
+// GetAllocationsBefore 实现 AllocationTimeStorage 接口
+func (s *MemoryIPStorage) GetAllocationsBefore(ctx context.Context, t time.Time) (map[string]string, error) {
+	return s.allocationsByTime(ctx, func(at time.Time) bool { return at.Before(t) })
+}
+
+// GetAllocationsAfter 实现 AllocationTimeStorage 接口
+func (s *MemoryIPStorage) GetAllocationsAfter(ctx context.Context, t time.Time) (map[string]string, error) {
+	return s.allocationsByTime(ctx, func(at time.Time) bool { return at.After(t) })
+}
+
+// GetAllocationTimes 实现 AllocationTimestampStorage 接口
+func (s *MemoryIPStorage) GetAllocationTimes(ctx context.Context) (map[string]time.Time, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]time.Time, len(s.allocTime))
+	for ip := range s.allocated {
+		if at, ok := s.allocTime[ip]; ok {
+			result[ip] = at
+		}
+	}
+	return result, nil
+}
+
+// SetAllocationTime 实现 AllocationTimestampStorage 接口
+func (s *MemoryIPStorage) SetAllocationTime(ctx context.Context, ip string, t time.Time) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.allocated[ip]; !exists {
+		return fmt.Errorf("IP %s 不在已分配池中", ip)
+	}
+	s.allocTime[ip] = t
+	return nil
+}
+
+// allocationsByTime 返回分配时间满足条件的已分配 IP 及描述，没有记录分配时间的 IP 不计入
+func (s *MemoryIPStorage) allocationsByTime(ctx context.Context, match func(time.Time) bool) (map[string]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]string)
+	for ip, desc := range s.allocated {
+		if at, ok := s.allocTime[ip]; ok && match(at) {
+			result[ip] = desc
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// metadater 返回存储后端的分配元数据接口
+func (g *CIDRGuardian) metadater() (AllocationMetadataStorage, error) {
+	metadater, ok := storageAs[AllocationMetadataStorage](g.storage)
+	if !ok {
+		return nil, fmt.Errorf("存储后端不支持分配元数据")
+	}
+	return metadater, nil
+}
+
+// AllocateIPWithMetadata 分配一个指定的IP并保存任意 JSON 元数据（如云主机信息）
+// meta 必须是合法的 JSON，否则不做分配直接返回错误；保存元数据失败时回滚分配
+func (g *CIDRGuardian) AllocateIPWithMetadata(ctx context.Context, ip, description string, meta json.RawMessage) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	if !json.Valid(meta) {
+		return fmt.Errorf("无效的元数据: 不是合法的 JSON")
+	}
+	metadater, err := g.metadater()
+	if err != nil {
+		return err
+	}
+
+	ip = normalizeIP(ip)
+	if err := g.AllocateIP(ctx, ip, description); err != nil {
+		return err
+	}
+
+	if err := metadater.SetAllocationMetadata(ctx, ip, meta); err != nil {
+		_ = g.storage.DeallocateIP(ctx, ip)
+		return g.wrapErr(ctx, "AllocateIPWithMetadata", err)
+	}
+	return nil
+}
+
+// GetMetadata 获取已分配IP的 JSON 元数据，没有保存元数据时返回 nil
+// IP 未分配时返回错误；需要存储后端实现 AllocationMetadataStorage
+func (g *CIDRGuardian) GetMetadata(ctx context.Context, ip string) (json.RawMessage, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	metadater, err := g.metadater()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := metadater.GetAllocationMetadata(ctx, normalizeIP(ip))
+	if err != nil {
+		return nil, g.wrapErr(ctx, "GetMetadata", err)
+	}
+	return meta, nil
+}
@@ -0,0 +1,241 @@
+package CIDRGuardian
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Option 是 CIDRGuardian 的可选配置项
+type Option func(*CIDRGuardian)
+
+// WithInitialCIDRs 设置创建时添加到管理池的初始 CIDR
+func WithInitialCIDRs(cidrs ...string) Option {
+	return func(g *CIDRGuardian) {
+		g.initialCIDRs = append(g.initialCIDRs, cidrs...)
+	}
+}
+
+// WithLogger 设置日志记录器，存储操作失败时会记录日志
+func WithLogger(logger *slog.Logger) Option {
+	return func(g *CIDRGuardian) {
+		g.logger = logger
+	}
+}
+
+// WithSoftDelete 启用软删除，RemoveCIDR 会归档 CIDR 以便通过 RestoreCIDR 恢复
+func WithSoftDelete() Option {
+	return func(g *CIDRGuardian) {
+		g.softDelete = true
+	}
+}
+
+// WithStrictCIDR 使 AddCIDR 拒绝设置了主机位的 CIDR，而不是将其规范化
+func WithStrictCIDR() Option {
+	return func(g *CIDRGuardian) {
+		g.strictCIDR = true
+	}
+}
+
+// WithAllowOverlayAllocated 允许 AddCIDR（以及 AddCIDRs、AddCIDRWithProgress 和 NewCIDRGuardianFromTemplate）
+// 将新 CIDR 叠加在已有分配之上：已被分配的成员被跳过，不会加入可用池。默认任一成员已被分配时返回错误；在已有分配的持久化存储上
+// 重新创建 CIDRGuardian 并传入初始 CIDR 时需要启用
+func WithAllowOverlayAllocated() Option {
+	return func(g *CIDRGuardian) {
+		g.overlayAlloc = true
+	}
+}
+
+// WithMaxConcurrency 设置批量操作（如 AddCIDR）中同时进行的存储调用上限
+// 默认为 1，即按顺序执行；小于 1 的值按 1 处理
+func WithMaxConcurrency(n int) Option {
+	return func(g *CIDRGuardian) {
+		if n < 1 {
+			n = 1
+		}
+		g.sem = make(chan struct{}, n)
+	}
+}
+
+// WithRateLimit 将分配和释放操作（AllocateIP、GetNextAvailableIP、AllocateCIDR、ReleaseIP、ReleaseCIDR 等）
+// 限制为每秒至多 rps 次，超出时阻塞等待，等待期间响应上下文取消；每次调用计一次，批量方法也只计一次。
+// 读取操作不受影响；rps 小于等于 0 时不限制
+func WithRateLimit(rps float64) Option {
+	return func(g *CIDRGuardian) {
+		if rps <= 0 {
+			g.rateLimit = nil
+			return
+		}
+		g.rateLimit = newRateLimiter(rps)
+	}
+}
+
+// WithDescriptionTemplate 启用描述模板，分配时展开 {ip}、{ip-dashed}、{cidr} 占位符
+func WithDescriptionTemplate() Option {
+	return func(g *CIDRGuardian) {
+		g.descTemplate = true
+	}
+}
+
+// WithMaxDescriptionLength 设置分配描述的最大字符数，超出时返回 ErrDescriptionTooLong
+// 默认不限制；n 小于等于 0 时同样不限制
+func WithMaxDescriptionLength(n int) Option {
+	return func(g *CIDRGuardian) {
+		g.maxDescLen = n
+	}
+}
+
+// WithRejectControlChars 拒绝包含控制字符（如换行、制表符）的分配描述，返回 ErrDescriptionInvalid
+func WithRejectControlChars() Option {
+	return func(g *CIDRGuardian) {
+		g.rejectCtrl = true
+	}
+}
+
+// WithRejectSpecialUse 使 AddCIDR、AddCIDRs、AddSingleIP、ExpandPool 等添加地址的方法拒绝环回、组播、文档等特殊用途地址，
+// 返回包装 ErrSpecialUse 的错误；CIDR 与任一特殊用途范围重叠即被拒绝。默认不检查
+func WithRejectSpecialUse() Option {
+	return func(g *CIDRGuardian) {
+		g.specialUse = true
+	}
+}
+
+// WithReadOnly 启用只读模式，所有修改操作直接返回 ErrReadOnly，查询操作不受影响
+// 只读模式下 WithInitialCIDRs 传入的 CIDR 只登记到管理池，不会写入存储
+func WithReadOnly() Option {
+	return func(g *CIDRGuardian) {
+		g.readOnly = true
+	}
+}
+
+// WithAutoExpand 设置备用 CIDR 列表，GetNextAvailableIP 发现可用池耗尽时
+// 按顺序取出下一个备用 CIDR 调用 ExpandPool 扩展，并重试一次分配
+func WithAutoExpand(cidrs []string) Option {
+	return func(g *CIDRGuardian) {
+		g.spareCIDRs = append(g.spareCIDRs, cidrs...)
+	}
+}
+
+// WithAvoidRecentReuse 使 GetNextAvailableIP 跳过在 window 内通过 ReleaseIP 等释放的单个IP，
+// 按数值顺序选择第一个未被近期释放的IP，减少地址在短时间内被复用；所有可用IP都在 window 内被释放过时，
+// 选择释放时间最早的IP。释放时间只记录在当前 CIDRGuardian 的内存中；window 小于等于 0 时不启用
+func WithAvoidRecentReuse(window time.Duration) Option {
+	return func(g *CIDRGuardian) {
+		g.reuseWindow = window
+	}
+}
+
+// WithClaimTTL 设置 ClaimIP 的认领在未确认时的有效期，默认 1 分钟；小于等于 0 时使用默认值
+func WithClaimTTL(ttl time.Duration) Option {
+	return func(g *CIDRGuardian) {
+		g.claimTTL = ttl
+	}
+}
+
+// WithIdempotencyTTL 设置 AllocateIdempotent 记录的请求键的保留时长，默认 10 分钟；小于等于 0 时使用默认值
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(g *CIDRGuardian) {
+		g.idemTTL = ttl
+	}
+}
+
+// WithClock 设置租约、认领到期、WithAvoidRecentReuse 和 WithRateLimit 的令牌产生等功能读取当前时间的时钟，默认使用系统时间，
+// 测试中可以传入 NewFakeClock 创建的时钟，推进时钟会放行正在等待令牌的调用。存储是 MemoryIPStorage 时，
+// 其记录的分配时间和历史也改用该时钟（覆盖 WithMemoryClock）。c 为 nil 时忽略
+func WithClock(c clock) Option {
+	return func(g *CIDRGuardian) {
+		if c != nil {
+			g.clock = c
+		}
+	}
+}
+
+// WithStorageSelfTest 在创建时调用 ValidateStorage 检查存储后端是否符合接口约定，失败时创建失败
+// 只读模式下不执行自检
+func WithStorageSelfTest() Option {
+	return func(g *CIDRGuardian) {
+		g.selfTest = true
+	}
+}
+
+// WithPanicRecovery 用 SafeStorage 包装存储后端，将存储方法中的 panic 转换为包装 ErrStoragePanic 的错误
+// 存储实现的可选接口（预留、块记录等）仍然可用，但这些可选方法不做 panic 恢复
+func WithPanicRecovery() Option {
+	return func(g *CIDRGuardian) {
+		g.recoverPanic = true
+	}
+}
+
+// WithSource 设置默认的分配来源（如进程或主机名），分配成功后与分配记录一起保存
+// 需要存储实现 AllocationSourceStorage；单次调用可通过 WithAllocationSource 覆盖
+func WithSource(source string) Option {
+	return func(g *CIDRGuardian) {
+		g.source = source
+	}
+}
+
+// WithCaseInsensitiveDescriptions 使 GetAllocatedIPsMatching、ReleaseByDescription 和 UsageByDescription
+// 按描述匹配时忽略大小写，存储中仍保留描述的原始写法；默认区分大小写
+func WithCaseInsensitiveDescriptions() Option {
+	return func(g *CIDRGuardian) {
+		g.foldDesc = true
+	}
+}
+
+// WithPerHostCIDRAllocation 使 AllocateCIDR、AllocateSpecificCIDR 等分配 CIDR 块时将每个成员都记录为已分配，
+// AllocatedCount 因此包含块内所有地址。网络地址仍记录为块，其余成员的描述由 hostTemplate 展开
+// （支持 {ip}、{ip-dashed}、{cidr}，为空时使用块的描述）；ReleaseCIDR 会一并释放这些成员，
+// 因此同一存储上不应混用两种模式
+func WithPerHostCIDRAllocation(hostTemplate string) Option {
+	return func(g *CIDRGuardian) {
+		g.perHost = true
+		g.hostDesc = hostTemplate
+	}
+}
+
+// WithIPFormat 设置列表和报告类方法（GetAvailableIPs、GetAvailableCIDRs、GetUsedCIDRs、
+// GetAllocatedIPsMatching、StatusTable 等）输出IP的格式，如 IPFormatUpperIPv6|IPFormatStripZone
+// 只影响查询结果，存储中始终保存规范形式，传入的参数也不受影响；分配、认领和释放类方法
+// （GetNextAvailableIP、AllocateByKey、ClaimIP、AllocateIdempotent、ReleaseAllInCIDR 等）始终返回规范形式
+func WithIPFormat(format IPFormat) Option {
+	return func(g *CIDRGuardian) {
+		g.ipFormat = format
+	}
+}
+
+// WithKeyHash 设置 AllocateByKey 将键映射到可用IP时使用的哈希函数，默认使用 64 位 FNV-1a
+func WithKeyHash(hash func(key string) uint64) Option {
+	return func(g *CIDRGuardian) {
+		g.keyHash = hash
+	}
+}
+
+// defaultAllocRetries 是分配遇到并发冲突时的默认重试次数
+const defaultAllocRetries = 3
+
+// WithAllocateRetries 设置 AllocateCIDR 选中的块、GetNextAvailableIP 和 GetLastAvailableIP 选中的IP
+// 被并发分配抢占时的最大重试次数。每次重试前带抖动地退避并重新查找；0 表示不重试，负数按 0 处理
+func WithAllocateRetries(n int) Option {
+	return func(g *CIDRGuardian) {
+		if n < 0 {
+			n = 0
+		}
+		g.allocRetries = n
+	}
+}
+
+// OrphanPolicy 决定释放不属于任何管理 CIDR 的IP（孤立IP）时的处理方式
+type OrphanPolicy int
+
+const (
+	// OrphanDrop 释放孤立IP后不放回可用池，这是默认策略
+	OrphanDrop OrphanPolicy = iota
+	// OrphanError 拒绝释放孤立IP并返回错误，IP 保持已分配状态
+	OrphanError
+)
+
+// WithOrphanPolicy 设置 ReleaseIP 处理孤立IP的策略
+func WithOrphanPolicy(policy OrphanPolicy) Option {
+	return func(g *CIDRGuardian) {
+		g.orphanPolicy = policy
+	}
+}
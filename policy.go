@@ -0,0 +1,163 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// ErrAllocationPolicy 表示分配违反了 CIDR 的分配策略
+var ErrAllocationPolicy = errors.New("违反 CIDR 分配策略")
+
+// ErrSoftCapReached 表示所有还有可用IP的 CIDR 都已达到 WithSoftCap 设置的软上限
+var ErrSoftCapReached = errors.New("已达到分配软上限")
+
+// AllocationPolicy 决定一个管理 CIDR 中的地址可以以何种方式分配
+type AllocationPolicy int
+
+const (
+	// PolicyAny 允许分配单个IP和整块，这是默认策略
+	PolicyAny AllocationPolicy = iota
+	// PolicySingleIPOnly 只允许分配单个IP，AllocateCIDR 等不会从该 CIDR 中划分块
+	PolicySingleIPOnly
+	// PolicyBlockOnly 只允许划分整块，AllocateIP、GetNextAvailableIP 等不会分配其中的单个IP
+	PolicyBlockOnly
+)
+
+// String 返回策略的名称
+func (p AllocationPolicy) String() string {
+	switch p {
+	case PolicyAny:
+		return "any"
+	case PolicySingleIPOnly:
+		return "single-ip-only"
+	case PolicyBlockOnly:
+		return "block-only"
+	default:
+		return fmt.Sprintf("AllocationPolicy(%d)", int(p))
+	}
+}
+
+// AddCIDRWithPolicy 与 AddCIDR 相同，并为该 CIDR 记录分配策略
+// 策略只约束之后通过 CIDRGuardian 进行的分配，ImportAllocations 导入的记录不受影响
+func (g *CIDRGuardian) AddCIDRWithPolicy(ctx context.Context, cidr, description string, policy AllocationPolicy) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	if policy < PolicyAny || policy > PolicyBlockOnly {
+		return fmt.Errorf("无效的分配策略: %d", int(policy))
+	}
+	return g.addCIDR(ctx, cidr, description, policy, addCIDRConfig{})
+}
+
+// GetCIDRPolicy 返回管理 CIDR 的分配策略
+func (g *CIDRGuardian) GetCIDRPolicy(ctx context.Context, cidr string) (AllocationPolicy, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return PolicyAny, err
+	}
+
+	info, exists := g.managedCIDRs.load()[canonicalCIDR(cidr)]
+	if !exists {
+		return PolicyAny, fmt.Errorf("CIDR %s 不在管理池中", cidr)
+	}
+	return info.Policy, nil
+}
+
+// checkSingleIPPolicy 检查IP是否可以作为单个地址分配，所在 CIDR 只允许整块时返回 ErrAllocationPolicy
+func (g *CIDRGuardian) checkSingleIPPolicy(ipStr string) error {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil
+	}
+
+	for cidr, info := range g.managedCIDRs.load() {
+		if info.Policy == PolicyBlockOnly && info.IPNet.Contains(ip) {
+			return fmt.Errorf("IP %s 所在的 CIDR %s 只允许分配整块: %w", ipStr, cidr, ErrAllocationPolicy)
+		}
+	}
+	return nil
+}
+
+// excludePolicy 过滤掉分配策略为 policy 的 CIDR 中的IP，保持原有顺序
+func (g *CIDRGuardian) excludePolicy(ips []string, policy AllocationPolicy) []string {
+	var excluded []*net.IPNet
+	for _, info := range g.managedCIDRs.load() {
+		if info.Policy == policy {
+			excluded = append(excluded, info.IPNet)
+		}
+	}
+	if len(excluded) == 0 {
+		return ips
+	}
+
+	candidates := make([]string, 0, len(ips))
+	for _, ipStr := range ips {
+		if ip := net.ParseIP(ipStr); ip == nil || !inAnyNet(ip, excluded) {
+			candidates = append(candidates, ipStr)
+		}
+	}
+	return candidates
+}
+
+// checkBlockPolicy 检查块是否可以划分，与只允许单个IP的 CIDR 重叠时返回 ErrAllocationPolicy
+func (g *CIDRGuardian) checkBlockPolicy(ipNet *net.IPNet) error {
+	for cidr, info := range g.managedCIDRs.load() {
+		if info.Policy == PolicySingleIPOnly && cidrsOverlap(ipNet, info.IPNet) {
+			return fmt.Errorf("CIDR %s 所在的 CIDR %s 只允许分配单个IP: %w", ipNet.String(), cidr, ErrAllocationPolicy)
+		}
+	}
+	return nil
+}
+
+// inAnyNet 检查IP是否属于任一网络
+func inAnyNet(ip net.IP, nets []*net.IPNet) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludeCapped 过滤掉使用率达到软上限的 CIDR 中的IP，保持原有顺序
+// 使用率按 ips 中属于该 CIDR 的地址计算；ips 不为空但全部被过滤时返回包装 ErrSoftCapReached 的错误
+func (g *CIDRGuardian) excludeCapped(ips []string) ([]string, error) {
+	var capped []*net.IPNet
+	for _, info := range g.managedCIDRs.load() {
+		if info.SoftCap > 0 && utilizationPercent(info.IPNet, ips) >= info.SoftCap {
+			capped = append(capped, info.IPNet)
+		}
+	}
+	if len(capped) == 0 {
+		return ips, nil
+	}
+
+	candidates := make([]string, 0, len(ips))
+	for _, ipStr := range ips {
+		if ip := net.ParseIP(ipStr); ip == nil || !inAnyNet(ip, capped) {
+			candidates = append(candidates, ipStr)
+		}
+	}
+	if len(candidates) == 0 && len(ips) > 0 {
+		return nil, fmt.Errorf("所有还有可用IP的 CIDR 都%w", ErrSoftCapReached)
+	}
+	return candidates, nil
+}
+
+// utilizationPercent 计算网络的使用率，available 中不属于该网络的地址被忽略
+func utilizationPercent(ipNet *net.IPNet, available []string) float64 {
+	free := int64(0)
+	for _, ipStr := range available {
+		if ip := net.ParseIP(ipStr); ip != nil && ipNet.Contains(ip) {
+			free++
+		}
+	}
+	total := cidrSize(ipNet)
+	used := new(big.Int).Sub(total, big.NewInt(free))
+	ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(used), new(big.Float).SetInt(total)).Float64()
+	return ratio * 100
+}
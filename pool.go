@@ -2,30 +2,81 @@ package CIDRGuardian
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"math/rand"
 	"net"
+	"net/netip"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+// allocRetryBackoff 是分配遇到并发冲突后首次重试前的基础等待时间
+const allocRetryBackoff = time.Millisecond
+
 // CIDRInfo 存储 CIDR 的信息
 type CIDRInfo struct {
-	CIDR        string     // CIDR 字符串表示
-	Description string     // CIDR 描述
-	IPNet       *net.IPNet // CIDR 的网络表示
+	CIDR        string           // CIDR 字符串表示
+	Description string           // CIDR 描述
+	IPNet       *net.IPNet       // CIDR 的网络表示
+	Policy      AllocationPolicy // 分配策略，由 AddCIDRWithPolicy 设置
+	SoftCap     float64          // 软上限使用率百分比，由 WithSoftCap 设置，0 表示不限制
 }
 
 // CIDRGuardian 定义一个增强的 IP 池结构体，支持多 CIDR 管理
 type CIDRGuardian struct {
 	mu           sync.RWMutex
 	storage      IPStorage
-	managedCIDRs map[string]*CIDRInfo // 管理的所有 CIDR 信息
+	managedCIDRs cidrSnapshot          // 管理的所有 CIDR 信息，写时复制，读取无需加锁
+	initialCIDRs []string              // 创建时添加的初始 CIDR
+	logger       *slog.Logger          // 可选的日志记录器
+	softDelete   bool                  // RemoveCIDR 是否归档而非直接删除
+	strictCIDR   bool                  // AddCIDR 是否拒绝设置了主机位的 CIDR
+	sem          chan struct{}         // 限制批量操作中同时进行的存储调用数量
+	descTemplate bool                  // 分配时是否展开描述中的占位符
+	hints        map[string]*net.IPNet // 每个放置提示上一次分配的块
+	maxDescLen   int                   // 描述的最大字符数，0 表示不限制
+	rejectCtrl   bool                  // 是否拒绝包含控制字符的描述
+	orphanPolicy OrphanPolicy          // 释放不属于任何管理 CIDR 的IP时的处理方式
+	readOnly     bool                  // 是否拒绝所有修改操作
+	spareCIDRs   []string              // 可用池耗尽时依次用于自动扩展的备用 CIDR
+	allocRetries int                   // 分配遇到并发冲突时的最大重试次数
+	selfTest     bool                  // 创建时是否对存储后端做自检
+	source       string                // 默认的分配来源，如进程或主机名
+	reconcileMu  sync.Mutex            // 保证 Reconcile 不会并发执行
+	allocStats   allocatorCounters     // 分配重试的统计计数
+	foldDesc     bool                  // 按描述匹配和统计时是否忽略大小写
+	ipFormat     IPFormat              // 列表和报告类方法输出IP的格式
+	perHost      bool                  // 分配 CIDR 块时是否将每个成员记录为已分配
+	hostDesc     string                // 逐个记录成员时使用的描述模板，为空时使用块的描述
+	keyHash      func(string) uint64   // AllocateByKey 使用的哈希函数，为 nil 时使用 FNV-1a
+	overlayAlloc bool                  // AddCIDR 是否允许成员中已有分配的IP
+	rateLimit    *rateLimiter          // 限制分配和释放的速率，为 nil 时不限制
+	reuseWindow  time.Duration         // GetNextAvailableIP 避开在此时长内被释放的IP，0 表示不避开
+	released     releaseTimes          // 单个IP最近一次被释放的时间
+	addProgress  checkpoints           // AddCIDRWithProgress 中途失败的 CIDR 及其检查点
+	claimTTL     time.Duration         // ClaimIP 的认领在未确认时的有效期，0 表示使用默认值
+	specialUse   bool                  // 添加地址时是否拒绝特殊用途范围
+	clock        clock                 // 与时间相关的功能读取当前时间的时钟，由 WithClock 设置
+	recoverPanic bool                  // 是否用 SafeStorage 包装存储，恢复存储方法中的 panic
+	idemKeys     idempotencyKeys       // AllocateIdempotent 记录的请求键及其分配结果
+	idemTTL      time.Duration         // AllocateIdempotent 记录的键的保留时长，0 表示使用默认值
 }
 
 // NewCIDRGuardian 初始化一个新的 CIDRGuardian
 // 可以传入零个或多个初始 CIDR
 func NewCIDRGuardian(ctx context.Context, storage IPStorage, initialCIDRs ...string) (*CIDRGuardian, error) {
+	return NewCIDRGuardianWithOptions(ctx, storage, WithInitialCIDRs(initialCIDRs...))
+}
+
+// NewCIDRGuardianWithOptions 使用可选配置项初始化一个新的 CIDRGuardian
+func NewCIDRGuardianWithOptions(ctx context.Context, storage IPStorage, opts ...Option) (*CIDRGuardian, error) {
 	// 检查上下文是否已取消
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -37,12 +88,43 @@ func NewCIDRGuardian(ctx context.Context, storage IPStorage, initialCIDRs ...str
 
 	guardian := &CIDRGuardian{
 		storage:      storage,
-		managedCIDRs: make(map[string]*CIDRInfo),
+		hints:        make(map[string]*net.IPNet),
+		allocRetries: defaultAllocRetries,
+		clock:        realClock{},
+	}
+
+	for _, opt := range opts {
+		opt(guardian)
+	}
+	if guardian.sem == nil {
+		guardian.sem = make(chan struct{}, 1)
+	}
+	// WithClock 注入的时钟同样用于内存存储记录分配时间和历史
+	if _, system := guardian.clock.(realClock); !system {
+		if memory, ok := storageAs[*MemoryIPStorage](guardian.storage); ok {
+			memory.setClock(guardian.clock.Now)
+		}
+	}
+	if guardian.recoverPanic {
+		guardian.storage = NewSafeStorage(guardian.storage)
+	}
+
+	// 自检会写入存储，只读模式下跳过
+	if guardian.selfTest && !guardian.readOnly {
+		if err := ValidateStorage(ctx, guardian.storage); err != nil {
+			return nil, err
+		}
 	}
 
-	// 初始化传入的所有 CIDR
-	for _, cidr := range initialCIDRs {
-		if err := guardian.AddCIDR(ctx, cidr, "初始 CIDR"); err != nil {
+	// 初始化传入的所有 CIDR，只读模式下只登记到管理池，不写入存储
+	for _, cidr := range guardian.initialCIDRs {
+		add := guardian.registerCIDR
+		if !guardian.readOnly {
+			add = func(ctx context.Context, cidr, description string) error {
+				return guardian.AddCIDR(ctx, cidr, description)
+			}
+		}
+		if err := add(ctx, cidr, "初始 CIDR"); err != nil {
 			return nil, fmt.Errorf("添加初始 CIDR %s 失败: %v", cidr, err)
 		}
 	}
@@ -51,109 +133,406 @@ func NewCIDRGuardian(ctx context.Context, storage IPStorage, initialCIDRs ...str
 }
 
 // AddCIDR 添加一个新的 CIDR 到管理池
-func (g *CIDRGuardian) AddCIDR(ctx context.Context, cidr, description string) error {
+// 设置了主机位的 CIDR（如 10.0.0.5/24）会被规范化为网络形式（10.0.0.0/24），
+// 启用 WithStrictCIDR 时则直接拒绝。任一成员已被分配时返回错误且不添加任何IP，
+// 启用 WithAllowOverlayAllocated 时跳过这些IP，只将其余成员加入可用池。
+// 传入 WithReserveNetworkBroadcast 时预留 IPv4 CIDR 的网络地址和广播地址
+func (g *CIDRGuardian) AddCIDR(ctx context.Context, cidr, description string, opts ...AddCIDROption) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	var cfg addCIDRConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.softCap < 0 || cfg.softCap > 100 || math.IsNaN(cfg.softCap) {
+		return fmt.Errorf("无效的软上限百分比: %v", cfg.softCap)
+	}
+	return g.addCIDR(ctx, cidr, description, PolicyAny, cfg)
+}
+
+// addCIDR 将 CIDR 的所有IP加入可用池，并以指定的分配策略登记到管理池
+func (g *CIDRGuardian) addCIDR(ctx context.Context, cidr, description string, policy AllocationPolicy, cfg addCIDRConfig) error {
 	// 检查上下文是否已取消
 	if err := ctx.Err(); err != nil {
 		return err
 	}
 
+	// 需要预留时先确认存储支持，避免添加后才失败
+	var reserver IPReservationStorage
+	if cfg.reserve {
+		var err error
+		if reserver, err = g.reserver(); err != nil {
+			return err
+		}
+	}
+
 	// 解析CIDR
 	ip, ipNet, err := net.ParseCIDR(cidr)
 	if err != nil {
 		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
 	}
 
+	// 规范化为网络形式，保证管理池的键与实际范围一致
+	if canonical := ipNet.String(); canonical != cidr {
+		if g.strictCIDR {
+			return fmt.Errorf("CIDR %s 设置了主机位，应为 %s", cidr, canonical)
+		}
+		cidr = canonical
+	}
+	if err := g.checkSpecialUse(ipNet); err != nil {
+		return err
+	}
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
 	// 检查是否已存在相同的 CIDR
-	if _, exists := g.managedCIDRs[cidr]; exists {
+	if _, exists := g.managedCIDRs.load()[cidr]; exists {
 		return fmt.Errorf("CIDR %s 已在管理池中", cidr)
 	}
 
-	// 将 CIDR 中的所有 IP 添加到可用池
+	excluded, err := g.exclusions(ctx, "AddCIDR")
+	if err != nil {
+		return err
+	}
+
+	// 将 CIDR 中除排除列表外的所有 IP 添加到可用池
 	ipList := []net.IP{}
-	for ip := cloneIP(ip.Mask(ipNet.Mask)); ipNet.Contains(ip); nextIP(ip) {
+	for ip, more := cloneIP(ip.Mask(ipNet.Mask)), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
 		ipList = append(ipList, cloneIP(ip))
 	}
 
-	// 逐个添加IP，如果失败则回滚
-	addedIPs := []string{}
+	ipStrs := make([]string, 0, len(ipList))
 	for _, ip := range ipList {
-		// 检查上下文是否已取消
-		if err := ctx.Err(); err != nil {
-			// 回滚已添加的IP
-			for _, addedIP := range addedIPs {
-				_ = g.storage.RemoveIP(ctx, addedIP)
-			}
-			return err
+		if ipStr := ip.String(); !excluded[ipStr] {
+			ipStrs = append(ipStrs, ipStr)
 		}
+	}
 
-		ipStr := ip.String()
-		err := g.storage.AddIP(ctx, ipStr)
-		if err != nil {
-			// 如果不是"IP已存在"错误，则需要回滚
+	// 添加IP，并发度受 WithMaxConcurrency 限制，如果失败则回滚
+	var addedMu sync.Mutex
+	addedIPs := []string{}
+	err = g.forEachBounded(ctx, ipStrs, func(ipStr string) error {
+		if err := g.storage.AddIP(ctx, ipStr); err != nil {
 			if !strings.Contains(err.Error(), "已被分配") && !strings.Contains(err.Error(), "already allocated") {
-				// 回滚已添加的IP
-				for _, addedIP := range addedIPs {
-					_ = g.storage.RemoveIP(ctx, addedIP)
-				}
-				return err
+				return g.wrapErr(ctx, "AddCIDR", err)
 			}
-		} else {
-			addedIPs = append(addedIPs, ipStr)
+			// 成员已被分配时默认整体失败，启用 WithAllowOverlayAllocated 时跳过该IP
+			if !g.overlayAlloc {
+				return fmt.Errorf("CIDR %s 中的 IP %s 已被分配", cidr, ipStr)
+			}
+			return nil
+		}
+		addedMu.Lock()
+		addedIPs = append(addedIPs, ipStr)
+		addedMu.Unlock()
+		return nil
+	})
+	if err == nil && cfg.reserve {
+		err = g.reserveNetworkBroadcast(ctx, reserver, ipNet, addedIPs, cfg)
+	}
+	if err != nil {
+		// 回滚已添加的IP
+		for _, addedIP := range addedIPs {
+			_ = g.storage.RemoveIP(ctx, addedIP)
 		}
+		return err
 	}
 
 	// 保存 CIDR 信息
-	g.managedCIDRs[cidr] = &CIDRInfo{
-		CIDR:        cidr,
-		Description: description,
-		IPNet:       ipNet,
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		m[cidr] = &CIDRInfo{
+			CIDR:        cidr,
+			Description: description,
+			IPNet:       ipNet,
+			Policy:      policy,
+			SoftCap:     cfg.softCap,
+		}
+	})
+
+	return nil
+}
+
+// AddCIDRs 批量添加 CIDR（CIDR -> 描述）到管理池
+// 先整体检查格式以及彼此之间、与已管理 CIDR 之间的重叠，再通过一次批量存储调用添加所有IP；
+// 任一步失败时不会添加任何 CIDR。与 AddCIDR 一样，成员已被分配时默认失败，启用 WithAllowOverlayAllocated 时跳过
+func (g *CIDRGuardian) AddCIDRs(ctx context.Context, cidrs map[string]string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 解析并规范化所有 CIDR
+	infos := make(map[string]*CIDRInfo, len(cidrs))
+	for cidr, description := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+		}
+		canonical := ipNet.String()
+		if canonical != cidr && g.strictCIDR {
+			return fmt.Errorf("CIDR %s 设置了主机位，应为 %s", cidr, canonical)
+		}
+		if err := g.checkSpecialUse(ipNet); err != nil {
+			return err
+		}
+		if _, exists := infos[canonical]; exists {
+			return fmt.Errorf("CIDR %s 与 %s 重叠", cidr, canonical)
+		}
+		infos[canonical] = &CIDRInfo{CIDR: canonical, Description: description, IPNet: ipNet}
+	}
+	keys := make([]string, 0, len(infos))
+	for key := range infos {
+		keys = append(keys, key)
+	}
+	sortCIDRStrings(keys)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// 检查新 CIDR 之间以及与已管理 CIDR 之间是否重叠
+	for i, key := range keys {
+		ipNet := infos[key].IPNet
+		for _, other := range keys[i+1:] {
+			if cidrsOverlap(ipNet, infos[other].IPNet) {
+				return fmt.Errorf("CIDR %s 与 %s 重叠", key, other)
+			}
+		}
+		for managed, info := range g.managedCIDRs.load() {
+			if cidrsOverlap(ipNet, info.IPNet) {
+				return fmt.Errorf("CIDR %s 与已管理的 CIDR %s 重叠", key, managed)
+			}
+		}
+	}
+
+	excluded, err := g.exclusions(ctx, "AddCIDRs")
+	if err != nil {
+		return err
+	}
+
+	allocated, err := g.allocatedMembers(ctx, "AddCIDRs")
+	if err != nil {
+		return err
+	}
+
+	// 枚举除排除列表外的所有 IP，一次性加入可用池；成员已被分配时与 AddCIDR 一样整体失败
+	ipStrs := []string{}
+	for _, key := range keys {
+		ipNet := infos[key].IPNet
+		for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+			ipStr := ip.String()
+			if excluded[ipStr] {
+				continue
+			}
+			if _, ok := allocated[ipStr]; ok {
+				return fmt.Errorf("CIDR %s 中的 IP %s 已被分配", key, ipStr)
+			}
+			ipStrs = append(ipStrs, ipStr)
+		}
+	}
+
+	if _, err := g.storage.BulkAddIP(ctx, ipStrs); err != nil {
+		return g.wrapErr(ctx, "AddCIDRs", err)
 	}
 
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		for _, key := range keys {
+			m[key] = infos[key]
+		}
+	})
 	return nil
 }
 
+// allocatedMembers 返回批量添加前用于检查成员的已分配IP；启用 WithAllowOverlayAllocated 时不检查，返回 nil
+func (g *CIDRGuardian) allocatedMembers(ctx context.Context, op string) (map[string]string, error) {
+	if g.overlayAlloc {
+		return nil, nil
+	}
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, op, err)
+	}
+	return allocated, nil
+}
+
+// cidrsOverlap 检查两个网络是否有重叠的地址
+func cidrsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
 // removeCIDRWithoutLock 内部方法，从管理池中移除 CIDR，不加锁
+// 启用软删除时，会将 CIDR 定义及其成员状态归档以便恢复
 func (g *CIDRGuardian) removeCIDRWithoutLock(ctx context.Context, cidr string) error {
-	cidrInfo, exists := g.managedCIDRs[cidr]
+	cidrInfo, exists := g.managedCIDRs.load()[cidr]
 	if !exists {
 		return fmt.Errorf("CIDR %s 不在管理池中", cidr)
 	}
 
+	var archiver CIDRArchiveStorage
+	var archive *CIDRArchive
+	var allocated map[string]string
+	var blocks blockIndex
+	if g.softDelete {
+		var ok bool
+		if archiver, ok = storageAs[CIDRArchiveStorage](g.storage); !ok {
+			return fmt.Errorf("存储后端不支持 CIDR 归档")
+		}
+
+		var err error
+		if allocated, err = g.storage.GetAllocatedIPs(ctx); err != nil {
+			return g.wrapErr(ctx, "RemoveCIDR", err)
+		}
+		if blocks, err = g.blockIndex(ctx, "RemoveCIDR"); err != nil {
+			return err
+		}
+		archive = &CIDRArchive{
+			CIDR:         cidr,
+			Description:  cidrInfo.Description,
+			AllocatedIPs: make(map[string]string),
+		}
+	}
+
 	// 从可用池中移除 CIDR 中的 IP
-	for ip := cloneIP(cidrInfo.IPNet.IP.Mask(cidrInfo.IPNet.Mask)); cidrInfo.IPNet.Contains(ip); nextIP(ip) {
+	removed := []string{}
+	for ip, more := cloneIP(cidrInfo.IPNet.IP.Mask(cidrInfo.IPNet.Mask)), true; more && cidrInfo.IPNet.Contains(ip); more = !nextIP(ip) {
 		// 检查上下文是否已取消
 		if err := ctx.Err(); err != nil {
 			return err
 		}
 
 		// 尝试移除 IP，忽略不存在的 IP 错误
-		available, err := g.storage.IsIPAvailable(ctx, ip.String())
+		ipStr := ip.String()
+		available, err := g.storage.IsIPAvailable(ctx, ipStr)
 		if err != nil {
-			return err
+			return g.wrapErr(ctx, "RemoveCIDR", err)
 		}
 
 		if available {
-			if err := g.storage.RemoveIP(ctx, ip.String()); err != nil {
-				return err
+			if err := g.storage.RemoveIP(ctx, ipStr); err != nil {
+				return g.wrapErr(ctx, "RemoveCIDR", err)
+			}
+			removed = append(removed, ipStr)
+		} else if desc, isAllocated := allocated[ipStr]; isAllocated {
+			// 归档中的块保持 "cidr - 描述" 格式
+			if block, ok := blocks[ipStr]; ok {
+				desc = packBlockDescription(block.cidr, block.desc)
+			}
+			archive.AllocatedIPs[ipStr] = desc
+		}
+	}
+
+	// 保存归档记录，失败时将已移除的IP放回可用池
+	if archive != nil {
+		archive.AvailableIPs = removed
+		if err := archiver.ArchiveCIDR(ctx, *archive); err != nil {
+			for _, ipStr := range removed {
+				_ = g.storage.AddIP(ctx, ipStr)
 			}
+			return g.wrapErr(ctx, "RemoveCIDR", err)
 		}
 	}
 
 	// 从管理的 CIDR 列表中移除
-	delete(g.managedCIDRs, cidr)
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		delete(m, cidr)
+	})
 
 	return nil
 }
 
 // RemoveCIDR 从管理池中移除一个 CIDR
 func (g *CIDRGuardian) RemoveCIDR(ctx context.Context, cidr string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.removeCIDRWithoutLock(ctx, canonicalCIDR(cidr))
+}
+
+// RestoreCIDR 恢复一个被软删除的 CIDR
+// 归档时可用的IP重新加入可用池，此后已被分配的IP保持分配状态
+func (g *CIDRGuardian) RestoreCIDR(ctx context.Context, cidr string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	archiver, ok := storageAs[CIDRArchiveStorage](g.storage)
+	if !ok {
+		return fmt.Errorf("存储后端不支持 CIDR 归档")
+	}
+	cidr = canonicalCIDR(cidr)
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	return g.removeCIDRWithoutLock(ctx, cidr)
+	if _, exists := g.managedCIDRs.load()[cidr]; exists {
+		return fmt.Errorf("CIDR %s 已在管理池中", cidr)
+	}
+
+	archive, err := archiver.GetArchivedCIDR(ctx, cidr)
+	if err != nil {
+		return g.wrapErr(ctx, "RestoreCIDR", err)
+	}
+
+	_, ipNet, err := net.ParseCIDR(archive.CIDR)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", archive.CIDR, err)
+	}
+
+	excluded, err := g.exclusions(ctx, "RestoreCIDR")
+	if err != nil {
+		return err
+	}
+
+	// 将归档的可用IP重新加入可用池，跳过归档后被排除的IP，失败时回滚
+	addedIPs := []string{}
+	for _, ipStr := range archive.AvailableIPs {
+		if excluded[ipStr] {
+			continue
+		}
+		if err := g.storage.AddIP(ctx, ipStr); err != nil {
+			// 忽略"IP已存在"错误
+			if strings.Contains(err.Error(), "已被分配") || strings.Contains(err.Error(), "already allocated") {
+				continue
+			}
+			for _, addedIP := range addedIPs {
+				_ = g.storage.RemoveIP(ctx, addedIP)
+			}
+			return g.wrapErr(ctx, "RestoreCIDR", err)
+		}
+		addedIPs = append(addedIPs, ipStr)
+	}
+
+	if err := archiver.DeleteArchivedCIDR(ctx, cidr); err != nil {
+		for _, addedIP := range addedIPs {
+			_ = g.storage.RemoveIP(ctx, addedIP)
+		}
+		return g.wrapErr(ctx, "RestoreCIDR", err)
+	}
+
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		m[cidr] = &CIDRInfo{
+			CIDR:        cidr,
+			Description: archive.Description,
+			IPNet:       ipNet,
+		}
+	})
+
+	return nil
 }
 
 // GetManagedCIDRs 获取所有管理的 CIDR 及其描述
@@ -163,17 +542,52 @@ func (g *CIDRGuardian) GetManagedCIDRs(ctx context.Context) (map[string]string,
 		return nil, err
 	}
 
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-
 	result := make(map[string]string)
-	for cidr, info := range g.managedCIDRs {
+	for cidr, info := range g.managedCIDRs.load() {
 		result[cidr] = info.Description
 	}
 
 	return result, nil
 }
 
+// UpdateCIDRDescription 更新管理 CIDR 的描述，只修改元数据，不涉及任何 IP
+func (g *CIDRGuardian) UpdateCIDRDescription(ctx context.Context, cidr, description string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := canonicalCIDR(cidr)
+	cidrInfo, exists := g.managedCIDRs.load()[key]
+	if !exists {
+		return fmt.Errorf("CIDR %s 不在管理池中", cidr)
+	}
+
+	// 已发布的 CIDRInfo 可能正被无锁读取，修改副本后替换
+	updated := *cidrInfo
+	updated.Description = description
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		m[key] = &updated
+	})
+	return nil
+}
+
+// GetManagedCIDRList 获取所有管理的 CIDR，按网络地址数值顺序排序
+func (g *CIDRGuardian) GetManagedCIDRList(ctx context.Context) ([]string, error) {
+	managed, err := g.GetManagedCIDRs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sortedCIDRKeys(managed), nil
+}
+
 // cloneIP 克隆一个IP
 func cloneIP(ip net.IP) net.IP {
 	clone := make(net.IP, len(ip))
@@ -181,23 +595,47 @@ func cloneIP(ip net.IP) net.IP {
 	return clone
 }
 
-// nextIP 计算下一个IP
-func nextIP(ip net.IP) {
+// canonicalCIDR 返回 CIDR 的网络形式，无法解析时原样返回
+func canonicalCIDR(cidr string) string {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+	return ipNet.String()
+}
+
+// cidrSize 计算 CIDR 包含的地址数量
+func cidrSize(ipNet *net.IPNet) *big.Int {
+	ones, bits := ipNet.Mask.Size()
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+}
+
+// nextIP 将 ip 原地加一，越过全 1 地址回绕到全 0 时返回 true
+// 遍历 CIDR 的循环需要在回绕时停止，否则广播地址为全 1 地址的大块（如 0.0.0.0/0）会无限循环
+func nextIP(ip net.IP) (wrapped bool) {
 	for i := len(ip) - 1; i >= 0; i-- {
 		ip[i]++
 		if ip[i] > 0 {
-			break
+			return false
 		}
 	}
+	return true
 }
 
 // AddSingleIP 添加单个IP到管理池
 func (g *CIDRGuardian) AddSingleIP(ctx context.Context, ip string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
 	// 解析 IP
 	parsedIP := net.ParseIP(ip)
 	if parsedIP == nil {
 		return fmt.Errorf("无效的IP地址格式: %s", ip)
 	}
+	if g.specialUse && IsSpecialUse(parsedIP) {
+		return fmt.Errorf("IP %s %w", parsedIP.String(), ErrSpecialUse)
+	}
 
 	// 检查 IP 是否在任何管理的 CIDR 范围内
 	g.mu.RLock()
@@ -208,245 +646,1814 @@ func (g *CIDRGuardian) AddSingleIP(ctx context.Context, ip string) error {
 		return err
 	}
 
-	// 直接添加到可用池
-	return g.storage.AddIP(ctx, ip)
+	excluded, err := g.exclusions(ctx, "AddSingleIP")
+	if err != nil {
+		return err
+	}
+	if excluded[parsedIP.String()] {
+		return fmt.Errorf("IP %s 在排除列表中", parsedIP.String())
+	}
+
+	// 直接添加到可用池，使用标准形式避免同一地址以不同写法重复存在
+	return g.wrapErr(ctx, "AddSingleIP", g.storage.AddIP(ctx, parsedIP.String()))
 }
 
 // RemoveSingleIP 从管理池中移除单个IP
 func (g *CIDRGuardian) RemoveSingleIP(ctx context.Context, ip string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
 	// 检查上下文是否已取消
 	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	return g.storage.RemoveIP(ctx, ip)
+	return g.wrapErr(ctx, "RemoveSingleIP", g.storage.RemoveIP(ctx, normalizeIP(ip)))
 }
 
-// ExpandPool 扩展IP池，添加新的CIDR
-func (g *CIDRGuardian) ExpandPool(ctx context.Context, cidr string) error {
-	// 解析新CIDR
-	_, newNet, err := net.ParseCIDR(cidr)
+// RemoveIPsMatching 从可用池中移除所有匹配通配符模式的IP，返回移除的数量
+// 模式为 IPv4 点分形式，末尾连续的若干段可以是 *（如 10.0.5.*、10.0.*.*），对应一段连续的地址；
+// 已分配的IP不受影响。不能映射为连续范围的模式（如 10.*.5.*）会被拒绝，移除失败时回滚
+func (g *CIDRGuardian) RemoveIPsMatching(ctx context.Context, pattern string) (int, error) {
+	if g.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	ipNet, err := globToIPNet(pattern)
 	if err != nil {
-		return fmt.Errorf("无效的CIDR格式: %v", err)
+		return 0, err
 	}
 
-	// 将新CIDR中的所有IP添加到可用池
-	for ip := cloneIP(newNet.IP.Mask(newNet.Mask)); newNet.Contains(ip); nextIP(ip) {
-		// 检查上下文是否已取消
-		if err := ctx.Err(); err != nil {
-			return err
-		}
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return 0, g.wrapErr(ctx, "RemoveIPsMatching", err)
+	}
 
-		// 检查IP是否已在任何已分配的CIDR中
-		allocated, err := g.storage.GetAllocatedIPs(ctx)
-		if err != nil {
-			return err
+	removed := []string{}
+	for _, ipStr := range availableIPs {
+		ip := net.ParseIP(ipStr)
+		if ip == nil || !ipNet.Contains(ip) {
+			continue
 		}
-
-		if _, exists := allocated[ip.String()]; !exists {
-			if err := g.storage.AddIP(ctx, ip.String()); err != nil {
-				return err
+		if err := g.storage.RemoveIP(ctx, ipStr); err != nil {
+			// 回滚已移除的IP
+			for _, removedIP := range removed {
+				_ = g.storage.AddIP(ctx, removedIP)
 			}
+			return 0, g.wrapErr(ctx, "RemoveIPsMatching", err)
 		}
+		removed = append(removed, ipStr)
 	}
 
-	// 将新CIDR添加到管理池中
-	return g.AddCIDR(ctx, cidr, "扩展的网段")
-}
-
-// AllocateIP 分配一个指定的IP
-func (g *CIDRGuardian) AllocateIP(ctx context.Context, ipStr string, description string) error {
-	return g.storage.AllocateIP(ctx, ipStr, description)
+	return len(removed), nil
 }
 
-// GetNextAvailableIP 获取下一个可用的IP
-func (g *CIDRGuardian) GetNextAvailableIP(ctx context.Context, description string) (string, error) {
-	ips, err := g.storage.GetAvailableIPs(ctx)
-	if err != nil {
-		return "", err
+// globToIPNet 将 10.0.5.* 形式的通配符模式转换为对应的网络
+func globToIPNet(pattern string) (*net.IPNet, error) {
+	parts := strings.Split(pattern, ".")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("无效的IP匹配模式 %s: 需要 4 段点分形式", pattern)
 	}
 
-	if len(ips) == 0 {
-		return "", fmt.Errorf("没有可用的IP")
+	ip := make(net.IP, 4)
+	bits := 32
+	for i, part := range parts {
+		if part == "*" {
+			if bits == 32 {
+				bits = i * 8
+			}
+			continue
+		}
+		// 通配符之后不能再出现具体的值，否则不是连续范围
+		if bits != 32 {
+			return nil, fmt.Errorf("无效的IP匹配模式 %s: 通配符只能出现在末尾", pattern)
+		}
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 || value > 255 || strconv.Itoa(value) != part {
+			return nil, fmt.Errorf("无效的IP匹配模式 %s: 无效的段 %q", pattern, part)
+		}
+		ip[i] = byte(value)
 	}
 
-	ip := ips[0]
-	err = g.storage.AllocateIP(ctx, ip, description)
-	if err != nil {
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, 32)}, nil
+}
+
+// ExpandPool 扩展IP池，添加新的CIDR
+// 已分配的IP只读取一次并被跳过，新CIDR中的其余IP通过一次批量存储调用整体加入可用池，任一步失败时不会留下部分扩展
+func (g *CIDRGuardian) ExpandPool(ctx context.Context, cidr string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 解析新CIDR
+	_, newNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式: %v", err)
+	}
+	if canonical := newNet.String(); canonical != cidr {
+		if g.strictCIDR {
+			return fmt.Errorf("CIDR %s 设置了主机位，应为 %s", cidr, canonical)
+		}
+		cidr = canonical
+	}
+	if err := g.checkSpecialUse(newNet); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.managedCIDRs.load()[cidr]; exists {
+		return fmt.Errorf("CIDR %s 已在管理池中", cidr)
+	}
+
+	// 一次性读取已分配的IP，避免在循环中反复全量查询
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return g.wrapErr(ctx, "ExpandPool", err)
+	}
+	excluded, err := g.exclusions(ctx, "ExpandPool")
+	if err != nil {
+		return err
+	}
+
+	// 枚举新CIDR中的所有IP，跳过已分配或被排除的IP
+	ipStrs := []string{}
+	for ip, more := cloneIP(newNet.IP), true; more && newNet.Contains(ip); more = !nextIP(ip) {
+		ipStr := ip.String()
+		if _, exists := allocated[ipStr]; exists || excluded[ipStr] {
+			continue
+		}
+		ipStrs = append(ipStrs, ipStr)
+	}
+
+	// 批量添加整体成功或失败，已在可用池中的IP保持不变
+	if _, err := g.storage.BulkAddIP(ctx, ipStrs); err != nil {
+		return g.wrapErr(ctx, "ExpandPool", err)
+	}
+
+	// 将新CIDR添加到管理池中
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		m[cidr] = &CIDRInfo{CIDR: cidr, Description: "扩展的网段", IPNet: newNet, Policy: PolicyAny}
+	})
+	return nil
+}
+
+// AllocateIP 分配一个指定的IP
+func (g *CIDRGuardian) AllocateIP(ctx context.Context, ipStr string, description string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return err
+	}
+
+	ipStr = normalizeIP(ipStr)
+	if err := g.checkSingleIPPolicy(ipStr); err != nil {
+		return err
+	}
+	description = g.expandIPDescription(description, ipStr)
+	if err := g.validateDescription(description); err != nil {
+		return err
+	}
+	if err := g.storage.AllocateIP(ctx, ipStr, description); err != nil {
+		return g.wrapErr(ctx, "AllocateIP", err)
+	}
+	g.stampSource(ctx, "AllocateIP", ipStr)
+	return nil
+}
+
+// AllocateIPWithParent 与 AllocateIP 相同，并返回包含该IP的管理 CIDR 的信息，省去之后再查找一次
+// IP 不在任何管理的 CIDR 范围内时返回错误且不分配；管理 CIDR 重叠时返回按数值顺序排在最前的 CIDR
+func (g *CIDRGuardian) AllocateIPWithParent(ctx context.Context, ip, description string) (CIDRInfo, error) {
+	if g.readOnly {
+		return CIDRInfo{}, ErrReadOnly
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return CIDRInfo{}, fmt.Errorf("无效的IP地址格式: %s", ip)
+	}
+	parent, exists := g.managedCIDRs.load()[g.managedCIDRFor(parsedIP)]
+	if !exists {
+		return CIDRInfo{}, fmt.Errorf("IP %s 不在任何管理的 CIDR 范围内", ip)
+	}
+
+	if err := g.AllocateIP(ctx, ip, description); err != nil {
+		return CIDRInfo{}, err
+	}
+
+	// 返回副本，避免调用方修改管理池中的网络
+	info := *parent
+	info.IPNet = &net.IPNet{IP: cloneIP(parent.IPNet.IP), Mask: append(net.IPMask(nil), parent.IPNet.Mask...)}
+	return info, nil
+}
+
+// UpdateDescription 更新已分配IP的描述，不释放也不重新分配该IP
+// 传入 CIDR 时更新通过 AllocateCIDR 等分配的整块描述，旧版存储中的块保留 "CIDR - " 前缀
+func (g *CIDRGuardian) UpdateDescription(ctx context.Context, ip string, description string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var ipStr string
+	if strings.Contains(ip, "/") {
+		_, ipNet, err := net.ParseCIDR(ip)
+		if err != nil {
+			return fmt.Errorf("无效的CIDR格式 %s: %v", ip, err)
+		}
+		description = g.expandDescription(description, ipNet.IP, ipNet.String())
+		if err := g.validateDescription(description); err != nil {
+			return err
+		}
+		ipStr = ipNet.IP.String()
+		// 以块记录的分配保存原样的描述，旧版记录保持 "cidr - 描述" 格式
+		blocks, err := g.blockIndex(ctx, "UpdateDescription")
+		if err != nil {
+			return err
+		}
+		if block, ok := blocks[ipStr]; !ok || block.cidr != ipNet.String() {
+			description = packBlockDescription(ipNet.String(), description)
+		}
+	} else {
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil {
+			return fmt.Errorf("无效的IP地址格式: %s", ip)
+		}
+		ipStr = parsedIP.String()
+		description = g.expandIPDescription(description, ipStr)
+		if err := g.validateDescription(description); err != nil {
+			return err
+		}
+	}
+
+	return g.wrapErr(ctx, "UpdateDescription", g.storage.UpdateDescription(ctx, ipStr, description))
+}
+
+// ImportAllocations 将已在使用的IP及描述直接导入已分配池
+// 与 AllocateIP 不同，IP 无需先存在于可用池中；任一 IP 无效或已被分配时整体失败
+func (g *CIDRGuardian) ImportAllocations(ctx context.Context, allocations map[string]string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 逐个校验IP格式，并转换为标准形式
+	normalized := make(map[string]string, len(allocations))
+	for ip, desc := range allocations {
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil {
+			return fmt.Errorf("无效的IP地址格式: %s", ip)
+		}
+		ipStr := parsedIP.String()
+		if _, exists := normalized[ipStr]; exists {
+			return fmt.Errorf("IP %s 重复导入", ipStr)
+		}
+		if err := g.validateDescription(desc); err != nil {
+			return fmt.Errorf("IP %s: %w", ipStr, err)
+		}
+		normalized[ipStr] = desc
+	}
+
+	if err := g.storage.ImportAllocations(ctx, normalized); err != nil {
+		return g.wrapErr(ctx, "ImportAllocations", err)
+	}
+	ips := make([]string, 0, len(normalized))
+	for ip := range normalized {
+		ips = append(ips, ip)
+	}
+	g.stampSource(ctx, "ImportAllocations", ips...)
+	return nil
+}
+
+// GetNextAvailableIP 获取下一个可用的IP（数值最小的可用IP）
+func (g *CIDRGuardian) GetNextAvailableIP(ctx context.Context, description string) (string, error) {
+	if g.readOnly {
+		return "", ErrReadOnly
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return "", err
+	}
+
+	return g.nextAvailableIP(ctx, "GetNextAvailableIP", description, false)
+}
+
+// GetLastAvailableIP 分配数值最大的可用IP，与 GetNextAvailableIP 相对，适合将高位地址留给另一类主机
+func (g *CIDRGuardian) GetLastAvailableIP(ctx context.Context, description string) (string, error) {
+	if g.readOnly {
+		return "", ErrReadOnly
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return "", err
+	}
+
+	return g.nextAvailableIP(ctx, "GetLastAvailableIP", description, true)
+}
+
+// GetNextAvailableIPTyped 与 GetNextAvailableIP 相同，但返回 net.IP；IPv4 地址为 4 字节形式
+func (g *CIDRGuardian) GetNextAvailableIPTyped(ctx context.Context, description string) (net.IP, error) {
+	if g.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	ip, err := g.nextAvailableIP(ctx, "GetNextAvailableIPTyped", description, false)
+	if err != nil {
+		return nil, err
+	}
+	return toNetIP(ip), nil
+}
+
+// nextAvailableIP 分配数值最小的可用IP，last 为 true 时分配数值最大的可用IP
+// 选中的IP被并发分配抢先占用时重新查找，最多重试 allocRetries 次
+func (g *CIDRGuardian) nextAvailableIP(ctx context.Context, op, description string, last bool) (string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	g.allocStats.total.Add(1)
+	for attempt := 0; ; attempt++ {
+		ip, err := g.tryNextAvailableIP(ctx, op, description, last)
+		if !g.shouldRetry(err, attempt) {
+			return ip, err
+		}
+		if err := retryBackoff(ctx, attempt); err != nil {
+			return "", err
+		}
+	}
+}
+
+// tryNextAvailableIP 查找并分配一次数值最小（或最大）的可用IP
+func (g *CIDRGuardian) tryNextAvailableIP(ctx context.Context, op, description string, last bool) (string, error) {
+	ips, err := g.availableIPs(ctx, op)
+	if err != nil {
+		return "", err
+	}
+	ips = g.excludePolicy(ips, PolicyBlockOnly)
+	ips, capErr := g.excludeCapped(ips)
+
+	// 可用池耗尽（或只剩达到软上限的 CIDR）时尝试用备用 CIDR 扩展一次
+	if len(ips) == 0 {
+		expanded, err := g.autoExpand(ctx)
+		if err != nil {
+			return "", err
+		}
+		if expanded {
+			if ips, err = g.availableIPs(ctx, op); err != nil {
+				return "", err
+			}
+			ips, capErr = g.excludeCapped(g.excludePolicy(ips, PolicyBlockOnly))
+		}
+	}
+	if capErr != nil {
+		return "", capErr
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("没有可用的IP")
+	}
+
+	return g.allocateCandidate(ctx, op, description, ips, last)
+}
+
+// allocateCandidate 从按数值排序的候选IP中选择数值最小（last 为 true 时最大）的一个并分配，
+// 启用 WithAvoidRecentReuse 时优先选择近期未被释放的IP
+func (g *CIDRGuardian) allocateCandidate(ctx context.Context, op, description string, ips []string, last bool) (string, error) {
+	ip := ips[0]
+	if last {
+		ip = ips[len(ips)-1]
+	} else if g.reuseWindow > 0 {
+		ip = g.released.pick(ips, g.clock.Now(), g.reuseWindow)
+	}
+	description = g.expandIPDescription(description, ip)
+	if err := g.validateDescription(description); err != nil {
+		return "", err
+	}
+	if err := g.storage.AllocateIP(ctx, ip, description); err != nil {
+		return "", g.wrapErr(ctx, op, err)
+	}
+	g.stampSource(ctx, op, ip)
+
+	return ip, nil
+}
+
+// GetNextAvailableIPInCIDR 与 GetNextAvailableIP 相同，但只从指定的管理 CIDR 中分配数值最小的可用IP
+// CIDR 不在管理池中或其中没有可用的IP时返回错误；达到软上限时返回 ErrSoftCapReached。不会触发 WithAutoExpand 的自动扩展
+func (g *CIDRGuardian) GetNextAvailableIPInCIDR(ctx context.Context, cidr, description string) (string, error) {
+	if g.readOnly {
+		return "", ErrReadOnly
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("无效的CIDR格式: %v", err)
+	}
+	cidrInfo, exists := g.managedCIDRs.load()[ipNet.String()]
+	if !exists {
+		return "", fmt.Errorf("CIDR %s 不在管理池中", cidr)
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return "", err
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	g.allocStats.total.Add(1)
+	for attempt := 0; ; attempt++ {
+		ip, err := g.tryNextAvailableIPInCIDR(ctx, cidrInfo, description)
+		if !g.shouldRetry(err, attempt) {
+			return ip, err
+		}
+		if err := retryBackoff(ctx, attempt); err != nil {
+			return "", err
+		}
+	}
+}
+
+// tryNextAvailableIPInCIDR 查找并分配一次管理 CIDR 中数值最小的可用IP
+func (g *CIDRGuardian) tryNextAvailableIPInCIDR(ctx context.Context, cidrInfo *CIDRInfo, description string) (string, error) {
+	ips, err := g.availableIPs(ctx, "GetNextAvailableIPInCIDR")
+	if err != nil {
+		return "", err
+	}
+
+	within := []string{}
+	for _, ipStr := range ips {
+		if ip := net.ParseIP(ipStr); ip != nil && cidrInfo.IPNet.Contains(ip) {
+			within = append(within, ipStr)
+		}
+	}
+	if within, err = g.excludeCapped(g.excludePolicy(within, PolicyBlockOnly)); err != nil {
 		return "", err
 	}
+	if len(within) == 0 {
+		return "", fmt.Errorf("CIDR %s 中没有可用的IP", cidrInfo.CIDR)
+	}
+
+	return g.allocateCandidate(ctx, "GetNextAvailableIPInCIDR", description, within, false)
+}
+
+// autoExpand 取出下一个通过 WithAutoExpand 配置的备用 CIDR 并扩展到IP池
+// 没有剩余的备用 CIDR 时返回 false；扩展失败时将该 CIDR 放回备用列表
+func (g *CIDRGuardian) autoExpand(ctx context.Context) (bool, error) {
+	g.mu.Lock()
+	if len(g.spareCIDRs) == 0 {
+		g.mu.Unlock()
+		return false, nil
+	}
+	spare := g.spareCIDRs[0]
+	g.spareCIDRs = g.spareCIDRs[1:]
+	g.mu.Unlock()
+
+	if err := g.ExpandPool(ctx, spare); err != nil {
+		g.mu.Lock()
+		g.spareCIDRs = append([]string{spare}, g.spareCIDRs...)
+		g.mu.Unlock()
+		return false, fmt.Errorf("自动扩展 CIDR %s 失败: %w", spare, err)
+	}
+	return true, nil
+}
+
+// GetAvailableIPs 获取所有可用的IP，按数值顺序排列，按 WithIPFormat 设置的格式输出
+func (g *CIDRGuardian) GetAvailableIPs(ctx context.Context) ([]string, error) {
+	ips, err := g.availableIPs(ctx, "GetAvailableIPs")
+	if err != nil {
+		return nil, err
+	}
+	return g.formatIPs(ips), nil
+}
+
+// GetAvailableIPsTyped 与 GetAvailableIPs 相同，但返回 net.IP，避免调用方再次解析
+// IPv4 地址为 4 字节形式，IPv6 地址为 16 字节形式；无法解析的条目会被跳过
+func (g *CIDRGuardian) GetAvailableIPsTyped(ctx context.Context) ([]net.IP, error) {
+	ips, err := g.availableIPs(ctx, "GetAvailableIPsTyped")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]net.IP, 0, len(ips))
+	for _, ipStr := range ips {
+		if ip := toNetIP(ipStr); ip != nil {
+			result = append(result, ip)
+		}
+	}
+	return result, nil
+}
+
+// GetAvailableIPsWithCIDR 获取所有可用的IP及其所属的管理 CIDR（IP -> CIDR）
+// 管理 CIDR 有重叠时归属于前缀最长（最具体）的 CIDR，不属于任何管理 CIDR 的IP对应空字符串
+func (g *CIDRGuardian) GetAvailableIPsWithCIDR(ctx context.Context) (map[string]string, error) {
+	ips, err := g.availableIPs(ctx, "GetAvailableIPsWithCIDR")
+	if err != nil {
+		return nil, err
+	}
+
+	managed := g.cidrsBySpecificity()
+	result := make(map[string]string, len(ips))
+	for _, ipStr := range ips {
+		owner := ""
+		if cidrInfo := mostSpecificCIDR(managed, ipStr); cidrInfo != nil {
+			owner = g.formatIP(cidrInfo.CIDR)
+		}
+		result[g.formatIP(ipStr)] = owner
+	}
+	return result, nil
+}
+
+// cidrsBySpecificity 返回按前缀从长到短排序的管理 CIDR，前缀相同时按字符串排序
+func (g *CIDRGuardian) cidrsBySpecificity() []*CIDRInfo {
+	cidrs := g.managedCIDRs.load()
+	managed := make([]*CIDRInfo, 0, len(cidrs))
+	for _, cidrInfo := range cidrs {
+		managed = append(managed, cidrInfo)
+	}
+	sort.Slice(managed, func(i, j int) bool {
+		a, _ := managed[i].IPNet.Mask.Size()
+		b, _ := managed[j].IPNet.Mask.Size()
+		if a != b {
+			return a > b
+		}
+		return managed[i].CIDR < managed[j].CIDR
+	})
+	return managed
+}
+
+// mostSpecificCIDR 返回 cidrsBySpecificity 结果中第一个包含IP的 CIDR，即最具体的匹配，不存在时返回 nil
+func mostSpecificCIDR(managed []*CIDRInfo, ipStr string) *CIDRInfo {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil
+	}
+	for _, cidrInfo := range managed {
+		if cidrInfo.IPNet.Contains(ip) {
+			return cidrInfo
+		}
+	}
+	return nil
+}
+
+// availableIPs 从存储获取可用IP并按数值排序
+func (g *CIDRGuardian) availableIPs(ctx context.Context, op string) ([]string, error) {
+	ips, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, op, err)
+	}
+
+	// 存储按字典序返回，这里按数值排序以保证确定的顺序
+	sortIPStrings(ips)
+	return ips, nil
+}
+
+// normalizeIP 将IP字符串转换为标准形式，IPv4 映射的 IPv6 地址（如 ::ffff:192.168.0.1）转换为 IPv4 形式
+// 无法解析的字符串原样返回，由存储层报告错误
+func normalizeIP(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return s
+}
+
+// toNetIP 将IP字符串解析为 net.IP，IPv4 地址转换为 4 字节形式以保留地址族信息
+func toNetIP(s string) net.IP {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// AllocateCIDR 从IP池中分配一个指定大小的CIDR
+// /31 按 RFC 3021 作为点对点链路处理，两个地址都归属于该块，不保留网络/广播地址
+func (g *CIDRGuardian) AllocateCIDR(ctx context.Context, bits int, description string) (string, error) {
+	if g.readOnly {
+		return "", ErrReadOnly
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return "", err
+	}
+
+	// 1. 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// 2. 验证位数参数
+	if bits < 0 || bits > 32 {
+		return "", fmt.Errorf("无效的子网掩码位数: %d", bits)
+	}
+
+	// 与其他分配并发时选中的块可能被抢先占用，此时排除该块重新查找，最多重试 allocRetries 次
+	excluded := make(map[string]bool)
+	g.allocStats.total.Add(1)
+	for attempt := 0; ; attempt++ {
+		cidr, err := g.tryAllocateCIDR(ctx, bits, description, excluded)
+		if !g.shouldRetry(err, attempt) {
+			return cidr, err
+		}
+		excluded[cidr] = true
+
+		if err := retryBackoff(ctx, attempt); err != nil {
+			return "", err
+		}
+	}
+}
+
+// retryBackoff 在第 attempt 次重试前带抖动地退避，等待期间上下文取消时返回其错误
+func retryBackoff(ctx context.Context, attempt int) error {
+	backoff := allocRetryBackoff << attempt
+	backoff += time.Duration(rand.Int63n(int64(backoff)))
+	select {
+	case <-time.After(backoff):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryAllocateCIDR 查找并分配一个指定大小的CIDR，跳过 excluded 中的块
+// 选中的块在查找之后被其他调用占用时，返回包装了 ErrIPUnavailable 的错误以及该块
+func (g *CIDRGuardian) tryAllocateCIDR(ctx context.Context, bits int, description string, excluded map[string]bool) (string, error) {
+	// 3. 获取所有可用IP
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return "", g.wrapErr(ctx, "AllocateCIDR", err)
+	}
+	if availableIPs, err = g.excludeCapped(availableIPs); err != nil {
+		return "", err
+	}
+
+	// 4. 计算需要的IP数量
+	size := 1 << (32 - bits)
+
+	// 5. 检查是否有足够的IP
+	if len(availableIPs) < size {
+		return "", fmt.Errorf("没有足够的IP可以分配 /%d 子网", bits)
+	}
+
+	// 6. 按数值对IP进行排序以确保一致性
+	sortIPStrings(availableIPs)
+	snapshot := make(map[string]bool, len(availableIPs))
+	for _, ipStr := range availableIPs {
+		snapshot[ipStr] = true
+	}
+
+	// 7. 查找网络对齐的起始IP
+	var startIP string
+	var candidateStartIPs []string
+
+	for _, ipStr := range availableIPs {
+		ip := net.ParseIP(ipStr)
+		if ip == nil || ip.To4() == nil {
+			continue
+		}
+
+		// 检查IP是否网络对齐
+		mask := net.CIDRMask(bits, 32)
+		maskedIP := cloneIP(ip.Mask(mask))
+		if maskedIP.String() != ipStr || excluded[fmt.Sprintf("%s/%d", ipStr, bits)] {
+			continue
+		}
+		// 跳过与只允许单个IP的 CIDR 重叠的块
+		if g.checkBlockPolicy(&net.IPNet{IP: maskedIP, Mask: mask}) == nil {
+			candidateStartIPs = append(candidateStartIPs, ipStr)
+		}
+	}
+
+	// 8. 按照数值顺序选择第一个候选起始IP
+	if len(candidateStartIPs) > 0 {
+		sortIPStrings(candidateStartIPs)
+		startIP = candidateStartIPs[0]
+	} else {
+		return "", fmt.Errorf("没有找到网络对齐的起始IP")
+	}
+
+	// 9. 创建CIDR
+	cidr := fmt.Sprintf("%s/%d", startIP, bits)
+	_, ipNet, _ := net.ParseCIDR(cidr)
+
+	// 10. 向存储确认子网中的所有IP仍然可用，存储支持时一次批量检查
+	members := make([]string, 0, size)
+	for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip) && len(members) < size; more = !nextIP(ip) {
+		members = append(members, ip.String())
+	}
+	availability, err := areIPsAvailable(ctx, g.storage, members)
+	if err != nil {
+		return "", g.wrapErr(ctx, "AllocateCIDR", err)
+	}
+	for _, ipStr := range members {
+		if !availability[ipStr] {
+			// 查找时可用、现在不可用，说明被并发的分配占用
+			if snapshot[ipStr] {
+				return cidr, fmt.Errorf("IP %s %w", ipStr, ErrIPUnavailable)
+			}
+			return "", fmt.Errorf("IP %s 不可用", ipStr)
+		}
+	}
+
+	// 11. 标记网络地址为已分配，并从可用池中移除其他IP
+	if err := g.allocateBlock(ctx, "AllocateCIDR", ipNet, description); err != nil {
+		return cidr, err
+	}
+
+	// 12. 返回CIDR
+	return cidr, nil
+}
+
+// AllocateSpecificCIDR 分配一个由调用方指定的CIDR块
+// 该块必须网络对齐、位于管理的 CIDR 范围内且所有地址都可用
+func (g *CIDRGuardian) AllocateSpecificCIDR(ctx context.Context, cidr, description string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return err
+	}
+
+	// 解析CIDR
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+
+	// 检查是否网络对齐
+	if !ip.Equal(ipNet.IP) {
+		return fmt.Errorf("CIDR %s 未网络对齐，应为 %s", cidr, ipNet.String())
+	}
+
+	// 一次性获取可用IP集合
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return g.wrapErr(ctx, "AllocateSpecificCIDR", err)
+	}
+	availableSet := make(map[string]struct{}, len(availableIPs))
+	for _, ipStr := range availableIPs {
+		availableSet[ipStr] = struct{}{}
+	}
+
+	// 检查所有成员都在管理范围内且可用
+	for member, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(member); more = !nextIP(member) {
+		// 检查上下文是否已取消
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !g.isManagedIP(member) {
+			return fmt.Errorf("IP %s 不在任何管理的 CIDR 范围内", member.String())
+		}
+		if _, exists := availableSet[member.String()]; !exists {
+			return fmt.Errorf("CIDR %s 中的 IP %s 不可用", ipNet.String(), member.String())
+		}
+	}
+
+	if err := g.checkBlockPolicy(ipNet); err != nil {
+		return err
+	}
+	return g.allocateBlock(ctx, "AllocateSpecificCIDR", ipNet, description)
+}
+
+// AllocateEntireCIDR 将 CIDR 中的每个地址都标记为已分配，适合整块归属同一租户的场景
+// 与 AllocateCIDR 只分配网络地址不同，块内每个地址都是独立的分配记录，可由 ReleaseIP 或 ReleaseByDescription 释放。
+// 所有地址都必须在管理范围内且可用，通过一次批量存储调用整体分配，任一失败时全部回滚；
+// 描述模板中的 {cidr} 展开为该块
+func (g *CIDRGuardian) AllocateEntireCIDR(ctx context.Context, cidr, description string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return err
+	}
+
+	// 解析CIDR
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+
+	// 检查是否网络对齐
+	if !ip.Equal(ipNet.IP) {
+		return fmt.Errorf("CIDR %s 未网络对齐，应为 %s", cidr, ipNet.String())
+	}
+	if cidrSize(ipNet).Cmp(big.NewInt(maxPopulationHosts)) > 0 {
+		return fmt.Errorf("CIDR %s 包含的地址超过上限 %d", cidr, maxPopulationHosts)
+	}
+	if err := g.checkBlockPolicy(ipNet); err != nil {
+		return err
+	}
+
+	allocations := make(map[string]string)
+	for member, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(member); more = !nextIP(member) {
+		if !g.isManagedIP(member) {
+			return fmt.Errorf("IP %s 不在任何管理的 CIDR 范围内", member.String())
+		}
+		desc := g.expandDescription(description, member, ipNet.String())
+		if err := g.validateDescription(desc); err != nil {
+			return err
+		}
+		allocations[member.String()] = desc
+	}
+
+	allocated, err := g.storage.BulkAllocateIP(ctx, allocations, false)
+	if err != nil {
+		return g.wrapErr(ctx, "AllocateEntireCIDR", err)
+	}
+	g.stampSource(ctx, "AllocateEntireCIDR", allocated...)
+	return nil
+}
+
+// allocateBlock 将块的网络地址以块记录标记为已分配（存储不支持时描述格式为 "cidr - 描述"），
+// 并从可用池中移除其余成员，任一步骤失败时回滚。
+// 启用 WithPerHostCIDRAllocation 时其余成员通过一次批量存储调用逐个记录为已分配
+func (g *CIDRGuardian) allocateBlock(ctx context.Context, op string, ipNet *net.IPNet, description string) error {
+	networkAddr := ipNet.IP.String()
+	description = g.expandDescription(description, ipNet.IP, ipNet.String())
+	if err := g.validateDescription(description); err != nil {
+		return err
+	}
+
+	// 预先生成成员的描述，避免写入网络地址后才发现描述无效
+	var hosts map[string]string
+	if g.perHost {
+		hosts = make(map[string]string)
+		for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+			ipStr := ip.String()
+			if ipStr == networkAddr {
+				continue
+			}
+			hostDesc := description
+			if g.hostDesc != "" {
+				hostDesc = expandTemplate(g.hostDesc, ip, ipNet.String())
+			}
+			if err := g.validateDescription(hostDesc); err != nil {
+				return err
+			}
+			hosts[ipStr] = hostDesc
+		}
+	}
+
+	if err := g.storeBlock(ctx, ipNet, description); err != nil {
+		return g.wrapErr(ctx, op, err)
+	}
+
+	if g.perHost {
+		allocated, err := g.storage.BulkAllocateIP(ctx, hosts, false)
+		if err != nil {
+			_ = g.storage.DeallocateIP(ctx, networkAddr)
+			return g.wrapErr(ctx, op, err)
+		}
+		g.stampSource(ctx, op, append(allocated, networkAddr)...)
+		return nil
+	}
+
+	removed := []string{}
+	for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+		ipStr := ip.String()
+		if ipStr == networkAddr { // 跳过已分配的网络地址
+			continue
+		}
+
+		if err := g.storage.RemoveIP(ctx, ipStr); err != nil {
+			// 发生错误时回滚已移除的IP和网络地址的分配
+			for _, removedIP := range removed {
+				_ = g.storage.AddIP(ctx, removedIP)
+			}
+			_ = g.storage.DeallocateIP(ctx, networkAddr)
+			return g.wrapErr(ctx, op, err)
+		}
+		removed = append(removed, ipStr)
+	}
+
+	g.stampSource(ctx, op, networkAddr)
+	return nil
+}
+
+// isManagedIP 检查 IP 是否在任何管理的 CIDR 范围内
+func (g *CIDRGuardian) isManagedIP(ip net.IP) bool {
+	for _, cidrInfo := range g.managedCIDRs.load() {
+		if cidrInfo.IPNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReleaseIP 释放一个已分配的IP
+// IP 不属于任何管理 CIDR 时按 WithOrphanPolicy 处理：默认直接丢弃，不放回可用池
+func (g *CIDRGuardian) ReleaseIP(ctx context.Context, ipStr string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return err
+	}
+
+	return g.releaseIP(ctx, "ReleaseIP", ipStr)
+}
+
+// releaseIP 释放单个IP，并按孤立IP策略决定是否将其保留在可用池中
+func (g *CIDRGuardian) releaseIP(ctx context.Context, op, ipStr string) error {
+	ipStr = normalizeIP(ipStr)
+	orphan := false
+	if ip := net.ParseIP(ipStr); ip != nil {
+		orphan = !g.isManagedIP(ip)
+	}
+	if orphan && g.orphanPolicy == OrphanError {
+		return fmt.Errorf("IP %s 不属于任何管理的 CIDR", ipStr)
+	}
+	excluded, err := g.exclusions(ctx, op)
+	if err != nil {
+		return err
+	}
+
+	if err := g.storage.DeallocateIP(ctx, ipStr); err != nil {
+		return g.wrapErr(ctx, op, err)
+	}
+
+	// 存储释放时会将IP放回可用池，孤立IP需要再移除，避免可用池无限增长；被排除的IP同样移除
+	if orphan || excluded[ipStr] {
+		if err := g.storage.RemoveIP(ctx, ipStr); err != nil {
+			return g.wrapErr(ctx, op, err)
+		}
+		return nil
+	}
+	g.recordRelease(ipStr)
+	return nil
+}
+
+// ReleaseCIDR 释放一个已分配的CIDR
+// 块可以跨越多个相邻的管理 CIDR：成员IP逐个放回可用池，但只放回仍属于某个管理 CIDR 的IP。
+// 块内单独分配的IP保持分配状态（需要一并释放时使用 ReleaseCIDRWithMembers）；
+// 启用 WithPerHostCIDRAllocation 时已分配的成员视为块的一部分一并释放
+func (g *CIDRGuardian) ReleaseCIDR(ctx context.Context, cidr string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return err
+	}
+
+	_, err := g.releaseCIDR(ctx, cidr, false)
+	return err
+}
+
+// ReleaseCIDRWithMembers 与 ReleaseCIDR 相同，但同时释放块内单独分配的成员IP，避免块释放后留下孤立的成员分配
+// 返回按数值排序的被释放的成员IP（不含块本身的网络地址）；中途失败时返回已释放的成员和错误
+func (g *CIDRGuardian) ReleaseCIDRWithMembers(ctx context.Context, cidr string) ([]string, error) {
+	if g.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	return g.releaseCIDR(ctx, cidr, true)
+}
+
+// releaseCIDR 释放一个已分配的CIDR，不经过限速，供批量释放的方法使用
+// releaseMembers 为 true 或启用 WithPerHostCIDRAllocation 时一并释放块内已分配的成员，按数值顺序返回被释放的成员IP
+func (g *CIDRGuardian) releaseCIDR(ctx context.Context, cidr string, releaseMembers bool) (freed []string, err error) {
+	// 解析CIDR
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的CIDR格式: %v", err)
+	}
+	freed = []string{}
+
+	// 检查网络地址是否作为该块被分配，单独分配的网络地址不算
+	networkAddr := ipNet.IP.Mask(ipNet.Mask).String()
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return freed, g.wrapErr(ctx, "ReleaseCIDR", err)
+	}
+
+	blocks, err := g.blockIndex(ctx, "ReleaseCIDR")
+	if err != nil {
+		return freed, err
+	}
+
+	desc, exists := allocated[networkAddr]
+	blockCIDR, _, isBlock := blocks.lookup(networkAddr, desc)
+	if !exists || !isBlock || canonicalCIDR(blockCIDR) != ipNet.String() {
+		return freed, fmt.Errorf("CIDR %s 未被分配", cidr)
+	}
+
+	// 一次性获取管理 CIDR，块可能跨越其中多个
+	cidrs := g.managedCIDRs.load()
+	managed := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidrInfo := range cidrs {
+		managed = append(managed, cidrInfo.IPNet)
+	}
+	excluded, err := g.exclusions(ctx, "ReleaseCIDR")
+	if err != nil {
+		return freed, err
+	}
+
+	// 被排除的IP与不属于管理 CIDR 的IP一样不放回可用池
+	isManaged := func(ip net.IP) bool {
+		if excluded[ip.String()] {
+			return false
+		}
+		for _, managedNet := range managed {
+			if managedNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 将IP重新添加到可用池中
+	for ip, more := cloneIP(ipNet.IP.Mask(ipNet.Mask)), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+		// 检查上下文是否已取消
+		if err := ctx.Err(); err != nil {
+			return freed, err
+		}
+
+		// 网络地址稍后释放
+		ipStr := ip.String()
+		if ipStr == networkAddr {
+			continue
+		}
+
+		// 逐个记录的成员随块一起释放，所属的管理 CIDR 已被移除时不留在可用池中
+		if _, exists := allocated[ipStr]; exists && (releaseMembers || g.perHost) {
+			if err := g.storage.DeallocateIP(ctx, ipStr); err != nil {
+				return freed, g.wrapErr(ctx, "ReleaseCIDR", err)
+			}
+			freed = append(freed, ipStr)
+			if !isManaged(ip) {
+				if err := g.storage.RemoveIP(ctx, ipStr); err != nil {
+					return freed, g.wrapErr(ctx, "ReleaseCIDR", err)
+				}
+			}
+			continue
+		}
+
+		// 所属的管理 CIDR 已被移除的IP不再放回
+		if !isManaged(ip) {
+			continue
+		}
+
+		// 只有当IP不在已分配列表中时，才添加到可用池
+		if _, exists := allocated[ipStr]; !exists {
+			if err := g.storage.AddIP(ctx, ipStr); err != nil {
+				// 忽略"IP已存在"错误
+				if !errors.Is(err, ErrIPAlreadyAvailable) &&
+					!strings.Contains(err.Error(), "已被分配") && !strings.Contains(err.Error(), "already allocated") {
+					return freed, g.wrapErr(ctx, "ReleaseCIDR", err)
+				}
+			}
+		}
+	}
+
+	// 从已用CIDR中移除网络地址，存储会将其放回可用池
+	if err := g.storage.DeallocateIP(ctx, networkAddr); err != nil {
+		return freed, g.wrapErr(ctx, "ReleaseCIDR", err)
+	}
+
+	// 网络地址所属的管理 CIDR 已被移除时，不应留在可用池中
+	if !isManaged(ipNet.IP) {
+		if err := g.storage.RemoveIP(ctx, networkAddr); err != nil {
+			return freed, g.wrapErr(ctx, "ReleaseCIDR", err)
+		}
+	}
+
+	return freed, nil
+}
+
+// BulkOption 配置批量分配的行为
+type BulkOption func(*bulkConfig)
+
+// bulkConfig 批量分配配置
+type bulkConfig struct {
+	skipUnavailable bool
+}
+
+// WithSkipUnavailable 跳过不可用的 IP，只分配可用的部分
+func WithSkipUnavailable() BulkOption {
+	return func(c *bulkConfig) {
+		c.skipUnavailable = true
+	}
+}
+
+// BulkAllocate 批量分配指定的IP（IP -> 描述），返回成功分配的IP
+// 默认任一IP无效或不可用时整体失败；启用 WithSkipUnavailable 时跳过不可用的IP
+func (g *CIDRGuardian) BulkAllocate(ctx context.Context, pairs map[string]string, opts ...BulkOption) ([]string, error) {
+	if g.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	var cfg bulkConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	// 逐个校验IP格式，并转换为标准形式
+	normalized := make(map[string]string, len(pairs))
+	for ip, desc := range pairs {
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil {
+			if cfg.skipUnavailable {
+				continue
+			}
+			return nil, fmt.Errorf("无效的IP地址格式: %s", ip)
+		}
+		ipStr := parsedIP.String()
+		if _, exists := normalized[ipStr]; exists {
+			return nil, fmt.Errorf("IP %s 重复分配", ipStr)
+		}
+		if err := g.checkSingleIPPolicy(ipStr); err != nil {
+			if cfg.skipUnavailable {
+				continue
+			}
+			return nil, err
+		}
+		desc = g.expandIPDescription(desc, ipStr)
+		if err := g.validateDescription(desc); err != nil {
+			return nil, fmt.Errorf("IP %s: %w", ipStr, err)
+		}
+		normalized[ipStr] = desc
+	}
+
+	allocated, err := g.storage.BulkAllocateIP(ctx, normalized, cfg.skipUnavailable)
+	if err != nil {
+		return allocated, g.wrapErr(ctx, "BulkAllocate", err)
+	}
+	g.stampSource(ctx, "BulkAllocate", allocated...)
+
+	sortIPStrings(allocated)
+	return allocated, nil
+}
+
+// AllocateContiguous 分配第一段连续 count 个可用的IP，不要求网络对齐或数量为 2 的幂
+// 所有IP整体分配，任一失败时全部回滚；返回按数值排序的IP列表
+func (g *CIDRGuardian) AllocateContiguous(ctx context.Context, count int, description string) ([]string, error) {
+	if g.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	if count < 1 {
+		return nil, fmt.Errorf("无效的IP数量: %d", count)
+	}
+
+	ips, err := g.availableIPs(ctx, "AllocateContiguous")
+	if err != nil {
+		return nil, err
+	}
+	if ips, err = g.excludeCapped(g.excludePolicy(ips, PolicyBlockOnly)); err != nil {
+		return nil, err
+	}
+
+	// 在有序的可用IP中查找第一段相邻地址
+	var run []string
+	var prev netip.Addr
+	for _, ipStr := range ips {
+		addr, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			run = nil
+			continue
+		}
+		addr = addr.Unmap()
+		if len(run) == 0 || prev.Next() != addr {
+			run = run[:0]
+		}
+		run = append(run, ipStr)
+		prev = addr
+		if len(run) == count {
+			break
+		}
+	}
+	if len(run) < count {
+		return nil, fmt.Errorf("没有 %d 个连续的可用IP", count)
+	}
+
+	allocations := make(map[string]string, count)
+	for _, ip := range run {
+		desc := g.expandIPDescription(description, ip)
+		if err := g.validateDescription(desc); err != nil {
+			return nil, fmt.Errorf("IP %s: %w", ip, err)
+		}
+		allocations[ip] = desc
+	}
+
+	if _, err := g.storage.BulkAllocateIP(ctx, allocations, false); err != nil {
+		return nil, g.wrapErr(ctx, "AllocateContiguous", err)
+	}
+	g.stampSource(ctx, "AllocateContiguous", run...)
+
+	return run, nil
+}
+
+// MatchOption 配置按描述匹配已分配记录的方式
+type MatchOption func(*matchConfig)
+
+// matchConfig 描述匹配配置
+type matchConfig struct {
+	prefix bool
+	fold   bool // 忽略大小写，由 WithCaseInsensitiveDescriptions 设置
+}
+
+// WithPrefixMatch 按前缀匹配描述，而不是精确匹配
+func WithPrefixMatch() MatchOption {
+	return func(c *matchConfig) {
+		c.prefix = true
+	}
+}
+
+// matches 检查描述是否与目标匹配
+func (c matchConfig) matches(desc, target string) bool {
+	if c.fold {
+		desc, target = strings.ToLower(desc), strings.ToLower(target)
+	}
+	if c.prefix {
+		return strings.HasPrefix(desc, target)
+	}
+	return desc == target
+}
+
+// matchConfigFor 根据 guardian 的配置和调用方传入的选项生成匹配配置
+func (g *CIDRGuardian) matchConfigFor(opts []MatchOption) matchConfig {
+	cfg := matchConfig{fold: g.foldDesc}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// GetAllocatedIPsMatching 获取描述匹配的已分配记录，匹配方式与 ReleaseByDescription 相同
+// 单个IP以IP为键，CIDR 块以 CIDR 为键，值为原始描述（CIDR 块不含 "CIDR - " 前缀）
+func (g *CIDRGuardian) GetAllocatedIPsMatching(ctx context.Context, description string, opts ...MatchOption) (map[string]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cfg := g.matchConfigFor(opts)
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "GetAllocatedIPsMatching", err)
+	}
+	blocks, err := g.blockIndex(ctx, "GetAllocatedIPsMatching")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for ip, desc := range allocated {
+		if cidr, blockDesc, ok := blocks.lookup(ip, desc); ok {
+			if cfg.matches(blockDesc, description) {
+				result[g.formatIP(cidr)] = blockDesc
+			}
+			continue
+		}
+		if cfg.matches(desc, description) {
+			result[g.formatIP(ip)] = desc
+		}
+	}
+	return result, nil
+}
+
+// splitBlockDescription 解析 CIDR 块网络地址上 "cidr - 描述" 格式的描述
+func splitBlockDescription(desc string) (cidr, description string, ok bool) {
+	parts := strings.SplitN(desc, " - ", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	if _, _, err := net.ParseCIDR(parts[0]); err != nil {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ReleaseByDescription 释放所有描述匹配的已分配IP，返回被释放的IP或CIDR
+// 默认精确匹配，可通过 WithPrefixMatch 改为前缀匹配；CIDR 块按其描述匹配并整块释放。
+// 任一释放失败时，会尝试恢复已释放的分配
+func (g *CIDRGuardian) ReleaseByDescription(ctx context.Context, description string, opts ...MatchOption) ([]string, error) {
+	if g.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	cfg := g.matchConfigFor(opts)
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "ReleaseByDescription", err)
+	}
+	index, err := g.blockIndex(ctx, "ReleaseByDescription")
+	if err != nil {
+		return nil, err
+	}
+
+	// 收集匹配的单个IP和CIDR块
+	singles := make(map[string]string)
+	blocks := make(map[string]string)
+	for ip, desc := range allocated {
+		if cidr, blockDesc, ok := index.lookup(ip, desc); ok {
+			if cfg.matches(blockDesc, description) {
+				blocks[cidr] = blockDesc
+			}
+			continue
+		}
+		if cfg.matches(desc, description) {
+			singles[ip] = desc
+		}
+	}
+
+	// 先释放单个IP，再释放CIDR块，均按数值顺序
+	singleIPs := make([]string, 0, len(singles))
+	for ip := range singles {
+		singleIPs = append(singleIPs, ip)
+	}
+	sortIPStrings(singleIPs)
+	targets := append(singleIPs, sortedCIDRKeys(blocks)...)
+
+	released := []string{}
+	for _, target := range targets {
+		var releaseErr error
+		if _, isBlock := blocks[target]; isBlock {
+			_, releaseErr = g.releaseCIDR(ctx, target, false)
+		} else {
+			releaseErr = g.releaseIP(ctx, "ReleaseByDescription", target)
+		}
+
+		if releaseErr != nil {
+			// 回滚已释放的分配，单个IP（包括释放后不在可用池中的孤立IP）一次性导入已分配池，回滚失败时一并返回
+			var rollbackErr error
+			restore := make(map[string]string)
+			for _, r := range released {
+				if blockDesc, isBlock := blocks[r]; isBlock {
+					_, ipNet, _ := net.ParseCIDR(r)
+					if err := g.allocateBlock(ctx, "ReleaseByDescription", ipNet, blockDesc); err != nil && rollbackErr == nil {
+						rollbackErr = err
+					}
+				} else {
+					restore[r] = singles[r]
+				}
+			}
+			if len(restore) > 0 {
+				if err := g.storage.ImportAllocations(ctx, restore); err != nil && rollbackErr == nil {
+					rollbackErr = g.wrapErr(ctx, "ReleaseByDescription", err)
+				}
+			}
+			if rollbackErr != nil {
+				return nil, fmt.Errorf("%w; 回滚已释放的分配失败: %w", releaseErr, rollbackErr)
+			}
+			return nil, releaseErr
+		}
+		released = append(released, target)
+	}
+
+	return released, nil
+}
+
+// ReleaseAllInCIDR 释放管理 CIDR 中的所有分配，返回被释放的IP或CIDR，CIDR 本身仍保留在管理池中
+// 网络地址位于该 CIDR 中的块整块释放；任一释放失败时，会尝试恢复已释放的分配
+func (g *CIDRGuardian) ReleaseAllInCIDR(ctx context.Context, cidr string) ([]string, error) {
+	if g.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	cidrInfo, exists := g.managedCIDRs.load()[canonicalCIDR(cidr)]
+	if !exists {
+		return nil, fmt.Errorf("CIDR %s 不在管理池中", cidr)
+	}
+
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "ReleaseAllInCIDR", err)
+	}
+	index, err := g.blockIndex(ctx, "ReleaseAllInCIDR")
+	if err != nil {
+		return nil, err
+	}
 
-	return ip, nil
+	// 收集该 CIDR 中的单个IP和起始于其中的CIDR块
+	blocks := make(map[string]string)
+	var blockNets []*net.IPNet
+	for ipStr, desc := range allocated {
+		blockCIDR, blockDesc, ok := index.lookup(ipStr, desc)
+		if !ok {
+			continue
+		}
+		_, blockNet, _ := net.ParseCIDR(blockCIDR)
+		blockNets = append(blockNets, blockNet)
+		if ip := net.ParseIP(ipStr); ip != nil && cidrInfo.IPNet.Contains(ip) {
+			blocks[blockNet.String()] = blockDesc
+		}
+	}
+	singles := make(map[string]string)
+	for ipStr, desc := range allocated {
+		ip := net.ParseIP(ipStr)
+		if ip == nil || !cidrInfo.IPNet.Contains(ip) {
+			continue
+		}
+		if _, _, isBlock := index.lookup(ipStr, desc); isBlock {
+			continue
+		}
+		// 逐个记录的块成员随块一起释放
+		if g.perHost && inAnyNet(ip, blockNets) {
+			continue
+		}
+		singles[ipStr] = desc
+	}
+
+	// 先释放单个IP，再释放CIDR块，均按数值顺序
+	singleIPs := make([]string, 0, len(singles))
+	for ip := range singles {
+		singleIPs = append(singleIPs, ip)
+	}
+	sortIPStrings(singleIPs)
+	targets := append(singleIPs, sortedCIDRKeys(blocks)...)
+
+	released := []string{}
+	for _, target := range targets {
+		var releaseErr error
+		if _, isBlock := blocks[target]; isBlock {
+			_, releaseErr = g.releaseCIDR(ctx, target, false)
+		} else {
+			releaseErr = g.releaseIP(ctx, "ReleaseAllInCIDR", target)
+		}
+
+		if releaseErr != nil {
+			// 回滚已释放的分配，单个IP一次性导入已分配池，回滚失败时一并返回
+			var rollbackErr error
+			restore := make(map[string]string)
+			for _, r := range released {
+				if blockDesc, isBlock := blocks[r]; isBlock {
+					_, ipNet, _ := net.ParseCIDR(r)
+					if err := g.allocateBlock(ctx, "ReleaseAllInCIDR", ipNet, blockDesc); err != nil && rollbackErr == nil {
+						rollbackErr = err
+					}
+				} else {
+					restore[r] = singles[r]
+				}
+			}
+			if len(restore) > 0 {
+				if err := g.storage.ImportAllocations(ctx, restore); err != nil && rollbackErr == nil {
+					rollbackErr = g.wrapErr(ctx, "ReleaseAllInCIDR", err)
+				}
+			}
+			if rollbackErr != nil {
+				return nil, fmt.Errorf("%w; 回滚已释放的分配失败: %w", releaseErr, rollbackErr)
+			}
+			return nil, releaseErr
+		}
+		released = append(released, target)
+	}
+
+	return released, nil
 }
 
-// AllocateCIDR 从IP池中分配一个指定大小的CIDR
-func (g *CIDRGuardian) AllocateCIDR(ctx context.Context, bits int, description string) (string, error) {
-	// 1. 检查上下文是否已取消
+// GetIPHistory 获取 IP 最近的分配历史，按时间从早到晚排列
+// 需要存储后端实现 IPHistoryStorage
+func (g *CIDRGuardian) GetIPHistory(ctx context.Context, ip string) ([]HistoryEntry, error) {
+	// 检查上下文是否已取消
 	if err := ctx.Err(); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// 2. 验证位数参数
-	if bits < 0 || bits > 32 {
-		return "", fmt.Errorf("无效的子网掩码位数: %d", bits)
+	historian, ok := storageAs[IPHistoryStorage](g.storage)
+	if !ok {
+		return nil, fmt.Errorf("存储后端不支持 IP 历史记录")
 	}
 
-	// 3. 获取所有可用IP
-	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("无效的IP地址格式: %s", ip)
+	}
+
+	entries, err := historian.GetIPHistory(ctx, parsedIP.String())
 	if err != nil {
-		return "", err
+		return nil, g.wrapErr(ctx, "GetIPHistory", err)
 	}
+	return entries, nil
+}
 
-	// 4. 计算需要的IP数量
-	size := 1 << (32 - bits)
+// IsCIDRAvailable 检查 CIDR 中的所有地址是否都在可用池中
+func (g *CIDRGuardian) IsCIDRAvailable(ctx context.Context, cidr string) (bool, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 
-	// 5. 检查是否有足够的IP
-	if len(availableIPs) < size {
-		return "", fmt.Errorf("没有足够的IP可以分配 /%d 子网", bits)
+	// 解析CIDR
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
 	}
 
-	// 6. 对IP进行排序以确保一致性
-	sort.Strings(availableIPs)
+	// 存储支持批量检查时按批查询 CIDR 的成员，遇到不可用的成员即停止
+	if bulk, ok := storageAs[BulkAvailabilityStorage](g.storage); ok {
+		return g.cidrAvailableBulk(ctx, bulk, ipNet)
+	}
 
-	// 7. 查找网络对齐的起始IP
-	var startIP string
-	var candidateStartIPs []string
+	// 否则一次性获取可用IP集合，避免逐个查询存储
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return false, g.wrapErr(ctx, "IsCIDRAvailable", err)
+	}
 
-	for _, ipStr := range availableIPs {
-		ip := net.ParseIP(ipStr)
-		if ip == nil || ip.To4() == nil {
-			continue
+	// 可用IP数量少于 CIDR 大小时不可能全部可用
+	if cidrSize(ipNet).Cmp(big.NewInt(int64(len(availableIPs)))) > 0 {
+		return false, nil
+	}
+
+	availableSet := make(map[string]struct{}, len(availableIPs))
+	for _, ip := range availableIPs {
+		availableSet[ip] = struct{}{}
+	}
+
+	for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+		// 检查上下文是否已取消
+		if err := ctx.Err(); err != nil {
+			return false, err
 		}
 
-		// 检查IP是否网络对齐
-		mask := net.CIDRMask(bits, 32)
-		maskedIP := cloneIP(ip.Mask(mask))
-		if maskedIP.String() == ipStr {
-			candidateStartIPs = append(candidateStartIPs, ipStr)
+		if _, exists := availableSet[ip.String()]; !exists {
+			return false, nil
 		}
 	}
 
-	// 8. 按照字典顺序选择第一个候选起始IP
-	if len(candidateStartIPs) > 0 {
-		sort.Strings(candidateStartIPs)
-		startIP = candidateStartIPs[0]
-	} else {
-		return "", fmt.Errorf("没有找到网络对齐的起始IP")
-	}
+	return true, nil
+}
 
-	// 9. 创建CIDR
-	cidr := fmt.Sprintf("%s/%d", startIP, bits)
-	_, ipNet, _ := net.ParseCIDR(cidr)
+// bulkCheckSize 是 IsCIDRAvailable 每次批量检查的成员数量
+const bulkCheckSize = 1024
 
-	// 10. 检查子网中的所有IP是否可用
-	ipCount := 0
-	for ip := cloneIP(ipNet.IP); ipNet.Contains(ip) && ipCount < size; nextIP(ip) {
-		// 这里显式调用IsIPAvailable以保持与测试的兼容性
-		available, err := g.storage.IsIPAvailable(ctx, ip.String())
+// cidrAvailableBulk 按 bulkCheckSize 分批检查 CIDR 的所有成员是否可用
+func (g *CIDRGuardian) cidrAvailableBulk(ctx context.Context, bulk BulkAvailabilityStorage, ipNet *net.IPNet) (bool, error) {
+	batch := make([]string, 0, bulkCheckSize)
+	check := func() (bool, error) {
+		availability, err := bulk.AreIPsAvailable(ctx, batch)
 		if err != nil {
-			return "", err
+			return false, g.wrapErr(ctx, "IsCIDRAvailable", err)
 		}
-		if !available {
-			return "", fmt.Errorf("IP %s 不可用", ip.String())
+		for _, ipStr := range batch {
+			if !availability[ipStr] {
+				return false, nil
+			}
 		}
-		ipCount++
+		batch = batch[:0]
+		return true, nil
 	}
 
-	// 11. 首先标记网络地址为已分配
-	if err := g.storage.AllocateIP(ctx, startIP, fmt.Sprintf("%s - %s", cidr, description)); err != nil {
-		return "", err
-	}
-
-	// 12. 从可用池中移除其他IP (不包括已分配的网络地址)
-	ipCount = 0
-	for ip := cloneIP(ipNet.IP); ipNet.Contains(ip) && ipCount < size; nextIP(ip) {
-		ipStr := ip.String()
-		if ipStr != startIP { // 跳过已分配的网络地址
-			if err := g.storage.RemoveIP(ctx, ipStr); err != nil {
-				// 发生错误时回滚
-				g.storage.DeallocateIP(ctx, startIP) // 尝试回滚网络地址的分配
-				return "", err
+	for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+		batch = append(batch, ip.String())
+		if len(batch) == bulkCheckSize {
+			if ok, err := check(); !ok || err != nil {
+				return false, err
 			}
 		}
-		ipCount++
 	}
-
-	// 13. 返回CIDR
-	return cidr, nil
+	return check()
 }
 
-// ReleaseIP 释放一个已分配的IP
-func (g *CIDRGuardian) ReleaseIP(ctx context.Context, ipStr string) error {
-	return g.storage.DeallocateIP(ctx, ipStr)
+// areIPsAvailable 检查一组IP是否可用，存储实现 BulkAvailabilityStorage 时一次调用完成，否则逐个调用 IsIPAvailable
+func areIPsAvailable(ctx context.Context, storage IPStorage, ips []string) (map[string]bool, error) {
+	if bulk, ok := storageAs[BulkAvailabilityStorage](storage); ok {
+		return bulk.AreIPsAvailable(ctx, ips)
+	}
+
+	result := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		available, err := storage.IsIPAvailable(ctx, ip)
+		if err != nil {
+			return nil, err
+		}
+		result[ip] = available
+	}
+	return result, nil
 }
 
-// ReleaseCIDR 释放一个已分配的CIDR
-func (g *CIDRGuardian) ReleaseCIDR(ctx context.Context, cidr string) error {
+// AreIPsAvailable 检查一组IP是否可用，返回每个传入IP（按原样作为键）是否在可用池中
+// 存储实现 BulkAvailabilityStorage 时（内存、SQL 存储）一次批量查询，否则逐个检查；任一IP格式无效时返回错误
+func (g *CIDRGuardian) AreIPsAvailable(ctx context.Context, ips []string) (map[string]bool, error) {
 	// 检查上下文是否已取消
 	if err := ctx.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// 解析CIDR
-	_, ipNet, err := net.ParseCIDR(cidr)
-	if err != nil {
-		return fmt.Errorf("无效的CIDR格式: %v", err)
+	normalized := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil {
+			return nil, fmt.Errorf("无效的IP地址格式: %s", ip)
+		}
+		normalized = append(normalized, parsedIP.String())
 	}
 
-	// 检查网络地址是否已被分配
-	networkAddr := ipNet.IP.Mask(ipNet.Mask).String()
-	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	availability, err := areIPsAvailable(ctx, g.storage, normalized)
 	if err != nil {
-		return err
+		return nil, g.wrapErr(ctx, "AreIPsAvailable", err)
 	}
 
-	if _, exists := allocated[networkAddr]; !exists {
-		return fmt.Errorf("CIDR %s 未被分配", cidr)
+	result := make(map[string]bool, len(ips))
+	for i, ip := range ips {
+		result[ip] = availability[normalized[i]]
 	}
+	return result, nil
+}
 
-	// 将IP重新添加到可用池中
-	for ip := cloneIP(ipNet.IP.Mask(ipNet.Mask)); ipNet.Contains(ip); nextIP(ip) {
+// maxEnumeratedBlocks 是按固定大小枚举块时允许返回的最大数量
+const maxEnumeratedBlocks = 1 << 20
+
+// AvailableBlocksOfSize 列出所有网络对齐且完全可用的指定前缀长度的块
+// 与 GetAvailableCIDRs 不同，结果按固定粒度枚举；IPv4 与 IPv6 分别处理，
+// 前缀长度超出某一地址族范围时该地址族不产生结果
+func (g *CIDRGuardian) AvailableBlocksOfSize(ctx context.Context, bits int) ([]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if bits < 0 || bits > 128 {
+		return nil, fmt.Errorf("无效的子网掩码位数: %d", bits)
+	}
+
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "AvailableBlocksOfSize", err)
+	}
+
+	var result []string
+	for _, free := range coalesceAddrs(availableIPs) {
 		// 检查上下文是否已取消
 		if err := ctx.Err(); err != nil {
-			return err
+			return nil, err
 		}
 
-		// 检查IP是否在任何管理的 CIDR 范围内
-		ipStr := ip.String()
-		inManagedRange := false
+		// 空闲块小于所需大小，或前缀长度超出该地址族范围
+		if free.Bits() > bits || bits > free.Addr().BitLen() {
+			continue
+		}
 
-		g.mu.RLock()
-		for _, cidrInfo := range g.managedCIDRs {
-			if cidrInfo.IPNet.Contains(ip) {
-				inManagedRange = true
-				break
-			}
+		// 将空闲块细分为所需大小
+		if bits-free.Bits() >= 63 || len(result)+(1<<(bits-free.Bits())) > maxEnumeratedBlocks {
+			return nil, fmt.Errorf("/%d 块数量超过上限 %d", bits, maxEnumeratedBlocks)
 		}
-		g.mu.RUnlock()
+		start := free.Addr()
+		for i := 0; i < 1<<(bits-free.Bits()); i++ {
+			block := netip.PrefixFrom(start, bits)
+			result = append(result, block.String())
+			start = lastAddr(block).Next()
+		}
+	}
 
-		if inManagedRange {
-			// 只有当IP不在已分配列表中时，才添加到可用池
-			if _, exists := allocated[ipStr]; !exists {
-				if err := g.storage.AddIP(ctx, ipStr); err != nil {
-					// 忽略"IP已存在"错误
-					if !strings.Contains(err.Error(), "已被分配") && !strings.Contains(err.Error(), "already allocated") {
-						return err
-					}
-				}
-			}
+	return result, nil
+}
+
+// FreeCIDRsWithin 返回管理 CIDR 内最大的网络对齐空闲子块，按数值顺序排列
+// 不在可用池中的地址（已分配或被单独移除）都视为非空闲；整个 CIDR 空闲时返回其自身，完全占用时返回空列表
+func (g *CIDRGuardian) FreeCIDRsWithin(ctx context.Context, parentCIDR string) ([]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	parent, err := netip.ParsePrefix(parentCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("无效的CIDR格式 %s: %v", parentCIDR, err)
+	}
+	parent = parent.Masked()
+
+	_, exists := g.managedCIDRs.load()[canonicalCIDR(parentCIDR)]
+	if !exists {
+		return nil, fmt.Errorf("CIDR %s 不在管理池中", parentCIDR)
+	}
+
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "FreeCIDRsWithin", err)
+	}
+
+	// 只保留父块内的可用IP
+	within := make([]string, 0, len(availableIPs))
+	for _, ipStr := range availableIPs {
+		addr, err := netip.ParseAddr(ipStr)
+		if err == nil && parent.Contains(addr.Unmap()) {
+			within = append(within, ipStr)
 		}
 	}
 
-	// 从已用CIDR中移除网络地址
-	if err := g.storage.DeallocateIP(ctx, networkAddr); err != nil {
-		return err
+	result := []string{}
+	for _, free := range coalesceAddrs(within) {
+		result = append(result, free.String())
 	}
+	return result, nil
+}
 
-	return nil
+// AvailableCIDROption 配置 GetAvailableCIDRs 的报告方式
+type AvailableCIDROption func(*availableCIDRConfig)
+
+// availableCIDRConfig 可用 CIDR 报告配置
+type availableCIDRConfig struct {
+	withinManaged bool // 按管理 CIDR 边界合并，由 WithinManagedCIDRs 设置
+}
+
+// WithinManagedCIDRs 使 GetAvailableCIDRs 将每个管理 CIDR 中的可用IP分别合并为最大的对齐块，
+// 返回的块不会跨越管理 CIDR 的边界，并且只包含确实可用的地址；管理 CIDR 重叠时IP归属于最具体的 CIDR，
+// 不属于任何管理 CIDR 的IP单独合并
+func WithinManagedCIDRs() AvailableCIDROption {
+	return func(c *availableCIDRConfig) {
+		c.withinManaged = true
+	}
 }
 
 // GetAvailableCIDRs 获取当前可用的CIDR块
-func (g *CIDRGuardian) GetAvailableCIDRs(ctx context.Context) ([]string, error) {
+// 默认返回包含可用IP的 /24 网段；WithinManagedCIDRs 时按管理 CIDR 边界合并可用IP
+func (g *CIDRGuardian) GetAvailableCIDRs(ctx context.Context, opts ...AvailableCIDROption) ([]string, error) {
+	var cfg availableCIDRConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	// 检查上下文是否已取消
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -455,13 +2462,17 @@ func (g *CIDRGuardian) GetAvailableCIDRs(ctx context.Context) ([]string, error)
 	// 获取所有可用的IP
 	availableIPs, err := g.storage.GetAvailableIPs(ctx)
 	if err != nil {
-		return nil, err
+		return nil, g.wrapErr(ctx, "GetAvailableCIDRs", err)
 	}
 
 	if len(availableIPs) == 0 {
 		return nil, nil
 	}
 
+	if cfg.withinManaged {
+		return g.formatIPs(g.availableBlocksByCIDR(availableIPs)), nil
+	}
+
 	// 简化实现，将可用IP按照/24网段分组
 	cidrs := make(map[string]bool)
 
@@ -488,41 +2499,115 @@ func (g *CIDRGuardian) GetAvailableCIDRs(ctx context.Context) ([]string, error)
 		result = append(result, cidr)
 	}
 
-	sort.Strings(result)
-	return result, nil
+	sortCIDRStrings(result)
+	return g.formatIPs(result), nil
+}
+
+// availableBlocksByCIDR 按最具体的管理 CIDR 对可用IP分组，每组分别合并为最大的对齐块，按数值顺序返回
+func (g *CIDRGuardian) availableBlocksByCIDR(availableIPs []string) []string {
+	managed := g.cidrsBySpecificity()
+	groups := make(map[*CIDRInfo][]string)
+	for _, ipStr := range availableIPs {
+		owner := mostSpecificCIDR(managed, ipStr)
+		groups[owner] = append(groups[owner], ipStr)
+	}
+
+	result := []string{}
+	for _, ips := range groups {
+		for _, prefix := range coalesceAddrs(ips) {
+			result = append(result, prefix.String())
+		}
+	}
+	sortCIDRStrings(result)
+	return result
+}
+
+// UsedCIDROption 配置 GetUsedCIDRs 的报告方式
+type UsedCIDROption func(*usedCIDRConfig)
+
+// usedCIDRConfig 已使用 CIDR 报告配置
+type usedCIDRConfig struct {
+	aggregate bool // 合并描述相同的相邻块，由 WithAggregatedBlocks 设置
+}
+
+// WithAggregatedBlocks 使用 MergeCIDRs 将描述相同的相邻块合并为其超网报告，使报告更紧凑
+// 不传该选项时 GetUsedCIDRs 按块逐条返回
+func WithAggregatedBlocks() UsedCIDROption {
+	return func(c *usedCIDRConfig) {
+		c.aggregate = true
+	}
 }
 
-// GetUsedCIDRs 获取已分配的CIDR及其描述
-func (g *CIDRGuardian) GetUsedCIDRs(ctx context.Context) (map[string]string, error) {
+// GetUsedCIDRs 获取已分配的CIDR及其描述，默认每个块一条，WithAggregatedBlocks 时合并相邻的同描述块
+func (g *CIDRGuardian) GetUsedCIDRs(ctx context.Context, opts ...UsedCIDROption) (map[string]string, error) {
+	var cfg usedCIDRConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	// 检查上下文是否已取消
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	// 从已分配的IP中提取CIDR信息
-	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	// 块记录直接读取，旧版记录从描述中解析，存储支持时逐条读取
+	blocks, err := g.blockIndex(ctx, "GetUsedCIDRs")
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]string)
+	err = g.forEachAllocated(ctx, "GetUsedCIDRs", func(ip, desc string) error {
+		if cidr, description, ok := blocks.lookup(ip, desc); ok {
+			raw[cidr] = description
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	result := make(map[string]string)
-
-	for _, desc := range allocated {
-		// 检查上下文是否已取消
-		if err := ctx.Err(); err != nil {
+	if cfg.aggregate {
+		if raw, err = aggregateBlocks(raw); err != nil {
 			return nil, err
 		}
+	}
 
-		if strings.Contains(desc, " - ") {
-			parts := strings.SplitN(desc, " - ", 2)
-			cidr, description := parts[0], parts[1]
-			result[cidr] = description
-		}
+	result := make(map[string]string, len(raw))
+	for cidr, description := range raw {
+		result[g.formatIP(cidr)] = description
+	}
+	return result, nil
+}
+
+// aggregateBlocks 按描述分组合并块，返回合并后的 CIDR 及描述
+func aggregateBlocks(blocks map[string]string) (map[string]string, error) {
+	byDesc := make(map[string][]string)
+	for cidr, desc := range blocks {
+		byDesc[desc] = append(byDesc[desc], cidr)
 	}
 
+	result := make(map[string]string, len(blocks))
+	for desc, cidrs := range byDesc {
+		merged, err := MergeCIDRs(cidrs)
+		if err != nil {
+			return nil, err
+		}
+		for _, cidr := range merged {
+			result[cidr] = desc
+		}
+	}
 	return result, nil
 }
 
+// GetUsedCIDRList 获取所有已分配的 CIDR，按网络地址数值顺序排序
+func (g *CIDRGuardian) GetUsedCIDRList(ctx context.Context) ([]string, error) {
+	used, err := g.GetUsedCIDRs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sortedCIDRKeys(used), nil
+}
+
 // AvailableCount 返回可用IP数量
 func (g *CIDRGuardian) AvailableCount(ctx context.Context) (int, error) {
 	// 检查上下文是否已取消
@@ -530,7 +2615,8 @@ func (g *CIDRGuardian) AvailableCount(ctx context.Context) (int, error) {
 		return 0, err
 	}
 
-	return g.storage.AvailableCount(ctx)
+	count, err := g.storage.AvailableCount(ctx)
+	return count, g.wrapErr(ctx, "AvailableCount", err)
 }
 
 // AllocatedCount 返回已分配IP数量
@@ -540,7 +2626,88 @@ func (g *CIDRGuardian) AllocatedCount(ctx context.Context) (int, error) {
 		return 0, err
 	}
 
-	return g.storage.AllocatedCount(ctx)
+	count, err := g.storage.AllocatedCount(ctx)
+	return count, g.wrapErr(ctx, "AllocatedCount", err)
+}
+
+// UsageByDescription 按描述统计已分配的IP数量
+// 通过 AllocateCIDR 等分配的块按整块地址数计入其描述（不含 "CIDR - " 前缀）。
+// 启用 WithCaseInsensitiveDescriptions 时仅大小写不同的描述合并计数，键为其中按字典序最小的写法
+func (g *CIDRGuardian) UsageByDescription(ctx context.Context) (map[string]int, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	blocks, err := g.blockIndex(ctx, "UsageByDescription")
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]int)
+	spelling := make(map[string]string) // 忽略大小写时每组描述使用的写法
+	err = g.forEachAllocated(ctx, "UsageByDescription", func(ip, desc string) error {
+		count := 1
+		if cidr, description, ok := blocks.lookup(ip, desc); ok {
+			// 块的其他成员只从可用池中移除，不在已分配池中，这里按块大小计数；
+			// 逐个记录成员时成员各自计数，网络地址只计 1 个
+			_, ipNet, _ := net.ParseCIDR(cidr)
+			if size := cidrSize(ipNet); size.IsInt64() && !g.perHost {
+				count = int(size.Int64())
+			}
+			desc = description
+		}
+
+		key := desc
+		if g.foldDesc {
+			key = strings.ToLower(desc)
+			if current, ok := spelling[key]; !ok || desc < current {
+				spelling[key] = desc
+			}
+		}
+		usage[key] += count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if g.foldDesc {
+		folded := make(map[string]int, len(usage))
+		for key, count := range usage {
+			folded[spelling[key]] = count
+		}
+		usage = folded
+	}
+	return usage, nil
+}
+
+// DistinctDescriptionCount 返回已分配IP中不同描述的数量，如租户数
+// 描述按存储中的原样比较，以块记录的 CIDR 块按其描述计入，旧格式的块按 "CIDR - 描述" 计入。存储实现 DescriptionCountStorage 时
+// 直接在存储中统计；否则（或启用 WithCaseInsensitiveDescriptions 时）遍历分配记录计数
+func (g *CIDRGuardian) DistinctDescriptionCount(ctx context.Context) (int, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if counter, ok := storageAs[DescriptionCountStorage](g.storage); ok && !g.foldDesc {
+		count, err := counter.DistinctDescriptionCount(ctx)
+		return count, g.wrapErr(ctx, "DistinctDescriptionCount", err)
+	}
+
+	descriptions := make(map[string]struct{})
+	err := g.forEachAllocated(ctx, "DistinctDescriptionCount", func(_, desc string) error {
+		if g.foldDesc {
+			desc = strings.ToLower(desc)
+		}
+		descriptions[desc] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(descriptions), nil
 }
 
 // String 返回IP池的字符串表示
@@ -558,8 +2725,8 @@ func (g *CIDRGuardian) String(ctx context.Context) (string, error) {
 	if len(managedCIDRs) == 0 {
 		sb.WriteString("  无\n")
 	} else {
-		for cidr, desc := range managedCIDRs {
-			sb.WriteString(fmt.Sprintf("  %s - %s\n", cidr, desc))
+		for _, cidr := range sortedCIDRKeys(managedCIDRs) {
+			sb.WriteString(fmt.Sprintf("  %s - %s\n", cidr, managedCIDRs[cidr]))
 		}
 	}
 
@@ -573,8 +2740,8 @@ func (g *CIDRGuardian) String(ctx context.Context) (string, error) {
 	if len(usedCIDRs) == 0 {
 		sb.WriteString("  无\n")
 	} else {
-		for cidr, desc := range usedCIDRs {
-			sb.WriteString(fmt.Sprintf("  %s - %s\n", cidr, desc))
+		for _, cidr := range sortedCIDRKeys(usedCIDRs) {
+			sb.WriteString(fmt.Sprintf("  %s - %s\n", cidr, usedCIDRs[cidr]))
 		}
 	}
 
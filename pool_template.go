@@ -0,0 +1,251 @@
+package CIDRGuardian
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+)
+
+// PoolTemplate 是可复用的IP池蓝图，描述管理的 CIDR、预留地址和可选配置项
+// 可以序列化为 JSON 纳入版本控制，通过 NewCIDRGuardianFromTemplate 应用
+type PoolTemplate struct {
+	CIDRs        []TemplateCIDR    `json:"cidrs"`                  // 管理的 CIDR
+	Reservations map[string]string `json:"reservations,omitempty"` // 预留的IP或 CIDR 块及预留原因，必须位于模板的 CIDR 内
+	Options      json.RawMessage   `json:"options,omitempty"`      // 可选配置项，格式与 LoadConfig 的 "guardian" 部分相同
+}
+
+// TemplateCIDR 是模板中的一个管理 CIDR
+type TemplateCIDR struct {
+	CIDR                    string  `json:"cidr"`                                // CIDR 字符串表示
+	Description             string  `json:"description,omitempty"`               // CIDR 描述
+	ReserveNetworkBroadcast bool    `json:"reserve_network_broadcast,omitempty"` // 与 WithReserveNetworkBroadcast 相同
+	SoftCap                 float64 `json:"soft_cap,omitempty"`                  // 与 WithSoftCap 相同，0 表示不限制
+}
+
+// NewCIDRGuardianFromTemplate 使用模板初始化一个新的 CIDRGuardian
+// 先按模板的配置项创建实例，再整体校验模板：CIDR 格式、彼此是否重叠、软上限范围以及预留地址是否位于模板的 CIDR 内；
+// 之后通过一次批量存储调用添加所有IP并完成预留，任一步失败时撤销本次加入可用池的IP和预留，不会留下部分应用的模板。
+// 成员已被分配时与 AddCIDR 一样失败，配置项启用 allow_overlay_allocated 时跳过。
+// 配置项不能包含 initial_cidrs 或 read_only；有预留地址时需要存储实现 IPReservationStorage
+func NewCIDRGuardianFromTemplate(ctx context.Context, storage IPStorage, tmpl PoolTemplate) (*CIDRGuardian, error) {
+	opts, err := tmpl.options()
+	if err != nil {
+		return nil, err
+	}
+
+	guardian, err := NewCIDRGuardianWithOptions(ctx, storage, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := guardian.applyTemplate(ctx, tmpl); err != nil {
+		return nil, err
+	}
+	return guardian, nil
+}
+
+// options 解析模板的配置项
+func (t PoolTemplate) options() ([]Option, error) {
+	if len(t.Options) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(t.Options))
+	decoder.DisallowUnknownFields()
+
+	var fc guardianFileConfig
+	if err := decoder.Decode(&fc); err != nil {
+		return nil, fmt.Errorf("解析模板配置项失败: %v", err)
+	}
+	if len(fc.InitialCIDRs) > 0 {
+		return nil, fmt.Errorf("模板配置项不能包含 initial_cidrs，请使用 cidrs")
+	}
+	if fc.ReadOnly {
+		return nil, fmt.Errorf("模板配置项不能包含 read_only")
+	}
+	return fc.toOptions()
+}
+
+// applyTemplate 校验并整体应用模板的 CIDR 和预留地址
+func (g *CIDRGuardian) applyTemplate(ctx context.Context, tmpl PoolTemplate) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 解析并规范化所有 CIDR
+	infos := make([]*CIDRInfo, 0, len(tmpl.CIDRs))
+	needReserver := len(tmpl.Reservations) > 0
+	for _, tc := range tmpl.CIDRs {
+		_, ipNet, err := net.ParseCIDR(tc.CIDR)
+		if err != nil {
+			return fmt.Errorf("无效的CIDR格式 %s: %v", tc.CIDR, err)
+		}
+		canonical := ipNet.String()
+		if canonical != tc.CIDR && g.strictCIDR {
+			return fmt.Errorf("CIDR %s 设置了主机位，应为 %s", tc.CIDR, canonical)
+		}
+		if err := g.checkSpecialUse(ipNet); err != nil {
+			return err
+		}
+		if tc.SoftCap < 0 || tc.SoftCap > 100 || math.IsNaN(tc.SoftCap) {
+			return fmt.Errorf("CIDR %s 的软上限百分比无效: %v", canonical, tc.SoftCap)
+		}
+		for _, other := range infos {
+			if cidrsOverlap(ipNet, other.IPNet) {
+				return fmt.Errorf("CIDR %s 与 %s 重叠", canonical, other.CIDR)
+			}
+		}
+		infos = append(infos, &CIDRInfo{CIDR: canonical, Description: tc.Description, IPNet: ipNet, Policy: PolicyAny, SoftCap: tc.SoftCap})
+		needReserver = needReserver || tc.ReserveNetworkBroadcast
+	}
+
+	// 展开预留地址，必须位于模板的 CIDR 内
+	explicit := make(map[string]string)
+	for target, reason := range tmpl.Reservations {
+		ips, err := templateReservationIPs(target)
+		if err != nil {
+			return err
+		}
+		for _, ip := range ips {
+			if !templateContains(infos, ip) {
+				return fmt.Errorf("预留地址 %s 不在模板的 CIDR 内", target)
+			}
+			explicit[ip.String()] = reason
+		}
+	}
+
+	var reserver IPReservationStorage
+	if needReserver {
+		var err error
+		if reserver, err = g.reserver(); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, info := range infos {
+		for managed, managedInfo := range g.managedCIDRs.load() {
+			if cidrsOverlap(info.IPNet, managedInfo.IPNet) {
+				return fmt.Errorf("CIDR %s 与已管理的 CIDR %s 重叠", info.CIDR, managed)
+			}
+		}
+	}
+
+	excluded, err := g.exclusions(ctx, "NewCIDRGuardianFromTemplate")
+	if err != nil {
+		return err
+	}
+
+	allocated, err := g.allocatedMembers(ctx, "NewCIDRGuardianFromTemplate")
+	if err != nil {
+		return err
+	}
+
+	// 枚举除排除列表外的所有 IP，一次性加入可用池；成员已被分配时与 AddCIDR 一样整体失败
+	ipStrs := []string{}
+	for _, info := range infos {
+		for ip, more := cloneIP(info.IPNet.IP), true; more && info.IPNet.Contains(ip); more = !nextIP(ip) {
+			ipStr := ip.String()
+			if excluded[ipStr] {
+				continue
+			}
+			if _, ok := allocated[ipStr]; ok {
+				return fmt.Errorf("CIDR %s 中的 IP %s 已被分配", info.CIDR, ipStr)
+			}
+			ipStrs = append(ipStrs, ipStr)
+		}
+	}
+	added, err := g.storage.BulkAddIP(ctx, ipStrs)
+	if err != nil {
+		return g.wrapErr(ctx, "NewCIDRGuardianFromTemplate", err)
+	}
+	isAdded := make(map[string]bool, len(added))
+	for _, ipStr := range added {
+		isAdded[ipStr] = true
+	}
+
+	// 网络地址和广播地址只预留本次加入可用池的，显式预留的原因优先
+	reservations := make(map[string]string)
+	for i, tc := range tmpl.CIDRs {
+		if !tc.ReserveNetworkBroadcast {
+			continue
+		}
+		network := infos[i].IPNet.IP.String()
+		broadcast, err := BroadcastAddress(infos[i].CIDR)
+		if err != nil {
+			continue // 没有广播地址的 CIDR 不预留
+		}
+		for ipStr, reason := range map[string]string{network: defaultNetworkReason, broadcast: defaultBroadcastReason} {
+			if isAdded[ipStr] {
+				reservations[ipStr] = reason
+			}
+		}
+	}
+	for ipStr, reason := range explicit {
+		reservations[ipStr] = reason
+	}
+
+	// 任一预留失败时撤销已完成的预留和本次加入可用池的IP
+	targets := make([]string, 0, len(reservations))
+	for ipStr := range reservations {
+		targets = append(targets, ipStr)
+	}
+	sortIPStrings(targets)
+	reserved := []string{}
+	for _, ipStr := range targets {
+		if err := reserver.ReserveIP(ctx, ipStr, reservations[ipStr]); err != nil {
+			for _, r := range reserved {
+				_ = reserver.UnreserveIP(ctx, r)
+			}
+			for _, a := range added {
+				_ = g.storage.RemoveIP(ctx, a)
+			}
+			return g.wrapErr(ctx, "NewCIDRGuardianFromTemplate", fmt.Errorf("预留 %s 失败: %w", ipStr, err))
+		}
+		reserved = append(reserved, ipStr)
+	}
+
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		for _, info := range infos {
+			m[info.CIDR] = info
+		}
+	})
+	return nil
+}
+
+// templateReservationIPs 将模板中的预留目标（单个IP或 CIDR 块）展开为地址列表
+func templateReservationIPs(target string) ([]net.IP, error) {
+	if !strings.Contains(target, "/") {
+		ip := net.ParseIP(target)
+		if ip == nil {
+			return nil, fmt.Errorf("无效的预留地址: %s", target)
+		}
+		return []net.IP{ip}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(target)
+	if err != nil {
+		return nil, fmt.Errorf("无效的预留 CIDR %s: %v", target, err)
+	}
+	ips := []net.IP{}
+	for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+		ips = append(ips, cloneIP(ip))
+	}
+	return ips, nil
+}
+
+// templateContains 判断地址是否位于模板的某个 CIDR 内
+func templateContains(infos []*CIDRInfo, ip net.IP) bool {
+	for _, info := range infos {
+		if info.IPNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,15 +1,26 @@
 package CIDRGuardian
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"iter"
+	"log/slog"
+	"math"
+	"math/big"
 	"net"
 	"os"
 	"reflect"
+	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -144,6 +155,78 @@ func (m *mockIPStorage) AllocatedCount(ctx context.Context) (int, error) {
 	return len(m.allocated), nil
 }
 
+// ImportAllocations 实现 IPStorage 接口
+func (m *mockIPStorage) ImportAllocations(ctx context.Context, allocations map[string]string) error {
+	if m.failOn == "ImportAllocations" {
+		return errors.New(m.errorMsg)
+	}
+
+	for ip := range allocations {
+		if _, exists := m.allocated[ip]; exists {
+			return errors.New("IP already allocated")
+		}
+	}
+	for ip, desc := range allocations {
+		delete(m.available, ip)
+		m.allocated[ip] = desc
+	}
+	return nil
+}
+
+// UpdateDescription 实现 IPStorage 接口
+func (m *mockIPStorage) UpdateDescription(ctx context.Context, ip string, description string) error {
+	if m.failOn == "UpdateDescription" {
+		return errors.New(m.errorMsg)
+	}
+
+	if _, exists := m.allocated[ip]; !exists {
+		return errors.New("IP not allocated")
+	}
+	m.allocated[ip] = description
+	return nil
+}
+
+// BulkAddIP 实现 IPStorage 接口
+func (m *mockIPStorage) BulkAddIP(ctx context.Context, ips []string) ([]string, error) {
+	if m.failOn == "BulkAddIP" {
+		return nil, errors.New(m.errorMsg)
+	}
+
+	added := []string{}
+	for _, ip := range ips {
+		if _, exists := m.allocated[ip]; exists || m.available[ip] {
+			continue
+		}
+		m.available[ip] = true
+		added = append(added, ip)
+	}
+	return added, nil
+}
+
+// BulkAllocateIP 实现 IPStorage 接口
+func (m *mockIPStorage) BulkAllocateIP(ctx context.Context, allocations map[string]string, skipUnavailable bool) ([]string, error) {
+	if m.failOn == "BulkAllocateIP" {
+		return nil, errors.New(m.errorMsg)
+	}
+
+	ips := []string{}
+	for ip := range allocations {
+		if !m.available[ip] {
+			if skipUnavailable {
+				continue
+			}
+			return nil, fmt.Errorf("IP %s not available", ip)
+		}
+		ips = append(ips, ip)
+	}
+	for _, ip := range ips {
+		delete(m.available, ip)
+		m.allocated[ip] = allocations[ip]
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
 // TestNewMemoryIPStorage 测试内存存储的创建
 func TestNewMemoryIPStorage(t *testing.T) {
 	storage := NewMemoryIPStorage()
@@ -185,6 +268,36 @@ func TestMemoryIPStorage_AddIP(t *testing.T) {
 	}
 }
 
+// TestMemoryIPStorage_StrictAdd 测试严格添加模式下重复添加可用 IP 返回 ErrIPAlreadyAvailable
+func TestMemoryIPStorage_StrictAdd(t *testing.T) {
+	ctx := context.Background()
+
+	// 默认幂等
+	storage := NewMemoryIPStorage()
+	if err := storage.AddIP(ctx, "192.168.1.1"); err != nil {
+		t.Fatalf("AddIP should succeed: %v", err)
+	}
+	if err := storage.AddIP(ctx, "192.168.1.1"); err != nil {
+		t.Errorf("AddIP should be idempotent by default: %v", err)
+	}
+
+	strict := NewMemoryIPStorage(WithMemoryStrictAdd())
+	if err := strict.AddIP(ctx, "192.168.1.1"); err != nil {
+		t.Fatalf("AddIP should succeed: %v", err)
+	}
+	err := strict.AddIP(ctx, "192.168.1.1")
+	if !errors.Is(err, ErrIPAlreadyAvailable) {
+		t.Errorf("expected ErrIPAlreadyAvailable, got %v", err)
+	}
+
+	// 已分配的 IP 仍返回原来的错误
+	strict.allocated["192.168.1.2"] = "test"
+	err = strict.AddIP(ctx, "192.168.1.2")
+	if err == nil || errors.Is(err, ErrIPAlreadyAvailable) {
+		t.Errorf("expected allocated error, got %v", err)
+	}
+}
+
 // TestMemoryIPStorage_RemoveIP 测试移除IP
 func TestMemoryIPStorage_RemoveIP(t *testing.T) {
 	ctx := context.Background()
@@ -512,7 +625,7 @@ func TestNewCIDRGuardian(t *testing.T) {
 	// 创建新的 MemoryIPStorage 可能在添加 CIDR 之前就已经返回
 	mockStorage := newMockIPStorage()
 	_, err = NewCIDRGuardian(canceledCtx, mockStorage)
-	if err == nil || err != context.Canceled {
+	if !errors.Is(err, context.Canceled) {
 		t.Error("NewCIDRGuardian should fail with context.Canceled when context is canceled")
 	}
 }
@@ -741,6 +854,48 @@ func TestCIDRGuardian_AllocateIP(t *testing.T) {
 	}
 }
 
+// TestCIDRGuardian_AllocateIPWithParent 测试分配IP并返回所属的管理 CIDR
+func TestCIDRGuardian_AllocateIPWithParent(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage)
+	_ = guardian.AddCIDR(ctx, "10.0.0.0/29", "lan")
+	_ = guardian.AddCIDR(ctx, "10.0.1.0/30", "dmz")
+
+	info, err := guardian.AllocateIPWithParent(ctx, "10.0.1.2", "web")
+	if err != nil {
+		t.Fatalf("AllocateIPWithParent failed: %v", err)
+	}
+	if info.CIDR != "10.0.1.0/30" || info.Description != "dmz" || info.IPNet.Mask.String() != "fffffffc" {
+		t.Errorf("Unexpected parent: %+v", info)
+	}
+	if allocated, _ := storage.GetAllocatedIPs(ctx); allocated["10.0.1.2"] != "web" {
+		t.Errorf("Expected 10.0.1.2 to be allocated, got %v", allocated)
+	}
+
+	// 修改返回的网络不影响管理池
+	info.IPNet.IP[0] = 192
+	if managed := guardian.managedCIDRs.load()["10.0.1.0/30"]; managed.IPNet.String() != "10.0.1.0/30" {
+		t.Errorf("Expected managed CIDR to be unaffected, got %s", managed.IPNet)
+	}
+
+	// 不在管理 CIDR 中的IP不分配
+	if _, err := guardian.AllocateIPWithParent(ctx, "172.16.0.1", "x"); err == nil {
+		t.Error("Expected error for IP outside managed CIDRs")
+	}
+	if allocated, _ := storage.GetAllocatedIPs(ctx); len(allocated) != 1 {
+		t.Errorf("Expected only one allocation, got %v", allocated)
+	}
+
+	// 分配失败时返回错误
+	if _, err := guardian.AllocateIPWithParent(ctx, "10.0.1.2", "again"); err == nil {
+		t.Error("Expected error for already allocated IP")
+	}
+	if _, err := guardian.AllocateIPWithParent(ctx, "invalid", "x"); err == nil {
+		t.Error("Expected error for invalid IP")
+	}
+}
+
 // TestCIDRGuardian_AllocateCIDR 测试分配CIDR
 func TestCIDRGuardian_AllocateCIDR(t *testing.T) {
 	ctx := context.Background()
@@ -967,12 +1122,11 @@ func TestCIDRGuardian_ExpandPool(t *testing.T) {
 		t.Error("ExpandPool should fail when GetAllocatedIPs fails")
 	}
 
-	// 测试添加IP失败
-	mockStorage.setFailure("GetAllocatedIPs", "")
-	mockStorage.setFailure("AddIP", "mock failure")
+	// 测试批量添加IP失败
+	mockStorage.setFailure("BulkAddIP", "mock failure")
 	err = guardian.ExpandPool(ctx, "192.168.0.0/24")
 	if err == nil {
-		t.Error("ExpandPool should fail when AddIP fails")
+		t.Error("ExpandPool should fail when BulkAddIP fails")
 	}
 }
 
@@ -1034,6 +1188,52 @@ func TestCIDRGuardian_GetAvailableCIDRs(t *testing.T) {
 		t.Error("GetAvailableCIDRs should fail when GetAvailableIPs fails")
 	}
 }
+func TestCIDRGuardian_GetAvailableCIDRsWithinManaged(t *testing.T) {
+	ctx := context.Background()
+	guardian, err := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if err != nil {
+		t.Fatalf("NewCIDRGuardian failed: %v", err)
+	}
+
+	// 两个相邻的 /25 组成一个 /24，但分别管理
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/25", "low"); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+	if err := guardian.AddCIDR(ctx, "10.0.0.128/25", "high"); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+
+	cidrs, err := guardian.GetAvailableCIDRs(ctx, WithinManagedCIDRs())
+	if err != nil {
+		t.Fatalf("GetAvailableCIDRs failed: %v", err)
+	}
+	if want := []string{"10.0.0.0/25", "10.0.0.128/25"}; !reflect.DeepEqual(cidrs, want) {
+		t.Errorf("Expected %v, got %v", want, cidrs)
+	}
+
+	// 已分配的IP被排除，剩余地址拆分为对齐块
+	if err := guardian.AllocateIP(ctx, "10.0.0.0", "gw"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	cidrs, err = guardian.GetAvailableCIDRs(ctx, WithinManagedCIDRs())
+	if err != nil {
+		t.Fatalf("GetAvailableCIDRs failed: %v", err)
+	}
+	want := []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/29", "10.0.0.16/28",
+		"10.0.0.32/27", "10.0.0.64/26", "10.0.0.128/25"}
+	if !reflect.DeepEqual(cidrs, want) {
+		t.Errorf("Expected %v, got %v", want, cidrs)
+	}
+
+	// 默认行为仍按 /24 分组
+	cidrs, err = guardian.GetAvailableCIDRs(ctx)
+	if err != nil {
+		t.Fatalf("GetAvailableCIDRs failed: %v", err)
+	}
+	if want := []string{"10.0.0.0/24"}; !reflect.DeepEqual(cidrs, want) {
+		t.Errorf("Expected %v, got %v", want, cidrs)
+	}
+}
 
 // TestCIDRGuardian_GetUsedCIDRs 测试获取已用CIDR
 func TestCIDRGuardian_GetUsedCIDRs(t *testing.T) {
@@ -1087,6 +1287,67 @@ func TestCIDRGuardian_GetUsedCIDRs(t *testing.T) {
 	}
 }
 
+// TestCIDRGuardian_GetUsedCIDRsAggregated 测试合并描述相同的相邻块
+func TestCIDRGuardian_GetUsedCIDRsAggregated(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/27")
+
+	// 10.0.0.0/30 和 10.0.0.4/30 相邻且对齐，10.0.0.12/30 与前两块不相邻，10.0.0.8/30 描述不同
+	for _, cidr := range []string{"10.0.0.0/30", "10.0.0.4/30", "10.0.0.12/30", "10.0.0.20/30"} {
+		if err := guardian.AllocateSpecificCIDR(ctx, cidr, "web"); err != nil {
+			t.Fatalf("AllocateSpecificCIDR(%s) failed: %v", cidr, err)
+		}
+	}
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.8/30", "db"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+
+	aggregated, err := guardian.GetUsedCIDRs(ctx, WithAggregatedBlocks())
+	if err != nil {
+		t.Fatalf("GetUsedCIDRs failed: %v", err)
+	}
+	expected := map[string]string{
+		"10.0.0.0/29":  "web",
+		"10.0.0.8/30":  "db",
+		"10.0.0.12/30": "web",
+		"10.0.0.20/30": "web",
+	}
+	if !reflect.DeepEqual(aggregated, expected) {
+		t.Errorf("Expected %v, got %v", expected, aggregated)
+	}
+
+	// 不传选项时仍按块逐条返回
+	raw, _ := guardian.GetUsedCIDRs(ctx)
+	if len(raw) != 5 || raw["10.0.0.0/30"] != "web" || raw["10.0.0.4/30"] != "web" {
+		t.Errorf("Expected per-block entries, got %v", raw)
+	}
+}
+
+// TestMergeCIDRs 测试合并 CIDR
+func TestMergeCIDRs(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{[]string{"10.0.0.4/30", "10.0.0.0/30"}, []string{"10.0.0.0/29"}},
+		{[]string{"10.0.0.4/30", "10.0.0.8/30"}, []string{"10.0.0.4/30", "10.0.0.8/30"}},
+		{[]string{"10.0.0.0/24", "10.0.0.128/25", "10.0.1.0/24"}, []string{"10.0.0.0/23"}},
+		{[]string{"10.0.0.0/30", "10.0.0.12/30"}, []string{"10.0.0.0/30", "10.0.0.12/30"}},
+		{[]string{"10.0.0.1/30", "255.255.255.252/30", "2001:db8::/33", "2001:db8:8000::/33"}, []string{"10.0.0.0/30", "255.255.255.252/30", "2001:db8::/32"}},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		got, err := MergeCIDRs(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MergeCIDRs(%v) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := MergeCIDRs([]string{"invalid"}); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
 // TestCIDRGuardian_AvailableCount 测试获取可用IP数量
 func TestCIDRGuardian_AvailableCount(t *testing.T) {
 	ctx := context.Background()
@@ -1251,6 +1512,51 @@ func TestHelperFunctions(t *testing.T) {
 	if !ip.Equal(net.ParseIP("192.168.1.0")) {
 		t.Error("nextIP should handle overflow correctly")
 	}
+
+	// 越过全 1 地址时回绕并返回 true
+	ip = net.ParseIP("255.255.255.255").To4()
+	if wrapped := nextIP(ip); !wrapped || !ip.Equal(net.IPv4zero) {
+		t.Errorf("nextIP should report wraparound, got %s (wrapped=%v)", ip, wrapped)
+	}
+	ip = net.ParseIP("255.255.255.254").To4()
+	if wrapped := nextIP(ip); wrapped {
+		t.Error("nextIP should not report wraparound before the all-ones address")
+	}
+}
+
+// TestCIDRGuardian_AllOnesBroadcast 测试遍历广播地址为全 1 地址的 CIDR
+func TestCIDRGuardian_AllOnesBroadcast(t *testing.T) {
+	ctx := context.Background()
+	guardian, err := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "255.255.255.248/29")
+	if err != nil {
+		t.Fatalf("NewCIDRGuardian failed: %v", err)
+	}
+
+	ips, err := guardian.GetAvailableIPs(ctx)
+	if err != nil {
+		t.Fatalf("GetAvailableIPs failed: %v", err)
+	}
+	if len(ips) != 8 || ips[7] != "255.255.255.255" {
+		t.Fatalf("Expected 8 IPs ending at 255.255.255.255, got %v", ips)
+	}
+
+	// 分配和释放以全 1 地址结尾的块
+	if err := guardian.AllocateSpecificCIDR(ctx, "255.255.255.252/30", "tail"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+	if err := guardian.ReleaseCIDR(ctx, "255.255.255.252/30"); err != nil {
+		t.Fatalf("ReleaseCIDR failed: %v", err)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 8 {
+		t.Errorf("Expected 8 available IPs after release, got %d", count)
+	}
+
+	if err := guardian.RemoveCIDR(ctx, "255.255.255.248/29"); err != nil {
+		t.Fatalf("RemoveCIDR failed: %v", err)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 0 {
+		t.Errorf("Expected no available IPs after removal, got %d", count)
+	}
 }
 
 // TestCIDRGuardian_GetNextAvailableIP 测试获取下一个可用IP
@@ -1304,6 +1610,162 @@ func TestCIDRGuardian_GetNextAvailableIP(t *testing.T) {
 	}
 }
 
+// TestCIDRGuardian_GetNextAvailableIPInCIDR 测试只从指定的管理 CIDR 中分配
+func TestCIDRGuardian_GetNextAvailableIPInCIDR(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/30", "10.0.1.0/31")
+
+	// 从数值较大的 CIDR 分配，不受另一个 CIDR 中更小地址的影响
+	for _, want := range []string{"10.0.1.0", "10.0.1.1"} {
+		ip, err := guardian.GetNextAvailableIPInCIDR(ctx, "10.0.1.0/31", "db")
+		if err != nil {
+			t.Fatalf("GetNextAvailableIPInCIDR failed: %v", err)
+		}
+		if ip != want {
+			t.Errorf("Expected %s, got %s", want, ip)
+		}
+	}
+
+	// CIDR 耗尽时返回错误，不从其他 CIDR 分配
+	if _, err := guardian.GetNextAvailableIPInCIDR(ctx, "10.0.1.0/31", "db"); err == nil {
+		t.Error("GetNextAvailableIPInCIDR should fail when the CIDR is exhausted")
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 4 {
+		t.Errorf("Expected the other CIDR to keep 4 available IPs, got %d", count)
+	}
+
+	// 设置了主机位的 CIDR 按网络形式匹配
+	ip, err := guardian.GetNextAvailableIPInCIDR(ctx, "10.0.0.2/30", "web")
+	if err != nil || ip != "10.0.0.0" {
+		t.Errorf("Expected 10.0.0.0, got %s, %v", ip, err)
+	}
+
+	// CIDR 不在管理池中或格式无效
+	if _, err := guardian.GetNextAvailableIPInCIDR(ctx, "10.0.2.0/24", "x"); err == nil {
+		t.Error("GetNextAvailableIPInCIDR should fail for an unmanaged CIDR")
+	}
+	if _, err := guardian.GetNextAvailableIPInCIDR(ctx, "invalid", "x"); err == nil {
+		t.Error("GetNextAvailableIPInCIDR should fail with invalid CIDR")
+	}
+
+	// 达到软上限时返回 ErrSoftCapReached
+	capped, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if err := capped.AddCIDR(ctx, "10.0.0.0/30", "capped", WithSoftCap(50)); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := capped.GetNextAvailableIPInCIDR(ctx, "10.0.0.0/30", "x"); err != nil {
+			t.Fatalf("GetNextAvailableIPInCIDR failed: %v", err)
+		}
+	}
+	if _, err := capped.GetNextAvailableIPInCIDR(ctx, "10.0.0.0/30", "x"); !errors.Is(err, ErrSoftCapReached) {
+		t.Errorf("Expected ErrSoftCapReached, got %v", err)
+	}
+}
+
+// TestCIDRGuardian_GetLastAvailableIP 测试获取数值最大的可用IP
+func TestCIDRGuardian_GetLastAvailableIP(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := newMockIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, mockStorage)
+
+	// 添加三个IP，按数值而非字典序比较
+	mockStorage.available["192.168.0.2"] = true
+	mockStorage.available["192.168.0.10"] = true
+	mockStorage.available["192.168.0.9"] = true
+
+	// 测试正常获取
+	ip, err := guardian.GetLastAvailableIP(ctx, "test")
+	if err != nil {
+		t.Errorf("GetLastAvailableIP should succeed: %v", err)
+	}
+	if ip != "192.168.0.10" {
+		t.Errorf("Expected 192.168.0.10, got %s", ip)
+	}
+	if ip, _ = guardian.GetLastAvailableIP(ctx, "test"); ip != "192.168.0.9" {
+		t.Errorf("Expected 192.168.0.9, got %s", ip)
+	}
+
+	// 测试没有可用IP
+	mockStorage.available = make(map[string]bool)
+	_, err = guardian.GetLastAvailableIP(ctx, "test")
+	if err == nil {
+		t.Error("GetLastAvailableIP should fail when no IP is available")
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = guardian.GetLastAvailableIP(canceledCtx, "test")
+	if err == nil {
+		t.Error("GetLastAvailableIP should fail when context is canceled")
+	}
+
+	// 测试获取IP列表失败
+	mockStorage.setFailure("GetAvailableIPs", "mock failure")
+	_, err = guardian.GetLastAvailableIP(ctx, "test")
+	if err == nil {
+		t.Error("GetLastAvailableIP should fail when GetAvailableIPs fails")
+	}
+
+	// 测试分配IP失败
+	mockStorage.setFailure("GetAvailableIPs", "")
+	mockStorage.available["192.168.0.1"] = true
+	mockStorage.setFailure("AllocateIP", "mock failure")
+	_, err = guardian.GetLastAvailableIP(ctx, "test")
+	if err == nil {
+		t.Error("GetLastAvailableIP should fail when AllocateIP fails")
+	}
+}
+
+// TestCIDRGuardian_AvoidRecentReuse 测试 GetNextAvailableIP 避开近期释放的IP
+func TestCIDRGuardian_AvoidRecentReuse(t *testing.T) {
+	ctx := context.Background()
+
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithInitialCIDRs("10.0.0.0/30"), WithAvoidRecentReuse(time.Hour))
+	now := time.Now()
+	guardian.released.times = map[string]time.Time{
+		"10.0.0.0": now.Add(-time.Minute),     // 近期释放
+		"10.0.0.1": now.Add(-2 * time.Minute), // 近期释放
+		"10.0.0.2": now.Add(-2 * time.Hour),   // 已超出窗口
+	}
+
+	// 跳过近期释放的IP，选择数值最小的其他IP
+	for _, want := range []string{"10.0.0.2", "10.0.0.3"} {
+		if ip, err := guardian.GetNextAvailableIP(ctx, "web"); err != nil || ip != want {
+			t.Errorf("Expected %s, got %s, %v", want, ip, err)
+		}
+	}
+	// 全部都是近期释放的IP时，选择释放时间最早的
+	for _, want := range []string{"10.0.0.1", "10.0.0.0"} {
+		if ip, err := guardian.GetNextAvailableIP(ctx, "web"); err != nil || ip != want {
+			t.Errorf("Expected fallback %s, got %s, %v", want, ip, err)
+		}
+	}
+
+	// 释放会记录时间，释放的IP暂不被复用
+	_ = guardian.ReleaseIP(ctx, "10.0.0.2")
+	_ = guardian.ReleaseIP(ctx, "10.0.0.3")
+	if _, ok := guardian.released.times["10.0.0.2"]; !ok {
+		t.Error("Expected release time of 10.0.0.2 to be recorded")
+	}
+	guardian.released.times["10.0.0.3"] = now.Add(-2 * time.Hour)
+	if ip, _ := guardian.GetNextAvailableIP(ctx, "web"); ip != "10.0.0.3" {
+		t.Errorf("Expected 10.0.0.3 released outside the window, got %s", ip)
+	}
+
+	// 未启用时按数值顺序复用
+	plain, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/30")
+	_, _ = plain.GetNextAvailableIP(ctx, "web")
+	_ = plain.ReleaseIP(ctx, "10.0.0.0")
+	if ip, _ := plain.GetNextAvailableIP(ctx, "web"); ip != "10.0.0.0" {
+		t.Errorf("Expected 10.0.0.0 to be reused, got %s", ip)
+	}
+	if len(plain.released.times) != 0 {
+		t.Errorf("Expected no release times without WithAvoidRecentReuse, got %v", plain.released.times)
+	}
+}
+
 // setupMockDB 创建一个带有 Mock 的数据库连接
 func setupMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock, *SQLIPStorage) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
@@ -1319,6 +1781,16 @@ func setupMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock, *SQLIPStorage) {
 	return db, mock, storage
 }
 
+// expectCurrentAllocatedColumns 预期 initTables 检查 ip_allocated 的列，并返回当前版本的完整表结构
+func expectCurrentAllocatedColumns(mock sqlmock.Sqlmock) {
+	rows := sqlmock.NewRows([]string{"column_name"})
+	for _, column := range []string{"ip", "description", "source", "expires_at", "metadata", "allocation_type", "cidr", "claim_token", "claim_expires_at", "allocated_at"} {
+		rows.AddRow(column)
+	}
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?").
+		WithArgs("ip_allocated").WillReturnRows(rows)
+}
+
 // TestNewSQLIPStorage_Integration 集成测试新建 SQL 存储
 // 这个测试需要实际的数据库连接，如果环境变量未设置则跳过
 func TestNewSQLIPStorage_Integration(t *testing.T) {
@@ -1389,6 +1861,46 @@ func TestNewSQLIPStorage_Integration(t *testing.T) {
 	}
 }
 
+// TestSQLIPStorage_Config 测试读取驱动名称和隐藏密码后的配置
+func TestSQLIPStorage_Config(t *testing.T) {
+	config := SQLConfig{
+		DriverName:     "mysql",
+		DataSourceName: "app:s3cr@t@tcp(db:3306)/ipam?parseTime=true",
+		MaxOpenConns:   10,
+		HistoryLimit:   5,
+	}
+	storage := &SQLIPStorage{driverName: config.DriverName, config: config}
+
+	if storage.DriverName() != "mysql" {
+		t.Errorf("Expected driver mysql, got %s", storage.DriverName())
+	}
+	got := storage.Config()
+	if got.DataSourceName != "app:xxxxx@tcp(db:3306)/ipam?parseTime=true" {
+		t.Errorf("Expected password to be masked, got %s", got.DataSourceName)
+	}
+	if got.MaxOpenConns != 10 || got.HistoryLimit != 5 {
+		t.Errorf("Expected other fields to be kept, got %+v", got)
+	}
+	if storage.config.DataSourceName != config.DataSourceName {
+		t.Error("Config should not modify the stored DSN")
+	}
+
+	tests := map[string]string{
+		"postgres://app:s3cret@db:5432/ipam?sslmode=disable": "postgres://app:xxxxx@db:5432/ipam?sslmode=disable",
+		"host=db user=app password=s3cret dbname=ipam":       "host=db user=app password=xxxxx dbname=ipam",
+		"host=db password='s3 cr\\'et' dbname=ipam":          "host=db password=xxxxx dbname=ipam",
+		"app@tcp(db:3306)/ipam":                              "app@tcp(db:3306)/ipam",
+		"/ipam":                                              "/ipam",
+		"postgres://db:5432/ipam":                            "postgres://db:5432/ipam",
+		"root:pw@unix(/var/run/mysqld/mysqld.sock)/ipam?x=1": "root:xxxxx@unix(/var/run/mysqld/mysqld.sock)/ipam?x=1",
+	}
+	for dsn, want := range tests {
+		if got := redactDSN(dsn); got != want {
+			t.Errorf("redactDSN(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
+
 // TestSQLIPStorage_initTables 测试表初始化
 func TestSQLIPStorage_initTables(t *testing.T) {
 	db, mock, storage := setupMockDB(t)
@@ -1405,8 +1917,34 @@ func TestSQLIPStorage_initTables(t *testing.T) {
 	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_allocated (
 			ip VARCHAR(45) PRIMARY KEY,
 			description TEXT,
+			source VARCHAR(255) NOT NULL DEFAULT '',
+			expires_at TIMESTAMP NULL,
+			metadata JSON NULL,
+			allocation_type VARCHAR(8) NOT NULL DEFAULT 'single',
+			cidr VARCHAR(49) NULL,
+			claim_token VARCHAR(64) NULL,
+			claim_expires_at TIMESTAMP NULL,
 			allocated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	// 新建的表已包含所有列，不需要迁移
+	expectCurrentAllocatedColumns(mock)
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS cidr_archive (
+			cidr VARCHAR(49) PRIMARY KEY,
+			description TEXT,
+			available_ips LONGTEXT,
+			allocated_ips LONGTEXT,
+			archived_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_reserved (
+			ip VARCHAR(45) PRIMARY KEY,
+			reason TEXT,
+			reserved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_excluded (
+			ip VARCHAR(45) PRIMARY KEY,
+			excluded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
 
 	// 执行初始化
 	err := storage.initTables(ctx)
@@ -1420,6 +1958,72 @@ func TestSQLIPStorage_initTables(t *testing.T) {
 	}
 }
 
+// TestSQLIPStorage_initTablesMigration 测试为基线版本创建的 ip_allocated 表补上新增的列
+func TestSQLIPStorage_initTablesMigration(t *testing.T) {
+	ctx := context.Background()
+	query := "SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?"
+	alters := []string{
+		"ALTER TABLE ip_allocated ADD COLUMN source VARCHAR(255) NOT NULL DEFAULT ''",
+		"ALTER TABLE ip_allocated ADD COLUMN expires_at TIMESTAMP NULL",
+		"ALTER TABLE ip_allocated ADD COLUMN metadata JSON NULL",
+		"ALTER TABLE ip_allocated ADD COLUMN allocation_type VARCHAR(8) NOT NULL DEFAULT 'single'",
+		"ALTER TABLE ip_allocated ADD COLUMN cidr VARCHAR(49) NULL",
+		"ALTER TABLE ip_allocated ADD COLUMN claim_token VARCHAR(64) NULL",
+		"ALTER TABLE ip_allocated ADD COLUMN claim_expires_at TIMESTAMP NULL",
+	}
+
+	// 建表语句按前缀匹配，其余语句完整匹配
+	newMock := func(driver string) (*sql.DB, sqlmock.Sqlmock, *SQLIPStorage) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("无法创建 sqlmock: %v", err)
+		}
+		return db, mock, &SQLIPStorage{db: db, driverName: driver}
+	}
+
+	for _, driver := range []string{"mysql", "postgres"} {
+		db, mock, storage := newMock(driver)
+		if driver == "postgres" {
+			query = "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1"
+		}
+
+		// 建表语句因已存在的表而不生效，ip_allocated 仍是基线的结构
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_available`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_allocated`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(query)).WithArgs("ip_allocated").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("ip").AddRow("description").AddRow("allocated_at"))
+		for _, alter := range alters {
+			if driver == "postgres" {
+				alter = strings.Replace(alter, "metadata JSON", "metadata JSONB", 1)
+			}
+			mock.ExpectExec("^" + regexp.QuoteMeta(alter) + "$").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		for _, table := range []string{"cidr_archive", "ip_reserved", "ip_excluded"} {
+			mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ` + table).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+
+		if err := storage.initTables(ctx); err != nil {
+			t.Errorf("%s: initTables 失败: %v", driver, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: 有未满足的预期: %s", driver, err)
+		}
+		db.Close()
+	}
+
+	// 添加列失败时返回错误
+	db, mock, storage := newMock("mysql")
+	defer db.Close()
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_available`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_allocated`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("ip_allocated").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("ip").AddRow("description"))
+	mock.ExpectExec(regexp.QuoteMeta(alters[0])).WillReturnError(fmt.Errorf("permission denied"))
+	if err := storage.initTables(ctx); err == nil || !strings.Contains(err.Error(), "source") {
+		t.Errorf("添加列失败时应返回错误，得到 %v", err)
+	}
+}
+
 // TestSQLIPStorage_AddIP 测试添加 IP
 func TestSQLIPStorage_AddIP(t *testing.T) {
 	db, mock, storage := setupMockDB(t)
@@ -1436,6 +2040,8 @@ func TestSQLIPStorage_AddIP(t *testing.T) {
 		WillReturnRows(checkRows)
 
 	// 预期添加到可用池
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_reserved WHERE ip = ?").
+		WithArgs(ip).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 	mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?) ON DUPLICATE KEY UPDATE ip = ip").
 		WithArgs(ip).
 		WillReturnResult(sqlmock.NewResult(1, 1))
@@ -1467,21 +2073,82 @@ func TestSQLIPStorage_AddIP(t *testing.T) {
 		t.Error("当 IP 已分配时，AddIP 应该失败")
 	}
 
+	// 测试 IP 已预留的情况，保持预留而不加入可用池
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs(ip).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_reserved WHERE ip = ?").
+		WithArgs(ip).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	if err := storage.AddIP(ctx, ip); err != nil {
+		t.Errorf("当 IP 已预留时，AddIP 应该跳过: %v", err)
+	}
+
 	// 验证所有预期的 SQL 语句已被执行
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("有未满足的预期: %s", err)
 	}
 }
 
-// TestSQLIPStorage_RemoveIP 测试移除 IP
-func TestSQLIPStorage_RemoveIP(t *testing.T) {
+// TestSQLIPStorage_StrictAdd 测试 StrictAdd 下 IP 已在可用池中时 AddIP 返回 ErrIPAlreadyAvailable
+func TestSQLIPStorage_StrictAdd(t *testing.T) {
 	db, mock, storage := setupMockDB(t)
 	defer db.Close()
+	storage.strictAdd = true
 
 	ctx := context.Background()
 	ip := "192.168.1.1"
 
-	// 预期检查 IP 是否可用
+	// 首次添加影响一行
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs(ip).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_reserved WHERE ip = ?").
+		WithArgs(ip).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?) ON DUPLICATE KEY UPDATE ip = ip").
+		WithArgs(ip).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := storage.AddIP(ctx, ip); err != nil {
+		t.Errorf("AddIP 失败: %v", err)
+	}
+
+	// 重复添加不影响任何行
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs(ip).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_reserved WHERE ip = ?").
+		WithArgs(ip).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?) ON DUPLICATE KEY UPDATE ip = ip").
+		WithArgs(ip).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := storage.AddIP(ctx, ip)
+	if !errors.Is(err, ErrIPAlreadyAvailable) {
+		t.Errorf("期望 ErrIPAlreadyAvailable，实际为 %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestSQLIPStorage_RemoveIP 测试移除 IP
+func TestSQLIPStorage_RemoveIP(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	ip := "192.168.1.1"
+
+	// 预期检查 IP 是否可用
 	mock.ExpectBegin()
 	checkRows := sqlmock.NewRows([]string{"count"}).AddRow(1)
 	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
@@ -1568,6 +2235,47 @@ func TestSQLIPStorage_IsIPAvailable(t *testing.T) {
 	}
 }
 
+// TestSQLIPStorage_AreIPsAvailable 测试分批的 IN 查询
+func TestSQLIPStorage_AreIPsAvailable(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	// 超过 availabilityChunkSize 时分成多条查询
+	ips := make([]string, availabilityChunkSize+2)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	first := make([]driver.Value, availabilityChunkSize)
+	for i := range first {
+		first[i] = ips[i]
+	}
+	query := func(n int) string {
+		return "SELECT ip FROM ip_available WHERE ip IN (" + strings.TrimSuffix(strings.Repeat("?, ", n), ", ") + ")"
+	}
+	mock.ExpectQuery(query(availabilityChunkSize)).WithArgs(first...).
+		WillReturnRows(sqlmock.NewRows([]string{"ip"}).AddRow(ips[0]).AddRow(ips[3]))
+	mock.ExpectQuery(query(2)).WithArgs(ips[availabilityChunkSize], ips[availabilityChunkSize+1]).
+		WillReturnRows(sqlmock.NewRows([]string{"ip"}).AddRow(ips[availabilityChunkSize+1]))
+
+	result, err := storage.AreIPsAvailable(ctx, ips)
+	if err != nil {
+		t.Fatalf("AreIPsAvailable 失败: %v", err)
+	}
+	if len(result) != len(ips) || !result[ips[0]] || result[ips[1]] || !result[ips[3]] || result[ips[availabilityChunkSize]] || !result[ips[availabilityChunkSize+1]] {
+		t.Errorf("结果不符: %d 条", len(result))
+	}
+
+	mock.ExpectQuery(query(1)).WithArgs("10.0.0.1").WillReturnError(fmt.Errorf("query failed"))
+	if _, err := storage.AreIPsAvailable(ctx, []string{"10.0.0.1"}); err == nil {
+		t.Error("查询失败时 AreIPsAvailable 应该返回错误")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
 // TestSQLIPStorage_GetAvailableIPs 测试获取可用 IP 列表
 func TestSQLIPStorage_GetAvailableIPs(t *testing.T) {
 	db, mock, storage := setupMockDB(t)
@@ -1665,6 +2373,65 @@ func TestSQLIPStorage_AllocateIP(t *testing.T) {
 	}
 }
 
+// TestSQLIPStorage_BadConnRetry 测试事务遇到失效连接时自动重试一次
+func TestSQLIPStorage_BadConnRetry(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	ip := "192.168.1.1"
+	checkSQL := "SELECT COUNT(*) FROM ip_available WHERE ip = ?"
+
+	// 第一次事务遇到失效连接，重试成功
+	mock.ExpectBegin()
+	mock.ExpectQuery(checkSQL).WithArgs(ip).WillReturnError(driver.ErrBadConn)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(checkSQL).WithArgs(ip).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").WithArgs(ip).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_allocated (ip, description) VALUES (?, ?)").WithArgs(ip, "web").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := storage.AllocateIP(ctx, ip, "web"); err != nil {
+		t.Errorf("AllocateIP should succeed after retry: %v", err)
+	}
+
+	// 业务错误不重试
+	mock.ExpectBegin()
+	mock.ExpectQuery(checkSQL).WithArgs(ip).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+
+	if err := storage.AllocateIP(ctx, ip, "web"); !errors.Is(err, ErrIPUnavailable) {
+		t.Errorf("Expected ErrIPUnavailable without retry, got %v", err)
+	}
+
+	// 只重试一次
+	mock.ExpectBegin()
+	mock.ExpectQuery(checkSQL).WithArgs(ip).WillReturnError(driver.ErrBadConn)
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(checkSQL).WithArgs(ip).WillReturnError(driver.ErrBadConn)
+	mock.ExpectRollback()
+
+	if err := storage.RemoveIP(ctx, ip); !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("Expected bad connection error after one retry, got %v", err)
+	}
+
+	// 提交失败的结果不确定，不重试
+	mock.ExpectBegin()
+	mock.ExpectQuery(checkSQL).WithArgs(ip).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").WithArgs(ip).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(driver.ErrBadConn)
+
+	if err := storage.RemoveIP(ctx, ip); err == nil {
+		t.Error("Expected commit failure to be returned")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
 // TestSQLIPStorage_DeallocateIP 测试释放 IP
 func TestSQLIPStorage_DeallocateIP(t *testing.T) {
 	db, mock, storage := setupMockDB(t)
@@ -1717,6 +2484,219 @@ func TestSQLIPStorage_DeallocateIP(t *testing.T) {
 	}
 }
 
+// TestSQLIPStorage_ListAllocations 测试SQL存储的分页查询
+func TestSQLIPStorage_ListAllocations(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	query := "SELECT ip, description, source, cidr FROM ip_allocated ORDER BY ip LIMIT ? OFFSET ?"
+
+	mock.ExpectQuery(query).WithArgs(2, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"ip", "description", "source", "cidr"}).
+			AddRow("192.168.1.5", "web", "host-a", nil).
+			AddRow("192.168.1.8", "db", "", "192.168.1.8/30"))
+	page, err := storage.ListAllocations(ctx, 4, 2)
+	expected := []Allocation{
+		{IP: "192.168.1.5", Description: "web", Source: "host-a"},
+		{IP: "192.168.1.8", Description: "db", CIDR: "192.168.1.8/30"},
+	}
+	if err != nil || !reflect.DeepEqual(page, expected) {
+		t.Errorf("预期 %v, 得到 %v, %v", expected, page, err)
+	}
+
+	// 测试超出范围的页
+	mock.ExpectQuery(query).WithArgs(2, 100).WillReturnRows(sqlmock.NewRows([]string{"ip", "description", "source", "cidr"}))
+	if page, err := storage.ListAllocations(ctx, 100, 2); err != nil || len(page) != 0 || page == nil {
+		t.Errorf("预期空切片, 得到 %v, %v", page, err)
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_ListAllocations 测试分页列出分配
+// TestSQLIPStorage_BlockAllocation 测试块分配记录到 allocation_type 和 cidr 列
+func TestSQLIPStorage_BlockAllocation(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.8").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.8").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_allocated (ip, description) VALUES (?, ?)").
+		WithArgs("192.168.1.8", "db").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE ip_allocated SET allocation_type = ?, cidr = ? WHERE ip = ?").
+		WithArgs("cidr", "192.168.1.8/30", "192.168.1.8").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := storage.AllocateBlock(ctx, "192.168.1.9/30", "db"); err != nil {
+		t.Errorf("AllocateBlock 失败: %v", err)
+	}
+
+	// 测试网络地址不可用时不写入块记录
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.8").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+	if err := storage.AllocateBlock(ctx, "192.168.1.8/30", "db"); !errors.Is(err, ErrIPUnavailable) {
+		t.Errorf("预期 ErrIPUnavailable, 得到 %v", err)
+	}
+
+	if err := storage.AllocateBlock(ctx, "invalid", "db"); err == nil {
+		t.Error("无效的 CIDR 应该返回错误")
+	}
+
+	mock.ExpectQuery("SELECT cidr, description FROM ip_allocated WHERE allocation_type = ?").
+		WithArgs("cidr").
+		WillReturnRows(sqlmock.NewRows([]string{"cidr", "description"}).AddRow("192.168.1.8/30", "db"))
+	blocks, err := storage.GetBlockAllocations(ctx)
+	if err != nil || !reflect.DeepEqual(blocks, map[string]string{"192.168.1.8/30": "db"}) {
+		t.Errorf("预期 map[192.168.1.8/30:db], 得到 %v, %v", blocks, err)
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+func TestCIDRGuardian_ListAllocations(t *testing.T) {
+	ctx := context.Background()
+
+	storages := map[string]IPStorage{
+		"memory":   NewMemoryIPStorage(),
+		"fallback": newMockIPStorage(),
+	}
+	for name, storage := range storages {
+		guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/24")
+		// 按数值而非字典序排列，10.0.0.10 在 10.0.0.9 之后
+		for _, ip := range []string{"10.0.0.10", "10.0.0.2", "10.0.0.9", "10.0.0.100", "10.0.0.1"} {
+			_ = guardian.AllocateIP(ctx, ip, "desc-"+ip)
+		}
+
+		pages := []struct {
+			offset, limit int
+			expected      []string
+		}{
+			{0, 2, []string{"10.0.0.1", "10.0.0.2"}},
+			{2, 2, []string{"10.0.0.9", "10.0.0.10"}},
+			{4, 2, []string{"10.0.0.100"}},
+			{0, 10, []string{"10.0.0.1", "10.0.0.2", "10.0.0.9", "10.0.0.10", "10.0.0.100"}},
+			{5, 2, []string{}},
+			{50, 2, []string{}},
+		}
+		for _, tc := range pages {
+			page, err := guardian.ListAllocations(ctx, tc.offset, tc.limit)
+			if err != nil {
+				t.Fatalf("%s: ListAllocations(%d, %d) failed: %v", name, tc.offset, tc.limit, err)
+			}
+			ips := []string{}
+			for _, allocation := range page {
+				ips = append(ips, allocation.IP)
+			}
+			if !reflect.DeepEqual(ips, tc.expected) {
+				t.Errorf("%s: ListAllocations(%d, %d) = %v, expected %v", name, tc.offset, tc.limit, ips, tc.expected)
+			}
+		}
+
+		page, _ := guardian.ListAllocations(ctx, 0, 1)
+		if len(page) != 1 || page[0].Description != "desc-10.0.0.1" {
+			t.Errorf("%s: Expected description of 10.0.0.1, got %v", name, page)
+		}
+
+		// 测试无效的分页参数
+		for _, args := range [][2]int{{-1, 2}, {0, 0}, {0, -1}} {
+			if _, err := guardian.ListAllocations(ctx, args[0], args[1]); err == nil {
+				t.Errorf("%s: ListAllocations(%d, %d) should fail", name, args[0], args[1])
+			}
+		}
+	}
+
+	// 测试来源随分页返回
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithInitialCIDRs("10.0.0.0/30"), WithSource("host-a"))
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	if page, _ := guardian.ListAllocations(ctx, 0, 1); len(page) != 1 || page[0].Source != "host-a" {
+		t.Errorf("Expected source host-a, got %v", page)
+	}
+}
+
+// TestCIDRGuardian_BlockAllocationRecords 测试块分配与单个IP分配无需解析描述即可区分
+func TestCIDRGuardian_BlockAllocationRecords(t *testing.T) {
+	ctx := context.Background()
+
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/28")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.4/30", "db - primary"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+	// 看起来像旧格式的单个IP描述不会被当作块
+	if err := guardian.AllocateIP(ctx, "10.0.0.1", "web - 1"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+
+	if storage.allocated["10.0.0.4"] != "db - primary" {
+		t.Errorf("Expected block description to be stored as-is, got %q", storage.allocated["10.0.0.4"])
+	}
+	if blocks, _ := storage.GetBlockAllocations(ctx); !reflect.DeepEqual(blocks, map[string]string{"10.0.0.4/30": "db - primary"}) {
+		t.Errorf("Unexpected block allocations: %v", blocks)
+	}
+	if allocation, _ := guardian.GetAllocation(ctx, "10.0.0.4"); allocation.CIDR != "10.0.0.4/30" || allocation.Description != "db - primary" {
+		t.Errorf("Unexpected block allocation: %+v", allocation)
+	}
+	if allocation, _ := guardian.GetAllocation(ctx, "10.0.0.1"); allocation.CIDR != "" || allocation.Description != "web - 1" {
+		t.Errorf("Unexpected single allocation: %+v", allocation)
+	}
+	page, _ := guardian.ListAllocations(ctx, 0, 10)
+	expected := []Allocation{{IP: "10.0.0.1", Description: "web - 1"}, {IP: "10.0.0.4", Description: "db - primary", CIDR: "10.0.0.4/30"}}
+	if !reflect.DeepEqual(page, expected) {
+		t.Errorf("Expected %v, got %v", expected, page)
+	}
+	if used, _ := guardian.GetUsedCIDRs(ctx); !reflect.DeepEqual(used, map[string]string{"10.0.0.4/30": "db - primary"}) {
+		t.Errorf("Unexpected used CIDRs: %v", used)
+	}
+
+	// 更新描述后仍为块记录，释放后块记录一并删除
+	if err := guardian.UpdateDescription(ctx, "10.0.0.4/30", "db"); err != nil {
+		t.Fatalf("UpdateDescription failed: %v", err)
+	}
+	if storage.allocated["10.0.0.4"] != "db" || storage.blocks["10.0.0.4"] != "10.0.0.4/30" {
+		t.Errorf("Expected block record to survive UpdateDescription, got %q", storage.allocated["10.0.0.4"])
+	}
+	if err := guardian.ReleaseCIDR(ctx, "10.0.0.4/30"); err != nil {
+		t.Fatalf("ReleaseCIDR failed: %v", err)
+	}
+	if blocks, _ := storage.GetBlockAllocations(ctx); len(blocks) != 0 {
+		t.Errorf("Expected no block allocations after release, got %v", blocks)
+	}
+
+	// 不支持块记录的存储仍使用旧格式，读取结果相同
+	legacy := struct{ IPStorage }{NewMemoryIPStorage()}
+	guardian, _ = NewCIDRGuardian(ctx, legacy, "10.0.0.0/28")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.4/30", "db"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+	if allocated, _ := legacy.GetAllocatedIPs(ctx); allocated["10.0.0.4"] != "10.0.0.4/30 - db" {
+		t.Errorf("Expected legacy block description, got %q", allocated["10.0.0.4"])
+	}
+	if allocation, _ := guardian.GetAllocation(ctx, "10.0.0.4"); allocation.CIDR != "10.0.0.4/30" || allocation.Description != "db" {
+		t.Errorf("Unexpected legacy block allocation: %+v", allocation)
+	}
+	if err := guardian.ReleaseCIDR(ctx, "10.0.0.4/30"); err != nil {
+		t.Errorf("ReleaseCIDR failed: %v", err)
+	}
+}
+
 // TestSQLIPStorage_GetAllocatedIPs 测试获取已分配 IP 列表
 func TestSQLIPStorage_GetAllocatedIPs(t *testing.T) {
 	db, mock, storage := setupMockDB(t)
@@ -1832,39 +2812,39 @@ func TestSQLIPStorage_CanceledContext(t *testing.T) {
 	cancel()
 
 	// 测试所有方法，确保它们都处理上下文取消
-	if _, err := storage.IsIPAvailable(ctx, "192.168.1.1"); err != context.Canceled {
+	if _, err := storage.IsIPAvailable(ctx, "192.168.1.1"); !errors.Is(err, context.Canceled) {
 		t.Errorf("IsIPAvailable 应该返回上下文取消错误，得到: %v", err)
 	}
 
-	if err := storage.AddIP(ctx, "192.168.1.1"); err != context.Canceled {
+	if err := storage.AddIP(ctx, "192.168.1.1"); !errors.Is(err, context.Canceled) {
 		t.Errorf("AddIP 应该返回上下文取消错误，得到: %v", err)
 	}
 
-	if err := storage.RemoveIP(ctx, "192.168.1.1"); err != context.Canceled {
+	if err := storage.RemoveIP(ctx, "192.168.1.1"); !errors.Is(err, context.Canceled) {
 		t.Errorf("RemoveIP 应该返回上下文取消错误，得到: %v", err)
 	}
 
-	if _, err := storage.GetAvailableIPs(ctx); err != context.Canceled {
+	if _, err := storage.GetAvailableIPs(ctx); !errors.Is(err, context.Canceled) {
 		t.Errorf("GetAvailableIPs 应该返回上下文取消错误，得到: %v", err)
 	}
 
-	if err := storage.AllocateIP(ctx, "192.168.1.1", "test"); err != context.Canceled {
+	if err := storage.AllocateIP(ctx, "192.168.1.1", "test"); !errors.Is(err, context.Canceled) {
 		t.Errorf("AllocateIP 应该返回上下文取消错误，得到: %v", err)
 	}
 
-	if err := storage.DeallocateIP(ctx, "192.168.1.1"); err != context.Canceled {
+	if err := storage.DeallocateIP(ctx, "192.168.1.1"); !errors.Is(err, context.Canceled) {
 		t.Errorf("DeallocateIP 应该返回上下文取消错误，得到: %v", err)
 	}
 
-	if _, err := storage.GetAllocatedIPs(ctx); err != context.Canceled {
+	if _, err := storage.GetAllocatedIPs(ctx); !errors.Is(err, context.Canceled) {
 		t.Errorf("GetAllocatedIPs 应该返回上下文取消错误，得到: %v", err)
 	}
 
-	if _, err := storage.AvailableCount(ctx); err != context.Canceled {
+	if _, err := storage.AvailableCount(ctx); !errors.Is(err, context.Canceled) {
 		t.Errorf("AvailableCount 应该返回上下文取消错误，得到: %v", err)
 	}
 
-	if _, err := storage.AllocatedCount(ctx); err != context.Canceled {
+	if _, err := storage.AllocatedCount(ctx); !errors.Is(err, context.Canceled) {
 		t.Errorf("AllocatedCount 应该返回上下文取消错误，得到: %v", err)
 	}
 }
@@ -1901,3 +2881,6323 @@ func TestSQLIPStorage_ErrorHandling(t *testing.T) {
 		t.Errorf("有未满足的预期: %s", err)
 	}
 }
+
+// TestCIDRGuardian_PointToPointCIDR 测试 RFC 3021 /31 与 /127 点对点网段
+func TestCIDRGuardian_PointToPointCIDR(t *testing.T) {
+	ctx := context.Background()
+
+	// /31 的两个地址都应进入可用池，不存在网络/广播地址
+	guardian, err := NewCIDRGuardian(ctx, nil, "10.0.0.0/31")
+	if err != nil {
+		t.Fatalf("NewCIDRGuardian should succeed: %v", err)
+	}
+	count, _ := guardian.AvailableCount(ctx)
+	if count != 2 {
+		t.Errorf("Expected 2 available IPs in /31, got %d", count)
+	}
+
+	// 两个地址都可以单独分配，直到耗尽
+	first, err := guardian.GetNextAvailableIP(ctx, "router-a")
+	if err != nil {
+		t.Fatalf("GetNextAvailableIP should succeed: %v", err)
+	}
+	second, err := guardian.GetNextAvailableIP(ctx, "router-b")
+	if err != nil {
+		t.Fatalf("GetNextAvailableIP should succeed: %v", err)
+	}
+	if first != "10.0.0.0" || second != "10.0.0.1" {
+		t.Errorf("Expected 10.0.0.0 and 10.0.0.1, got %s and %s", first, second)
+	}
+	if _, err := guardian.GetNextAvailableIP(ctx, "router-c"); err == nil {
+		t.Error("GetNextAvailableIP should fail when /31 is fully consumed")
+	}
+
+	// 以 /31 为单位分配，直到 /30 被完全消耗
+	guardian, _ = NewCIDRGuardian(ctx, nil, "10.0.1.0/30")
+	cidr, err := guardian.AllocateCIDR(ctx, 31, "link-1")
+	if err != nil {
+		t.Fatalf("AllocateCIDR /31 should succeed: %v", err)
+	}
+	if cidr != "10.0.1.0/31" {
+		t.Errorf("Expected 10.0.1.0/31, got %s", cidr)
+	}
+	cidr, err = guardian.AllocateCIDR(ctx, 31, "link-2")
+	if err != nil {
+		t.Fatalf("AllocateCIDR /31 should succeed: %v", err)
+	}
+	if cidr != "10.0.1.2/31" {
+		t.Errorf("Expected 10.0.1.2/31, got %s", cidr)
+	}
+	count, _ = guardian.AvailableCount(ctx)
+	if count != 0 {
+		t.Errorf("Expected 0 available IPs after consuming /30, got %d", count)
+	}
+	if _, err := guardian.AllocateCIDR(ctx, 31, "link-3"); err == nil {
+		t.Error("AllocateCIDR should fail when all /31 blocks are consumed")
+	}
+
+	// 释放后两个地址都应回到可用池
+	if err := guardian.ReleaseCIDR(ctx, "10.0.1.0/31"); err != nil {
+		t.Fatalf("ReleaseCIDR should succeed: %v", err)
+	}
+	for _, ip := range []string{"10.0.1.0", "10.0.1.1"} {
+		available, _ := guardian.storage.IsIPAvailable(ctx, ip)
+		if !available {
+			t.Errorf("IP %s should be available after release", ip)
+		}
+	}
+
+	// /127 的两个地址同样都可用
+	guardian, err = NewCIDRGuardian(ctx, nil, "2001:db8::/127")
+	if err != nil {
+		t.Fatalf("NewCIDRGuardian should succeed: %v", err)
+	}
+	ips, _ := guardian.storage.GetAvailableIPs(ctx)
+	expected := []string{"2001:db8::", "2001:db8::1"}
+	if !reflect.DeepEqual(ips, expected) {
+		t.Errorf("Expected %v, got %v", expected, ips)
+	}
+}
+
+// TestMemoryIPStorage_ImportAllocations 测试直接导入已分配IP
+func TestMemoryIPStorage_ImportAllocations(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	storage.available["192.168.1.1"] = true
+	storage.allocated["192.168.1.9"] = "existing"
+
+	// 测试正常导入，可用池中的IP应被移出
+	err := storage.ImportAllocations(ctx, map[string]string{
+		"192.168.1.1": "web",
+		"192.168.1.2": "db",
+	})
+	if err != nil {
+		t.Errorf("ImportAllocations should succeed: %v", err)
+	}
+	if storage.allocated["192.168.1.1"] != "web" || storage.allocated["192.168.1.2"] != "db" {
+		t.Errorf("Imported IPs should be allocated, got %v", storage.allocated)
+	}
+	if storage.available["192.168.1.1"] {
+		t.Error("Imported IP should be removed from available pool")
+	}
+
+	// 测试冲突时整体失败
+	err = storage.ImportAllocations(ctx, map[string]string{
+		"192.168.1.3": "new",
+		"192.168.1.9": "conflict",
+	})
+	if err == nil {
+		t.Error("ImportAllocations should fail when an IP is already allocated")
+	}
+	if _, exists := storage.allocated["192.168.1.3"]; exists {
+		t.Error("ImportAllocations should not partially import on conflict")
+	}
+	if storage.allocated["192.168.1.9"] != "existing" {
+		t.Error("Existing allocation should not be overwritten")
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = storage.ImportAllocations(canceledCtx, map[string]string{"192.168.1.4": "x"})
+	if err == nil {
+		t.Error("ImportAllocations should fail when context is canceled")
+	}
+}
+
+// TestCIDRGuardian_ImportAllocations 测试通过 CIDRGuardian 导入已分配IP
+func TestCIDRGuardian_ImportAllocations(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/30")
+
+	// 测试正常导入
+	err := guardian.ImportAllocations(ctx, map[string]string{
+		"10.0.0.1":   "legacy-web",
+		"172.16.0.1": "outside-managed",
+	})
+	if err != nil {
+		t.Fatalf("ImportAllocations should succeed: %v", err)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if allocated["10.0.0.1"] != "legacy-web" || allocated["172.16.0.1"] != "outside-managed" {
+		t.Errorf("Imported IPs should be allocated, got %v", allocated)
+	}
+	available, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.1")
+	if available {
+		t.Error("Imported IP should no longer be available")
+	}
+
+	// 测试无效IP，整体失败
+	err = guardian.ImportAllocations(ctx, map[string]string{
+		"10.0.0.2": "ok",
+		"bad-ip":   "bad",
+	})
+	if err == nil {
+		t.Error("ImportAllocations should fail with invalid IP")
+	}
+	available, _ = guardian.storage.IsIPAvailable(ctx, "10.0.0.2")
+	if !available {
+		t.Error("ImportAllocations should not import anything when an IP is invalid")
+	}
+
+	// 测试冲突，整体失败
+	err = guardian.ImportAllocations(ctx, map[string]string{
+		"10.0.0.2": "ok",
+		"10.0.0.1": "conflict",
+	})
+	if err == nil {
+		t.Error("ImportAllocations should fail when an IP is already allocated")
+	}
+	available, _ = guardian.storage.IsIPAvailable(ctx, "10.0.0.2")
+	if !available {
+		t.Error("ImportAllocations should not import anything on conflict")
+	}
+
+	// 测试同一地址的不同写法重复导入
+	err = guardian.ImportAllocations(ctx, map[string]string{
+		"2001:db8::1":          "a",
+		"2001:0db8:0000::0001": "b",
+	})
+	if err == nil {
+		t.Error("ImportAllocations should fail when the same IP appears twice")
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = guardian.ImportAllocations(canceledCtx, map[string]string{"10.0.0.3": "x"})
+	if err == nil {
+		t.Error("ImportAllocations should fail when context is canceled")
+	}
+}
+
+// TestSQLIPStorage_ImportAllocations 测试 SQL 直接导入已分配IP
+func TestSQLIPStorage_ImportAllocations(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	// 预期按排序后的顺序逐个导入
+	mock.ExpectBegin()
+	for _, ip := range []string{"192.168.1.1", "192.168.1.2"} {
+		mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+			WithArgs(ip).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").
+			WithArgs(ip).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO ip_allocated (ip, description) VALUES (?, ?)").
+			WithArgs(ip, "legacy").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	err := storage.ImportAllocations(ctx, map[string]string{
+		"192.168.1.2": "legacy",
+		"192.168.1.1": "legacy",
+	})
+	if err != nil {
+		t.Errorf("ImportAllocations 失败: %v", err)
+	}
+
+	// 测试冲突时回滚
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	err = storage.ImportAllocations(ctx, map[string]string{"192.168.1.1": "conflict"})
+	if err == nil {
+		t.Error("当 IP 已分配时，ImportAllocations 应该失败")
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_RequestID 测试请求 ID 附加到存储错误和日志中
+func TestCIDRGuardian_RequestID(t *testing.T) {
+	ctx := context.Background()
+
+	// 测试上下文中的请求 ID
+	if _, ok := RequestIDFromContext(ctx); ok {
+		t.Error("Background context should not carry a request ID")
+	}
+	tracedCtx := WithRequestID(ctx, "req-42")
+	if id, ok := RequestIDFromContext(tracedCtx); !ok || id != "req-42" {
+		t.Errorf("Expected request ID req-42, got %q", id)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	mockStorage := newMockIPStorage()
+	guardian, err := NewCIDRGuardianWithOptions(ctx, mockStorage, WithLogger(logger))
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianWithOptions should succeed: %v", err)
+	}
+
+	// 测试存储错误包含请求 ID
+	mockStorage.setFailure("GetAvailableIPs", "mock failure")
+	_, err = guardian.AllocateCIDR(tracedCtx, 30, "test")
+	if err == nil {
+		t.Fatal("AllocateCIDR should fail when storage fails")
+	}
+	if !strings.Contains(err.Error(), "mock failure") || !strings.Contains(err.Error(), "req-42") {
+		t.Errorf("Error should contain storage error and request ID, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "request_id=req-42") || !strings.Contains(buf.String(), "op=AllocateCIDR") {
+		t.Errorf("Log should contain request ID and operation, got %q", buf.String())
+	}
+
+	// 测试没有请求 ID 时错误文本不变
+	_, err = guardian.AllocateCIDR(ctx, 30, "test")
+	if err == nil || err.Error() != "mock failure" {
+		t.Errorf("Error without request ID should be unchanged, got %v", err)
+	}
+
+	// 测试包装后的错误仍可通过 errors.Is 匹配
+	sentinel := errors.New("sentinel")
+	if !errors.Is(guardian.wrapErr(tracedCtx, "test", sentinel), sentinel) {
+		t.Error("Wrapped error should match the original with errors.Is")
+	}
+	if guardian.wrapErr(tracedCtx, "test", nil) != nil {
+		t.Error("wrapErr should return nil for nil error")
+	}
+}
+
+// cancelingIPStorage 在 GetAvailableIPs 进行中取消上下文，模拟存储调用期间超时或取消
+type cancelingIPStorage struct {
+	*MemoryIPStorage
+	cancel context.CancelFunc
+}
+
+func (s *cancelingIPStorage) GetAvailableIPs(ctx context.Context) ([]string, error) {
+	s.cancel()
+	return nil, ctx.Err()
+}
+
+// TestCIDRGuardian_StorageCancellation 测试存储调用中的取消会注明进行中的操作，且仍可用 errors.Is 匹配
+func TestCIDRGuardian_StorageCancellation(t *testing.T) {
+	storage := &cancelingIPStorage{MemoryIPStorage: NewMemoryIPStorage()}
+	guardian, _ := NewCIDRGuardian(context.Background(), storage, "10.0.0.0/30")
+
+	// 存储调用中被取消
+	ctx, cancel := context.WithCancel(context.Background())
+	storage.cancel = cancel
+	_, err := guardian.GetNextAvailableIP(ctx, "web")
+	if !errors.Is(err, context.Canceled) || err == context.Canceled {
+		t.Errorf("Expected wrapped context.Canceled, got %v", err)
+	}
+	if err != nil && !strings.Contains(err.Error(), "GetNextAvailableIP") {
+		t.Errorf("Expected error to name the in-flight operation, got %v", err)
+	}
+
+	// 存储调用中超时
+	storage.cancel = func() {}
+	deadlineCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := guardian.GetAvailableIPs(deadlineCtx); !errors.Is(err, context.DeadlineExceeded) || err == context.DeadlineExceeded {
+		t.Errorf("Expected wrapped context.DeadlineExceeded, got %v", err)
+	}
+
+	// 调用开始前已取消时原样返回
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := guardian.GetNextAvailableIP(canceledCtx, "web"); err != context.Canceled {
+		t.Errorf("Expected bare context.Canceled before the storage call, got %v", err)
+	}
+}
+
+// TestCIDRGuardian_IsCIDRAvailable 测试检查 CIDR 是否完全可用
+func TestCIDRGuardian_IsCIDRAvailable(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := newMockIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, mockStorage, "192.168.0.0/29")
+
+	// 测试完全可用
+	available, err := guardian.IsCIDRAvailable(ctx, "192.168.0.0/30")
+	if err != nil {
+		t.Errorf("IsCIDRAvailable should succeed: %v", err)
+	}
+	if !available {
+		t.Error("192.168.0.0/30 should be fully available")
+	}
+
+	// 测试部分地址被分配
+	if err := guardian.AllocateIP(ctx, "192.168.0.5", "test"); err != nil {
+		t.Fatalf("AllocateIP should succeed: %v", err)
+	}
+	available, err = guardian.IsCIDRAvailable(ctx, "192.168.0.4/30")
+	if err != nil {
+		t.Errorf("IsCIDRAvailable should succeed: %v", err)
+	}
+	if available {
+		t.Error("192.168.0.4/30 should not be fully available")
+	}
+
+	// 测试超出可用池大小的 CIDR
+	available, err = guardian.IsCIDRAvailable(ctx, "192.168.0.0/24")
+	if err != nil {
+		t.Errorf("IsCIDRAvailable should succeed: %v", err)
+	}
+	if available {
+		t.Error("192.168.0.0/24 should not be fully available")
+	}
+
+	// 测试无效CIDR
+	_, err = guardian.IsCIDRAvailable(ctx, "invalid")
+	if err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("IsCIDRAvailable should fail with a descriptive error, got %v", err)
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = guardian.IsCIDRAvailable(canceledCtx, "192.168.0.0/30")
+	if err == nil {
+		t.Error("IsCIDRAvailable should fail when context is canceled")
+	}
+
+	// 测试存储失败
+	mockStorage.setFailure("GetAvailableIPs", "mock failure")
+	_, err = guardian.IsCIDRAvailable(ctx, "192.168.0.0/30")
+	if err == nil {
+		t.Error("IsCIDRAvailable should fail when GetAvailableIPs fails")
+	}
+}
+
+// TestCIDRGuardian_AreIPsAvailable 测试批量检查IP是否可用
+func TestCIDRGuardian_AreIPsAvailable(t *testing.T) {
+	ctx := context.Background()
+
+	sharded, _ := NewShardedIPStorage(NewMemoryIPStorage(), NewMemoryIPStorage())
+	for name, storage := range map[string]IPStorage{
+		"memory":      NewMemoryIPStorage(),
+		"sharded":     sharded,
+		"unsupported": struct{ IPStorage }{NewMemoryIPStorage()},
+	} {
+		guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/29")
+		_ = guardian.AllocateIP(ctx, "10.0.0.0", "web")
+		_ = guardian.ReserveIP(ctx, "10.0.0.2", "gateway")
+
+		result, err := guardian.AreIPsAvailable(ctx, []string{"10.0.0.0", "10.0.0.1", "10.0.0.3", "172.16.0.1", "::ffff:10.0.0.4"})
+		if err != nil {
+			t.Fatalf("%s: AreIPsAvailable failed: %v", name, err)
+		}
+		expected := map[string]bool{"10.0.0.0": false, "10.0.0.1": true, "10.0.0.3": true, "172.16.0.1": false, "::ffff:10.0.0.4": true}
+		if _, ok := storage.(IPReservationStorage); ok {
+			if r, _ := guardian.AreIPsAvailable(ctx, []string{"10.0.0.2"}); r["10.0.0.2"] {
+				t.Errorf("%s: expected reserved IP to be unavailable", name)
+			}
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, result)
+		}
+
+		// AllocateCIDR 和 IsCIDRAvailable 使用批量检查
+		if available, _ := guardian.IsCIDRAvailable(ctx, "10.0.0.4/30"); !available {
+			t.Errorf("%s: expected 10.0.0.4/30 to be available", name)
+		}
+		if available, _ := guardian.IsCIDRAvailable(ctx, "10.0.0.0/30"); available {
+			t.Errorf("%s: expected 10.0.0.0/30 to be unavailable", name)
+		}
+		if cidr, err := guardian.AllocateCIDR(ctx, 30, "block"); err != nil || cidr != "10.0.0.4/30" {
+			t.Errorf("%s: expected 10.0.0.4/30, got %s, %v", name, cidr, err)
+		}
+	}
+
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if _, err := guardian.AreIPsAvailable(ctx, []string{"invalid"}); err == nil {
+		t.Error("Expected error for invalid IP")
+	}
+}
+
+// TestCIDRGuardian_AllocateSpecificCIDR 测试分配指定的CIDR块
+func TestCIDRGuardian_AllocateSpecificCIDR(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := newMockIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, mockStorage, "10.0.1.0/24")
+
+	// 测试正常分配
+	err := guardian.AllocateSpecificCIDR(ctx, "10.0.1.16/28", "tenant-a")
+	if err != nil {
+		t.Fatalf("AllocateSpecificCIDR should succeed: %v", err)
+	}
+	if desc := mockStorage.allocated["10.0.1.16"]; desc != "10.0.1.16/28 - tenant-a" {
+		t.Errorf("Network address should be allocated with block description, got %q", desc)
+	}
+	for i := 16; i < 32; i++ {
+		if mockStorage.available[fmt.Sprintf("10.0.1.%d", i)] {
+			t.Errorf("IP 10.0.1.%d should be removed from available pool", i)
+		}
+	}
+	used, _ := guardian.GetUsedCIDRs(ctx)
+	if used["10.0.1.16/28"] != "tenant-a" {
+		t.Errorf("Expected 10.0.1.16/28 in used CIDRs, got %v", used)
+	}
+
+	// 测试成员已被占用
+	if err := guardian.AllocateIP(ctx, "10.0.1.40", "taken"); err != nil {
+		t.Fatalf("AllocateIP should succeed: %v", err)
+	}
+	err = guardian.AllocateSpecificCIDR(ctx, "10.0.1.32/28", "tenant-b")
+	if err == nil || !strings.Contains(err.Error(), "10.0.1.40") {
+		t.Errorf("AllocateSpecificCIDR should name the taken member, got %v", err)
+	}
+	if !mockStorage.available["10.0.1.32"] {
+		t.Error("Failed allocation should leave the block untouched")
+	}
+
+	// 测试未对齐的CIDR
+	err = guardian.AllocateSpecificCIDR(ctx, "10.0.1.50/28", "tenant-c")
+	if err == nil {
+		t.Error("AllocateSpecificCIDR should fail when CIDR is not aligned")
+	}
+
+	// 测试不在管理范围内
+	mockStorage.available["10.0.2.0"] = true
+	err = guardian.AllocateSpecificCIDR(ctx, "10.0.2.0/32", "tenant-d")
+	if err == nil {
+		t.Error("AllocateSpecificCIDR should fail when CIDR is not managed")
+	}
+
+	// 测试无效CIDR
+	err = guardian.AllocateSpecificCIDR(ctx, "invalid", "test")
+	if err == nil {
+		t.Error("AllocateSpecificCIDR should fail with invalid CIDR")
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = guardian.AllocateSpecificCIDR(canceledCtx, "10.0.1.64/28", "test")
+	if err == nil {
+		t.Error("AllocateSpecificCIDR should fail when context is canceled")
+	}
+
+	// 测试移除IP失败时回滚
+	mockStorage.setFailure("RemoveIP", "mock failure")
+	err = guardian.AllocateSpecificCIDR(ctx, "10.0.1.64/28", "test")
+	if err == nil {
+		t.Error("AllocateSpecificCIDR should fail when RemoveIP fails")
+	}
+	mockStorage.setFailure("", "")
+	if _, exists := mockStorage.allocated["10.0.1.64"]; exists {
+		t.Error("Network address allocation should be rolled back")
+	}
+	if !mockStorage.available["10.0.1.64"] {
+		t.Error("Network address should be available after rollback")
+	}
+
+	// 测试获取IP列表失败
+	mockStorage.setFailure("GetAvailableIPs", "mock failure")
+	err = guardian.AllocateSpecificCIDR(ctx, "10.0.1.64/28", "test")
+	if err == nil {
+		t.Error("AllocateSpecificCIDR should fail when GetAvailableIPs fails")
+	}
+}
+
+// TestCIDRGuardian_SoftDeleteCIDR 测试软删除与恢复CIDR
+func TestCIDRGuardian_SoftDeleteCIDR(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	guardian, err := NewCIDRGuardianWithOptions(ctx, storage, WithSoftDelete())
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianWithOptions should succeed: %v", err)
+	}
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/30", "office"); err != nil {
+		t.Fatalf("AddCIDR should succeed: %v", err)
+	}
+	if err := guardian.AllocateIP(ctx, "10.0.0.1", "printer"); err != nil {
+		t.Fatalf("AllocateIP should succeed: %v", err)
+	}
+
+	// 测试软删除会归档 CIDR
+	if err := guardian.RemoveCIDR(ctx, "10.0.0.0/30"); err != nil {
+		t.Fatalf("RemoveCIDR should succeed: %v", err)
+	}
+	managed, _ := guardian.GetManagedCIDRs(ctx)
+	if _, exists := managed["10.0.0.0/30"]; exists {
+		t.Error("CIDR should be removed from managed CIDRs")
+	}
+	count, _ := guardian.AvailableCount(ctx)
+	if count != 0 {
+		t.Errorf("Expected 0 available IPs after removal, got %d", count)
+	}
+	archive, err := storage.GetArchivedCIDR(ctx, "10.0.0.0/30")
+	if err != nil {
+		t.Fatalf("GetArchivedCIDR should succeed: %v", err)
+	}
+	if !reflect.DeepEqual(archive.AvailableIPs, []string{"10.0.0.0", "10.0.0.2", "10.0.0.3"}) {
+		t.Errorf("Unexpected archived available IPs: %v", archive.AvailableIPs)
+	}
+	if archive.AllocatedIPs["10.0.0.1"] != "printer" {
+		t.Errorf("Unexpected archived allocated IPs: %v", archive.AllocatedIPs)
+	}
+
+	// 测试恢复
+	if err := guardian.RestoreCIDR(ctx, "10.0.0.0/30"); err != nil {
+		t.Fatalf("RestoreCIDR should succeed: %v", err)
+	}
+	managed, _ = guardian.GetManagedCIDRs(ctx)
+	if managed["10.0.0.0/30"] != "office" {
+		t.Errorf("Restored CIDR should keep its description, got %v", managed)
+	}
+	count, _ = guardian.AvailableCount(ctx)
+	if count != 3 {
+		t.Errorf("Expected 3 available IPs after restore, got %d", count)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if allocated["10.0.0.1"] != "printer" {
+		t.Error("Allocated IP should stay allocated after restore")
+	}
+	if _, err := storage.GetArchivedCIDR(ctx, "10.0.0.0/30"); err == nil {
+		t.Error("Archive should be deleted after restore")
+	}
+
+	// 测试恢复不存在的归档
+	if err := guardian.RestoreCIDR(ctx, "10.0.0.0/30"); err == nil {
+		t.Error("RestoreCIDR should fail when CIDR is already managed")
+	}
+	if err := guardian.RestoreCIDR(ctx, "172.16.0.0/30"); err == nil {
+		t.Error("RestoreCIDR should fail when CIDR is not archived")
+	}
+
+	// 测试默认硬删除不留下归档
+	hard, _ := NewCIDRGuardian(ctx, nil, "10.0.1.0/30")
+	if err := hard.RemoveCIDR(ctx, "10.0.1.0/30"); err != nil {
+		t.Fatalf("RemoveCIDR should succeed: %v", err)
+	}
+	if err := hard.RestoreCIDR(ctx, "10.0.1.0/30"); err == nil {
+		t.Error("RestoreCIDR should fail after hard removal")
+	}
+
+	// 测试存储不支持归档
+	unsupported, _ := NewCIDRGuardianWithOptions(ctx, newMockIPStorage(), WithSoftDelete(), WithInitialCIDRs("10.0.2.0/30"))
+	if err := unsupported.RemoveCIDR(ctx, "10.0.2.0/30"); err == nil {
+		t.Error("RemoveCIDR should fail in soft mode when storage cannot archive")
+	}
+	if err := unsupported.RestoreCIDR(ctx, "10.0.2.0/30"); err == nil {
+		t.Error("RestoreCIDR should fail when storage cannot archive")
+	}
+}
+
+// TestSQLIPStorage_CIDRArchive 测试 SQL CIDR 归档
+func TestSQLIPStorage_CIDRArchive(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	archive := CIDRArchive{
+		CIDR:         "10.0.0.0/30",
+		Description:  "office",
+		AvailableIPs: []string{"10.0.0.0", "10.0.0.2"},
+		AllocatedIPs: map[string]string{"10.0.0.1": "printer"},
+	}
+
+	// 预期保存归档
+	mock.ExpectExec("INSERT INTO cidr_archive (cidr, description, available_ips, allocated_ips) VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE description = VALUES(description), available_ips = VALUES(available_ips), allocated_ips = VALUES(allocated_ips)").
+		WithArgs("10.0.0.0/30", "office", `["10.0.0.0","10.0.0.2"]`, `{"10.0.0.1":"printer"}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := storage.ArchiveCIDR(ctx, archive); err != nil {
+		t.Errorf("ArchiveCIDR 失败: %v", err)
+	}
+
+	// 预期读取归档
+	mock.ExpectQuery("SELECT description, available_ips, allocated_ips FROM cidr_archive WHERE cidr = ?").
+		WithArgs("10.0.0.0/30").
+		WillReturnRows(sqlmock.NewRows([]string{"description", "available_ips", "allocated_ips"}).
+			AddRow("office", `["10.0.0.0","10.0.0.2"]`, `{"10.0.0.1":"printer"}`))
+
+	got, err := storage.GetArchivedCIDR(ctx, "10.0.0.0/30")
+	if err != nil {
+		t.Errorf("GetArchivedCIDR 失败: %v", err)
+	}
+	if !reflect.DeepEqual(got, archive) {
+		t.Errorf("预期 %v, 得到 %v", archive, got)
+	}
+
+	// 预期归档不存在
+	mock.ExpectQuery("SELECT description, available_ips, allocated_ips FROM cidr_archive WHERE cidr = ?").
+		WithArgs("10.0.1.0/30").
+		WillReturnError(sql.ErrNoRows)
+
+	if _, err := storage.GetArchivedCIDR(ctx, "10.0.1.0/30"); err == nil {
+		t.Error("当归档不存在时，GetArchivedCIDR 应该失败")
+	}
+
+	// 预期删除归档
+	mock.ExpectExec("DELETE FROM cidr_archive WHERE cidr = ?").
+		WithArgs("10.0.0.0/30").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := storage.DeleteArchivedCIDR(ctx, "10.0.0.0/30"); err != nil {
+		t.Errorf("DeleteArchivedCIDR 失败: %v", err)
+	}
+
+	mock.ExpectExec("DELETE FROM cidr_archive WHERE cidr = ?").
+		WithArgs("10.0.0.0/30").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := storage.DeleteArchivedCIDR(ctx, "10.0.0.0/30"); err == nil {
+		t.Error("当归档不存在时，DeleteArchivedCIDR 应该失败")
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestShardedIPStorage 测试分片存储
+func TestShardedIPStorage(t *testing.T) {
+	ctx := context.Background()
+
+	// 测试创建失败
+	if _, err := NewShardedIPStorage(); err == nil {
+		t.Error("NewShardedIPStorage should fail without backends")
+	}
+	if _, err := NewShardedIPStorage(NewMemoryIPStorage(), nil); err == nil {
+		t.Error("NewShardedIPStorage should fail with a nil backend")
+	}
+
+	shards := []*MemoryIPStorage{NewMemoryIPStorage(), NewMemoryIPStorage(), NewMemoryIPStorage()}
+	storage, err := NewShardedIPStorage(shards[0], shards[1], shards[2])
+	if err != nil {
+		t.Fatalf("NewShardedIPStorage should succeed: %v", err)
+	}
+
+	guardian, err := NewCIDRGuardian(ctx, storage, "10.0.0.0/26")
+	if err != nil {
+		t.Fatalf("NewCIDRGuardian should succeed: %v", err)
+	}
+
+	// 测试IP被分散到多个分片，且每个IP只在其所属分片中
+	total := 0
+	for i, shard := range shards {
+		if len(shard.available) == 0 {
+			t.Errorf("Shard %d should hold some IPs", i)
+		}
+		for ip := range shard.available {
+			if storage.shardIndex(ip) != i {
+				t.Errorf("IP %s stored in wrong shard %d", ip, i)
+			}
+		}
+		total += len(shard.available)
+	}
+	if total != 64 {
+		t.Errorf("Expected 64 IPs across shards, got %d", total)
+	}
+
+	// 测试汇总列表与计数
+	count, _ := storage.AvailableCount(ctx)
+	if count != 64 {
+		t.Errorf("Expected aggregated available count 64, got %d", count)
+	}
+	ips, _ := storage.GetAvailableIPs(ctx)
+	if len(ips) != 64 || !sort.StringsAreSorted(ips) {
+		t.Errorf("Expected 64 sorted available IPs, got %d", len(ips))
+	}
+
+	// 测试跨分片分配CIDR
+	cidr, err := guardian.AllocateCIDR(ctx, 29, "sharded")
+	if err != nil {
+		t.Fatalf("AllocateCIDR should succeed: %v", err)
+	}
+	if cidr != "10.0.0.0/29" {
+		t.Errorf("Expected 10.0.0.0/29, got %s", cidr)
+	}
+	count, _ = storage.AvailableCount(ctx)
+	if count != 56 {
+		t.Errorf("Expected 56 available IPs after allocating /29, got %d", count)
+	}
+	allocatedCount, _ := storage.AllocatedCount(ctx)
+	if allocatedCount != 1 {
+		t.Errorf("Expected 1 allocated marker, got %d", allocatedCount)
+	}
+	if err := guardian.ReleaseCIDR(ctx, cidr); err != nil {
+		t.Fatalf("ReleaseCIDR should succeed: %v", err)
+	}
+	count, _ = storage.AvailableCount(ctx)
+	if count != 64 {
+		t.Errorf("Expected 64 available IPs after release, got %d", count)
+	}
+
+	// 测试单IP分配与汇总已分配列表
+	if err := guardian.AllocateIP(ctx, "10.0.0.9", "web"); err != nil {
+		t.Fatalf("AllocateIP should succeed: %v", err)
+	}
+	allocated, _ := storage.GetAllocatedIPs(ctx)
+	if allocated["10.0.0.9"] != "web" {
+		t.Errorf("Expected 10.0.0.9 allocated, got %v", allocated)
+	}
+	if err := storage.DeallocateIP(ctx, "10.0.0.9"); err != nil {
+		t.Errorf("DeallocateIP should succeed: %v", err)
+	}
+
+	// 测试跨分片导入
+	err = storage.ImportAllocations(ctx, map[string]string{"10.0.0.10": "a", "10.0.0.11": "b", "10.0.0.12": "c"})
+	if err != nil {
+		t.Errorf("ImportAllocations should succeed: %v", err)
+	}
+	err = storage.ImportAllocations(ctx, map[string]string{"10.0.0.13": "d", "10.0.0.10": "conflict"})
+	if err == nil {
+		t.Error("ImportAllocations should fail on conflict")
+	}
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.0.13"); !available {
+		t.Error("ImportAllocations should not import any IP on conflict")
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := storage.GetAvailableIPs(canceledCtx); err == nil {
+		t.Error("GetAvailableIPs should fail when context is canceled")
+	}
+	if _, err := storage.AllocatedCount(canceledCtx); err == nil {
+		t.Error("AllocatedCount should fail when context is canceled")
+	}
+
+	// 测试分片失败
+	failing := newMockIPStorage()
+	failing.setFailure("AvailableCount", "mock failure")
+	storage, _ = NewShardedIPStorage(NewMemoryIPStorage(), failing)
+	if _, err := storage.AvailableCount(ctx); err == nil {
+		t.Error("AvailableCount should fail when a shard fails")
+	}
+}
+
+// TestCoalesceAddrs 测试将IP集合合并为最大的对齐前缀
+func TestCoalesceAddrs(t *testing.T) {
+	tests := []struct {
+		name     string
+		ips      []string
+		expected []string
+	}{
+		{"empty", nil, nil},
+		{"single", []string{"10.0.0.1"}, []string{"10.0.0.1/32"}},
+		{"aligned block", []string{"10.0.0.3", "10.0.0.2", "10.0.0.1", "10.0.0.0"}, []string{"10.0.0.0/30"}},
+		{"unaligned run", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}, []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/32"}},
+		{"duplicates and invalid", []string{"10.0.0.0", "10.0.0.0", "bad", "10.0.0.1"}, []string{"10.0.0.0/31"}},
+		{"numeric order", []string{"10.0.0.10", "10.0.0.9", "10.0.0.8", "10.0.0.11"}, []string{"10.0.0.8/30"}},
+		{"both families", []string{"2001:db8::1", "2001:db8::", "10.0.0.0"}, []string{"10.0.0.0/32", "2001:db8::/127"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, p := range coalesceAddrs(tt.ips) {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+// TestCIDRGuardian_AvailableBlocksOfSize 测试列出固定大小的可用块
+func TestCIDRGuardian_AvailableBlocksOfSize(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := newMockIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, mockStorage, "10.0.0.0/27", "2001:db8::/126")
+
+	// 分配一个IP，令 10.0.0.0/28 不再完全可用
+	if err := guardian.AllocateIP(ctx, "10.0.0.3", "test"); err != nil {
+		t.Fatalf("AllocateIP should succeed: %v", err)
+	}
+
+	// 测试 /28
+	blocks, err := guardian.AvailableBlocksOfSize(ctx, 28)
+	if err != nil {
+		t.Fatalf("AvailableBlocksOfSize should succeed: %v", err)
+	}
+	if !reflect.DeepEqual(blocks, []string{"10.0.0.16/28"}) {
+		t.Errorf("Expected [10.0.0.16/28], got %v", blocks)
+	}
+
+	// 测试 /30，被占用的块应被排除
+	blocks, _ = guardian.AvailableBlocksOfSize(ctx, 30)
+	if len(blocks) != 7 || blocks[0] != "10.0.0.4/30" {
+		t.Errorf("Expected 7 /30 blocks starting at 10.0.0.4/30, got %v", blocks)
+	}
+
+	// 测试 IPv6
+	blocks, _ = guardian.AvailableBlocksOfSize(ctx, 127)
+	if !reflect.DeepEqual(blocks, []string{"2001:db8::/127", "2001:db8::2/127"}) {
+		t.Errorf("Expected two IPv6 /127 blocks, got %v", blocks)
+	}
+
+	// 测试没有足够大的块
+	blocks, _ = guardian.AvailableBlocksOfSize(ctx, 24)
+	if len(blocks) != 0 {
+		t.Errorf("Expected no /24 blocks, got %v", blocks)
+	}
+
+	// 测试无效的掩码位数
+	if _, err := guardian.AvailableBlocksOfSize(ctx, 129); err == nil {
+		t.Error("AvailableBlocksOfSize should fail with invalid bits")
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := guardian.AvailableBlocksOfSize(canceledCtx, 28); err == nil {
+		t.Error("AvailableBlocksOfSize should fail when context is canceled")
+	}
+
+	// 测试获取IP列表失败
+	mockStorage.setFailure("GetAvailableIPs", "mock failure")
+	if _, err := guardian.AvailableBlocksOfSize(ctx, 28); err == nil {
+		t.Error("AvailableBlocksOfSize should fail when GetAvailableIPs fails")
+	}
+}
+
+// TestSQLIPStorage_Stats 测试获取连接池统计信息
+func TestSQLIPStorage_Stats(t *testing.T) {
+	db, _, storage := setupMockDB(t)
+	defer db.Close()
+
+	db.SetMaxOpenConns(7)
+	stats := storage.Stats()
+	if stats.MaxOpenConnections != 7 {
+		t.Errorf("预期 MaxOpenConnections 为 7, 得到 %d", stats.MaxOpenConnections)
+	}
+	if !reflect.DeepEqual(stats, db.Stats()) {
+		t.Errorf("预期 %+v, 得到 %+v", db.Stats(), stats)
+	}
+}
+
+// TestSortIPStrings 测试按数值排序IP
+func TestSortIPStrings(t *testing.T) {
+	ips := []string{"10.0.0.10", "bad", "2001:db8::1", "10.0.0.9", "10.0.0.100", "10.0.0.2"}
+	sortIPStrings(ips)
+	expected := []string{"10.0.0.2", "10.0.0.9", "10.0.0.10", "10.0.0.100", "2001:db8::1", "bad"}
+	if !reflect.DeepEqual(ips, expected) {
+		t.Errorf("Expected %v, got %v", expected, ips)
+	}
+
+	cidrs := []string{"10.0.0.128/25", "10.0.0.0/25", "9.0.0.0/8", "10.0.0.0/24"}
+	sortCIDRStrings(cidrs)
+	expectedCIDRs := []string{"9.0.0.0/8", "10.0.0.0/24", "10.0.0.0/25", "10.0.0.128/25"}
+	if !reflect.DeepEqual(cidrs, expectedCIDRs) {
+		t.Errorf("Expected %v, got %v", expectedCIDRs, cidrs)
+	}
+}
+
+// TestCIDRGuardian_DeterministicOrder 测试分配与列表顺序的确定性
+func TestCIDRGuardian_DeterministicOrder(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := newMockIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, mockStorage)
+
+	// 字典序中 10.0.0.10 排在 10.0.0.2 之前，数值序应选择 10.0.0.2
+	mockStorage.available["10.0.0.10"] = true
+	mockStorage.available["10.0.0.2"] = true
+	ip, err := guardian.GetNextAvailableIP(ctx, "test")
+	if err != nil {
+		t.Fatalf("GetNextAvailableIP should succeed: %v", err)
+	}
+	if ip != "10.0.0.2" {
+		t.Errorf("Expected numerically smallest 10.0.0.2, got %s", ip)
+	}
+
+	// 字典序中 10.0.0.100 排在 10.0.0.20 之前，数值序应选择 10.0.0.20/30
+	mockStorage.available = make(map[string]bool)
+	for _, start := range []int{100, 20} {
+		for i := 0; i < 4; i++ {
+			mockStorage.available[fmt.Sprintf("10.0.0.%d", start+i)] = true
+		}
+	}
+	cidr, err := guardian.AllocateCIDR(ctx, 30, "test")
+	if err != nil {
+		t.Fatalf("AllocateCIDR should succeed: %v", err)
+	}
+	if cidr != "10.0.0.20/30" {
+		t.Errorf("Expected 10.0.0.20/30, got %s", cidr)
+	}
+
+	// 多次获取的列表顺序应一致且按数值排序
+	guardian, _ = NewCIDRGuardian(ctx, nil, "192.168.10.0/30", "192.168.2.0/30", "10.0.0.0/30", "172.16.0.0/30")
+	expected := []string{"10.0.0.0/30", "172.16.0.0/30", "192.168.2.0/30", "192.168.10.0/30"}
+	for i := 0; i < 20; i++ {
+		list, err := guardian.GetManagedCIDRList(ctx)
+		if err != nil {
+			t.Fatalf("GetManagedCIDRList should succeed: %v", err)
+		}
+		if !reflect.DeepEqual(list, expected) {
+			t.Fatalf("Expected %v, got %v", expected, list)
+		}
+	}
+
+	for _, bits := range []int{31, 31} {
+		if _, err := guardian.AllocateCIDR(ctx, bits, "link"); err != nil {
+			t.Fatalf("AllocateCIDR should succeed: %v", err)
+		}
+	}
+	used, err := guardian.GetUsedCIDRList(ctx)
+	if err != nil {
+		t.Fatalf("GetUsedCIDRList should succeed: %v", err)
+	}
+	if !reflect.DeepEqual(used, []string{"10.0.0.0/31", "10.0.0.2/31"}) {
+		t.Errorf("Unexpected used CIDR list: %v", used)
+	}
+
+	// String 输出中的管理 CIDR 应按顺序排列
+	str, _ := guardian.String(ctx)
+	last := -1
+	for _, cidr := range expected {
+		idx := strings.Index(str, cidr)
+		if idx <= last {
+			t.Errorf("String output should list %s in sorted order", cidr)
+		}
+		last = idx
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := guardian.GetManagedCIDRList(canceledCtx); err == nil {
+		t.Error("GetManagedCIDRList should fail when context is canceled")
+	}
+	if _, err := guardian.GetUsedCIDRList(canceledCtx); err == nil {
+		t.Error("GetUsedCIDRList should fail when context is canceled")
+	}
+}
+
+// TestCIDRGuardian_ReleaseByDescription 测试按描述释放IP
+func TestCIDRGuardian_ReleaseByDescription(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := newMockIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, mockStorage, "10.0.0.0/24")
+
+	_ = guardian.AllocateIP(ctx, "10.0.0.10", "deploy-a")
+	_ = guardian.AllocateIP(ctx, "10.0.0.9", "deploy-a")
+	_ = guardian.AllocateIP(ctx, "10.0.0.11", "deploy-ab")
+	_ = guardian.AllocateIP(ctx, "10.0.0.12", "other")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.64/30", "deploy-a"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR should succeed: %v", err)
+	}
+
+	// 测试精确匹配，包括CIDR块
+	released, err := guardian.ReleaseByDescription(ctx, "deploy-a")
+	if err != nil {
+		t.Fatalf("ReleaseByDescription should succeed: %v", err)
+	}
+	expected := []string{"10.0.0.9", "10.0.0.10", "10.0.0.64/30"}
+	if !reflect.DeepEqual(released, expected) {
+		t.Errorf("Expected %v, got %v", expected, released)
+	}
+	for _, ip := range []string{"10.0.0.9", "10.0.0.10", "10.0.0.64", "10.0.0.65", "10.0.0.67"} {
+		if !mockStorage.available[ip] {
+			t.Errorf("IP %s should be available after release", ip)
+		}
+	}
+	if _, exists := mockStorage.allocated["10.0.0.11"]; !exists {
+		t.Error("deploy-ab should not match an exact deploy-a query")
+	}
+
+	// 测试前缀匹配
+	released, err = guardian.ReleaseByDescription(ctx, "deploy-", WithPrefixMatch())
+	if err != nil {
+		t.Fatalf("ReleaseByDescription should succeed: %v", err)
+	}
+	if !reflect.DeepEqual(released, []string{"10.0.0.11"}) {
+		t.Errorf("Expected [10.0.0.11], got %v", released)
+	}
+	if _, exists := mockStorage.allocated["10.0.0.12"]; !exists {
+		t.Error("Unrelated allocation should not be released")
+	}
+
+	// 测试没有匹配
+	released, err = guardian.ReleaseByDescription(ctx, "missing")
+	if err != nil || len(released) != 0 {
+		t.Errorf("Expected no released IPs, got %v, %v", released, err)
+	}
+
+	// 测试释放失败时回滚
+	_ = guardian.AllocateIP(ctx, "10.0.0.20", "batch")
+	_ = guardian.AllocateIP(ctx, "10.0.0.21", "batch")
+	mockStorage.setFailure("DeallocateIP", "mock failure")
+	if _, err := guardian.ReleaseByDescription(ctx, "batch"); err == nil {
+		t.Error("ReleaseByDescription should fail when DeallocateIP fails")
+	}
+	mockStorage.setFailure("", "")
+	if mockStorage.allocated["10.0.0.20"] != "batch" || mockStorage.allocated["10.0.0.21"] != "batch" {
+		t.Error("Allocations should remain after a failed release")
+	}
+
+	// 测试回滚失败时返回回滚错误
+	failing := &failDeallocStorage{MemoryIPStorage: NewMemoryIPStorage()}
+	failingGuardian, _ := NewCIDRGuardian(ctx, failing, "10.0.1.0/24")
+	_ = failingGuardian.AllocateIP(ctx, "10.0.1.1", "batch")
+	_ = failingGuardian.AllocateIP(ctx, "10.0.1.2", "batch")
+	failing.failIP = "10.0.1.2"
+	failing.failImport = true
+	_, err = failingGuardian.ReleaseByDescription(ctx, "batch")
+	if err == nil || !strings.Contains(err.Error(), "deallocate 10.0.1.2 failed") || !strings.Contains(err.Error(), "import failed") {
+		t.Errorf("Expected both the release and rollback errors, got %v", err)
+	}
+
+	// 测试上下文取消
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := guardian.ReleaseByDescription(canceledCtx, "batch"); err == nil {
+		t.Error("ReleaseByDescription should fail when context is canceled")
+	}
+
+	// 测试获取已分配IP列表失败
+	mockStorage.setFailure("GetAllocatedIPs", "mock failure")
+	if _, err := guardian.ReleaseByDescription(ctx, "batch"); err == nil {
+		t.Error("ReleaseByDescription should fail when GetAllocatedIPs fails")
+	}
+}
+
+// failDeallocStorage 在释放指定IP时失败
+type failDeallocStorage struct {
+	*MemoryIPStorage
+	failIP     string
+	failImport bool
+}
+
+func (s *failDeallocStorage) ImportAllocations(ctx context.Context, allocations map[string]string) error {
+	if s.failImport {
+		return fmt.Errorf("import failed")
+	}
+	return s.MemoryIPStorage.ImportAllocations(ctx, allocations)
+}
+
+func (s *failDeallocStorage) DeallocateIP(ctx context.Context, ip string) error {
+	if ip == s.failIP {
+		return fmt.Errorf("deallocate %s failed", ip)
+	}
+	return s.MemoryIPStorage.DeallocateIP(ctx, ip)
+}
+
+// TestCIDRGuardian_ReleaseAllInCIDR 测试释放管理 CIDR 中的所有分配
+func TestCIDRGuardian_ReleaseAllInCIDR(t *testing.T) {
+	ctx := context.Background()
+	storage := &failDeallocStorage{MemoryIPStorage: NewMemoryIPStorage()}
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/24", "10.0.1.0/24")
+
+	_ = guardian.AllocateIP(ctx, "10.0.0.10", "a")
+	_ = guardian.AllocateIP(ctx, "10.0.0.9", "b")
+	_ = guardian.AllocateIP(ctx, "10.0.1.5", "other")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.64/30", "block"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR should succeed: %v", err)
+	}
+
+	// 测试释放失败时回滚
+	storage.failIP = "10.0.0.10"
+	if _, err := guardian.ReleaseAllInCIDR(ctx, "10.0.0.0/24"); err == nil {
+		t.Error("ReleaseAllInCIDR should fail when a release fails")
+	}
+	allocated, _ := storage.GetAllocatedIPs(ctx)
+	for _, ip := range []string{"10.0.0.9", "10.0.0.10", "10.0.0.64"} {
+		if _, exists := allocated[ip]; !exists {
+			t.Errorf("IP %s should remain allocated after a failed release", ip)
+		}
+	}
+	storage.failIP = ""
+
+	// 测试释放单个IP和块，可用成员和其他 CIDR 的分配不受影响
+	beforeAvailable, _ := storage.AvailableCount(ctx)
+	released, err := guardian.ReleaseAllInCIDR(ctx, "10.0.0.5/24")
+	if err != nil {
+		t.Fatalf("ReleaseAllInCIDR should succeed: %v", err)
+	}
+	expected := []string{"10.0.0.9", "10.0.0.10", "10.0.0.64/30"}
+	if !reflect.DeepEqual(released, expected) {
+		t.Errorf("Expected %v, got %v", expected, released)
+	}
+	if afterAvailable, _ := storage.AvailableCount(ctx); afterAvailable != beforeAvailable+6 {
+		t.Errorf("Expected %d available IPs, got %d", beforeAvailable+6, afterAvailable)
+	}
+	allocated, _ = storage.GetAllocatedIPs(ctx)
+	if len(allocated) != 1 || allocated["10.0.1.5"] != "other" {
+		t.Errorf("Only the other CIDR's allocation should remain, got %v", allocated)
+	}
+	if managed, _ := guardian.GetManagedCIDRs(ctx); len(managed) != 2 {
+		t.Errorf("ReleaseAllInCIDR should keep the CIDR managed, got %v", managed)
+	}
+
+	// 测试没有分配
+	released, err = guardian.ReleaseAllInCIDR(ctx, "10.0.0.0/24")
+	if err != nil || len(released) != 0 {
+		t.Errorf("Expected no released IPs, got %v, %v", released, err)
+	}
+
+	// 测试不在管理池中的 CIDR
+	if _, err := guardian.ReleaseAllInCIDR(ctx, "10.0.2.0/24"); err == nil {
+		t.Error("ReleaseAllInCIDR should fail for an unmanaged CIDR")
+	}
+
+	// 测试回滚失败时返回回滚错误
+	_ = guardian.AllocateIP(ctx, "10.0.0.9", "b")
+	_ = guardian.AllocateIP(ctx, "10.0.0.10", "a")
+	storage.failIP = "10.0.0.10"
+	storage.failImport = true
+	_, err = guardian.ReleaseAllInCIDR(ctx, "10.0.0.0/24")
+	if err == nil || !strings.Contains(err.Error(), "deallocate 10.0.0.10 failed") || !strings.Contains(err.Error(), "import failed") {
+		t.Errorf("Expected both the release and rollback errors, got %v", err)
+	}
+}
+
+// TestCIDRGuardian_AddCIDRCanonical 测试添加设置了主机位的CIDR
+func TestCIDRGuardian_AddCIDRCanonical(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil)
+
+	// 测试规范化为网络形式
+	if err := guardian.AddCIDR(ctx, "10.0.0.5/24", "test"); err != nil {
+		t.Fatalf("AddCIDR should succeed: %v", err)
+	}
+	managed, _ := guardian.GetManagedCIDRs(ctx)
+	if _, exists := managed["10.0.0.0/24"]; !exists {
+		t.Errorf("Managed key should be canonical 10.0.0.0/24, got %v", managed)
+	}
+	if _, exists := managed["10.0.0.5/24"]; exists {
+		t.Error("Non-canonical key should not be stored")
+	}
+
+	// 测试重复添加同一范围的不同写法
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/24", "dup"); err == nil {
+		t.Error("AddCIDR should fail when the canonical CIDR already exists")
+	}
+
+	// 测试使用非规范写法移除
+	if err := guardian.RemoveCIDR(ctx, "10.0.0.9/24"); err != nil {
+		t.Errorf("RemoveCIDR should accept a non-canonical CIDR: %v", err)
+	}
+
+	// 测试严格模式拒绝非规范写法
+	strict, _ := NewCIDRGuardianWithOptions(ctx, nil, WithStrictCIDR())
+	if err := strict.AddCIDR(ctx, "10.0.0.5/24", "test"); err == nil {
+		t.Error("AddCIDR should reject host bits in strict mode")
+	}
+	if err := strict.AddCIDR(ctx, "10.0.0.0/24", "test"); err != nil {
+		t.Errorf("AddCIDR should accept canonical CIDR in strict mode: %v", err)
+	}
+}
+
+// inflightIPStorage 记录同时进行的 AddIP 调用数量
+type inflightIPStorage struct {
+	*MemoryIPStorage
+	inflight int32
+	peak     int32
+	failIP   string
+}
+
+func (s *inflightIPStorage) AddIP(ctx context.Context, ip string) error {
+	n := atomic.AddInt32(&s.inflight, 1)
+	defer atomic.AddInt32(&s.inflight, -1)
+	for {
+		peak := atomic.LoadInt32(&s.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&s.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	if ip == s.failIP {
+		return fmt.Errorf("模拟添加失败")
+	}
+	return s.MemoryIPStorage.AddIP(ctx, ip)
+}
+
+// TestCIDRGuardian_MaxConcurrency 测试批量操作的并发上限
+func TestCIDRGuardian_MaxConcurrency(t *testing.T) {
+	ctx := context.Background()
+
+	// 测试默认按顺序执行
+	storage := &inflightIPStorage{MemoryIPStorage: NewMemoryIPStorage()}
+	guardian, _ := NewCIDRGuardian(ctx, storage)
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/28", "test"); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+	if storage.peak != 1 {
+		t.Errorf("Default should be sequential, peak inflight = %d", storage.peak)
+	}
+
+	// 测试并发上限
+	storage = &inflightIPStorage{MemoryIPStorage: NewMemoryIPStorage()}
+	guardian, _ = NewCIDRGuardianWithOptions(ctx, storage, WithMaxConcurrency(4))
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/26", "test"); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+	if storage.peak > 4 {
+		t.Errorf("Peak inflight %d exceeds limit 4", storage.peak)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 64 {
+		t.Errorf("Expected 64 available IPs, got %d", count)
+	}
+
+	// 测试并发执行失败时回滚
+	storage = &inflightIPStorage{MemoryIPStorage: NewMemoryIPStorage(), failIP: "10.0.1.20"}
+	guardian, _ = NewCIDRGuardianWithOptions(ctx, storage, WithMaxConcurrency(4))
+	if err := guardian.AddCIDR(ctx, "10.0.1.0/26", "test"); err == nil {
+		t.Error("AddCIDR should fail when a storage call fails")
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 0 {
+		t.Errorf("Expected rollback to leave 0 available IPs, got %d", count)
+	}
+
+	// 测试等待空位时响应上下文取消
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	var calls int32
+	err := guardian.forEachBounded(cancelCtx, []string{"a", "b"}, func(string) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// 测试并发安全
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	items := []string{"a", "b", "c", "d", "e"}
+	if err := guardian.forEachBounded(ctx, items, func(item string) error {
+		mu.Lock()
+		seen[item] = true
+		mu.Unlock()
+		return nil
+	}); err != nil || len(seen) != len(items) {
+		t.Errorf("Expected all items visited, got %v (err=%v)", seen, err)
+	}
+}
+
+// TestCIDRGuardian_RateLimit 测试分配和释放按设置的速率限速
+func TestCIDRGuardian_RateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithInitialCIDRs("10.0.0.0/28"), WithRateLimit(100))
+
+	// 读取不消耗令牌
+	for i := 0; i < 20; i++ {
+		if _, err := guardian.AvailableCount(ctx); err != nil {
+			t.Fatalf("AvailableCount failed: %v", err)
+		}
+	}
+
+	// 第一次调用立即执行，其后每次间隔 10ms
+	const n = 6
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if _, err := guardian.GetNextAvailableIP(ctx, "web"); err != nil {
+			t.Fatalf("GetNextAvailableIP failed: %v", err)
+		}
+	}
+	if err := guardian.ReleaseIP(ctx, "10.0.0.0"); err != nil {
+		t.Fatalf("ReleaseIP failed: %v", err)
+	}
+	if elapsed, want := time.Since(start), n*10*time.Millisecond; elapsed < want {
+		t.Errorf("Expected %d rate-limited calls to take at least %v, took %v", n+1, want, elapsed)
+	}
+
+	// 等待令牌时响应上下文取消，不做任何分配
+	slow, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithInitialCIDRs("10.0.0.0/28"), WithRateLimit(1))
+	if err := slow.AllocateIP(ctx, "10.0.0.1", "web"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := slow.AllocateIP(timeoutCtx, "10.0.0.2", "web"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if count, _ := slow.AllocatedCount(ctx); count != 1 {
+		t.Errorf("Expected 1 allocated IP, got %d", count)
+	}
+
+	// 令牌按注入的时钟产生，推进时钟后无需等待
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	fake, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithInitialCIDRs("10.0.0.0/28"), WithRateLimit(0.001), WithClock(clock))
+	if err := fake.AllocateIP(ctx, "10.0.0.1", "web"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	blockedCtx, cancelBlocked := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelBlocked()
+	if err := fake.AllocateIP(blockedCtx, "10.0.0.2", "web"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded before the clock advances, got %v", err)
+	}
+	clock.Advance(1000 * time.Second)
+	advancedCtx, cancelAdvanced := context.WithTimeout(ctx, time.Second)
+	defer cancelAdvanced()
+	if err := fake.AllocateIP(advancedCtx, "10.0.0.2", "web"); err != nil {
+		t.Errorf("Expected a token after advancing the clock, got %v", err)
+	}
+
+	// 推进时钟放行已经在等待令牌的调用
+	waitCtx, cancelWait := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelWait()
+	done := make(chan error, 1)
+	go func() {
+		done <- fake.AllocateIP(waitCtx, "10.0.0.3", "web")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	clock.Advance(1000 * time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("Expected the blocked call to proceed after advancing the clock, got %v", err)
+	}
+}
+
+// TestCIDRGuardian_DescriptionTemplate 测试分配描述中的模板占位符
+func TestCIDRGuardian_DescriptionTemplate(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, nil,
+		WithInitialCIDRs("10.0.0.0/24"),
+		WithDescriptionTemplate(),
+	)
+
+	// 测试 {ip}
+	if err := guardian.AllocateIP(ctx, "10.0.0.10", "host {ip}"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	// 测试 {ip-dashed}
+	ip, err := guardian.GetNextAvailableIP(ctx, "svc-{ip-dashed}")
+	if err != nil {
+		t.Fatalf("GetNextAvailableIP failed: %v", err)
+	}
+	// 测试 {cidr}
+	if err := guardian.AllocateIP(ctx, "10.0.0.11", "in {cidr}"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	// 测试没有占位符的描述保持不变
+	if err := guardian.AllocateIP(ctx, "10.0.0.12", "plain {name"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	// 测试 CIDR 块分配
+	block, err := guardian.AllocateCIDR(ctx, 30, "blk {ip} {cidr}")
+	if err != nil {
+		t.Fatalf("AllocateCIDR failed: %v", err)
+	}
+
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	blockIP := strings.Split(block, "/")[0]
+	expected := map[string]string{
+		"10.0.0.10": "host 10.0.0.10",
+		ip:          "svc-" + strings.ReplaceAll(ip, ".", "-"),
+		"10.0.0.11": "in 10.0.0.0/24",
+		"10.0.0.12": "plain {name",
+		blockIP:     fmt.Sprintf("blk %s %s", blockIP, block),
+	}
+	for k, want := range expected {
+		if got := allocated[k]; got != want {
+			t.Errorf("Description of %s = %q, want %q", k, got, want)
+		}
+	}
+
+	// 测试未启用模板时占位符保持原样
+	plain, _ := NewCIDRGuardian(ctx, nil, "10.0.1.0/24")
+	if err := plain.AllocateIP(ctx, "10.0.1.1", "host {ip}"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	if allocated, _ := plain.storage.GetAllocatedIPs(ctx); allocated["10.0.1.1"] != "host {ip}" {
+		t.Errorf("Template should not be expanded by default, got %q", allocated["10.0.1.1"])
+	}
+}
+
+// countingIPStorage 统计全量查询次数，并可在第 N 次 AddIP 或 BulkAddIP 时失败
+type countingIPStorage struct {
+	*MemoryIPStorage
+	allocatedReads int
+	addCalls       int
+	failAfter      int      // 大于 0 时，第 failAfter 次 AddIP 失败
+	bulkStarts     []string // 每次 BulkAddIP 的第一个IP
+	failBulkAt     int      // 大于 0 时，第 failBulkAt 次 BulkAddIP 失败
+}
+
+func (s *countingIPStorage) GetAllocatedIPs(ctx context.Context) (map[string]string, error) {
+	s.allocatedReads++
+	return s.MemoryIPStorage.GetAllocatedIPs(ctx)
+}
+
+func (s *countingIPStorage) AddIP(ctx context.Context, ip string) error {
+	s.addCalls++
+	if s.failAfter > 0 && s.addCalls == s.failAfter {
+		return fmt.Errorf("模拟添加失败")
+	}
+	return s.MemoryIPStorage.AddIP(ctx, ip)
+}
+
+func (s *countingIPStorage) BulkAddIP(ctx context.Context, ips []string) ([]string, error) {
+	if len(ips) > 0 {
+		s.bulkStarts = append(s.bulkStarts, ips[0])
+	}
+	if s.failBulkAt > 0 && len(s.bulkStarts) == s.failBulkAt {
+		return nil, fmt.Errorf("模拟批量添加失败")
+	}
+	return s.MemoryIPStorage.BulkAddIP(ctx, ips)
+}
+
+// TestCIDRGuardian_ExpandPoolRollback 测试扩展IP池只读取一次已分配IP并在失败时回滚
+func TestCIDRGuardian_ExpandPoolRollback(t *testing.T) {
+	ctx := context.Background()
+
+	// 测试已分配IP只读取一次
+	storage := &countingIPStorage{MemoryIPStorage: NewMemoryIPStorage()}
+	guardian, _ := NewCIDRGuardian(ctx, storage)
+	if err := guardian.ExpandPool(ctx, "10.0.0.0/24"); err != nil {
+		t.Fatalf("ExpandPool failed: %v", err)
+	}
+	if storage.allocatedReads != 1 {
+		t.Errorf("Expected GetAllocatedIPs to be called once, got %d", storage.allocatedReads)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 256 {
+		t.Errorf("Expected 256 available IPs, got %d", count)
+	}
+
+	// 测试通过一次批量调用添加，不逐个调用 AddIP，中途的 AddIP 失败不会造成部分扩展
+	storage = &countingIPStorage{MemoryIPStorage: NewMemoryIPStorage()}
+	guardian, _ = NewCIDRGuardian(ctx, storage)
+	_ = guardian.AddSingleIP(ctx, "10.0.1.1")
+	storage.addCalls = 0
+	storage.failAfter = 10
+	if err := guardian.ExpandPool(ctx, "10.0.1.0/28"); err != nil {
+		t.Fatalf("ExpandPool failed: %v", err)
+	}
+	if storage.addCalls != 0 || len(storage.bulkStarts) != 1 {
+		t.Errorf("Expected a single BulkAddIP call, got %d AddIP and %d BulkAddIP calls", storage.addCalls, len(storage.bulkStarts))
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 16 {
+		t.Errorf("Expected 16 available IPs, got %d", count)
+	}
+
+	// 测试批量添加失败时不留下部分扩展，且不影响原有的可用IP
+	storage = &countingIPStorage{MemoryIPStorage: NewMemoryIPStorage(), failBulkAt: 1}
+	guardian, _ = NewCIDRGuardian(ctx, storage)
+	_ = guardian.AddSingleIP(ctx, "10.0.1.1")
+	if err := guardian.ExpandPool(ctx, "10.0.1.0/28"); err == nil {
+		t.Fatal("ExpandPool should fail when BulkAddIP fails")
+	}
+	ips, _ := guardian.storage.GetAvailableIPs(ctx)
+	if !reflect.DeepEqual(ips, []string{"10.0.1.1"}) {
+		t.Errorf("Expected only the pre-existing IP to remain, got %v", ips)
+	}
+	if managed, _ := guardian.GetManagedCIDRs(ctx); managed["10.0.1.0/28"] != "" {
+		t.Error("Failed ExpandPool should not register the CIDR")
+	}
+
+	// 测试 CIDR 已在管理池中时不修改可用池
+	guardian, _ = NewCIDRGuardian(ctx, nil, "10.0.2.0/28")
+	_ = guardian.RemoveSingleIP(ctx, "10.0.2.1")
+	if err := guardian.ExpandPool(ctx, "10.0.2.0/28"); err == nil {
+		t.Fatal("ExpandPool should fail when the CIDR is already managed")
+	}
+	if ok, _ := guardian.storage.IsIPAvailable(ctx, "10.0.2.1"); ok {
+		t.Error("Failed ExpandPool should not add IPs")
+	}
+	if ok, _ := guardian.storage.IsIPAvailable(ctx, "10.0.2.2"); !ok {
+		t.Error("Pre-existing available IP should be kept")
+	}
+
+	// 测试新CIDR中已分配的IP被跳过
+	guardian, _ = NewCIDRGuardian(ctx, nil)
+	_ = guardian.AddSingleIP(ctx, "10.0.3.5")
+	if err := guardian.AllocateIP(ctx, "10.0.3.5", "used"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	if err := guardian.ExpandPool(ctx, "10.0.3.0/28"); err != nil {
+		t.Fatalf("ExpandPool failed: %v", err)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 15 {
+		t.Errorf("Expected 15 available IPs, got %d", count)
+	}
+	if ok, _ := guardian.storage.IsIPAvailable(ctx, "10.0.3.5"); ok {
+		t.Error("Allocated member should stay out of the available pool")
+	}
+}
+
+// TestCIDRGuardian_AddCIDRWithProgress 测试分批添加 CIDR 时报告进度并从检查点继续
+func TestCIDRGuardian_AddCIDRWithProgress(t *testing.T) {
+	ctx := context.Background()
+
+	// 第 3 批提交失败
+	storage := &countingIPStorage{MemoryIPStorage: NewMemoryIPStorage(), failBulkAt: 3}
+	guardian, _ := NewCIDRGuardian(ctx, storage)
+	var reports [][2]int
+	progress := func(done, total int) {
+		reports = append(reports, [2]int{done, total})
+	}
+	if err := guardian.AddCIDRWithProgress(ctx, "10.0.0.0/20", "big", progress); err == nil {
+		t.Fatal("Expected AddCIDRWithProgress to fail")
+	}
+	if expected := [][2]int{{1024, 4096}, {2048, 4096}}; !reflect.DeepEqual(reports, expected) {
+		t.Errorf("Expected progress %v, got %v", expected, reports)
+	}
+	if managed, _ := guardian.GetManagedCIDRs(ctx); len(managed) != 0 {
+		t.Errorf("Expected CIDR not to be managed before completion, got %v", managed)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 2048 {
+		t.Errorf("Expected committed batches to be kept, got %d available IPs", count)
+	}
+
+	// 重新运行从检查点继续，不重复提交已完成的批次
+	reports = nil
+	storage.bulkStarts, storage.failBulkAt = nil, 0
+	if err := guardian.AddCIDRWithProgress(ctx, "10.0.0.0/20", "big", progress); err != nil {
+		t.Fatalf("AddCIDRWithProgress failed: %v", err)
+	}
+	if expected := []string{"10.0.8.0", "10.0.12.0"}; !reflect.DeepEqual(storage.bulkStarts, expected) {
+		t.Errorf("Expected resumed batches to start at %v, got %v", expected, storage.bulkStarts)
+	}
+	if expected := [][2]int{{3072, 4096}, {4096, 4096}}; !reflect.DeepEqual(reports, expected) {
+		t.Errorf("Expected progress %v, got %v", expected, reports)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 4096 {
+		t.Errorf("Expected 4096 available IPs, got %d", count)
+	}
+	if managed, _ := guardian.GetManagedCIDRs(ctx); managed["10.0.0.0/20"] != "big" {
+		t.Errorf("Expected CIDR to be managed, got %v", managed)
+	}
+	if len(guardian.addProgress) != 0 {
+		t.Errorf("Expected checkpoint to be cleared, got %v", guardian.addProgress)
+	}
+
+	// 重复添加和无效参数
+	if err := guardian.AddCIDRWithProgress(ctx, "10.0.0.0/20", "big", nil); err == nil {
+		t.Error("Expected error for already managed CIDR")
+	}
+	if err := guardian.AddCIDRWithProgress(ctx, "invalid", "big", nil); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+// BenchmarkCIDRGuardian_ExpandPool 测试扩展 /22 网段的性能
+func BenchmarkCIDRGuardian_ExpandPool(b *testing.B) {
+	ctx := context.Background()
+	allocations := make(map[string]string, 1024)
+	for i := 0; i < 1024; i++ {
+		allocations[fmt.Sprintf("10.0.%d.%d", i/256, i%256)] = "existing"
+	}
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/22")
+		if err := guardian.ImportAllocations(ctx, allocations); err != nil {
+			b.Fatalf("ImportAllocations failed: %v", err)
+		}
+		b.StartTimer()
+
+		if err := guardian.ExpandPool(ctx, "10.1.0.0/22"); err != nil {
+			b.Fatalf("ExpandPool failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkCIDRGuardian_ManagedCIDRReads 比较写入进行时读取管理 CIDR 的开销
+// RWMutex 子测试在读锁下读取，模拟写时复制之前的实现
+func BenchmarkCIDRGuardian_ManagedCIDRReads(b *testing.B) {
+	ctx := context.Background()
+	reads := map[string]func(g *CIDRGuardian) error{
+		"Snapshot": func(g *CIDRGuardian) error {
+			_, err := g.GetManagedCIDRs(ctx)
+			return err
+		},
+		"RWMutex": func(g *CIDRGuardian) error {
+			g.mu.RLock()
+			defer g.mu.RUnlock()
+			_, err := g.GetManagedCIDRs(ctx)
+			return err
+		},
+	}
+
+	for _, name := range []string{"RWMutex", "Snapshot"} {
+		read := reads[name]
+		b.Run(name, func(b *testing.B) {
+			guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/24", "10.0.1.0/24")
+
+			// 写入方反复添加和移除 CIDR，每次都在写锁下操作存储
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					_ = guardian.AddCIDR(ctx, "10.0.2.0/24", "churn")
+					_ = guardian.RemoveCIDR(ctx, "10.0.2.0/24")
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := read(guardian); err != nil {
+						b.Errorf("read failed: %v", err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+
+			close(stop)
+			<-done
+		})
+	}
+}
+
+// TestCIDRGuardian_AllocateCIDRWithHint 测试按放置提示分配CIDR
+func TestCIDRGuardian_AllocateCIDRWithHint(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/24")
+
+	a1, err := guardian.AllocateCIDRWithHint(ctx, 30, "a1", "region-a")
+	if err != nil {
+		t.Fatalf("AllocateCIDRWithHint failed: %v", err)
+	}
+	// 其他提示的分配不应插入到 region-a 的块之间
+	b1, err := guardian.AllocateCIDRWithHint(ctx, 30, "b1", "region-b")
+	if err != nil {
+		t.Fatalf("AllocateCIDRWithHint failed: %v", err)
+	}
+	a2, err := guardian.AllocateCIDRWithHint(ctx, 30, "a2", "region-a")
+	if err != nil {
+		t.Fatalf("AllocateCIDRWithHint failed: %v", err)
+	}
+
+	if a1 != "10.0.0.0/30" || a2 != "10.0.0.4/30" {
+		t.Errorf("Same-hint /30s should be adjacent, got %s and %s", a1, a2)
+	}
+	if b1 == "10.0.0.4/30" {
+		t.Errorf("Different hint should not take the block next to region-a, got %s", b1)
+	}
+	b2, _ := guardian.AllocateCIDRWithHint(ctx, 30, "b2", "region-b")
+	_, n1, _ := net.ParseCIDR(b1)
+	_, n2, _ := net.ParseCIDR(b2)
+	if ipv4ToUint(n2.IP)-ipv4ToUint(n1.IP) != 4 {
+		t.Errorf("Same-hint /30s should be adjacent, got %s and %s", b1, b2)
+	}
+
+	// 测试空提示等同于 AllocateCIDR
+	if cidr, err := guardian.AllocateCIDRWithHint(ctx, 30, "none", ""); err != nil || cidr != "10.0.0.8/30" {
+		t.Errorf("Empty hint should behave like AllocateCIDR, got %s (err=%v)", cidr, err)
+	}
+
+	// 测试无效位数
+	if _, err := guardian.AllocateCIDRWithHint(ctx, 33, "bad", "region-a"); err == nil {
+		t.Error("AllocateCIDRWithHint should fail with invalid bits")
+	}
+}
+
+// TestParseAndValidateCIDR 测试CIDR校验辅助函数
+func TestParseAndValidateCIDR(t *testing.T) {
+	tests := []struct {
+		input   string
+		network string
+		family  int
+		hosts   string
+		wantErr bool
+	}{
+		{"10.0.0.5/24", "10.0.0.0/24", FamilyIPv4, "256", false},
+		{"192.168.1.1/32", "192.168.1.1/32", FamilyIPv4, "1", false},
+		{"2001:db8::1/64", "2001:db8::/64", FamilyIPv6, "18446744073709551616", false},
+		{"10.0.0.0/33", "", 0, "", true},
+		{"invalid", "", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		network, family, hosts, err := ParseAndValidateCIDR(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAndValidateCIDR(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if network != tt.network || family != tt.family || hosts.String() != tt.hosts {
+			t.Errorf("ParseAndValidateCIDR(%s) = %s, %d, %s; want %s, %d, %s",
+				tt.input, network, family, hosts, tt.network, tt.family, tt.hosts)
+		}
+	}
+}
+
+// TestValidateIP 测试IP校验辅助函数
+func TestValidateIP(t *testing.T) {
+	tests := []struct {
+		input   string
+		family  int
+		wantErr bool
+	}{
+		{"10.0.0.1", FamilyIPv4, false},
+		{"2001:db8::1", FamilyIPv6, false},
+		{"10.0.0.256", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		family, err := ValidateIP(tt.input)
+		if (err != nil) != tt.wantErr || family != tt.family {
+			t.Errorf("ValidateIP(%q) = %d, %v; want %d, wantErr %v", tt.input, family, err, tt.family, tt.wantErr)
+		}
+	}
+}
+
+// TestIsSpecialUse 测试特殊用途地址判断
+func TestIsSpecialUse(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":        true,
+		"224.0.0.251":      true,
+		"240.0.0.1":        true,
+		"255.255.255.255":  true,
+		"192.0.2.10":       true,
+		"169.254.1.1":      true,
+		"::1":              true,
+		"ff02::1":          true,
+		"2001:db8::1":      true,
+		"fe80::1":          true,
+		"::ffff:127.0.0.1": true,
+		"10.0.0.1":         false,
+		"192.168.1.1":      false,
+		"100.64.0.1":       false,
+		"8.8.8.8":          false,
+		"2001:4860::8888":  false,
+		"fd00::1":          false,
+	}
+	for ip, want := range tests {
+		if got := IsSpecialUse(net.ParseIP(ip)); got != want {
+			t.Errorf("IsSpecialUse(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if IsSpecialUse(nil) {
+		t.Error("Expected nil IP not to be special use")
+	}
+}
+
+// TestCIDRGuardian_RejectSpecialUse 测试拒绝添加特殊用途地址
+func TestCIDRGuardian_RejectSpecialUse(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithRejectSpecialUse())
+
+	for _, cidr := range []string{"127.0.0.0/30", "224.0.0.0/30", "2001:db8::/126", "192.0.0.0/16"} {
+		if err := guardian.AddCIDR(ctx, cidr, "x"); !errors.Is(err, ErrSpecialUse) {
+			t.Errorf("AddCIDR(%s): expected ErrSpecialUse, got %v", cidr, err)
+		}
+	}
+	if err := guardian.AddCIDRs(ctx, map[string]string{"10.1.0.0/30": "ok", "203.0.113.0/30": "doc"}); !errors.Is(err, ErrSpecialUse) {
+		t.Errorf("AddCIDRs: expected ErrSpecialUse, got %v", err)
+	}
+	if err := guardian.ExpandPool(ctx, "240.0.0.0/30"); !errors.Is(err, ErrSpecialUse) {
+		t.Errorf("ExpandPool: expected ErrSpecialUse, got %v", err)
+	}
+	if err := guardian.AddSingleIP(ctx, "ff02::1"); !errors.Is(err, ErrSpecialUse) {
+		t.Errorf("AddSingleIP: expected ErrSpecialUse, got %v", err)
+	}
+
+	// 普通地址不受影响
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/30", "lan"); err != nil {
+		t.Errorf("AddCIDR failed for normal CIDR: %v", err)
+	}
+	if err := guardian.AddSingleIP(ctx, "192.168.1.1"); err != nil {
+		t.Errorf("AddSingleIP failed for normal IP: %v", err)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 5 {
+		t.Errorf("Expected 5 available IPs, got %d", count)
+	}
+
+	// 默认不检查
+	plain, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if err := plain.AddCIDR(ctx, "127.0.0.0/30", "loopback"); err != nil {
+		t.Errorf("Expected special-use CIDR to be accepted by default, got %v", err)
+	}
+}
+
+// TestCIDRGuardian_BulkAllocate 测试批量分配
+func TestCIDRGuardian_BulkAllocate(t *testing.T) {
+	ctx := context.Background()
+
+	for name, storage := range map[string]func() IPStorage{
+		"memory": func() IPStorage { return NewMemoryIPStorage() },
+		"sharded": func() IPStorage {
+			s, _ := NewShardedIPStorage(NewMemoryIPStorage(), NewMemoryIPStorage())
+			return s
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			guardian, _ := NewCIDRGuardian(ctx, storage(), "10.0.0.0/28")
+			_ = guardian.AllocateIP(ctx, "10.0.0.5", "taken")
+
+			// 测试整体失败模式
+			_, err := guardian.BulkAllocate(ctx, map[string]string{
+				"10.0.0.2": "a",
+				"10.0.0.5": "b",
+			})
+			if err == nil {
+				t.Error("BulkAllocate should fail when an IP is unavailable")
+			}
+			if ok, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.2"); !ok {
+				t.Error("Failed BulkAllocate should not allocate any IP")
+			}
+
+			// 测试全部可用时成功
+			ips, err := guardian.BulkAllocate(ctx, map[string]string{
+				"10.0.0.10": "a",
+				"10.0.0.2":  "b",
+			})
+			if err != nil {
+				t.Fatalf("BulkAllocate failed: %v", err)
+			}
+			if !reflect.DeepEqual(ips, []string{"10.0.0.2", "10.0.0.10"}) {
+				t.Errorf("Expected numerically sorted IPs, got %v", ips)
+			}
+
+			// 测试跳过不可用模式
+			ips, err = guardian.BulkAllocate(ctx, map[string]string{
+				"10.0.0.3":  "c",
+				"10.0.0.5":  "c",
+				"10.0.0.99": "c",
+			}, WithSkipUnavailable())
+			if err != nil {
+				t.Fatalf("BulkAllocate with skip failed: %v", err)
+			}
+			if !reflect.DeepEqual(ips, []string{"10.0.0.3"}) {
+				t.Errorf("Expected only 10.0.0.3 to be allocated, got %v", ips)
+			}
+			allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+			if allocated["10.0.0.5"] != "taken" {
+				t.Error("Skipped IP should keep its original allocation")
+			}
+		})
+	}
+
+	// 测试无效IP
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/28")
+	if _, err := guardian.BulkAllocate(ctx, map[string]string{"invalid": "x"}); err == nil {
+		t.Error("BulkAllocate should fail with invalid IP")
+	}
+}
+
+// TestSQLIPStorage_BulkAllocateIP 测试SQL存储的批量分配
+func TestSQLIPStorage_BulkAllocateIP(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	// 测试在同一事务中分配
+	mock.ExpectBegin()
+	for _, ip := range []string{"192.168.1.1", "192.168.1.2"} {
+		mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+			WithArgs(ip).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").
+			WithArgs(ip).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO ip_allocated (ip, description) VALUES (?, ?)").
+			WithArgs(ip, "warm").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectCommit()
+
+	ips, err := storage.BulkAllocateIP(ctx, map[string]string{
+		"192.168.1.2": "warm",
+		"192.168.1.1": "warm",
+	}, false)
+	if err != nil {
+		t.Errorf("BulkAllocateIP 失败: %v", err)
+	}
+	if !reflect.DeepEqual(ips, []string{"192.168.1.1", "192.168.1.2"}) {
+		t.Errorf("BulkAllocateIP 返回 %v", ips)
+	}
+
+	// 测试不可用时整体回滚
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_allocated (ip, description) VALUES (?, ?)").
+		WithArgs("192.168.1.1", "warm").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.2").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+
+	if _, err := storage.BulkAllocateIP(ctx, map[string]string{
+		"192.168.1.1": "warm",
+		"192.168.1.2": "warm",
+	}, false); err == nil {
+		t.Error("当 IP 不可用时，BulkAllocateIP 应该失败")
+	}
+
+	// 测试跳过不可用的 IP
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.2").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_allocated (ip, description) VALUES (?, ?)").
+		WithArgs("192.168.1.2", "warm").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	ips, err = storage.BulkAllocateIP(ctx, map[string]string{
+		"192.168.1.1": "warm",
+		"192.168.1.2": "warm",
+	}, true)
+	if err != nil || !reflect.DeepEqual(ips, []string{"192.168.1.2"}) {
+		t.Errorf("BulkAllocateIP 跳过模式返回 %v, %v", ips, err)
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_FreeCIDRsWithin 测试计算管理CIDR内的空闲子块
+func TestCIDRGuardian_FreeCIDRsWithin(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/24", "10.0.1.0/30")
+
+	// 测试整个父块空闲
+	free, err := guardian.FreeCIDRsWithin(ctx, "10.0.0.0/24")
+	if err != nil || !reflect.DeepEqual(free, []string{"10.0.0.0/24"}) {
+		t.Errorf("Expected whole parent to be free, got %v (err=%v)", free, err)
+	}
+
+	// 测试扣除已分配的块和单个IP
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.64/26", "block"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "host")
+	free, _ = guardian.FreeCIDRsWithin(ctx, "10.0.0.0/24")
+	expected := []string{"10.0.0.0/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/29",
+		"10.0.0.16/28", "10.0.0.32/27", "10.0.0.128/25"}
+	if !reflect.DeepEqual(free, expected) {
+		t.Errorf("Expected %v, got %v", expected, free)
+	}
+
+	// 测试完全占用时返回空列表，且不包含其他管理CIDR的地址
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.1.0/30", "full"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+	free, err = guardian.FreeCIDRsWithin(ctx, "10.0.1.0/30")
+	if err != nil || free == nil || len(free) != 0 {
+		t.Errorf("Expected empty result for fully allocated CIDR, got %v (err=%v)", free, err)
+	}
+
+	// 测试非管理CIDR和无效CIDR
+	if _, err := guardian.FreeCIDRsWithin(ctx, "10.0.2.0/24"); err == nil {
+		t.Error("FreeCIDRsWithin should fail for unmanaged CIDR")
+	}
+	if _, err := guardian.FreeCIDRsWithin(ctx, "invalid"); err == nil {
+		t.Error("FreeCIDRsWithin should fail with invalid CIDR")
+	}
+}
+
+// TestCIDRGuardian_DescriptionValidation 测试分配描述的长度和字符校验
+func TestCIDRGuardian_DescriptionValidation(t *testing.T) {
+	ctx := context.Background()
+
+	// 测试默认不限制
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/24")
+	if err := guardian.AllocateIP(ctx, "10.0.0.1", strings.Repeat("x", 10000)+"\n"); err != nil {
+		t.Errorf("Default should not limit descriptions: %v", err)
+	}
+
+	guardian, _ = NewCIDRGuardianWithOptions(ctx, nil,
+		WithInitialCIDRs("10.0.0.0/24"),
+		WithMaxDescriptionLength(8),
+		WithRejectControlChars(),
+	)
+
+	// 测试边界长度，按字符计算
+	if err := guardian.AllocateIP(ctx, "10.0.0.1", "数据库集群主节点"); err != nil {
+		t.Errorf("Description at the limit should be accepted: %v", err)
+	}
+	if err := guardian.AllocateIP(ctx, "10.0.0.2", "123456789"); !errors.Is(err, ErrDescriptionTooLong) {
+		t.Errorf("Expected ErrDescriptionTooLong, got %v", err)
+	}
+	if ok, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.2"); !ok {
+		t.Error("Rejected allocation should leave the IP available")
+	}
+
+	// 测试控制字符
+	if err := guardian.AllocateIP(ctx, "10.0.0.3", "a\tb"); !errors.Is(err, ErrDescriptionInvalid) {
+		t.Errorf("Expected ErrDescriptionInvalid, got %v", err)
+	}
+
+	// 测试其他分配入口
+	if _, err := guardian.GetNextAvailableIP(ctx, "123456789"); !errors.Is(err, ErrDescriptionTooLong) {
+		t.Errorf("GetNextAvailableIP: expected ErrDescriptionTooLong, got %v", err)
+	}
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.128/30", "123456789"); !errors.Is(err, ErrDescriptionTooLong) {
+		t.Errorf("AllocateSpecificCIDR: expected ErrDescriptionTooLong, got %v", err)
+	}
+	if _, err := guardian.BulkAllocate(ctx, map[string]string{"10.0.0.9": "123456789"}); !errors.Is(err, ErrDescriptionTooLong) {
+		t.Errorf("BulkAllocate: expected ErrDescriptionTooLong, got %v", err)
+	}
+	if err := guardian.ImportAllocations(ctx, map[string]string{"10.0.1.1": "123456789"}); !errors.Is(err, ErrDescriptionTooLong) {
+		t.Errorf("ImportAllocations: expected ErrDescriptionTooLong, got %v", err)
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 1 {
+		t.Errorf("Expected only the valid allocation, got %d", count)
+	}
+}
+
+// TestCIDRGuardian_StatusTable 测试表格形式的状态输出
+func TestCIDRGuardian_StatusTable(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/28")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.4/30", "db"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+
+	before, _ := guardian.String(ctx)
+	table, err := guardian.StatusTable(ctx)
+	if err != nil {
+		t.Fatalf("StatusTable failed: %v", err)
+	}
+	if after, _ := guardian.String(ctx); after != before {
+		t.Error("StatusTable should not change String output")
+	}
+
+	lines := strings.Split(table, "\n")
+	if len(lines) < 6 {
+		t.Fatalf("Unexpected table:\n%s", table)
+	}
+	// 测试使用率和对齐
+	if !strings.Contains(lines[1], "10.0.0.0/28") || !strings.Contains(lines[1], "16") ||
+		!strings.Contains(lines[1], "31.2%") {
+		t.Errorf("Unexpected CIDR row: %q", lines[1])
+	}
+	if strings.Index(lines[0], "描述") != strings.Index(lines[1], "初始 CIDR") {
+		t.Errorf("Columns should be aligned:\n%s", table)
+	}
+	if !strings.Contains(table, "10.0.0.1     IP    web") || !strings.Contains(table, "10.0.0.4/30  CIDR  db") {
+		t.Errorf("Allocations should be listed in order:\n%s", table)
+	}
+}
+
+// TestMemoryIPStorage_History 测试内存存储的分配历史
+func TestMemoryIPStorage_History(t *testing.T) {
+	ctx := context.Background()
+
+	// 测试默认不记录历史
+	storage := NewMemoryIPStorage()
+	_ = storage.AddIP(ctx, "10.0.0.1")
+	_ = storage.AllocateIP(ctx, "10.0.0.1", "web")
+	if history, _ := storage.GetIPHistory(ctx, "10.0.0.1"); len(history) != 0 {
+		t.Errorf("History should be disabled by default, got %v", history)
+	}
+
+	// 测试只保留最近 K 条
+	storage = NewMemoryIPStorage(WithMemoryHistory(3))
+	_ = storage.AddIP(ctx, "10.0.0.1")
+	_ = storage.AllocateIP(ctx, "10.0.0.1", "web")
+	_ = storage.DeallocateIP(ctx, "10.0.0.1")
+	_ = storage.AllocateIP(ctx, "10.0.0.1", "db")
+	_ = storage.DeallocateIP(ctx, "10.0.0.1")
+
+	history, err := storage.GetIPHistory(ctx, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("GetIPHistory failed: %v", err)
+	}
+	var got []string
+	for _, entry := range history {
+		if entry.Time.IsZero() {
+			t.Error("History entry should carry a timestamp")
+		}
+		got = append(got, entry.Action+":"+entry.Description)
+	}
+	expected := []string{"deallocate:web", "allocate:db", "deallocate:db"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected history %v, got %v", expected, got)
+	}
+}
+
+// TestCIDRGuardian_GetIPHistory 测试通过 CIDRGuardian 获取分配历史
+func TestCIDRGuardian_GetIPHistory(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(WithMemoryHistory(5)), "10.0.0.0/30")
+
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "old")
+	_ = guardian.ReleaseIP(ctx, "10.0.0.1")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "new")
+
+	history, err := guardian.GetIPHistory(ctx, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("GetIPHistory failed: %v", err)
+	}
+	if len(history) != 3 || history[1].Description != "old" || history[2].Description != "new" {
+		t.Errorf("Unexpected history: %v", history)
+	}
+
+	// 测试无效IP和不支持历史的存储
+	if _, err := guardian.GetIPHistory(ctx, "invalid"); err == nil {
+		t.Error("GetIPHistory should fail with invalid IP")
+	}
+	guardian, _ = NewCIDRGuardian(ctx, newMockIPStorage())
+	if _, err := guardian.GetIPHistory(ctx, "10.0.0.1"); err == nil {
+		t.Error("GetIPHistory should fail when storage does not support history")
+	}
+}
+
+// TestSQLIPStorage_History 测试SQL存储的分配历史
+func TestSQLIPStorage_History(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+	storage.historyLimit = 2
+
+	ctx := context.Background()
+
+	// 测试分配时追加历史
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_allocated (ip, description) VALUES (?, ?)").
+		WithArgs("192.168.1.1", "web").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO ip_history (ip, action, description) VALUES (?, ?, ?)").
+		WithArgs("192.168.1.1", HistoryAllocate, "web").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := storage.AllocateIP(ctx, "192.168.1.1", "web"); err != nil {
+		t.Errorf("AllocateIP 失败: %v", err)
+	}
+
+	// 测试释放时保留释放前的描述
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO ip_history (ip, action, description) SELECT ip, ?, description FROM ip_allocated WHERE ip = ?").
+		WithArgs(HistoryDeallocate, "192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("DELETE FROM ip_allocated WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?)").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := storage.DeallocateIP(ctx, "192.168.1.1"); err != nil {
+		t.Errorf("DeallocateIP 失败: %v", err)
+	}
+
+	// 测试按时间正序返回最近的记录
+	now := time.Now()
+	mock.ExpectQuery("SELECT action, description, created_at FROM ip_history WHERE ip = ? ORDER BY id DESC LIMIT ?").
+		WithArgs("192.168.1.1", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"action", "description", "created_at"}).
+			AddRow(HistoryDeallocate, "web", now).
+			AddRow(HistoryAllocate, "web", now.Add(-time.Minute)))
+
+	history, err := storage.GetIPHistory(ctx, "192.168.1.1")
+	if err != nil {
+		t.Fatalf("GetIPHistory 失败: %v", err)
+	}
+	if len(history) != 2 || history[0].Action != HistoryAllocate || history[1].Action != HistoryDeallocate {
+		t.Errorf("GetIPHistory 返回 %v", history)
+	}
+
+	// 测试启用历史时创建历史表
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_available (
+			ip VARCHAR(45) PRIMARY KEY,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_allocated (
+			ip VARCHAR(45) PRIMARY KEY,
+			description TEXT,
+			source VARCHAR(255) NOT NULL DEFAULT '',
+			expires_at TIMESTAMP NULL,
+			metadata JSON NULL,
+			allocation_type VARCHAR(8) NOT NULL DEFAULT 'single',
+			cidr VARCHAR(49) NULL,
+			claim_token VARCHAR(64) NULL,
+			claim_expires_at TIMESTAMP NULL,
+			allocated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentAllocatedColumns(mock)
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS cidr_archive (
+			cidr VARCHAR(49) PRIMARY KEY,
+			description TEXT,
+			available_ips LONGTEXT,
+			allocated_ips LONGTEXT,
+			archived_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_reserved (
+			ip VARCHAR(45) PRIMARY KEY,
+			reason TEXT,
+			reserved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_excluded (
+			ip VARCHAR(45) PRIMARY KEY,
+			excluded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ip_history (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			ip VARCHAR(45) NOT NULL,
+			action VARCHAR(16) NOT NULL,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_ip_history_ip (ip)
+		) ENGINE=InnoDB;`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := storage.initTables(ctx); err != nil {
+		t.Errorf("initTables 失败: %v", err)
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_AvailabilityBitmap 测试可用性位图的导出和导入
+func TestCIDRGuardian_AvailabilityBitmap(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/28")
+	_ = guardian.AllocateIP(ctx, "10.0.0.0", "gw")
+	_ = guardian.RemoveSingleIP(ctx, "10.0.0.9")
+
+	// 测试完整CIDR，高位在前
+	bitmap, err := guardian.AvailabilityBitmap(ctx, "10.0.0.0/28")
+	if err != nil {
+		t.Fatalf("AvailabilityBitmap failed: %v", err)
+	}
+	if !bytes.Equal(bitmap, []byte{0x7f, 0xbf}) {
+		t.Errorf("Expected bitmap 7fbf, got %x", bitmap)
+	}
+
+	// 测试部分CIDR和填充位
+	bitmap, _ = guardian.AvailabilityBitmap(ctx, "10.0.0.8/30")
+	if !bytes.Equal(bitmap, []byte{0xb0}) {
+		t.Errorf("Expected bitmap b0, got %x", bitmap)
+	}
+
+	// 测试导入到副本
+	replica, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/28")
+	_ = replica.AllocateIP(ctx, "10.0.0.0", "gw")
+	full, _ := guardian.AvailabilityBitmap(ctx, "10.0.0.0/28")
+	if err := replica.ImportAvailabilityBitmap(ctx, "10.0.0.0/28", full); err != nil {
+		t.Fatalf("ImportAvailabilityBitmap failed: %v", err)
+	}
+	src, _ := guardian.storage.GetAvailableIPs(ctx)
+	dst, _ := replica.storage.GetAvailableIPs(ctx)
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("Replica state %v should match source %v", dst, src)
+	}
+
+	// 测试导入错误
+	if err := replica.ImportAvailabilityBitmap(ctx, "10.0.0.0/28", []byte{0xff}); err == nil {
+		t.Error("Import should fail with wrong bitmap length")
+	}
+	if err := replica.ImportAvailabilityBitmap(ctx, "10.0.0.8/30", []byte{0xb1}); err == nil {
+		t.Error("Import should fail when padding bits are set")
+	}
+	if err := replica.ImportAvailabilityBitmap(ctx, "10.0.0.0/30", []byte{0xf0}); err == nil {
+		t.Error("Import should fail when an allocated IP is marked available")
+	}
+	if err := replica.ImportAvailabilityBitmap(ctx, "10.0.1.0/30", []byte{0x80}); err == nil {
+		t.Error("Import should fail for unmanaged addresses")
+	}
+	if dst2, _ := replica.storage.GetAvailableIPs(ctx); !reflect.DeepEqual(dst, dst2) {
+		t.Error("Failed imports should not change state")
+	}
+
+	// 测试过大的CIDR
+	if _, err := guardian.AvailabilityBitmap(ctx, "10.0.0.0/7"); err == nil {
+		t.Error("AvailabilityBitmap should reject CIDRs above the size limit")
+	}
+}
+
+// TestSQLIPStorage_verifyTables 测试跳过建表时的表结构检查
+func TestSQLIPStorage_verifyTables(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	query := "SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?"
+	columns := func(names ...string) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"column_name"})
+		for _, name := range names {
+			rows.AddRow(name)
+		}
+		return rows
+	}
+
+	// 测试表结构完整，列名大小写不敏感
+	mock.ExpectQuery(query).WithArgs("ip_available").WillReturnRows(columns("ip", "created_at"))
+	mock.ExpectQuery(query).WithArgs("ip_allocated").WillReturnRows(columns("IP", "DESCRIPTION", "SOURCE", "EXPIRES_AT", "METADATA", "ALLOCATION_TYPE", "CIDR", "CLAIM_TOKEN", "CLAIM_EXPIRES_AT", "allocated_at"))
+	mock.ExpectQuery(query).WithArgs("cidr_archive").
+		WillReturnRows(columns("cidr", "description", "available_ips", "allocated_ips", "archived_at"))
+	mock.ExpectQuery(query).WithArgs("ip_reserved").WillReturnRows(columns("ip", "reason", "reserved_at"))
+	mock.ExpectQuery(query).WithArgs("ip_excluded").WillReturnRows(columns("ip", "excluded_at"))
+	if err := storage.verifyTables(ctx); err != nil {
+		t.Errorf("verifyTables 失败: %v", err)
+	}
+
+	// 测试表不存在
+	mock.ExpectQuery(query).WithArgs("ip_available").WillReturnRows(columns())
+	if err := storage.verifyTables(ctx); err == nil || !strings.Contains(err.Error(), "ip_available 不存在") {
+		t.Errorf("表不存在时应返回明确的错误，得到 %v", err)
+	}
+
+	// 测试缺少列
+	mock.ExpectQuery(query).WithArgs("ip_available").WillReturnRows(columns("ip"))
+	mock.ExpectQuery(query).WithArgs("ip_allocated").WillReturnRows(columns("ip"))
+	if err := storage.verifyTables(ctx); err == nil || !strings.Contains(err.Error(), "缺少列: description") {
+		t.Errorf("缺少列时应返回明确的错误，得到 %v", err)
+	}
+
+	// 测试缺少认领列，启动时即报告而不是等到第一次 ClaimIP
+	mock.ExpectQuery(query).WithArgs("ip_available").WillReturnRows(columns("ip"))
+	mock.ExpectQuery(query).WithArgs("ip_allocated").
+		WillReturnRows(columns("ip", "description", "source", "expires_at", "metadata", "allocation_type", "cidr", "allocated_at"))
+	if err := storage.verifyTables(ctx); err == nil || !strings.Contains(err.Error(), "缺少列: claim_token, claim_expires_at") {
+		t.Errorf("缺少认领列时应返回明确的错误，得到 %v", err)
+	}
+
+	// 测试查询失败
+	mock.ExpectQuery(query).WithArgs("ip_available").WillReturnError(fmt.Errorf("permission denied"))
+	if err := storage.verifyTables(ctx); err == nil {
+		t.Error("查询失败时 verifyTables 应该失败")
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_UpdateCIDRDescription 测试更新管理CIDR的描述
+func TestCIDRGuardian_UpdateCIDRDescription(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil)
+	_ = guardian.AddCIDR(ctx, "10.0.0.0/24", "old")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	before, _ := guardian.AvailableCount(ctx)
+
+	if err := guardian.UpdateCIDRDescription(ctx, "10.0.0.0/24", "new"); err != nil {
+		t.Fatalf("UpdateCIDRDescription failed: %v", err)
+	}
+	managed, _ := guardian.GetManagedCIDRs(ctx)
+	if managed["10.0.0.0/24"] != "new" {
+		t.Errorf("Expected description new, got %q", managed["10.0.0.0/24"])
+	}
+	if after, _ := guardian.AvailableCount(ctx); after != before {
+		t.Errorf("UpdateCIDRDescription should not touch IPs: %d -> %d", before, after)
+	}
+
+	// 测试非规范写法
+	if err := guardian.UpdateCIDRDescription(ctx, "10.0.0.7/24", "canonical"); err != nil {
+		t.Errorf("UpdateCIDRDescription should accept non-canonical CIDR: %v", err)
+	}
+
+	// 测试未管理的CIDR
+	if err := guardian.UpdateCIDRDescription(ctx, "10.0.1.0/24", "x"); err == nil {
+		t.Error("UpdateCIDRDescription should fail for unmanaged CIDR")
+	}
+}
+
+// TestCIDRGuardian_UpdateDescription 测试更新已分配IP的描述
+func TestCIDRGuardian_UpdateDescription(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/24")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "svc-old")
+	block := "10.0.0.4/30"
+	if err := guardian.AllocateSpecificCIDR(ctx, block, "db-old"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+
+	if err := guardian.UpdateDescription(ctx, "10.0.0.1", "svc-new"); err != nil {
+		t.Fatalf("UpdateDescription failed: %v", err)
+	}
+	if err := guardian.UpdateDescription(ctx, block, "db-new"); err != nil {
+		t.Fatalf("UpdateDescription for block failed: %v", err)
+	}
+
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if allocated["10.0.0.1"] != "svc-new" {
+		t.Errorf("Expected svc-new, got %q", allocated["10.0.0.1"])
+	}
+	used, _ := guardian.GetUsedCIDRs(ctx)
+	if used[block] != "db-new" {
+		t.Errorf("Expected block description db-new, got %v", used)
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 2 {
+		t.Errorf("UpdateDescription should not change allocations, got %d", count)
+	}
+
+	// 测试未分配的IP
+	if err := guardian.UpdateDescription(ctx, "10.0.0.200", "x"); err == nil {
+		t.Error("UpdateDescription should fail for unallocated IP")
+	}
+	if err := guardian.UpdateDescription(ctx, "invalid", "x"); err == nil {
+		t.Error("UpdateDescription should fail with invalid IP")
+	}
+}
+
+// TestSQLIPStorage_UpdateDescription 测试SQL存储更新描述
+func TestSQLIPStorage_UpdateDescription(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE ip_allocated SET description = ? WHERE ip = ?").
+		WithArgs("renamed", "192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := storage.UpdateDescription(ctx, "192.168.1.1", "renamed"); err != nil {
+		t.Errorf("UpdateDescription 失败: %v", err)
+	}
+
+	// 测试未分配的 IP
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("192.168.1.2").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+
+	if err := storage.UpdateDescription(ctx, "192.168.1.2", "renamed"); err == nil {
+		t.Error("当 IP 未分配时，UpdateDescription 应该失败")
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// cancelAfterFirstCheckCtx 在第一次 Err 检查之后表现为已取消，用于模拟扫描过程中被取消
+type cancelAfterFirstCheckCtx struct {
+	context.Context
+	checks int32
+}
+
+func (c *cancelAfterFirstCheckCtx) Err() error {
+	if atomic.AddInt32(&c.checks, 1) > 1 {
+		return context.Canceled
+	}
+	return nil
+}
+
+// TestSQLIPStorage_ScanCancellation 测试扫描大结果集时响应上下文取消
+func TestSQLIPStorage_ScanCancellation(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	available := sqlmock.NewRows([]string{"ip"})
+	allocated := sqlmock.NewRows([]string{"ip", "description"})
+	for i := 0; i < 3*scanCancelCheckInterval; i++ {
+		ip := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+		available.AddRow(ip)
+		allocated.AddRow(ip, "bulk")
+	}
+
+	mock.ExpectQuery("SELECT ip FROM ip_available ORDER BY ip").WillReturnRows(available)
+	if _, err := storage.GetAvailableIPs(&cancelAfterFirstCheckCtx{Context: context.Background()}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetAvailableIPs 应在扫描中途因取消而返回，得到 %v", err)
+	}
+
+	mock.ExpectQuery("SELECT ip, description FROM ip_allocated").WillReturnRows(allocated)
+	if _, err := storage.GetAllocatedIPs(&cancelAfterFirstCheckCtx{Context: context.Background()}); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetAllocatedIPs 应在扫描中途因取消而返回，得到 %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_ReserveCIDR 测试按块预留和取消预留
+func TestCIDRGuardian_ReserveCIDR(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/24")
+
+	// 测试预留单个IP
+	if err := guardian.ReserveIP(ctx, "10.0.0.200", "gateway"); err != nil {
+		t.Fatalf("ReserveIP failed: %v", err)
+	}
+	if err := guardian.AllocateIP(ctx, "10.0.0.200", "x"); err == nil {
+		t.Error("Reserved IP should not be allocatable")
+	}
+
+	// 测试预留整个块
+	if err := guardian.ReserveCIDR(ctx, "10.0.0.0/26", "planned cluster"); err != nil {
+		t.Fatalf("ReserveCIDR failed: %v", err)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 256-64-1 {
+		t.Errorf("Reserved IPs should not count as available, got %d", count)
+	}
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.0/28", "x"); err == nil {
+		t.Error("Reserved block should not be allocatable")
+	}
+	if cidr, _ := guardian.AllocateCIDR(ctx, 26, "next"); cidr != "10.0.0.64/26" {
+		t.Errorf("AllocateCIDR should skip the reserved block, got %s", cidr)
+	}
+	reserved, _ := guardian.GetReservedIPs(ctx)
+	if len(reserved) != 65 || reserved["10.0.0.10"] != "planned cluster" {
+		t.Errorf("Unexpected reserved IPs: %d", len(reserved))
+	}
+
+	// 测试部分地址不可用时整体失败并回滚
+	if err := guardian.ReserveCIDR(ctx, "10.0.0.192/26", "overlap"); err == nil {
+		t.Error("ReserveCIDR should fail when a member is already reserved")
+	}
+	if ok, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.192"); !ok {
+		t.Error("Failed ReserveCIDR should be rolled back")
+	}
+
+	// 测试取消预留后可以分配
+	if err := guardian.UnreserveCIDR(ctx, "10.0.0.0/26"); err != nil {
+		t.Fatalf("UnreserveCIDR failed: %v", err)
+	}
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.0/28", "x"); err != nil {
+		t.Errorf("Unreserved block should be allocatable: %v", err)
+	}
+	if err := guardian.UnreserveCIDR(ctx, "10.0.0.0/26"); err == nil {
+		t.Error("UnreserveCIDR should fail when nothing is reserved")
+	}
+	if err := guardian.UnreserveIP(ctx, "10.0.0.200"); err != nil {
+		t.Errorf("UnreserveIP failed: %v", err)
+	}
+
+	// 测试重新添加 CIDR 时已预留的IP保持预留，不会被分配
+	guardian, _ = NewCIDRGuardian(ctx, nil, "10.0.1.0/29")
+	if err := guardian.ReserveIP(ctx, "10.0.1.3", "gateway"); err != nil {
+		t.Fatalf("ReserveIP failed: %v", err)
+	}
+	for _, add := range []func() error{
+		func() error { return guardian.AddCIDR(ctx, "10.0.1.0/29", "again") },
+		func() error { return guardian.AddCIDRs(ctx, map[string]string{"10.0.1.0/29": "again"}) },
+	} {
+		if err := guardian.RemoveCIDR(ctx, "10.0.1.0/29"); err != nil {
+			t.Fatalf("RemoveCIDR failed: %v", err)
+		}
+		if err := add(); err != nil {
+			t.Fatalf("Re-adding the CIDR failed: %v", err)
+		}
+		if count, _ := guardian.AvailableCount(ctx); count != 7 {
+			t.Errorf("Expected 7 available IPs after re-adding the CIDR, got %d", count)
+		}
+	}
+	for {
+		ip, err := guardian.GetNextAvailableIP(ctx, "x")
+		if err != nil {
+			break
+		}
+		if ip == "10.0.1.3" {
+			t.Fatal("Reserved IP should never be allocated after re-adding its CIDR")
+		}
+	}
+
+	// 测试不支持预留的存储
+	guardian, _ = NewCIDRGuardian(ctx, newMockIPStorage())
+	if err := guardian.ReserveCIDR(ctx, "10.0.0.0/30", "x"); err == nil {
+		t.Error("ReserveCIDR should fail when storage does not support reservations")
+	}
+}
+
+// TestCIDRGuardian_AddCIDRReserveNetworkBroadcast 测试添加 CIDR 时预留网络地址和广播地址
+func TestCIDRGuardian_AddCIDRReserveNetworkBroadcast(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+
+	// 默认原因
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/29", "lan", WithReserveNetworkBroadcast()); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+	reserved, _ := guardian.GetReservedIPs(ctx)
+	if expected := map[string]string{"10.0.0.0": "network", "10.0.0.7": "broadcast"}; !reflect.DeepEqual(reserved, expected) {
+		t.Errorf("Expected %v, got %v", expected, reserved)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 6 {
+		t.Errorf("Expected 6 available IPs, got %d", count)
+	}
+
+	// 自定义原因，空字符串使用默认原因
+	if err := guardian.AddCIDR(ctx, "10.0.1.0/30", "p2p", WithReserveReasons("net-id", "")); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+	reserved, _ = guardian.GetReservedIPs(ctx)
+	if reserved["10.0.1.0"] != "net-id" || reserved["10.0.1.3"] != "broadcast" {
+		t.Errorf("Expected custom reasons, got %v", reserved)
+	}
+
+	// /31 和 IPv6 不预留
+	_ = guardian.AddCIDR(ctx, "10.0.2.0/31", "link", WithReserveNetworkBroadcast())
+	_ = guardian.AddCIDR(ctx, "2001:db8::/126", "v6", WithReserveNetworkBroadcast())
+	if reserved, _ = guardian.GetReservedIPs(ctx); len(reserved) != 4 {
+		t.Errorf("Expected no reservations for /31 and IPv6, got %v", reserved)
+	}
+
+	// 不传选项时不预留
+	_ = guardian.AddCIDR(ctx, "10.0.3.0/30", "plain")
+	if reserved, _ = guardian.GetReservedIPs(ctx); reserved["10.0.3.0"] != "" {
+		t.Error("Expected network address not to be reserved without the option")
+	}
+
+	// 存储不支持预留时不添加任何IP
+	plain, _ := NewCIDRGuardian(ctx, newMockIPStorage())
+	if err := plain.AddCIDR(ctx, "10.0.0.0/30", "lan", WithReserveNetworkBroadcast()); err == nil {
+		t.Error("Expected error for storage without reservation support")
+	}
+	if cidrs, _ := plain.GetManagedCIDRs(ctx); len(cidrs) != 0 {
+		t.Errorf("Expected CIDR not to be added, got %v", cidrs)
+	}
+}
+
+// TestCIDRGuardian_Exclusion 测试全局排除列表
+func TestCIDRGuardian_Exclusion(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage)
+
+	// 测试添加 CIDR 时跳过被排除的IP
+	if err := guardian.AddExclusion(ctx, "10.0.0.5"); err != nil {
+		t.Fatalf("AddExclusion should succeed: %v", err)
+	}
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/29", "test"); err != nil {
+		t.Fatalf("AddCIDR should succeed: %v", err)
+	}
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.0.5"); available {
+		t.Error("Excluded IP should not become available")
+	}
+	if count, _ := storage.AvailableCount(ctx); count != 7 {
+		t.Errorf("Expected 7 available IPs, got %d", count)
+	}
+
+	// 测试排除已可用的IP
+	_ = guardian.AddExclusion(ctx, "10.0.0.3")
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.0.3"); available {
+		t.Error("AddExclusion should remove the IP from the available pool")
+	}
+
+	// 测试排除已分配的IP，释放后不放回可用池
+	_ = guardian.AllocateIP(ctx, "10.0.0.4", "web")
+	_ = guardian.AddExclusion(ctx, "10.0.0.4")
+	if allocated, _ := storage.GetAllocatedIPs(ctx); allocated["10.0.0.4"] != "web" {
+		t.Error("AddExclusion should keep an allocated IP allocated")
+	}
+	if err := guardian.ReleaseIP(ctx, "10.0.0.4"); err != nil {
+		t.Fatalf("ReleaseIP should succeed: %v", err)
+	}
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.0.4"); available {
+		t.Error("Released excluded IP should not return to the available pool")
+	}
+
+	// 测试释放 CIDR 块时跳过被排除的成员
+	_ = guardian.AddCIDR(ctx, "10.0.2.0/30", "blocks")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.2.0/30", "block"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR should succeed: %v", err)
+	}
+	_ = guardian.AddExclusion(ctx, "10.0.2.1")
+	if err := guardian.ReleaseCIDR(ctx, "10.0.2.0/30"); err != nil {
+		t.Fatalf("ReleaseCIDR should succeed: %v", err)
+	}
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.2.1"); available {
+		t.Error("ReleaseCIDR should not return an excluded member to the available pool")
+	}
+
+	// 测试 AddSingleIP 和 ExpandPool
+	if err := guardian.AddSingleIP(ctx, "10.0.0.5"); err == nil {
+		t.Error("AddSingleIP should reject an excluded IP")
+	}
+	_ = guardian.AddExclusion(ctx, "10.0.1.1")
+	if err := guardian.ExpandPool(ctx, "10.0.1.0/30"); err != nil {
+		t.Fatalf("ExpandPool should succeed: %v", err)
+	}
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.1.1"); available {
+		t.Error("ExpandPool should skip an excluded IP")
+	}
+
+	exclusions, err := guardian.GetExclusions(ctx)
+	expected := []string{"10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.1.1", "10.0.2.1"}
+	if err != nil || !reflect.DeepEqual(exclusions, expected) {
+		t.Errorf("Expected %v, got %v, %v", expected, exclusions, err)
+	}
+
+	// 测试移出排除列表后重新加入可用池
+	if err := guardian.RemoveExclusion(ctx, "10.0.0.5"); err != nil {
+		t.Fatalf("RemoveExclusion should succeed: %v", err)
+	}
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.0.5"); !available {
+		t.Error("RemoveExclusion should return a managed IP to the available pool")
+	}
+	if err := guardian.RemoveExclusion(ctx, "10.0.0.5"); err == nil {
+		t.Error("RemoveExclusion should fail for an IP that is not excluded")
+	}
+
+	// 测试无效IP和不支持排除列表的存储
+	if err := guardian.AddExclusion(ctx, "invalid"); err == nil {
+		t.Error("AddExclusion should fail for an invalid IP")
+	}
+	unsupported, _ := NewCIDRGuardian(ctx, newMockIPStorage(), "10.0.0.0/30")
+	if err := unsupported.AddExclusion(ctx, "10.0.0.1"); err == nil {
+		t.Error("AddExclusion should fail when the storage does not support exclusions")
+	}
+}
+
+// TestSQLIPStorage_Exclusion 测试SQL存储的排除列表
+func TestSQLIPStorage_Exclusion(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	mock.ExpectExec("INSERT INTO ip_excluded (ip) VALUES (?) ON DUPLICATE KEY UPDATE ip = ip").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := storage.AddExclusion(ctx, "192.168.1.1"); err != nil {
+		t.Errorf("AddExclusion 失败: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT ip FROM ip_excluded").
+		WillReturnRows(sqlmock.NewRows([]string{"ip"}).AddRow("192.168.1.1"))
+	if excluded, err := storage.GetExclusions(ctx); err != nil || !reflect.DeepEqual(excluded, []string{"192.168.1.1"}) {
+		t.Errorf("GetExclusions 返回 %v, %v", excluded, err)
+	}
+
+	mock.ExpectExec("DELETE FROM ip_excluded WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := storage.RemoveExclusion(ctx, "192.168.1.1"); err != nil {
+		t.Errorf("RemoveExclusion 失败: %v", err)
+	}
+
+	// 测试移除未排除的 IP
+	mock.ExpectExec("DELETE FROM ip_excluded WHERE ip = ?").
+		WithArgs("192.168.1.2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := storage.RemoveExclusion(ctx, "192.168.1.2"); err == nil {
+		t.Error("当 IP 未被排除时，RemoveExclusion 应该失败")
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestSQLIPStorage_Reservation 测试SQL存储的IP预留
+func TestSQLIPStorage_Reservation(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_reserved (ip, reason) VALUES (?, ?)").
+		WithArgs("192.168.1.1", "planned").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if err := storage.ReserveIP(ctx, "192.168.1.1", "planned"); err != nil {
+		t.Errorf("ReserveIP 失败: %v", err)
+	}
+
+	mock.ExpectQuery("SELECT ip, reason FROM ip_reserved").
+		WillReturnRows(sqlmock.NewRows([]string{"ip", "reason"}).AddRow("192.168.1.1", "planned"))
+	if reserved, err := storage.GetReservedIPs(ctx); err != nil || reserved["192.168.1.1"] != "planned" {
+		t.Errorf("GetReservedIPs 返回 %v, %v", reserved, err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM ip_reserved WHERE ip = ?").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?)").
+		WithArgs("192.168.1.1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if err := storage.UnreserveIP(ctx, "192.168.1.1"); err != nil {
+		t.Errorf("UnreserveIP 失败: %v", err)
+	}
+
+	// 测试取消未预留的 IP
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM ip_reserved WHERE ip = ?").
+		WithArgs("192.168.1.2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	if err := storage.UnreserveIP(ctx, "192.168.1.2"); err == nil {
+		t.Error("当 IP 未预留时，UnreserveIP 应该失败")
+	}
+
+	// 验证所有预期的 SQL 语句已被执行
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_TypedIPs 测试返回 net.IP 的方法
+func TestCIDRGuardian_TypedIPs(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.8/30", "2001:db8::/127")
+
+	strs, _ := guardian.GetAvailableIPs(ctx)
+	typed, err := guardian.GetAvailableIPsTyped(ctx)
+	if err != nil {
+		t.Fatalf("GetAvailableIPsTyped failed: %v", err)
+	}
+	if len(typed) != len(strs) {
+		t.Fatalf("Expected %d typed IPs, got %d", len(strs), len(typed))
+	}
+	for i, ip := range typed {
+		if ip.String() != strs[i] {
+			t.Errorf("Typed IP %d = %s, want %s", i, ip, strs[i])
+		}
+	}
+	if len(typed[0]) != net.IPv4len || len(typed[len(typed)-1]) != net.IPv6len {
+		t.Error("Typed IPs should preserve address family length")
+	}
+
+	ip, err := guardian.GetNextAvailableIPTyped(ctx, "typed")
+	if err != nil {
+		t.Fatalf("GetNextAvailableIPTyped failed: %v", err)
+	}
+	if !ip.Equal(net.ParseIP("10.0.0.8")) || len(ip) != net.IPv4len {
+		t.Errorf("Expected 4-byte 10.0.0.8, got %v", ip)
+	}
+	if ok, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.8"); ok {
+		t.Error("GetNextAvailableIPTyped should allocate the IP")
+	}
+}
+
+// TestCIDRGuardian_GetAvailableIPsWithCIDR 测试可用IP归属于最具体的管理 CIDR
+func TestCIDRGuardian_GetAvailableIPsWithCIDR(t *testing.T) {
+	ctx := context.Background()
+
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/29")
+	if err := guardian.AddCIDR(ctx, "10.0.0.4/30", "inner"); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	_ = storage.AddIP(ctx, "192.168.0.1")
+
+	result, err := guardian.GetAvailableIPsWithCIDR(ctx)
+	if err != nil {
+		t.Fatalf("GetAvailableIPsWithCIDR failed: %v", err)
+	}
+	expected := map[string]string{
+		"10.0.0.0":    "10.0.0.0/29",
+		"10.0.0.2":    "10.0.0.0/29",
+		"10.0.0.3":    "10.0.0.0/29",
+		"10.0.0.4":    "10.0.0.4/30",
+		"10.0.0.5":    "10.0.0.4/30",
+		"10.0.0.6":    "10.0.0.4/30",
+		"10.0.0.7":    "10.0.0.4/30",
+		"192.168.0.1": "",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+// TestCIDRGuardian_ReleaseOrphanIP 测试释放不属于管理CIDR的IP
+func TestCIDRGuardian_ReleaseOrphanIP(t *testing.T) {
+	ctx := context.Background()
+
+	// 测试默认丢弃孤立IP
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/30")
+	_ = guardian.ImportAllocations(ctx, map[string]string{"172.16.0.1": "legacy"})
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "managed")
+
+	if err := guardian.ReleaseIP(ctx, "172.16.0.1"); err != nil {
+		t.Fatalf("ReleaseIP failed: %v", err)
+	}
+	if ok, _ := guardian.storage.IsIPAvailable(ctx, "172.16.0.1"); ok {
+		t.Error("Orphan IP should not be re-added to the available pool")
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 1 {
+		t.Errorf("Orphan IP should be released, allocated count %d", count)
+	}
+
+	// 测试管理范围内的IP仍放回可用池
+	if err := guardian.ReleaseIP(ctx, "10.0.0.1"); err != nil {
+		t.Fatalf("ReleaseIP failed: %v", err)
+	}
+	if ok, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.1"); !ok {
+		t.Error("Managed IP should return to the available pool")
+	}
+
+	// 测试报错策略
+	guardian, _ = NewCIDRGuardianWithOptions(ctx, nil,
+		WithInitialCIDRs("10.0.0.0/30"),
+		WithOrphanPolicy(OrphanError),
+	)
+	_ = guardian.ImportAllocations(ctx, map[string]string{"172.16.0.1": "legacy"})
+	if err := guardian.ReleaseIP(ctx, "172.16.0.1"); err == nil {
+		t.Error("ReleaseIP should fail for orphan IP with OrphanError policy")
+	}
+	if allocated, _ := guardian.storage.GetAllocatedIPs(ctx); allocated["172.16.0.1"] != "legacy" {
+		t.Error("Orphan IP should stay allocated when release is refused")
+	}
+}
+
+// TestCIDRGuardian_CapacityProjection 测试可用池耗尽时间估算
+func TestCIDRGuardian_CapacityProjection(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/24")
+
+	runway, err := guardian.CapacityProjection(ctx, 16)
+	if err != nil || runway != 16*time.Hour {
+		t.Errorf("Expected 16h runway, got %v (err=%v)", runway, err)
+	}
+	if runway, _ := guardian.CapacityProjection(ctx, 512); runway != 30*time.Minute {
+		t.Errorf("Expected 30m runway, got %v", runway)
+	}
+
+	// 测试速率为 0 和极小速率
+	if runway, err := guardian.CapacityProjection(ctx, 0); err != nil || runway != InfiniteRunway {
+		t.Errorf("Zero rate should return InfiniteRunway, got %v (err=%v)", runway, err)
+	}
+	if runway, _ := guardian.CapacityProjection(ctx, 1e-12); runway != InfiniteRunway {
+		t.Errorf("Tiny rate should saturate to InfiniteRunway, got %v", runway)
+	}
+
+	// 测试无效速率
+	for _, rate := range []float64{-1, math.NaN(), math.Inf(1)} {
+		if _, err := guardian.CapacityProjection(ctx, rate); err == nil {
+			t.Errorf("CapacityProjection(%v) should fail", rate)
+		}
+	}
+
+	// 测试可用池为空
+	empty, _ := NewCIDRGuardian(ctx, nil)
+	if runway, _ := empty.CapacityProjection(ctx, 1); runway != 0 {
+		t.Errorf("Empty pool should have zero runway, got %v", runway)
+	}
+}
+
+// TestCIDRGuardian_TotalCapacity 测试管理 CIDR 的地址总数
+func TestCIDRGuardian_TotalCapacity(t *testing.T) {
+	ctx := context.Background()
+
+	// 只读模式只登记 CIDR，可以包含无法展开的 IPv6 大块；重叠的 /30 只计一次
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithReadOnly(),
+		WithInitialCIDRs("10.0.0.0/24", "10.0.1.0/30", "10.0.0.4/30", "2001:db8::/64"))
+	total, err := guardian.TotalCapacity(ctx)
+	if err != nil {
+		t.Fatalf("TotalCapacity failed: %v", err)
+	}
+	expected := new(big.Int).Lsh(big.NewInt(1), 64)
+	expected.Add(expected, big.NewInt(256+4))
+	if total.Cmp(expected) != 0 {
+		t.Errorf("Expected %s, got %s", expected, total)
+	}
+
+	// 预留的地址不计入可用和已分配数量，但仍计入总容量
+	storage := NewMemoryIPStorage()
+	guardian, _ = NewCIDRGuardian(ctx, storage, "10.0.0.0/29")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	_ = guardian.ReserveIP(ctx, "10.0.0.2", "gateway")
+	available, _ := guardian.AvailableCount(ctx)
+	allocated, _ := guardian.AllocatedCount(ctx)
+	if total, _ = guardian.TotalCapacity(ctx); total.Int64() != 8 || available+allocated != 7 {
+		t.Errorf("Expected capacity 8 and 7 stored entries, got %s and %d", total, available+allocated)
+	}
+
+	empty, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if total, _ = empty.TotalCapacity(ctx); total.Sign() != 0 {
+		t.Errorf("Expected zero capacity, got %s", total)
+	}
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := guardian.TotalCapacity(canceledCtx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestCIDRGuardian_AllocateContiguous 测试连续IP分配
+func TestCIDRGuardian_AllocateContiguous(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/23")
+
+	// 测试不跨越字节边界的连续段，跳过被占用地址前面不足的部分
+	if err := guardian.AllocateIP(ctx, "10.0.0.2", "gap"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	ips, err := guardian.AllocateContiguous(ctx, 3, "run")
+	if err != nil {
+		t.Fatalf("AllocateContiguous failed: %v", err)
+	}
+	if want := []string{"10.0.0.3", "10.0.0.4", "10.0.0.5"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("Expected %v, got %v", want, ips)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if allocated["10.0.0.4"] != "run" {
+		t.Errorf("Expected 10.0.0.4 allocated with description run, got %q", allocated["10.0.0.4"])
+	}
+
+	// 测试跨越字节边界的连续段
+	if _, err := guardian.AllocateContiguous(ctx, 248, "fill"); err != nil {
+		t.Fatalf("AllocateContiguous failed: %v", err)
+	}
+	ips, err = guardian.AllocateContiguous(ctx, 4, "span")
+	if err != nil {
+		t.Fatalf("AllocateContiguous failed: %v", err)
+	}
+	if want := []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("Expected %v, got %v", want, ips)
+	}
+
+	// 测试没有足够长的连续段和无效数量
+	before, _ := guardian.AvailableCount(ctx)
+	if _, err := guardian.AllocateContiguous(ctx, 1000, "too-many"); err == nil {
+		t.Error("Expected error when no run is long enough")
+	}
+	if _, err := guardian.AllocateContiguous(ctx, 0, "zero"); err == nil {
+		t.Error("Expected error for zero count")
+	}
+	if after, _ := guardian.AvailableCount(ctx); after != before {
+		t.Errorf("Failed allocation changed available count from %d to %d", before, after)
+	}
+
+	// 测试存储失败时不会留下部分分配
+	mock := newMockIPStorage()
+	mockGuardian, _ := NewCIDRGuardian(ctx, mock, "192.168.0.0/30")
+	mock.failOn = "BulkAllocateIP"
+	mock.errorMsg = "bulk failed"
+	if _, err := mockGuardian.AllocateContiguous(ctx, 2, "run"); err == nil {
+		t.Error("Expected storage error")
+	}
+	if count, _ := mockGuardian.AllocatedCount(ctx); count != 0 {
+		t.Errorf("Expected no allocations after failure, got %d", count)
+	}
+}
+
+// TestCIDRGuardian_IPv4MappedIPv6 测试 IPv4 映射的 IPv6 地址与对应 IPv4 地址视为同一地址
+func TestCIDRGuardian_IPv4MappedIPv6(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "192.168.0.0/30")
+
+	// 通过映射形式分配后，IPv4 形式应显示为已分配
+	if err := guardian.AllocateIP(ctx, "::ffff:192.168.0.1", "mapped"); err != nil {
+		t.Fatalf("AllocateIP with mapped address failed: %v", err)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if allocated["192.168.0.1"] != "mapped" {
+		t.Errorf("Expected 192.168.0.1 allocated, got %v", allocated)
+	}
+	if available, _ := guardian.storage.IsIPAvailable(ctx, "192.168.0.1"); available {
+		t.Error("192.168.0.1 should not be available and allocated at the same time")
+	}
+	if err := guardian.AllocateIP(ctx, "192.168.0.1", "again"); err == nil {
+		t.Error("Expected error allocating the IPv4 form of an already allocated mapped address")
+	}
+
+	// 通过映射形式释放
+	if err := guardian.ReleaseIP(ctx, "::ffff:192.168.0.1"); err != nil {
+		t.Fatalf("ReleaseIP with mapped address failed: %v", err)
+	}
+	if available, _ := guardian.storage.IsIPAvailable(ctx, "192.168.0.1"); !available {
+		t.Error("192.168.0.1 should be available after release")
+	}
+
+	// 映射形式的单个IP和 CIDR 不应产生重复条目
+	_ = guardian.AddSingleIP(ctx, "::ffff:192.168.0.2")
+	if err := guardian.AddCIDR(ctx, "::ffff:192.168.0.0/126", "dup"); err == nil {
+		t.Error("Expected error adding mapped form of a managed CIDR")
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 4 {
+		t.Errorf("Expected 4 available IPs, got %d", count)
+	}
+	if err := guardian.RemoveSingleIP(ctx, "::ffff:192.168.0.3"); err != nil {
+		t.Errorf("RemoveSingleIP with mapped address failed: %v", err)
+	}
+	if available, _ := guardian.storage.IsIPAvailable(ctx, "192.168.0.3"); available {
+		t.Error("192.168.0.3 should be removed")
+	}
+}
+
+// TestCIDRGuardian_AddCIDRs 测试批量添加管理 CIDR
+func TestCIDRGuardian_AddCIDRs(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "172.16.0.0/30")
+
+	// 测试无重叠的集合
+	err := guardian.AddCIDRs(ctx, map[string]string{
+		"10.0.0.0/30":    "a",
+		"10.0.1.0/29":    "b",
+		"192.168.0.0/31": "c",
+	})
+	if err != nil {
+		t.Fatalf("AddCIDRs failed: %v", err)
+	}
+	managed, _ := guardian.GetManagedCIDRs(ctx)
+	if len(managed) != 4 || managed["10.0.1.0/29"] != "b" {
+		t.Errorf("Unexpected managed CIDRs: %v", managed)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 4+4+8+2 {
+		t.Errorf("Expected 18 available IPs, got %d", count)
+	}
+
+	// 测试集合内部重叠、与已管理 CIDR 重叠以及无效格式，均不应添加任何 CIDR
+	for name, set := range map[string]map[string]string{
+		"internal": {"10.1.0.0/24": "x", "10.1.0.128/25": "y"},
+		"managed":  {"10.2.0.0/24": "x", "10.0.0.0/16": "y"},
+		"invalid":  {"10.3.0.0/24": "x", "bad": "y"},
+	} {
+		if err := guardian.AddCIDRs(ctx, set); err == nil {
+			t.Errorf("%s: expected error for set %v", name, set)
+		}
+	}
+	if after, _ := guardian.GetManagedCIDRs(ctx); len(after) != 4 {
+		t.Errorf("Failed AddCIDRs changed managed CIDRs: %v", after)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 18 {
+		t.Errorf("Failed AddCIDRs changed available count to %d", count)
+	}
+
+	// 测试存储失败时整体回滚
+	mock := newMockIPStorage()
+	mockGuardian, _ := NewCIDRGuardian(ctx, mock)
+	mock.failOn = "BulkAddIP"
+	mock.errorMsg = "bulk add failed"
+	if err := mockGuardian.AddCIDRs(ctx, map[string]string{"10.0.0.0/30": "a"}); err == nil {
+		t.Error("Expected storage error")
+	}
+	if after, _ := mockGuardian.GetManagedCIDRs(ctx); len(after) != 0 {
+		t.Errorf("Expected no managed CIDRs after failure, got %v", after)
+	}
+}
+
+// TestSQLIPStorage_BulkAddIP 测试 SQL 存储批量添加 IP
+func TestSQLIPStorage_BulkAddIP(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_reserved WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?) ON DUPLICATE KEY UPDATE ip = ip").
+		WithArgs("10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.2").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.5").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_reserved WHERE ip = ?").
+		WithArgs("10.0.0.5").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.3").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_reserved WHERE ip = ?").
+		WithArgs("10.0.0.3").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?) ON DUPLICATE KEY UPDATE ip = ip").
+		WithArgs("10.0.0.3").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	added, err := storage.BulkAddIP(ctx, []string{"10.0.0.1", "10.0.0.2", "10.0.0.5", "10.0.0.3"})
+	if err != nil {
+		t.Fatalf("BulkAddIP failed: %v", err)
+	}
+	if !reflect.DeepEqual(added, []string{"10.0.0.1"}) {
+		t.Errorf("Expected only 10.0.0.1 to be newly added, got %v", added)
+	}
+
+	// 测试插入失败时回滚事务
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.4").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_reserved WHERE ip = ?").
+		WithArgs("10.0.0.4").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?) ON DUPLICATE KEY UPDATE ip = ip").
+		WithArgs("10.0.0.4").WillReturnError(errors.New("insert failed"))
+	mock.ExpectRollback()
+
+	if _, err := storage.BulkAddIP(ctx, []string{"10.0.0.4"}); err == nil {
+		t.Error("Expected error when insert fails")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCIDRGuardian_ReadOnly 测试只读模式拒绝所有修改操作而查询正常
+func TestCIDRGuardian_ReadOnly(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	writer, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/28")
+	if err := writer.AllocateIP(ctx, "10.0.0.1", "web"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+
+	guardian, err := NewCIDRGuardianWithOptions(ctx, storage, WithReadOnly(), WithInitialCIDRs("10.0.0.0/28"))
+	if err != nil {
+		t.Fatalf("Failed to create read-only guardian: %v", err)
+	}
+
+	mutators := map[string]func() error{
+		"AddCIDR":               func() error { return guardian.AddCIDR(ctx, "10.1.0.0/30", "x") },
+		"AddCIDRs":              func() error { return guardian.AddCIDRs(ctx, map[string]string{"10.1.0.0/30": "x"}) },
+		"RemoveCIDR":            func() error { return guardian.RemoveCIDR(ctx, "10.0.0.0/28") },
+		"RestoreCIDR":           func() error { return guardian.RestoreCIDR(ctx, "10.0.0.0/28") },
+		"UpdateCIDRDescription": func() error { return guardian.UpdateCIDRDescription(ctx, "10.0.0.0/28", "x") },
+		"AddSingleIP":           func() error { return guardian.AddSingleIP(ctx, "10.1.0.1") },
+		"RemoveSingleIP":        func() error { return guardian.RemoveSingleIP(ctx, "10.0.0.2") },
+		"ExpandPool":            func() error { return guardian.ExpandPool(ctx, "10.2.0.0/30") },
+		"AllocateIP":            func() error { return guardian.AllocateIP(ctx, "10.0.0.2", "x") },
+		"AllocateIPWithParent": func() error {
+			_, err := guardian.AllocateIPWithParent(ctx, "10.0.0.2", "x")
+			return err
+		},
+		"UpdateDescription":    func() error { return guardian.UpdateDescription(ctx, "10.0.0.1", "x") },
+		"ImportAllocations":    func() error { return guardian.ImportAllocations(ctx, map[string]string{"10.3.0.1": "x"}) },
+		"ImportAllocationsCSV": func() error { return guardian.ImportAllocationsCSV(ctx, strings.NewReader("10.3.0.1,x\n")) },
+		"ReleaseIP":            func() error { return guardian.ReleaseIP(ctx, "10.0.0.1") },
+		"ReleaseCIDR":          func() error { return guardian.ReleaseCIDR(ctx, "10.0.0.0/30") },
+		"ReleaseCIDRWithMembers": func() error {
+			_, err := guardian.ReleaseCIDRWithMembers(ctx, "10.0.0.0/30")
+			return err
+		},
+		"AllocateSpecificCIDR":     func() error { return guardian.AllocateSpecificCIDR(ctx, "10.0.0.4/30", "x") },
+		"ImportAvailabilityBitmap": func() error { return guardian.ImportAvailabilityBitmap(ctx, "10.0.0.0/28", []byte{0, 0}) },
+		"ReserveIP":                func() error { return guardian.ReserveIP(ctx, "10.0.0.2", "x") },
+		"UnreserveIP":              func() error { return guardian.UnreserveIP(ctx, "10.0.0.2") },
+		"ReserveCIDR":              func() error { return guardian.ReserveCIDR(ctx, "10.0.0.4/30", "x") },
+		"UnreserveCIDR":            func() error { return guardian.UnreserveCIDR(ctx, "10.0.0.4/30") },
+		"GetNextAvailableIP": func() error {
+			_, err := guardian.GetNextAvailableIP(ctx, "x")
+			return err
+		},
+		"GetNextAvailableIPInCIDR": func() error {
+			_, err := guardian.GetNextAvailableIPInCIDR(ctx, "10.0.0.0/24", "x")
+			return err
+		},
+		"GetNextAvailableIPTyped": func() error {
+			_, err := guardian.GetNextAvailableIPTyped(ctx, "x")
+			return err
+		},
+		"AllocateCIDR": func() error {
+			_, err := guardian.AllocateCIDR(ctx, 30, "x")
+			return err
+		},
+		"AllocateCIDRWithHint": func() error {
+			_, err := guardian.AllocateCIDRWithHint(ctx, 30, "x", "hint")
+			return err
+		},
+		"BulkAllocate": func() error {
+			_, err := guardian.BulkAllocate(ctx, map[string]string{"10.0.0.2": "x"})
+			return err
+		},
+		"AllocateContiguous": func() error {
+			_, err := guardian.AllocateContiguous(ctx, 2, "x")
+			return err
+		},
+		"ClaimIP": func() error {
+			_, _, err := guardian.ClaimIP(ctx, "x")
+			return err
+		},
+		"AllocateIdempotent": func() error {
+			_, err := guardian.AllocateIdempotent(ctx, "key", "x")
+			return err
+		},
+		"ConfirmClaim": func() error { return guardian.ConfirmClaim(ctx, "token") },
+		"CancelClaim":  func() error { return guardian.CancelClaim(ctx, "token") },
+		"ReapExpiredClaims": func() error {
+			_, err := guardian.ReapExpiredClaims(ctx)
+			return err
+		},
+		"ReleaseByDescription": func() error {
+			_, err := guardian.ReleaseByDescription(ctx, "web")
+			return err
+		},
+		"AllocateIPWithTTL": func() error { return guardian.AllocateIPWithTTL(ctx, "10.0.0.2", "x", time.Minute) },
+		"RenewLease":        func() error { return guardian.RenewLease(ctx, "10.0.0.1", time.Minute) },
+		"RemoveIPsMatching": func() error {
+			_, err := guardian.RemoveIPsMatching(ctx, "10.0.0.*")
+			return err
+		},
+		"GetLastAvailableIP": func() error {
+			_, err := guardian.GetLastAvailableIP(ctx, "x")
+			return err
+		},
+		"AddCIDRWithPolicy": func() error {
+			return guardian.AddCIDRWithPolicy(ctx, "10.9.0.0/30", "x", PolicyBlockOnly)
+		},
+		"AllocateIPWithMetadata": func() error {
+			return guardian.AllocateIPWithMetadata(ctx, "10.0.0.9", "x", json.RawMessage(`{}`))
+		},
+		"SwapIP": func() error {
+			return guardian.SwapIP(ctx, "10.0.0.1", "10.0.0.2", "x")
+		},
+		"ReleaseAllInCIDR": func() error {
+			_, err := guardian.ReleaseAllInCIDR(ctx, "10.0.0.0/24")
+			return err
+		},
+		"AddExclusion": func() error {
+			return guardian.AddExclusion(ctx, "10.0.0.9")
+		},
+		"RemoveExclusion": func() error {
+			return guardian.RemoveExclusion(ctx, "10.0.0.9")
+		},
+		"AllocateByKey": func() error {
+			_, err := guardian.AllocateByKey(ctx, "svc", "x")
+			return err
+		},
+		"SyncFrom": func() error {
+			_, err := guardian.SyncFrom(ctx, &fakeInventory{})
+			return err
+		},
+		"AllocateEntireCIDR": func() error {
+			return guardian.AllocateEntireCIDR(ctx, "10.0.0.0/30", "x")
+		},
+		"Reconcile": func() error {
+			_, err := guardian.Reconcile(ctx)
+			return err
+		},
+	}
+	for name, mutate := range mutators {
+		if err := mutate(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+
+	// 存储不应发生任何变化
+	if count, _ := storage.AvailableCount(ctx); count != 15 {
+		t.Errorf("Expected 15 available IPs, got %d", count)
+	}
+	if allocated, _ := storage.GetAllocatedIPs(ctx); len(allocated) != 1 || allocated["10.0.0.1"] != "web" {
+		t.Errorf("Unexpected allocations: %v", allocated)
+	}
+
+	readers := map[string]func() error{
+		"GetManagedCIDRs": func() error {
+			managed, err := guardian.GetManagedCIDRs(ctx)
+			if err == nil && len(managed) != 1 {
+				return fmt.Errorf("expected 1 managed CIDR, got %v", managed)
+			}
+			return err
+		},
+		"AllocatedCount": func() error {
+			count, err := guardian.AllocatedCount(ctx)
+			if err == nil && count != 1 {
+				return fmt.Errorf("expected 1, got %d", count)
+			}
+			return err
+		},
+		"AvailableCount": func() error {
+			count, err := guardian.AvailableCount(ctx)
+			if err == nil && count != 15 {
+				return fmt.Errorf("expected 15, got %d", count)
+			}
+			return err
+		},
+		"GetManagedCIDRList":    func() error { _, err := guardian.GetManagedCIDRList(ctx); return err },
+		"GetAvailableIPs":       func() error { _, err := guardian.GetAvailableIPs(ctx); return err },
+		"GetAvailableIPsTyped":  func() error { _, err := guardian.GetAvailableIPsTyped(ctx); return err },
+		"GetAvailableCIDRs":     func() error { _, err := guardian.GetAvailableCIDRs(ctx); return err },
+		"GetUsedCIDRList":       func() error { _, err := guardian.GetUsedCIDRList(ctx); return err },
+		"GetUsedCIDRs":          func() error { _, err := guardian.GetUsedCIDRs(ctx); return err },
+		"IsCIDRAvailable":       func() error { _, err := guardian.IsCIDRAvailable(ctx, "10.0.0.4/30"); return err },
+		"AvailableBlocksOfSize": func() error { _, err := guardian.AvailableBlocksOfSize(ctx, 30); return err },
+		"FreeCIDRsWithin":       func() error { _, err := guardian.FreeCIDRsWithin(ctx, "10.0.0.0/28"); return err },
+		"AvailabilityBitmap":    func() error { _, err := guardian.AvailabilityBitmap(ctx, "10.0.0.0/28"); return err },
+		"GetReservedIPs":        func() error { _, err := guardian.GetReservedIPs(ctx); return err },
+		"CapacityProjection":    func() error { _, err := guardian.CapacityProjection(ctx, 1); return err },
+		"String":                func() error { _, err := guardian.String(ctx); return err },
+		"StatusTable":           func() error { _, err := guardian.StatusTable(ctx); return err },
+	}
+	for name, read := range readers {
+		if err := read(); err != nil {
+			t.Errorf("%s should work in read-only mode: %v", name, err)
+		}
+	}
+}
+
+// TestCIDRGuardian_UsageByDescription 测试按描述统计已分配IP数量
+func TestCIDRGuardian_UsageByDescription(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/24")
+
+	if usage, err := guardian.UsageByDescription(ctx); err != nil || len(usage) != 0 {
+		t.Errorf("Expected empty usage, got %v (err=%v)", usage, err)
+	}
+
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		_ = guardian.AllocateIP(ctx, ip, "web")
+	}
+	_ = guardian.AllocateIP(ctx, "10.0.0.4", "db")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.16/28", "web"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.32/29", "cache"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+
+	usage, err := guardian.UsageByDescription(ctx)
+	if err != nil {
+		t.Fatalf("UsageByDescription failed: %v", err)
+	}
+	want := map[string]int{"web": 3 + 16, "db": 1, "cache": 8}
+	if !reflect.DeepEqual(usage, want) {
+		t.Errorf("Expected %v, got %v", want, usage)
+	}
+
+	// 测试存储错误
+	mock := newMockIPStorage()
+	mockGuardian, _ := NewCIDRGuardian(ctx, mock)
+	mock.failOn = "GetAllocatedIPs"
+	mock.errorMsg = "query failed"
+	if _, err := mockGuardian.UsageByDescription(ctx); err == nil {
+		t.Error("Expected storage error")
+	}
+}
+
+// TestCIDRGuardian_AutoExpand 测试可用池耗尽时自动扩展备用 CIDR
+func TestCIDRGuardian_AutoExpand(t *testing.T) {
+	ctx := context.Background()
+	guardian, err := NewCIDRGuardianWithOptions(ctx, nil,
+		WithInitialCIDRs("10.0.0.0/31"),
+		WithAutoExpand([]string{"10.0.1.0/31", "10.0.2.0/32"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create guardian: %v", err)
+	}
+
+	// 依次耗尽初始 CIDR 和两个备用 CIDR
+	want := []string{"10.0.0.0", "10.0.0.1", "10.0.1.0", "10.0.1.1", "10.0.2.0"}
+	for _, expected := range want {
+		ip, err := guardian.GetNextAvailableIP(ctx, "auto")
+		if err != nil {
+			t.Fatalf("GetNextAvailableIP failed: %v", err)
+		}
+		if ip != expected {
+			t.Errorf("Expected %s, got %s", expected, ip)
+		}
+	}
+	managed, _ := guardian.GetManagedCIDRs(ctx)
+	if _, ok := managed["10.0.1.0/31"]; !ok {
+		t.Errorf("Expected spare CIDR to be managed after auto-expand, got %v", managed)
+	}
+
+	// 备用 CIDR 用尽后返回常规错误
+	if _, err := guardian.GetNextAvailableIP(ctx, "auto"); err == nil || !strings.Contains(err.Error(), "没有可用的IP") {
+		t.Errorf("Expected no available IP error, got %v", err)
+	}
+
+	// 未配置备用 CIDR 时不会扩展
+	plain, _ := NewCIDRGuardian(ctx, nil, "10.0.0.0/32")
+	_, _ = plain.GetNextAvailableIP(ctx, "x")
+	if _, err := plain.GetNextAvailableIP(ctx, "x"); err == nil {
+		t.Error("Expected error without spares")
+	}
+
+	// 扩展失败时返回错误并保留备用 CIDR
+	bad, _ := NewCIDRGuardianWithOptions(ctx, nil, WithAutoExpand([]string{"invalid"}))
+	if _, err := bad.GetNextAvailableIP(ctx, "x"); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("Expected auto-expand error, got %v", err)
+	}
+}
+
+// TestCIDRGuardian_Verify 测试存储状态一致性检查
+func TestCIDRGuardian_Verify(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/28")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	_ = guardian.ReserveIP(ctx, "10.0.0.2", "gateway")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.8/30", "block"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+
+	// 正常状态下没有不一致
+	issues, err := guardian.Verify(ctx)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Expected no inconsistencies, got %v", issues)
+	}
+
+	// 直接修改存储，制造各类不一致
+	storage.available["10.0.0.1"] = true
+	storage.available["10.0.0.2"] = true
+	storage.allocated["192.168.1.1"] = "stray"
+	storage.allocated["10.0.0.10"] = "dup"
+	storage.available["10.0.0.10"] = true
+
+	issues, err = guardian.Verify(ctx)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	want := []Inconsistency{
+		{IP: "10.0.0.1", Kind: InconsistencyAvailableAndAllocated},
+		{IP: "10.0.0.2", Kind: InconsistencyReservedAndAvailable},
+		{IP: "10.0.0.10", Kind: InconsistencyAvailableAndAllocated},
+		{IP: "192.168.1.1", Kind: InconsistencyUnmanagedAllocation},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("Expected %v, got %v", want, issues)
+	}
+
+	// 存储不支持预留时跳过预留检查，存储错误时返回错误
+	mock := newMockIPStorage()
+	mockGuardian, _ := NewCIDRGuardian(ctx, mock, "10.0.0.0/30")
+	if issues, err := mockGuardian.Verify(ctx); err != nil || len(issues) != 0 {
+		t.Errorf("Expected clean result from mock storage, got %v (err=%v)", issues, err)
+	}
+	mock.failOn = "GetAllocatedIPs"
+	mock.errorMsg = "query failed"
+	if _, err := mockGuardian.Verify(ctx); err == nil {
+		t.Error("Expected storage error")
+	}
+}
+
+// barrierIPStorage 让前 n 次 GetAvailableIPs 调用互相等待，使并发的分配看到相同的快照
+type barrierIPStorage struct {
+	IPStorage
+	mu      sync.Mutex
+	pending int
+	release chan struct{}
+}
+
+func newBarrierIPStorage(storage IPStorage, n int) *barrierIPStorage {
+	return &barrierIPStorage{IPStorage: storage, pending: n, release: make(chan struct{})}
+}
+
+// GetAvailableIPs 读取快照后等待其他调用也读取完毕
+func (s *barrierIPStorage) GetAvailableIPs(ctx context.Context) ([]string, error) {
+	ips, err := s.IPStorage.GetAvailableIPs(ctx)
+
+	s.mu.Lock()
+	waiting := s.pending > 0
+	if waiting {
+		s.pending--
+		if s.pending == 0 {
+			close(s.release)
+		}
+	}
+	s.mu.Unlock()
+
+	if waiting {
+		<-s.release
+	}
+	return ips, err
+}
+
+// TestCIDRGuardian_AllocateCIDRRetry 测试并发分配同样大小的 CIDR 时，冲突的一方重试其他块
+func TestCIDRGuardian_AllocateCIDRRetry(t *testing.T) {
+	ctx := context.Background()
+
+	allocateConcurrently := func(guardian *CIDRGuardian) ([]string, []error) {
+		var wg sync.WaitGroup
+		cidrs := make([]string, 2)
+		errs := make([]error, 2)
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				cidrs[i], errs[i] = guardian.AllocateCIDR(ctx, 30, fmt.Sprintf("worker-%d", i))
+			}(i)
+		}
+		wg.Wait()
+		return cidrs, errs
+	}
+
+	// 两个调用看到相同的快照并选中同一个块，失败的一方应重试并得到下一个块
+	guardian, _ := NewCIDRGuardian(ctx, newBarrierIPStorage(NewMemoryIPStorage(), 2), "10.0.0.0/28")
+	cidrs, errs := allocateConcurrently(guardian)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("worker %d failed: %v", i, err)
+		}
+	}
+	sort.Strings(cidrs)
+	if want := []string{"10.0.0.0/30", "10.0.0.4/30"}; !reflect.DeepEqual(cidrs, want) {
+		t.Errorf("Expected %v, got %v", want, cidrs)
+	}
+
+	// 关闭重试时冲突的一方返回 ErrIPUnavailable
+	noRetry, _ := NewCIDRGuardianWithOptions(ctx, newBarrierIPStorage(NewMemoryIPStorage(), 2),
+		WithInitialCIDRs("10.0.0.0/28"), WithAllocateRetries(0))
+	_, errs = allocateConcurrently(noRetry)
+	failures := 0
+	for _, err := range errs {
+		if err != nil {
+			if !errors.Is(err, ErrIPUnavailable) {
+				t.Errorf("Expected ErrIPUnavailable, got %v", err)
+			}
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Errorf("Expected exactly one conflicting allocation without retries, got %d", failures)
+	}
+
+	// 重试等待期间响应上下文取消
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := guardian.AllocateCIDR(cancelCtx, 30, "cancelled"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestCIDRGuardian_GetLastAvailableIPRetry 测试并发获取最大可用IP时，冲突的一方重试下一个IP
+func TestCIDRGuardian_GetLastAvailableIPRetry(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, newBarrierIPStorage(NewMemoryIPStorage(), 2), "10.0.0.0/30")
+
+	var wg sync.WaitGroup
+	ips := make([]string, 2)
+	errs := make([]error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ips[i], errs[i] = guardian.GetLastAvailableIP(ctx, fmt.Sprintf("worker-%d", i))
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("worker %d failed: %v", i, err)
+		}
+	}
+	sort.Strings(ips)
+	if want := []string{"10.0.0.2", "10.0.0.3"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("Expected %v, got %v", want, ips)
+	}
+}
+
+// leakyAllocateStorage 分配IP时不从可用池中移除，用于测试存储自检
+type leakyAllocateStorage struct {
+	*MemoryIPStorage
+}
+
+// AllocateIP 只写入已分配池，违反接口约定
+func (s *leakyAllocateStorage) AllocateIP(ctx context.Context, ip string, description string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allocated[ip] = description
+	return nil
+}
+
+// TestValidateStorage 测试存储后端自检
+func TestValidateStorage(t *testing.T) {
+	ctx := context.Background()
+
+	// 符合约定的存储通过自检，且不留下临时地址
+	storage := NewMemoryIPStorage()
+	if err := ValidateStorage(ctx, storage); err != nil {
+		t.Fatalf("ValidateStorage failed for memory storage: %v", err)
+	}
+	if count, _ := storage.AvailableCount(ctx); count != 0 {
+		t.Errorf("Self test left %d available IPs", count)
+	}
+	if count, _ := storage.AllocatedCount(ctx); count != 0 {
+		t.Errorf("Self test left %d allocated IPs", count)
+	}
+
+	// 违反约定的存储返回描述性错误，并清理临时地址
+	leaky := &leakyAllocateStorage{NewMemoryIPStorage()}
+	err := ValidateStorage(ctx, leaky)
+	if err == nil || !strings.Contains(err.Error(), "AllocateIP") {
+		t.Errorf("Expected AllocateIP contract error, got %v", err)
+	}
+	if count, _ := leaky.AvailableCount(ctx); count != 0 {
+		t.Errorf("Failed self test left %d available IPs", count)
+	}
+
+	// 临时地址已存在时拒绝自检，且不修改已有数据
+	existing := NewMemoryIPStorage()
+	_ = existing.AddIP(ctx, selfTestIP)
+	if err := ValidateStorage(ctx, existing); err == nil {
+		t.Error("Expected error when the self test address already exists")
+	}
+	if available, _ := existing.IsIPAvailable(ctx, selfTestIP); !available {
+		t.Error("Self test should not remove a pre-existing address")
+	}
+
+	// 存储错误
+	mock := newMockIPStorage()
+	mock.failOn = "AddIP"
+	mock.errorMsg = "add failed"
+	if err := ValidateStorage(ctx, mock); err == nil || !strings.Contains(err.Error(), "add failed") {
+		t.Errorf("Expected storage error, got %v", err)
+	}
+
+	// 通过选项在创建时执行自检
+	if _, err := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithStorageSelfTest(), WithInitialCIDRs("10.0.0.0/30")); err != nil {
+		t.Errorf("Expected guardian creation to pass self test: %v", err)
+	}
+	if _, err := NewCIDRGuardianWithOptions(ctx, &leakyAllocateStorage{NewMemoryIPStorage()}, WithStorageSelfTest()); err == nil {
+		t.Error("Expected guardian creation to fail self test")
+	}
+}
+
+// panickingIPStorage 在 failOn 指定的方法中 panic
+type panickingIPStorage struct {
+	*MemoryIPStorage
+	failOn string
+}
+
+func (s *panickingIPStorage) GetAvailableIPs(ctx context.Context) ([]string, error) {
+	if s.failOn == "GetAvailableIPs" {
+		panic("corrupted index")
+	}
+	return s.MemoryIPStorage.GetAvailableIPs(ctx)
+}
+
+func (s *panickingIPStorage) AllocateIP(ctx context.Context, ip, description string) error {
+	if s.failOn == "AllocateIP" {
+		var m map[string]string
+		m[ip] = description // 写入 nil map 引发运行时 panic
+	}
+	return s.MemoryIPStorage.AllocateIP(ctx, ip, description)
+}
+
+// TestCIDRGuardian_PanicRecovery 测试 WithPanicRecovery 将存储方法中的 panic 转换为错误
+func TestCIDRGuardian_PanicRecovery(t *testing.T) {
+	ctx := context.Background()
+	storage := &panickingIPStorage{MemoryIPStorage: NewMemoryIPStorage()}
+	guardian, err := NewCIDRGuardianWithOptions(ctx, storage, WithInitialCIDRs("10.0.0.0/30"), WithPanicRecovery())
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianWithOptions failed: %v", err)
+	}
+
+	// 未发生 panic 时正常调用被包装的存储
+	if err := guardian.AllocateIP(ctx, "10.0.0.1", "ok"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+
+	storage.failOn = "GetAvailableIPs"
+	if _, err := guardian.GetNextAvailableIP(ctx, "x"); !errors.Is(err, ErrStoragePanic) || !strings.Contains(err.Error(), "corrupted index") {
+		t.Errorf("Expected ErrStoragePanic with the panic value, got %v", err)
+	}
+
+	storage.failOn = "AllocateIP"
+	if err := guardian.AllocateIP(ctx, "10.0.0.2", "x"); !errors.Is(err, ErrStoragePanic) || !strings.Contains(err.Error(), "AllocateIP") {
+		t.Errorf("Expected ErrStoragePanic naming the method, got %v", err)
+	}
+
+	// 不重复包装，Unwrap 返回原存储
+	safe := NewSafeStorage(storage)
+	if NewSafeStorage(safe) != safe || safe.Unwrap() != IPStorage(storage) {
+		t.Error("NewSafeStorage should not wrap twice and Unwrap should return the wrapped storage")
+	}
+
+	// 启用后被包装存储的可选接口仍然可用
+	reserving, err := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithPanicRecovery(), WithInitialCIDRs("10.0.1.0/29"))
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianWithOptions failed: %v", err)
+	}
+	if err := reserving.ReserveIP(ctx, "10.0.1.2", "gateway"); err != nil {
+		t.Fatalf("ReserveIP failed with WithPanicRecovery: %v", err)
+	}
+	if reserved, _ := reserving.GetReservedIPs(ctx); reserved["10.0.1.2"] != "gateway" {
+		t.Errorf("Expected 10.0.1.2 to be reserved, got %v", reserved)
+	}
+
+	// 未启用时 panic 照常向上传播
+	plain, _ := NewCIDRGuardian(ctx, storage)
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected the panic to propagate without WithPanicRecovery")
+		}
+	}()
+	_ = plain.AllocateIP(ctx, "10.0.0.3", "x")
+}
+
+// recordingT 记录一致性测试报告的错误而不终止当前测试
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Fatalf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+
+// TestRunStorageConformance 测试存储一致性测试套件
+func TestRunStorageConformance(t *testing.T) {
+	RunStorageConformance(t, func() IPStorage { return NewMemoryIPStorage() })
+	RunStorageConformance(t, func() IPStorage {
+		storage, err := NewShardedIPStorage(NewMemoryIPStorage(), NewMemoryIPStorage())
+		if err != nil {
+			t.Fatalf("Failed to create sharded storage: %v", err)
+		}
+		return storage
+	})
+
+	// 违反约定的存储被报告，错误信息带有用例名
+	rec := &recordingT{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunStorageConformance(rec, func() IPStorage { return &leakyAllocateStorage{NewMemoryIPStorage()} })
+	}()
+	<-done
+	if len(rec.errors) == 0 {
+		t.Fatal("Expected conformance failures for a leaky storage")
+	}
+	if !strings.HasPrefix(rec.errors[0], "AllocateDeallocate: ") {
+		t.Errorf("Expected first failure in AllocateDeallocate, got %q", rec.errors[0])
+	}
+}
+
+// TestCIDRGuardian_AllocationSource 测试分配来源的记录和查询
+func TestCIDRGuardian_AllocationSource(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, nil, WithInitialCIDRs("10.0.0.0/24"), WithSource("host-a"))
+
+	// 默认来源
+	if err := guardian.AllocateIP(ctx, "10.0.0.1", "web"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	allocation, err := guardian.GetAllocation(ctx, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("GetAllocation failed: %v", err)
+	}
+	if want := (Allocation{IP: "10.0.0.1", Description: "web", Source: "host-a"}); allocation != want {
+		t.Errorf("Expected %+v, got %+v", want, allocation)
+	}
+
+	// 单次调用覆盖来源，覆盖所有分配路径
+	callCtx := WithAllocationSource(ctx, "job-42")
+	ip, err := guardian.GetNextAvailableIP(callCtx, "next")
+	if err != nil {
+		t.Fatalf("GetNextAvailableIP failed: %v", err)
+	}
+	if allocation, _ := guardian.GetAllocation(ctx, ip); allocation.Source != "job-42" {
+		t.Errorf("Expected per-call source job-42, got %q", allocation.Source)
+	}
+	if err := guardian.AllocateSpecificCIDR(callCtx, "10.0.0.16/28", "block"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+	if allocation, _ := guardian.GetAllocation(ctx, "10.0.0.16"); allocation.Source != "job-42" || allocation.Description != "block" || allocation.CIDR != "10.0.0.16/28" {
+		t.Errorf("Unexpected block allocation: %+v", allocation)
+	}
+	ips, _ := guardian.BulkAllocate(ctx, map[string]string{"10.0.0.100": "bulk"})
+	contiguous, _ := guardian.AllocateContiguous(ctx, 2, "run")
+	for _, ip := range append(ips, contiguous...) {
+		if allocation, _ := guardian.GetAllocation(ctx, ip); allocation.Source != "host-a" {
+			t.Errorf("Expected source host-a for %s, got %q", ip, allocation.Source)
+		}
+	}
+
+	// 报表中显示来源
+	table, _ := guardian.StatusTable(ctx)
+	if !strings.Contains(table, "来源") || !strings.Contains(table, "job-42") {
+		t.Errorf("StatusTable should include sources, got:\n%s", table)
+	}
+
+	// 释放后来源一并删除，重新分配时不带旧来源
+	_ = guardian.ReleaseIP(ctx, "10.0.0.1")
+	plain, _ := NewCIDRGuardian(ctx, guardian.storage)
+	_ = plain.AllocateIP(ctx, "10.0.0.1", "again")
+	if allocation, _ := plain.GetAllocation(ctx, "10.0.0.1"); allocation.Source != "" {
+		t.Errorf("Expected no source after reallocation, got %q", allocation.Source)
+	}
+
+	// 未分配的IP
+	if _, err := guardian.GetAllocation(ctx, "10.0.0.200"); err == nil {
+		t.Error("Expected error for unallocated IP")
+	}
+}
+
+// TestSQLIPStorage_AllocationSource 测试 SQL 存储的分配来源
+func TestSQLIPStorage_AllocationSource(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE ip_allocated SET source = ? WHERE ip = ?").
+		WithArgs("host-a", "10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := storage.SetAllocationSource(ctx, "10.0.0.1", "host-a"); err != nil {
+		t.Fatalf("SetAllocationSource failed: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.2").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+	if err := storage.SetAllocationSource(ctx, "10.0.0.2", "host-a"); err == nil {
+		t.Error("Expected error for unallocated IP")
+	}
+
+	mock.ExpectQuery("SELECT ip, source FROM ip_allocated WHERE source <> ''").
+		WillReturnRows(sqlmock.NewRows([]string{"ip", "source"}).AddRow("10.0.0.1", "host-a"))
+	sources, err := storage.GetAllocationSources(ctx)
+	if err != nil {
+		t.Fatalf("GetAllocationSources failed: %v", err)
+	}
+	if !reflect.DeepEqual(sources, map[string]string{"10.0.0.1": "host-a"}) {
+		t.Errorf("Unexpected sources: %v", sources)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCIDRGuardian_RemoveIPsMatching 测试按通配符模式移除可用IP
+func TestCIDRGuardian_RemoveIPsMatching(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, nil, "10.0.4.0/23")
+	_ = guardian.AllocateIP(ctx, "10.0.5.10", "keep")
+
+	// 单段通配符只移除匹配的可用IP，已分配的IP不受影响
+	removed, err := guardian.RemoveIPsMatching(ctx, "10.0.5.*")
+	if err != nil {
+		t.Fatalf("RemoveIPsMatching failed: %v", err)
+	}
+	if removed != 255 {
+		t.Errorf("Expected 255 removed IPs, got %d", removed)
+	}
+	if available, _ := guardian.storage.IsIPAvailable(ctx, "10.0.5.20"); available {
+		t.Error("10.0.5.20 should be removed")
+	}
+	if available, _ := guardian.storage.IsIPAvailable(ctx, "10.0.4.20"); !available {
+		t.Error("10.0.4.20 should not be removed")
+	}
+	if allocated, _ := guardian.storage.GetAllocatedIPs(ctx); allocated["10.0.5.10"] != "keep" {
+		t.Error("Allocated IP should not be affected")
+	}
+
+	// 没有匹配时返回 0
+	if removed, err := guardian.RemoveIPsMatching(ctx, "192.168.*.*"); err != nil || removed != 0 {
+		t.Errorf("Expected 0 removed, got %d (err=%v)", removed, err)
+	}
+
+	// 无效模式
+	for _, pattern := range []string{"10.*.5.*", "10.0.5", "10.0.5.1*", "10.0.256.*", "a.b.c.*", "10.0.05.*"} {
+		if _, err := guardian.RemoveIPsMatching(ctx, pattern); err == nil {
+			t.Errorf("Expected error for pattern %q", pattern)
+		}
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 256 {
+		t.Errorf("Invalid patterns should not remove IPs, available count %d", count)
+	}
+}
+
+// TestCIDRGuardian_RenewLease 测试租约续期
+func TestCIDRGuardian_RenewLease(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/28")
+
+	// 续期仍然有效的租约
+	if err := guardian.AllocateIPWithTTL(ctx, "10.0.0.1", "worker", time.Minute); err != nil {
+		t.Fatalf("AllocateIPWithTTL failed: %v", err)
+	}
+	before, _, _ := storage.GetLeaseExpiry(ctx, "10.0.0.1")
+	if err := guardian.RenewLease(ctx, "10.0.0.1", time.Hour); err != nil {
+		t.Fatalf("RenewLease failed: %v", err)
+	}
+	after, ok, _ := storage.GetLeaseExpiry(ctx, "10.0.0.1")
+	if !ok || !after.After(before) || time.Until(after) < 59*time.Minute {
+		t.Errorf("Expected lease extended to about an hour, got %v (before %v)", after, before)
+	}
+
+	// 续期已过期的租约
+	if err := guardian.AllocateIPWithTTL(ctx, "10.0.0.2", "short", time.Millisecond); err != nil {
+		t.Fatalf("AllocateIPWithTTL failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := guardian.RenewLease(ctx, "10.0.0.2", time.Hour); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Expected ErrLeaseExpired, got %v", err)
+	}
+
+	// 已被释放（回收）的IP和没有租约的IP
+	_ = guardian.ReleaseIP(ctx, "10.0.0.2")
+	if err := guardian.RenewLease(ctx, "10.0.0.2", time.Hour); err == nil {
+		t.Error("Expected error renewing a released IP")
+	}
+	_ = guardian.AllocateIP(ctx, "10.0.0.3", "no-lease")
+	if err := guardian.RenewLease(ctx, "10.0.0.3", time.Hour); err == nil {
+		t.Error("Expected error renewing an allocation without lease")
+	}
+
+	// 无效时长以及不支持租约的存储
+	if err := guardian.RenewLease(ctx, "10.0.0.1", 0); err == nil {
+		t.Error("Expected error for zero ttl")
+	}
+	mockGuardian, _ := NewCIDRGuardian(ctx, newMockIPStorage(), "192.168.0.0/30")
+	if err := mockGuardian.AllocateIPWithTTL(ctx, "192.168.0.1", "x", time.Minute); err == nil {
+		t.Error("Expected error for storage without lease support")
+	}
+}
+
+// TestSQLIPStorage_Lease 测试 SQL 存储的租约到期时间
+func TestSQLIPStorage_Lease(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE ip_allocated SET expires_at = ? WHERE ip = ?").
+		WithArgs(expiresAt, "10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := storage.SetLeaseExpiry(ctx, "10.0.0.1", expiresAt); err != nil {
+		t.Fatalf("SetLeaseExpiry failed: %v", err)
+	}
+
+	// MySQL 写入相同的到期时间时不影响任何行，已分配的IP仍然成功
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE ip_allocated SET expires_at = ? WHERE ip = ?").
+		WithArgs(expiresAt, "10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if err := storage.SetLeaseExpiry(ctx, "10.0.0.1", expiresAt); err != nil {
+		t.Errorf("SetLeaseExpiry with an unchanged value failed: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.2").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+	if err := storage.SetLeaseExpiry(ctx, "10.0.0.2", expiresAt); err == nil {
+		t.Error("Expected error for unallocated IP")
+	}
+
+	mock.ExpectQuery("SELECT expires_at FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"expires_at"}).AddRow(expiresAt))
+	got, ok, err := storage.GetLeaseExpiry(ctx, "10.0.0.1")
+	if err != nil || !ok || !got.Equal(expiresAt) {
+		t.Errorf("Expected %v, got %v ok=%v err=%v", expiresAt, got, ok, err)
+	}
+	mock.ExpectQuery("SELECT expires_at FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.3").WillReturnRows(sqlmock.NewRows([]string{"expires_at"}).AddRow(nil))
+	if _, ok, err := storage.GetLeaseExpiry(ctx, "10.0.0.3"); err != nil || ok {
+		t.Errorf("Expected no lease, got ok=%v err=%v", ok, err)
+	}
+	mock.ExpectQuery("SELECT expires_at FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.4").WillReturnRows(sqlmock.NewRows([]string{"expires_at"}))
+	if _, _, err := storage.GetLeaseExpiry(ctx, "10.0.0.4"); err == nil {
+		t.Error("Expected error for unallocated IP")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCIDRGuardian_Claim 测试两阶段分配的确认、取消和到期回收
+func TestCIDRGuardian_Claim(t *testing.T) {
+	ctx := context.Background()
+
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/29")
+
+	// 确认后IP保持分配，认领被删除
+	ip, token, err := guardian.ClaimIP(ctx, "web")
+	if err != nil || ip != "10.0.0.0" || token == "" {
+		t.Fatalf("ClaimIP = %q, %q, %v", ip, token, err)
+	}
+	if claim, ok, _ := storage.GetClaim(ctx, token); !ok || claim.IP != ip || time.Until(claim.ExpiresAt) > defaultClaimTTL {
+		t.Errorf("Unexpected claim: %+v ok=%v", claim, ok)
+	}
+	if err := guardian.ConfirmClaim(ctx, token); err != nil {
+		t.Fatalf("ConfirmClaim failed: %v", err)
+	}
+	if err := guardian.ConfirmClaim(ctx, token); err == nil {
+		t.Error("Expected error when confirming twice")
+	}
+	if allocated, _ := storage.GetAllocatedIPs(ctx); allocated[ip] != "web" {
+		t.Errorf("Expected %s to stay allocated, got %v", ip, allocated)
+	}
+
+	// 取消后IP被释放
+	ip, token, _ = guardian.ClaimIP(ctx, "db")
+	if err := guardian.CancelClaim(ctx, token); err != nil {
+		t.Fatalf("CancelClaim failed: %v", err)
+	}
+	if available, _ := storage.IsIPAvailable(ctx, ip); !available {
+		t.Errorf("Expected %s to be released", ip)
+	}
+	if err := guardian.CancelClaim(ctx, token); err == nil {
+		t.Error("Expected error when cancelling twice")
+	}
+
+	// 到期未确认的认领被回收，已确认的不受影响
+	short, _ := NewCIDRGuardianWithOptions(ctx, storage, WithClaimTTL(10*time.Millisecond))
+	expiredIP, expiredToken, _ := short.ClaimIP(ctx, "tmp")
+	_, pendingToken, _ := guardian.ClaimIP(ctx, "pending")
+	time.Sleep(20 * time.Millisecond)
+	if err := short.ConfirmClaim(ctx, expiredToken); !errors.Is(err, ErrClaimExpired) {
+		t.Errorf("Expected ErrClaimExpired, got %v", err)
+	}
+	released, err := short.ReapExpiredClaims(ctx)
+	if err != nil || !reflect.DeepEqual(released, []string{expiredIP}) {
+		t.Errorf("Expected %s to be reaped, got %v, %v", expiredIP, released, err)
+	}
+	if err := guardian.ConfirmClaim(ctx, pendingToken); err != nil {
+		t.Errorf("Expected unexpired claim to be confirmable, got %v", err)
+	}
+	if count, _ := storage.AllocatedCount(ctx); count != 2 {
+		t.Errorf("Expected 2 allocated IPs, got %d", count)
+	}
+
+	// 后台回收循环
+	_, loopToken, _ := short.ClaimIP(ctx, "loop")
+	loopCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := short.RunClaimReaper(loopCtx, 5*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected RunClaimReaper to stop with the context, got %v", err)
+	}
+	if _, ok, _ := storage.GetClaim(ctx, loopToken); ok {
+		t.Error("Expected reaper loop to release the expired claim")
+	}
+
+	// 存储不支持认领
+	plain, _ := NewCIDRGuardian(ctx, newMockIPStorage(), "10.0.0.0/30")
+	if _, _, err := plain.ClaimIP(ctx, "web"); err == nil {
+		t.Error("Expected error for storage without claim support")
+	}
+}
+
+// TestCIDRGuardian_AllocateIdempotent 测试以相同的请求键重试时返回同一个IP
+func TestCIDRGuardian_AllocateIdempotent(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(),
+		WithInitialCIDRs("10.0.0.0/29"), WithClock(clock), WithIdempotencyTTL(time.Minute))
+
+	first, err := guardian.AllocateIdempotent(ctx, "req-1", "web")
+	if err != nil {
+		t.Fatalf("AllocateIdempotent failed: %v", err)
+	}
+	retry, err := guardian.AllocateIdempotent(ctx, "req-1", "web")
+	if err != nil {
+		t.Fatalf("AllocateIdempotent retry failed: %v", err)
+	}
+	if retry != first {
+		t.Errorf("Expected the retry to return %s, got %s", first, retry)
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 1 {
+		t.Errorf("Expected a single allocation, got %d", count)
+	}
+
+	// 不同的键分配不同的IP
+	second, err := guardian.AllocateIdempotent(ctx, "req-2", "web")
+	if err != nil {
+		t.Fatalf("AllocateIdempotent failed: %v", err)
+	}
+	if second == first {
+		t.Errorf("Distinct keys should get different IPs, both got %s", first)
+	}
+
+	// 并发的重复请求只分配一次
+	var wg sync.WaitGroup
+	results := make([]string, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = guardian.AllocateIdempotent(ctx, "req-3", "web")
+		}(i)
+	}
+	wg.Wait()
+	for _, ip := range results {
+		if ip == "" || ip != results[0] {
+			t.Fatalf("Concurrent retries should return the same IP, got %v", results)
+		}
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 3 {
+		t.Errorf("Expected 3 allocations, got %d", count)
+	}
+
+	// IP 被释放后记录失效，重新分配
+	if err := guardian.ReleaseIP(ctx, first); err != nil {
+		t.Fatalf("ReleaseIP failed: %v", err)
+	}
+	again, err := guardian.AllocateIdempotent(ctx, "req-1", "web")
+	if err != nil {
+		t.Fatalf("AllocateIdempotent failed: %v", err)
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 3 {
+		t.Errorf("Expected the released key to allocate again, got %d allocations", count)
+	}
+
+	// IP 被释放后又被其他请求分配时记录失效，重试不返回别人的IP
+	if err := guardian.ReleaseIP(ctx, again); err != nil {
+		t.Fatalf("ReleaseIP failed: %v", err)
+	}
+	if err := guardian.AllocateIP(ctx, again, "db"); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	reclaimed, err := guardian.AllocateIdempotent(ctx, "req-1", "web")
+	if err != nil {
+		t.Fatalf("AllocateIdempotent failed: %v", err)
+	}
+	if reclaimed == again {
+		t.Errorf("Expected a new IP after %s was reallocated elsewhere", again)
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 4 {
+		t.Errorf("Expected 4 allocations, got %d", count)
+	}
+
+	// 记录到期后以相同的键分配新的IP
+	clock.Advance(time.Minute)
+	expired, err := guardian.AllocateIdempotent(ctx, "req-1", "web")
+	if err != nil {
+		t.Fatalf("AllocateIdempotent failed: %v", err)
+	}
+	if expired == reclaimed {
+		t.Errorf("Expected a new IP after the key expired, got %s again", expired)
+	}
+
+	if _, err := guardian.AllocateIdempotent(ctx, "", "web"); err == nil {
+		t.Error("AllocateIdempotent should reject an empty key")
+	}
+}
+
+// TestCIDRGuardian_FakeClock 测试注入时钟后租约、认领和分配时间按时钟确定性地到期
+func TestCIDRGuardian_FakeClock(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, storage, WithClock(clock), WithInitialCIDRs("10.0.0.0/29"))
+
+	// 租约按时钟计算到期时间
+	if err := guardian.AllocateIPWithTTL(ctx, "10.0.0.1", "web", time.Hour); err != nil {
+		t.Fatalf("AllocateIPWithTTL failed: %v", err)
+	}
+	if expiresAt, _, _ := storage.GetLeaseExpiry(ctx, "10.0.0.1"); !expiresAt.Equal(start.Add(time.Hour)) {
+		t.Errorf("Expected lease to expire at %v, got %v", start.Add(time.Hour), expiresAt)
+	}
+	clock.Advance(59 * time.Minute)
+	if err := guardian.RenewLease(ctx, "10.0.0.1", time.Hour); err != nil {
+		t.Errorf("Expected lease to be renewable before expiry, got %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := guardian.RenewLease(ctx, "10.0.0.1", time.Hour); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("Expected ErrLeaseExpired exactly at expiry, got %v", err)
+	}
+
+	// 认领在时钟走过 TTL 后到期，不需要等待
+	_, token, _ := guardian.ClaimIP(ctx, "tmp")
+	clock.Advance(defaultClaimTTL - time.Second)
+	if released, _ := guardian.ReapExpiredClaims(ctx); len(released) != 0 {
+		t.Errorf("Expected no claims to be reaped yet, got %v", released)
+	}
+	clock.Advance(time.Second)
+	if err := guardian.ConfirmClaim(ctx, token); !errors.Is(err, ErrClaimExpired) {
+		t.Errorf("Expected ErrClaimExpired, got %v", err)
+	}
+	if released, _ := guardian.ReapExpiredClaims(ctx); len(released) != 1 {
+		t.Errorf("Expected the claim to be reaped, got %v", released)
+	}
+
+	// 内存存储的分配时间使用同一个时钟
+	before, _ := guardian.GetAllocationsBefore(ctx, start.Add(time.Second))
+	if !reflect.DeepEqual(before, map[string]string{"10.0.0.1": "web"}) {
+		t.Errorf("Unexpected allocations before: %v", before)
+	}
+
+	// nil 时钟被忽略
+	plain, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithClock(nil))
+	if now := plain.clock.Now(); time.Since(now) > time.Minute {
+		t.Errorf("Expected system clock, got %v", now)
+	}
+}
+
+// TestSQLIPStorage_Claim 测试 SQL 存储的认领记录
+func TestSQLIPStorage_Claim(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec("UPDATE ip_allocated SET claim_token = ?, claim_expires_at = ? WHERE ip = ?").
+		WithArgs("tok", expiresAt, "10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := storage.SetClaim(ctx, "10.0.0.1", "tok", expiresAt); err != nil {
+		t.Fatalf("SetClaim failed: %v", err)
+	}
+	mock.ExpectExec("UPDATE ip_allocated SET claim_token = ?, claim_expires_at = ? WHERE ip = ?").
+		WithArgs("tok2", expiresAt, "10.0.0.2").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := storage.SetClaim(ctx, "10.0.0.2", "tok2", expiresAt); err == nil {
+		t.Error("Expected error for unallocated IP")
+	}
+
+	mock.ExpectQuery("SELECT ip, claim_expires_at FROM ip_allocated WHERE claim_token = ?").
+		WithArgs("tok").WillReturnRows(sqlmock.NewRows([]string{"ip", "claim_expires_at"}).AddRow("10.0.0.1", expiresAt))
+	claim, ok, err := storage.GetClaim(ctx, "tok")
+	if expected := (IPClaim{Token: "tok", IP: "10.0.0.1", ExpiresAt: expiresAt}); err != nil || !ok || claim != expected {
+		t.Errorf("Expected %+v, got %+v ok=%v err=%v", expected, claim, ok, err)
+	}
+	mock.ExpectQuery("SELECT ip, claim_expires_at FROM ip_allocated WHERE claim_token = ?").
+		WithArgs("missing").WillReturnRows(sqlmock.NewRows([]string{"ip", "claim_expires_at"}))
+	if _, ok, err := storage.GetClaim(ctx, "missing"); err != nil || ok {
+		t.Errorf("Expected no claim, got ok=%v err=%v", ok, err)
+	}
+
+	mock.ExpectExec("UPDATE ip_allocated SET claim_token = NULL, claim_expires_at = NULL WHERE claim_token = ?").
+		WithArgs("tok").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := storage.ClearClaim(ctx, "tok"); err != nil {
+		t.Errorf("ClearClaim failed: %v", err)
+	}
+	mock.ExpectExec("UPDATE ip_allocated SET claim_token = NULL, claim_expires_at = NULL WHERE claim_token = ?").
+		WithArgs("tok").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := storage.ClearClaim(ctx, "tok"); err == nil {
+		t.Error("Expected error for missing claim")
+	}
+
+	now := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT claim_token, ip, claim_expires_at FROM ip_allocated WHERE claim_token IS NOT NULL AND claim_expires_at <= ?").
+		WithArgs(now).WillReturnRows(sqlmock.NewRows([]string{"claim_token", "ip", "claim_expires_at"}).AddRow("tok", "10.0.0.1", expiresAt))
+	expired, err := storage.GetExpiredClaims(ctx, now)
+	if expected := []IPClaim{{Token: "tok", IP: "10.0.0.1", ExpiresAt: expiresAt}}; err != nil || !reflect.DeepEqual(expired, expected) {
+		t.Errorf("Expected %+v, got %+v, %v", expected, expired, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestNetworkAndBroadcastAddress 测试网络地址和广播地址辅助函数
+func TestNetworkAndBroadcastAddress(t *testing.T) {
+	tests := []struct {
+		cidr      string
+		network   string
+		broadcast string // 为空表示应返回错误
+	}{
+		{"192.168.1.0/24", "192.168.1.0", "192.168.1.255"},
+		{"192.168.1.77/24", "192.168.1.0", "192.168.1.255"},
+		{"10.0.0.0/8", "10.0.0.0", "10.255.255.255"},
+		{"172.16.5.4/30", "172.16.5.4", "172.16.5.7"},
+		{"0.0.0.0/0", "0.0.0.0", "255.255.255.255"},
+		{"10.0.0.3/31", "10.0.0.2", ""},
+		{"10.0.0.5/32", "10.0.0.5", ""},
+		{"2001:db8::1/64", "2001:db8::", ""},
+	}
+	for _, tt := range tests {
+		network, err := NetworkAddress(tt.cidr)
+		if err != nil || network != tt.network {
+			t.Errorf("NetworkAddress(%s) = %q, %v; want %q", tt.cidr, network, err, tt.network)
+		}
+
+		broadcast, err := BroadcastAddress(tt.cidr)
+		if tt.broadcast == "" {
+			if err == nil {
+				t.Errorf("BroadcastAddress(%s) should fail, got %q", tt.cidr, broadcast)
+			}
+		} else if err != nil || broadcast != tt.broadcast {
+			t.Errorf("BroadcastAddress(%s) = %q, %v; want %q", tt.cidr, broadcast, err, tt.broadcast)
+		}
+	}
+
+	if _, err := NetworkAddress("invalid"); err == nil {
+		t.Error("NetworkAddress should fail for invalid CIDR")
+	}
+	if _, err := BroadcastAddress("invalid"); err == nil {
+		t.Error("BroadcastAddress should fail for invalid CIDR")
+	}
+}
+
+// TestHostsSeq 测试逐个产生 CIDR 中的地址
+func TestHostsSeq(t *testing.T) {
+	collect := func(seq iter.Seq[net.IP], limit int) []string {
+		ips := []string{}
+		for ip := range seq {
+			ips = append(ips, ip.String())
+			if limit > 0 && len(ips) == limit {
+				break
+			}
+		}
+		return ips
+	}
+
+	seq, err := HostsSeq("10.0.0.5/30")
+	if err != nil {
+		t.Fatalf("HostsSeq failed: %v", err)
+	}
+	if got, want := collect(seq, 0), []string{"10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// 跳过网络地址和广播地址，/31、/32 和 IPv6 不跳过
+	for cidr, want := range map[string][]string{
+		"10.0.0.0/29":    {"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"},
+		"10.0.0.0/30":    {"10.0.0.1", "10.0.0.2"},
+		"10.0.0.0/31":    {"10.0.0.0", "10.0.0.1"},
+		"10.0.0.7/32":    {"10.0.0.7"},
+		"2001:db8::/127": {"2001:db8::", "2001:db8::1"},
+	} {
+		seq, err := HostsSeq(cidr)
+		if err != nil {
+			t.Fatalf("HostsSeq(%s) failed: %v", cidr, err)
+		}
+		if got := collect(WithoutNetworkBroadcast(seq), 0); !reflect.DeepEqual(got, want) {
+			t.Errorf("WithoutNetworkBroadcast(HostsSeq(%s)) = %v, want %v", cidr, got, want)
+		}
+	}
+	seq, _ = HostsSeq("10.0.0.0/29")
+	if got := collect(WithoutNetworkBroadcast(seq), 2); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Expected an early break to stop the filtered sequence, got %v", got)
+	}
+
+	// 提前停止后不再调用 yield，序列可以重新从头消费
+	seq, _ = HostsSeq("10.0.0.0/8")
+	var kept []net.IP
+	for ip := range seq {
+		kept = append(kept, ip)
+		if len(kept) == 3 {
+			break
+		}
+	}
+	if len(kept) != 3 {
+		t.Errorf("Expected 3 IPs before the early break, got %d", len(kept))
+	}
+	// 产生的地址是独立的副本，不会被后续枚举覆盖
+	if kept[0].String() != "10.0.0.0" || kept[2].String() != "10.0.0.2" {
+		t.Errorf("Yielded IPs should be independent copies, got %v", kept)
+	}
+	if got := collect(seq, 2); !reflect.DeepEqual(got, []string{"10.0.0.0", "10.0.0.1"}) {
+		t.Errorf("Expected the sequence to restart, got %v", got)
+	}
+
+	// 覆盖整个地址空间末尾的块也能正常结束
+	seq, _ = HostsSeq("255.255.255.254/31")
+	if got := collect(seq, 0); !reflect.DeepEqual(got, []string{"255.255.255.254", "255.255.255.255"}) {
+		t.Errorf("Expected the last /31, got %v", got)
+	}
+
+	if _, err := HostsSeq("invalid"); err == nil {
+		t.Error("HostsSeq should fail with invalid CIDR")
+	}
+}
+
+// TestCIDRGuardian_Reconcile 测试校正可以安全修正的存储不一致
+func TestCIDRGuardian_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/28")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	_ = guardian.ReserveIP(ctx, "10.0.0.2", "gateway")
+
+	storage.available["10.0.0.1"] = true
+	storage.available["10.0.0.2"] = true
+	storage.allocated["192.168.1.1"] = "stray"
+
+	corrected, err := guardian.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	want := []Inconsistency{
+		{IP: "10.0.0.1", Kind: InconsistencyAvailableAndAllocated},
+		{IP: "10.0.0.2", Kind: InconsistencyReservedAndAvailable},
+	}
+	if !reflect.DeepEqual(corrected, want) {
+		t.Errorf("Expected %v, got %v", want, corrected)
+	}
+
+	// 不属于管理 CIDR 的分配保持不变
+	issues, _ := guardian.Verify(ctx)
+	if len(issues) != 1 || issues[0].Kind != InconsistencyUnmanagedAllocation {
+		t.Errorf("Expected only the unmanaged allocation to remain, got %v", issues)
+	}
+}
+
+// TestCIDRGuardian_StartReconciler 测试后台校正按周期执行并能干净地停止
+func TestCIDRGuardian_StartReconciler(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, storage, WithInitialCIDRs("10.0.0.0/28"), WithLogger(logger))
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+
+	storage.mu.Lock()
+	storage.available["10.0.0.1"] = true
+	storage.mu.Unlock()
+
+	stop, err := guardian.StartReconciler(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatalf("StartReconciler failed: %v", err)
+	}
+
+	// 等待后台校正修正不一致
+	deadline := time.Now().Add(time.Second)
+	for {
+		available, _ := storage.IsIPAvailable(ctx, "10.0.0.1")
+		if !available {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Reconciler did not correct the inconsistency")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stop()
+	stop() // 重复调用是安全的
+	if !strings.Contains(buf.String(), "10.0.0.1") {
+		t.Errorf("Expected the correction to be logged, got %q", buf.String())
+	}
+
+	// 停止后不再执行
+	storage.mu.Lock()
+	storage.available["10.0.0.1"] = true
+	storage.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.0.1"); !available {
+		t.Error("Reconciler should not run after stop")
+	}
+
+	// 上下文取消时同样退出
+	cancelCtx, cancel := context.WithCancel(ctx)
+	stop, err = guardian.StartReconciler(cancelCtx, time.Millisecond)
+	if err != nil {
+		t.Fatalf("StartReconciler failed: %v", err)
+	}
+	cancel()
+	stop()
+
+	// 无效的间隔返回错误而不是 panic
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := guardian.StartReconciler(ctx, interval); err == nil {
+			t.Errorf("Expected error for interval %v", interval)
+		}
+	}
+
+	// 手动校正进行中时跳过本次执行
+	guardian.reconcileMu.Lock()
+	guardian.reconcileTick(ctx)
+	guardian.reconcileMu.Unlock()
+	if available, _ := storage.IsIPAvailable(ctx, "10.0.0.1"); !available {
+		t.Error("Tick should be skipped while another reconcile is running")
+	}
+}
+
+// TestLoadConfig 测试从 JSON 加载 SQL 配置和可选配置项
+func TestLoadConfig(t *testing.T) {
+	ctx := context.Background()
+	input := `{
+		"sql": {
+			"driver": "mysql",
+			"dsn": "user:pass@tcp(localhost:3306)/ipam",
+			"max_open_conns": 10,
+			"max_idle_conns": 5,
+			"conn_max_lifetime": "5m",
+			"conn_max_idle_time": "30s",
+			"history_limit": 20,
+			"skip_table_creation": true,
+			"strict_add": true
+		},
+		"guardian": {
+			"initial_cidrs": ["10.0.0.0/28"],
+			"spare_cidrs": ["10.0.1.0/28"],
+			"orphan_policy": "error",
+			"soft_delete": true,
+			"strict_cidr": true,
+			"max_description_length": 32,
+			"allocate_retries": 0,
+			"source": "host-a"
+		}
+	}`
+
+	sqlConfig, opts, err := LoadConfig(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	want := SQLConfig{
+		DriverName:        "mysql",
+		DataSourceName:    "user:pass@tcp(localhost:3306)/ipam",
+		MaxOpenConns:      10,
+		MaxIdleConns:      5,
+		ConnMaxLifetime:   5 * time.Minute,
+		ConnMaxIdleTime:   30 * time.Second,
+		HistoryLimit:      20,
+		SkipTableCreation: true,
+		StrictAdd:         true,
+	}
+	if sqlConfig != want {
+		t.Errorf("Expected %+v, got %+v", want, sqlConfig)
+	}
+
+	guardian, err := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), opts...)
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianWithOptions failed: %v", err)
+	}
+	if _, ok := guardian.managedCIDRs.load()["10.0.0.0/28"]; !ok {
+		t.Error("Expected initial CIDR to be managed")
+	}
+	if !reflect.DeepEqual(guardian.spareCIDRs, []string{"10.0.1.0/28"}) {
+		t.Errorf("Unexpected spare CIDRs: %v", guardian.spareCIDRs)
+	}
+	if guardian.orphanPolicy != OrphanError || !guardian.softDelete || !guardian.strictCIDR {
+		t.Error("Expected orphan policy, soft delete and strict CIDR to be set")
+	}
+	if guardian.maxDescLen != 32 || guardian.allocRetries != 0 || guardian.source != "host-a" {
+		t.Errorf("Unexpected options: maxDescLen=%d allocRetries=%d source=%q",
+			guardian.maxDescLen, guardian.allocRetries, guardian.source)
+	}
+
+	// 只有 guardian 部分时返回零值 SQLConfig
+	sqlConfig, opts, err = LoadConfig(strings.NewReader(`{"guardian": {"read_only": true}}`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if sqlConfig != (SQLConfig{}) || len(opts) != 1 {
+		t.Errorf("Expected empty SQLConfig and one option, got %+v and %d options", sqlConfig, len(opts))
+	}
+}
+
+// TestLoadConfig_Invalid 测试无效的配置返回错误
+func TestLoadConfig_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"malformed":       `{"sql": `,
+		"unknown field":   `{"guardian": {"strategy": "random"}}`,
+		"unknown policy":  `{"guardian": {"orphan_policy": "keep"}}`,
+		"invalid cidr":    `{"guardian": {"initial_cidrs": ["10.0.0.0/33"]}}`,
+		"invalid spare":   `{"guardian": {"spare_cidrs": ["not-a-cidr"]}}`,
+		"invalid driver":  `{"sql": {"driver": "sqlite"}}`,
+		"invalid time":    `{"sql": {"driver": "mysql", "conn_max_lifetime": "5 minutes"}}`,
+		"negative time":   `{"sql": {"driver": "postgres", "conn_max_idle_time": "-1s"}}`,
+		"wrong type":      `{"sql": {"driver": "mysql", "max_open_conns": "10"}}`,
+		"unknown section": `{"storage": {}}`,
+	}
+	for name, input := range cases {
+		if _, _, err := LoadConfig(strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// TestNewCIDRGuardianFromTemplate 测试从 JSON 模板创建IP池并整体应用
+func TestNewCIDRGuardianFromTemplate(t *testing.T) {
+	ctx := context.Background()
+	data := []byte(`{
+		"cidrs": [
+			{"cidr": "10.0.0.0/29", "description": "web", "reserve_network_broadcast": true, "soft_cap": 80},
+			{"cidr": "10.0.1.0/30", "description": "db"}
+		],
+		"reservations": {"10.0.0.1": "gateway", "10.0.1.2/31": "vip"},
+		"options": {"strict_cidr": true, "max_description_length": 8}
+	}`)
+	var tmpl PoolTemplate
+	if err := json.Unmarshal(data, &tmpl); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	guardian, err := NewCIDRGuardianFromTemplate(ctx, NewMemoryIPStorage(), tmpl)
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianFromTemplate failed: %v", err)
+	}
+	managed, _ := guardian.GetManagedCIDRs(ctx)
+	if want := map[string]string{"10.0.0.0/29": "web", "10.0.1.0/30": "db"}; !reflect.DeepEqual(managed, want) {
+		t.Errorf("Expected managed CIDRs %v, got %v", want, managed)
+	}
+	if softCap := guardian.managedCIDRs.load()["10.0.0.0/29"].SoftCap; softCap != 80 {
+		t.Errorf("Expected soft cap 80, got %v", softCap)
+	}
+	reserved, _ := guardian.GetReservedIPs(ctx)
+	want := map[string]string{"10.0.0.0": "network", "10.0.0.1": "gateway", "10.0.0.7": "broadcast", "10.0.1.2": "vip", "10.0.1.3": "vip"}
+	if !reflect.DeepEqual(reserved, want) {
+		t.Errorf("Expected reservations %v, got %v", want, reserved)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 7 {
+		t.Errorf("Expected 7 available IPs, got %d", count)
+	}
+
+	// 模板中的配置项生效
+	if err := guardian.AddCIDR(ctx, "10.0.2.5/24", "x"); err == nil {
+		t.Error("strict_cidr from the template should reject host bits")
+	}
+	if _, err := guardian.GetNextAvailableIP(ctx, "too long description"); err == nil {
+		t.Error("max_description_length from the template should be applied")
+	}
+
+	// 模板可以序列化后再次应用
+	encoded, err := json.Marshal(tmpl)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded PoolTemplate
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	other, err := NewCIDRGuardianFromTemplate(ctx, NewMemoryIPStorage(), decoded)
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianFromTemplate failed for round-tripped template: %v", err)
+	}
+	if reserved, _ := other.GetReservedIPs(ctx); !reflect.DeepEqual(reserved, want) {
+		t.Errorf("Expected reservations %v, got %v", want, reserved)
+	}
+
+	// 校验失败时不写入存储
+	invalid := []PoolTemplate{
+		{CIDRs: []TemplateCIDR{{CIDR: "invalid"}}},
+		{CIDRs: []TemplateCIDR{{CIDR: "10.0.0.0/24"}, {CIDR: "10.0.0.128/25"}}},
+		{CIDRs: []TemplateCIDR{{CIDR: "10.0.0.0/24", SoftCap: 120}}},
+		{CIDRs: []TemplateCIDR{{CIDR: "10.0.0.0/24"}}, Reservations: map[string]string{"10.0.1.1": "outside"}},
+		{CIDRs: []TemplateCIDR{{CIDR: "10.0.0.0/24"}}, Options: json.RawMessage(`{"initial_cidrs": ["10.0.1.0/24"]}`)},
+		{CIDRs: []TemplateCIDR{{CIDR: "10.0.0.0/24"}}, Options: json.RawMessage(`{"unknown": true}`)},
+	}
+	for i, tmpl := range invalid {
+		storage := NewMemoryIPStorage()
+		if _, err := NewCIDRGuardianFromTemplate(ctx, storage, tmpl); err == nil {
+			t.Errorf("Template %d should be rejected", i)
+		}
+		if ips, _ := storage.GetAvailableIPs(ctx); len(ips) != 0 {
+			t.Errorf("Template %d should not add IPs, got %v", i, ips)
+		}
+	}
+
+	// 成员已被分配时默认失败，启用叠加时跳过该成员
+	newAllocatedStorage := func() *MemoryIPStorage {
+		storage := NewMemoryIPStorage()
+		_ = storage.AddIP(ctx, "10.0.0.3")
+		_ = storage.AllocateIP(ctx, "10.0.0.3", "used")
+		return storage
+	}
+	storage := newAllocatedStorage()
+	if _, err := NewCIDRGuardianFromTemplate(ctx, storage, PoolTemplate{CIDRs: []TemplateCIDR{{CIDR: "10.0.0.0/29"}}}); err == nil {
+		t.Error("NewCIDRGuardianFromTemplate should fail when a member is already allocated")
+	}
+	if ips, _ := storage.GetAvailableIPs(ctx); len(ips) != 0 {
+		t.Errorf("Expected no available IPs after the rejected template, got %v", ips)
+	}
+	overlayOptions := json.RawMessage(`{"allow_overlay_allocated": true}`)
+	overlay, err := NewCIDRGuardianFromTemplate(ctx, newAllocatedStorage(), PoolTemplate{CIDRs: []TemplateCIDR{{CIDR: "10.0.0.0/29"}}, Options: overlayOptions})
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianFromTemplate failed with overlay allowed: %v", err)
+	}
+	if count, _ := overlay.AvailableCount(ctx); count != 7 {
+		t.Errorf("Expected the allocated member to be skipped, got %d available IPs", count)
+	}
+
+	// 预留失败时撤销本次添加的IP和已完成的预留
+	storage = newAllocatedStorage()
+	tmpl = PoolTemplate{
+		CIDRs:        []TemplateCIDR{{CIDR: "10.0.0.0/29", ReserveNetworkBroadcast: true}},
+		Reservations: map[string]string{"10.0.0.3": "taken"},
+		Options:      overlayOptions,
+	}
+	if _, err := NewCIDRGuardianFromTemplate(ctx, storage, tmpl); err == nil {
+		t.Fatal("NewCIDRGuardianFromTemplate should fail when a reservation fails")
+	}
+	if ips, _ := storage.GetAvailableIPs(ctx); len(ips) != 0 {
+		t.Errorf("Expected no available IPs after rollback, got %v", ips)
+	}
+	if reserved, _ := storage.GetReservedIPs(ctx); len(reserved) != 0 {
+		t.Errorf("Expected no reservations after rollback, got %v", reserved)
+	}
+	if allocated, _ := storage.GetAllocatedIPs(ctx); allocated["10.0.0.3"] != "used" {
+		t.Errorf("Pre-existing allocation should be kept, got %v", allocated)
+	}
+}
+
+// TestCIDRGuardian_AllocatorStats 测试并发冲突重试时统计计数随之变化
+func TestCIDRGuardian_AllocatorStats(t *testing.T) {
+	ctx := context.Background()
+
+	allocateConcurrently := func(guardian *CIDRGuardian) {
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, _ = guardian.AllocateCIDR(ctx, 30, fmt.Sprintf("worker-%d", i))
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	// 两个调用选中同一个块，其中一个重试后成功
+	guardian, _ := NewCIDRGuardian(ctx, newBarrierIPStorage(NewMemoryIPStorage(), 2), "10.0.0.0/28")
+	allocateConcurrently(guardian)
+	if got, want := guardian.AllocatorStats(), (AllocatorStats{Total: 2, Retried: 1}); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// 单个IP分配同样计数
+	if _, err := guardian.GetLastAvailableIP(ctx, "host"); err != nil {
+		t.Fatalf("GetLastAvailableIP failed: %v", err)
+	}
+	if got := guardian.AllocatorStats().Total; got != 3 {
+		t.Errorf("Expected total 3, got %d", got)
+	}
+
+	// 关闭重试时冲突的一方计入 FailedAfterRetry
+	noRetry, _ := NewCIDRGuardianWithOptions(ctx, newBarrierIPStorage(NewMemoryIPStorage(), 2),
+		WithInitialCIDRs("10.0.0.0/28"), WithAllocateRetries(0))
+	allocateConcurrently(noRetry)
+	if got, want := noRetry.AllocatorStats(), (AllocatorStats{Total: 2, FailedAfterRetry: 1}); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+// fakeInventory 是测试用的 InventorySource
+type fakeInventory struct {
+	cidrs       map[string]string
+	allocations map[string]string
+	err         error
+}
+
+func (f *fakeInventory) ListManagedCIDRs(ctx context.Context) (map[string]string, error) {
+	return f.cidrs, f.err
+}
+
+func (f *fakeInventory) ListAllocations(ctx context.Context) (map[string]string, error) {
+	return f.allocations, f.err
+}
+
+// TestCIDRGuardian_SyncFrom 测试从外部台账同步管理池和分配
+func TestCIDRGuardian_SyncFrom(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/28", "10.0.1.0/28")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	_ = guardian.AllocateIP(ctx, "10.0.0.2", "old")
+	_ = guardian.AllocateIP(ctx, "10.0.1.1", "gone")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.8/30", "block"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+
+	src := &fakeInventory{
+		cidrs: map[string]string{
+			"10.0.0.0/28": "office",
+			"10.0.2.5/28": "lab",
+		},
+		allocations: map[string]string{
+			"10.0.0.1": "web",
+			"10.0.0.2": "db",
+			"10.0.0.3": "cache",
+			"10.0.2.1": "printer",
+		},
+	}
+
+	report, err := guardian.SyncFrom(ctx, src)
+	if err != nil {
+		t.Fatalf("SyncFrom failed: %v", err)
+	}
+	want := SyncReport{
+		AddedCIDRs:   []string{"10.0.2.0/28"},
+		RemovedCIDRs: []string{"10.0.1.0/28"},
+		UpdatedCIDRs: []string{"10.0.0.0/28"},
+		Allocated:    []string{"10.0.0.3", "10.0.2.1"},
+		Released:     []string{"10.0.1.1"},
+		Updated:      []string{"10.0.0.2"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("Expected %+v, got %+v", want, report)
+	}
+
+	managed, _ := guardian.GetManagedCIDRs(ctx)
+	if !reflect.DeepEqual(managed, map[string]string{"10.0.0.0/28": "office", "10.0.2.0/28": "lab"}) {
+		t.Errorf("Unexpected managed CIDRs: %v", managed)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	for ip, desc := range map[string]string{"10.0.0.2": "db", "10.0.0.3": "cache", "10.0.2.1": "printer"} {
+		if allocated[ip] != desc {
+			t.Errorf("Expected %s to be allocated as %q, got %q", ip, desc, allocated[ip])
+		}
+	}
+	if _, ok := allocated["10.0.1.1"]; ok {
+		t.Error("Expected 10.0.1.1 to be released")
+	}
+	// CIDR 块不受影响
+	if allocated["10.0.0.8"] != "block" {
+		t.Errorf("Expected block allocation to be untouched, got %q", allocated["10.0.0.8"])
+	}
+
+	// 再次同步没有修改
+	report, err = guardian.SyncFrom(ctx, src)
+	if err != nil {
+		t.Fatalf("SyncFrom failed: %v", err)
+	}
+	if !reflect.DeepEqual(report, SyncReport{}) {
+		t.Errorf("Expected no changes, got %+v", report)
+	}
+
+	// 台账错误和无效条目
+	if _, err := guardian.SyncFrom(ctx, &fakeInventory{err: fmt.Errorf("unavailable")}); err == nil {
+		t.Error("Expected inventory error")
+	}
+	if _, err := guardian.SyncFrom(ctx, &fakeInventory{cidrs: map[string]string{"bad": ""}}); err == nil {
+		t.Error("Expected invalid CIDR error")
+	}
+	if _, err := guardian.SyncFrom(ctx, &fakeInventory{cidrs: src.cidrs, allocations: map[string]string{"bad": ""}}); err == nil {
+		t.Error("Expected invalid IP error")
+	}
+
+	// 台账中的IP不可分配时返回错误和已完成的修改
+	src.allocations["192.168.0.1"] = "outside"
+	report, err = guardian.SyncFrom(ctx, src)
+	if err == nil {
+		t.Error("Expected error for an IP outside the managed CIDRs")
+	}
+	if len(report.Allocated) != 0 {
+		t.Errorf("Expected no allocations, got %v", report.Allocated)
+	}
+}
+
+// TestCIDRGuardian_ReleaseCIDRSpanningManagedCIDRs 测试释放跨越两个相邻管理 /25 的块
+func TestCIDRGuardian_ReleaseCIDRSpanningManagedCIDRs(t *testing.T) {
+	ctx := context.Background()
+
+	newGuardian := func(opts ...MemoryOption) (*CIDRGuardian, *MemoryIPStorage) {
+		storage := NewMemoryIPStorage(opts...)
+		guardian, err := NewCIDRGuardian(ctx, storage, "10.0.0.0/25", "10.0.0.128/25")
+		if err != nil {
+			t.Fatalf("NewCIDRGuardian failed: %v", err)
+		}
+		if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.0/24", "span"); err != nil {
+			t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+		}
+		return guardian, storage
+	}
+
+	// 两个 /25 都在管理中时整块放回，严格添加模式下已可用的成员不会导致失败
+	guardian, storage := newGuardian(WithMemoryStrictAdd())
+	storage.available["10.0.0.200"] = true
+	if err := guardian.ReleaseCIDR(ctx, "10.0.0.0/24"); err != nil {
+		t.Fatalf("ReleaseCIDR failed: %v", err)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 256 {
+		t.Errorf("Expected 256 available IPs, got %d", count)
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 0 {
+		t.Errorf("Expected no allocated IPs, got %d", count)
+	}
+
+	// 下半部分的管理 CIDR 被移除后，只放回上半部分，网络地址也不留在可用池
+	guardian, storage = newGuardian()
+	if err := guardian.RemoveCIDR(ctx, "10.0.0.0/25"); err != nil {
+		t.Fatalf("RemoveCIDR failed: %v", err)
+	}
+	if err := guardian.ReleaseCIDR(ctx, "10.0.0.0/24"); err != nil {
+		t.Fatalf("ReleaseCIDR failed: %v", err)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 128 {
+		t.Errorf("Expected 128 available IPs, got %d", count)
+	}
+	for _, ip := range []string{"10.0.0.0", "10.0.0.127"} {
+		if storage.available[ip] {
+			t.Errorf("Expected %s to stay out of the available pool", ip)
+		}
+	}
+	if !storage.available["10.0.0.128"] || !storage.available["10.0.0.255"] {
+		t.Error("Expected the upper /25 to be available")
+	}
+
+	// 单独分配的网络地址不是块分配
+	single, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/25", "10.0.0.128/25")
+	_ = single.AllocateIP(ctx, "10.0.0.0", "host")
+	if err := single.ReleaseCIDR(ctx, "10.0.0.0/24"); err == nil {
+		t.Error("Expected error when the network address is not a block allocation")
+	}
+}
+
+// TestCIDRGuardian_CaseInsensitiveDescriptions 测试忽略大小写的描述匹配和统计
+func TestCIDRGuardian_CaseInsensitiveDescriptions(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(opts ...Option) *CIDRGuardian {
+		opts = append(opts, WithInitialCIDRs("10.0.0.0/28"))
+		guardian, err := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), opts...)
+		if err != nil {
+			t.Fatalf("NewCIDRGuardianWithOptions failed: %v", err)
+		}
+		_ = guardian.AllocateIP(ctx, "10.0.0.1", "Web")
+		_ = guardian.AllocateIP(ctx, "10.0.0.2", "web")
+		_ = guardian.AllocateIP(ctx, "10.0.0.3", "WebCache")
+		if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.8/30", "WEB"); err != nil {
+			t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+		}
+		return guardian
+	}
+
+	// 默认区分大小写
+	guardian := setup()
+	matched, err := guardian.GetAllocatedIPsMatching(ctx, "web")
+	if err != nil {
+		t.Fatalf("GetAllocatedIPsMatching failed: %v", err)
+	}
+	if !reflect.DeepEqual(matched, map[string]string{"10.0.0.2": "web"}) {
+		t.Errorf("Unexpected case-sensitive matches: %v", matched)
+	}
+
+	guardian = setup(WithCaseInsensitiveDescriptions())
+	matched, _ = guardian.GetAllocatedIPsMatching(ctx, "wEb")
+	want := map[string]string{"10.0.0.1": "Web", "10.0.0.2": "web", "10.0.0.8/30": "WEB"}
+	if !reflect.DeepEqual(matched, want) {
+		t.Errorf("Expected %v, got %v", want, matched)
+	}
+	matched, _ = guardian.GetAllocatedIPsMatching(ctx, "WEBC", WithPrefixMatch())
+	if !reflect.DeepEqual(matched, map[string]string{"10.0.0.3": "WebCache"}) {
+		t.Errorf("Unexpected prefix matches: %v", matched)
+	}
+
+	// 统计合并大小写不同的描述，保留原始写法
+	usage, err := guardian.UsageByDescription(ctx)
+	if err != nil {
+		t.Fatalf("UsageByDescription failed: %v", err)
+	}
+	if wantUsage := map[string]int{"WEB": 6, "WebCache": 1}; !reflect.DeepEqual(usage, wantUsage) {
+		t.Errorf("Expected %v, got %v", wantUsage, usage)
+	}
+
+	released, err := guardian.ReleaseByDescription(ctx, "WeB")
+	if err != nil {
+		t.Fatalf("ReleaseByDescription failed: %v", err)
+	}
+	if wantReleased := []string{"10.0.0.1", "10.0.0.2", "10.0.0.8/30"}; !reflect.DeepEqual(released, wantReleased) {
+		t.Errorf("Expected %v, got %v", wantReleased, released)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if !reflect.DeepEqual(allocated, map[string]string{"10.0.0.3": "WebCache"}) {
+		t.Errorf("Expected only WebCache to remain with its original casing, got %v", allocated)
+	}
+}
+
+// TestCIDRGuardian_VerifyCIDRPopulation 测试检查管理 CIDR 中缺失的地址
+func TestCIDRGuardian_VerifyCIDRPopulation(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryIPStorage()
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/28")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	_ = guardian.ReserveIP(ctx, "10.0.0.2", "gateway")
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.8/30", "block"); err != nil {
+		t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+	}
+
+	// 可用、已分配、预留和块成员都算存在
+	missing, err := guardian.VerifyCIDRPopulation(ctx, "10.0.0.0/28")
+	if err != nil {
+		t.Fatalf("VerifyCIDRPopulation failed: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("Expected no missing addresses, got %v", missing)
+	}
+
+	// 直接从存储中删除地址
+	delete(storage.available, "10.0.0.15")
+	delete(storage.available, "10.0.0.3")
+	missing, _ = guardian.VerifyCIDRPopulation(ctx, "10.0.0.5/28")
+	if want := []string{"10.0.0.3", "10.0.0.15"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("Expected %v, got %v", want, missing)
+	}
+
+	// 非管理 CIDR、超出上限和无效输入
+	if _, err := guardian.VerifyCIDRPopulation(ctx, "10.0.1.0/28"); err == nil {
+		t.Error("Expected error for unmanaged CIDR")
+	}
+	if _, err := guardian.VerifyCIDRPopulation(ctx, "10.0.0.0/8"); err == nil {
+		t.Error("Expected error when CIDR exceeds the host limit")
+	}
+	if _, err := guardian.VerifyCIDRPopulation(ctx, "bad"); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+// TestCIDRGuardian_AllocateEntireCIDR 测试将块内每个地址都标记为已分配
+func TestCIDRGuardian_AllocateEntireCIDR(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(),
+		WithInitialCIDRs("10.0.0.0/28"), WithDescriptionTemplate())
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+
+	before, _ := guardian.AllocatedCount(ctx)
+	if err := guardian.AllocateEntireCIDR(ctx, "10.0.0.8/29", "tenant {cidr}"); err != nil {
+		t.Fatalf("AllocateEntireCIDR failed: %v", err)
+	}
+	after, _ := guardian.AllocatedCount(ctx)
+	if after-before != 8 {
+		t.Errorf("Expected AllocatedCount to increase by 8, got %d", after-before)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	for _, ip := range []string{"10.0.0.8", "10.0.0.15"} {
+		if allocated[ip] != "tenant 10.0.0.8/29" {
+			t.Errorf("Expected %s to be allocated as the tenant, got %q", ip, allocated[ip])
+		}
+	}
+
+	// 任一地址不可用时整体失败，不留下部分分配
+	if err := guardian.AllocateEntireCIDR(ctx, "10.0.0.0/29", "tenant"); err == nil {
+		t.Error("Expected error when a member is already allocated")
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != after {
+		t.Errorf("Expected AllocatedCount to stay %d, got %d", after, count)
+	}
+
+	// 成员整块释放
+	if released, _ := guardian.ReleaseByDescription(ctx, "tenant 10.0.0.8/29"); len(released) != 8 {
+		t.Errorf("Expected 8 released IPs, got %v", released)
+	}
+
+	// 未对齐、超出管理范围和无效输入
+	for _, cidr := range []string{"10.0.0.1/29", "10.0.0.0/27", "bad"} {
+		if err := guardian.AllocateEntireCIDR(ctx, cidr, "tenant"); err == nil {
+			t.Errorf("Expected error for %s", cidr)
+		}
+	}
+}
+
+// TestCIDRGuardian_IPFormat 测试列表和报告类方法的IP输出格式
+func TestCIDRGuardian_IPFormat(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		format    IPFormat
+		available []string
+		used      string
+	}{
+		{IPFormatCanonical, []string{"10.0.0.1", "2001:db8::ab", "fe80::1%eth0"}, "2001:db8::a0/124"},
+		{IPFormatUpperIPv6, []string{"10.0.0.1", "2001:DB8::AB", "FE80::1%eth0"}, "2001:DB8::A0/124"},
+		{IPFormatStripZone, []string{"10.0.0.1", "2001:db8::ab", "fe80::1"}, "2001:db8::a0/124"},
+		{IPFormatUpperIPv6 | IPFormatStripZone, []string{"10.0.0.1", "2001:DB8::AB", "FE80::1"}, "2001:DB8::A0/124"},
+	}
+	for _, tc := range cases {
+		// 直接写入带区域标识的地址，模拟返回这类地址的自定义存储
+		storage := NewMemoryIPStorage()
+		storage.available["10.0.0.1"] = true
+		storage.available["2001:db8::ab"] = true
+		storage.available["fe80::1%eth0"] = true
+		storage.allocated["2001:db8::a0"] = "2001:db8::a0/124 - block"
+		guardian, _ := NewCIDRGuardianWithOptions(ctx, storage, WithIPFormat(tc.format))
+
+		available, err := guardian.GetAvailableIPs(ctx)
+		if err != nil {
+			t.Fatalf("GetAvailableIPs failed: %v", err)
+		}
+		if !reflect.DeepEqual(available, tc.available) {
+			t.Errorf("format %d: expected %v, got %v", tc.format, tc.available, available)
+		}
+		used, _ := guardian.GetUsedCIDRList(ctx)
+		if !reflect.DeepEqual(used, []string{tc.used}) {
+			t.Errorf("format %d: expected used %v, got %v", tc.format, tc.used, used)
+		}
+		table, _ := guardian.StatusTable(ctx)
+		if !strings.Contains(table, tc.used) {
+			t.Errorf("format %d: expected status table to contain %s", tc.format, tc.used)
+		}
+
+		// 存储中保持规范形式
+		if _, ok := storage.allocated["2001:db8::a0"]; !ok || !storage.available["fe80::1%eth0"] {
+			t.Errorf("format %d: storage should keep the canonical form", tc.format)
+		}
+	}
+
+	// 分配和认领类方法无论入口都返回规范形式
+	guardian, _ := NewCIDRGuardianWithOptions(ctx, NewMemoryIPStorage(), WithIPFormat(IPFormatUpperIPv6), WithInitialCIDRs("2001:db8::a0/124"))
+	allocators := map[string]func() (string, error){
+		"GetNextAvailableIP": func() (string, error) { return guardian.GetNextAvailableIP(ctx, "web") },
+		"GetLastAvailableIP": func() (string, error) { return guardian.GetLastAvailableIP(ctx, "web") },
+		"AllocateByKey":      func() (string, error) { return guardian.AllocateByKey(ctx, "node-1", "web") },
+		"AllocateIdempotent": func() (string, error) { return guardian.AllocateIdempotent(ctx, "req-1", "web") },
+		"ClaimIP": func() (string, error) {
+			ip, _, err := guardian.ClaimIP(ctx, "web")
+			return ip, err
+		},
+	}
+	for name, allocate := range allocators {
+		ip, err := allocate()
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		if ip != strings.ToLower(ip) {
+			t.Errorf("%s should return the canonical form, got %s", name, ip)
+		}
+	}
+}
+
+// TestCIDRGuardian_GetAllocationsByTime 测试按分配时间查询分配
+func TestCIDRGuardian_GetAllocationsByTime(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	storage := NewMemoryIPStorage(WithMemoryClock(func() time.Time { return now }))
+	guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/28")
+
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "old")
+	now = base.Add(time.Hour)
+	_, _ = guardian.BulkAllocate(ctx, map[string]string{"10.0.0.2": "middle"})
+	now = base.Add(2 * time.Hour)
+	_ = guardian.AllocateIP(ctx, "10.0.0.3", "new")
+
+	before, err := guardian.GetAllocationsBefore(ctx, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetAllocationsBefore failed: %v", err)
+	}
+	if !reflect.DeepEqual(before, map[string]string{"10.0.0.1": "old"}) {
+		t.Errorf("Unexpected allocations before: %v", before)
+	}
+	after, err := guardian.GetAllocationsAfter(ctx, base.Add(30*time.Minute))
+	if err != nil {
+		t.Fatalf("GetAllocationsAfter failed: %v", err)
+	}
+	if !reflect.DeepEqual(after, map[string]string{"10.0.0.2": "middle", "10.0.0.3": "new"}) {
+		t.Errorf("Unexpected allocations after: %v", after)
+	}
+
+	// 释放后重新分配使用新的时间
+	_ = guardian.ReleaseIP(ctx, "10.0.0.1")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "reused")
+	if before, _ = guardian.GetAllocationsBefore(ctx, base.Add(time.Hour)); len(before) != 0 {
+		t.Errorf("Expected no allocations before, got %v", before)
+	}
+
+	// 存储不支持时返回错误
+	mockGuardian, _ := NewCIDRGuardian(ctx, newMockIPStorage())
+	if _, err := mockGuardian.GetAllocationsBefore(ctx, base); err == nil {
+		t.Error("Expected error when storage does not support allocation times")
+	}
+}
+
+// TestSQLIPStorage_GetAllocationsByTime 测试按 allocated_at 列查询分配
+func TestSQLIPStorage_GetAllocationsByTime(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT ip, description FROM ip_allocated WHERE allocated_at < ?").
+		WithArgs(cutoff).
+		WillReturnRows(sqlmock.NewRows([]string{"ip", "description"}).AddRow("192.168.1.1", "old"))
+	before, err := storage.GetAllocationsBefore(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("GetAllocationsBefore 失败: %v", err)
+	}
+	if !reflect.DeepEqual(before, map[string]string{"192.168.1.1": "old"}) {
+		t.Errorf("结果不符: %v", before)
+	}
+
+	mock.ExpectQuery("SELECT ip, description FROM ip_allocated WHERE allocated_at > ?").
+		WithArgs(cutoff).
+		WillReturnError(fmt.Errorf("query failed"))
+	if _, err := storage.GetAllocationsAfter(ctx, cutoff); err == nil {
+		t.Error("查询失败时 GetAllocationsAfter 应该返回错误")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_AllocationsCSV 测试分配记录的 CSV 导出和导入
+func TestCIDRGuardian_AllocationsCSV(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	now := base
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(WithMemoryClock(func() time.Time { return now })), "10.0.0.0/28")
+
+	_ = guardian.AllocateIP(ctx, "10.0.0.10", `web, "primary"`)
+	now = base.Add(time.Hour)
+	_ = guardian.AllocateIP(ctx, "10.0.0.2", "db")
+	_ = guardian.AllocateSpecificCIDR(ctx, "10.0.0.4/30", "block")
+
+	var buf bytes.Buffer
+	if err := guardian.ExportAllocationsCSV(ctx, &buf); err != nil {
+		t.Fatalf("ExportAllocationsCSV failed: %v", err)
+	}
+	expected := "ip,description,allocated_at\n" +
+		"10.0.0.2,db,2024-01-01T09:00:00Z\n" +
+		"10.0.0.4,10.0.0.4/30 - block,2024-01-01T09:00:00Z\n" +
+		"10.0.0.10,\"web, \"\"primary\"\"\",2024-01-01T08:00:00Z\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+
+	// 导入到新的存储，描述、块和分配时间都被恢复
+	storage := NewMemoryIPStorage()
+	restored, _ := NewCIDRGuardian(ctx, storage)
+	if err := restored.ImportAllocationsCSV(ctx, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("ImportAllocationsCSV failed: %v", err)
+	}
+	allocated, _ := storage.GetAllocatedIPs(ctx)
+	if allocated["10.0.0.10"] != `web, "primary"` || allocated["10.0.0.2"] != "db" {
+		t.Errorf("Unexpected allocations: %v", allocated)
+	}
+	if used, _ := restored.GetUsedCIDRs(ctx); used["10.0.0.4/30"] != "block" {
+		t.Errorf("Expected block to be restored, got %v", used)
+	}
+	if times, _ := storage.GetAllocationTimes(ctx); !times["10.0.0.10"].Equal(base) {
+		t.Errorf("Expected allocation time %v, got %v", base, times["10.0.0.10"])
+	}
+	var again bytes.Buffer
+	_ = restored.ExportAllocationsCSV(ctx, &again)
+	if again.String() != expected {
+		t.Errorf("Expected round trip to be stable, got:\n%s", again.String())
+	}
+
+	// 没有表头、省略 allocated_at 列
+	plain, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if err := plain.ImportAllocationsCSV(ctx, strings.NewReader("10.1.0.1,a\n10.1.0.2,b,\n")); err != nil {
+		t.Errorf("ImportAllocationsCSV failed without header: %v", err)
+	}
+	if count, _ := plain.AllocatedCount(ctx); count != 2 {
+		t.Errorf("Expected 2 imported IPs, got %d", count)
+	}
+
+	// 格式错误时返回带行号的错误且不导入任何记录
+	malformed := map[string]string{
+		"ip,description\n10.2.0.1,a\nbad-ip,b\n":         "第 3 行",
+		"10.2.0.1,a\n10.2.0.2\n":                         "第 2 行",
+		"10.2.0.1,a,yesterday\n":                         "第 1 行",
+		"10.2.0.1,a\n10.2.0.1,b\n":                       "第 2 行",
+		"ip,description,allocated_at\n10.2.0.1,\"open\n": "line 2",
+	}
+	for input, want := range malformed {
+		empty, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+		err := empty.ImportAllocationsCSV(ctx, strings.NewReader(input))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ImportAllocationsCSV(%q): expected error containing %q, got %v", input, want, err)
+		}
+		if count, _ := empty.AllocatedCount(ctx); count != 0 {
+			t.Errorf("ImportAllocationsCSV(%q): expected nothing imported, got %d", input, count)
+		}
+	}
+}
+
+// TestSQLIPStorage_AllocationTimes 测试读取和设置 allocated_at 列
+func TestSQLIPStorage_AllocationTimes(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT ip, allocated_at FROM ip_allocated").
+		WillReturnRows(sqlmock.NewRows([]string{"ip", "allocated_at"}).AddRow("192.168.1.1", at).AddRow("192.168.1.2", nil))
+	times, err := storage.GetAllocationTimes(ctx)
+	if err != nil {
+		t.Fatalf("GetAllocationTimes 失败: %v", err)
+	}
+	if !reflect.DeepEqual(times, map[string]time.Time{"192.168.1.1": at}) {
+		t.Errorf("结果不符: %v", times)
+	}
+
+	for _, rows := range []int64{1, 0} {
+		// MySQL 写入与原值相同的时间时不影响任何行，已分配的IP仍然成功
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+			WithArgs("192.168.1.1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("UPDATE ip_allocated SET allocated_at = ? WHERE ip = ?").
+			WithArgs(at, "192.168.1.1").WillReturnResult(sqlmock.NewResult(0, rows))
+		mock.ExpectCommit()
+		if err := storage.SetAllocationTime(ctx, "192.168.1.1", at); err != nil {
+			t.Errorf("SetAllocationTime 失败（影响 %d 行）: %v", rows, err)
+		}
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("192.168.1.9").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+	if err := storage.SetAllocationTime(ctx, "192.168.1.9", at); err == nil {
+		t.Error("IP 未分配时 SetAllocationTime 应该返回错误")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_PerHostCIDRAllocation 测试逐个记录块成员时的分配计数和释放
+func TestCIDRGuardian_PerHostCIDRAllocation(t *testing.T) {
+	ctx := context.Background()
+
+	// 默认只记录网络地址
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/28")
+	if _, err := guardian.AllocateCIDR(ctx, 30, "db"); err != nil {
+		t.Fatalf("AllocateCIDR failed: %v", err)
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 1 {
+		t.Errorf("Expected 1 allocated IP by default, got %d", count)
+	}
+
+	storage := NewMemoryIPStorage()
+	perHost, _ := NewCIDRGuardianWithOptions(ctx, storage,
+		WithInitialCIDRs("10.0.0.0/28"), WithPerHostCIDRAllocation("db host {ip}"))
+	cidr, err := perHost.AllocateCIDR(ctx, 30, "db")
+	if err != nil {
+		t.Fatalf("AllocateCIDR failed: %v", err)
+	}
+	if count, _ := perHost.AllocatedCount(ctx); count != 4 {
+		t.Errorf("Expected 4 allocated IPs in per-host mode, got %d", count)
+	}
+	if storage.allocated["10.0.0.0"] != "db" || storage.blocks["10.0.0.0"] != "10.0.0.0/30" || storage.allocated["10.0.0.3"] != "db host 10.0.0.3" {
+		t.Errorf("Unexpected descriptions: %v", storage.allocated)
+	}
+	if used, _ := perHost.GetUsedCIDRs(ctx); used[cidr] != "db" {
+		t.Errorf("Expected %s to be listed as used, got %v", cidr, used)
+	}
+	if usage, _ := perHost.UsageByDescription(ctx); usage["db"] != 1 || usage["db host 10.0.0.1"] != 1 {
+		t.Errorf("Unexpected usage: %v", usage)
+	}
+
+	// 释放时成员一并释放
+	if err := perHost.ReleaseCIDR(ctx, cidr); err != nil {
+		t.Fatalf("ReleaseCIDR failed: %v", err)
+	}
+	if count, _ := perHost.AllocatedCount(ctx); count != 0 {
+		t.Errorf("Expected no allocated IPs after release, got %d", count)
+	}
+	if count, _ := perHost.AvailableCount(ctx); count != 16 {
+		t.Errorf("Expected 16 available IPs after release, got %d", count)
+	}
+
+	// 成员分配失败时回滚网络地址的分配
+	mockStorage := newMockIPStorage()
+	mockGuardian, _ := NewCIDRGuardianWithOptions(ctx, mockStorage,
+		WithInitialCIDRs("10.0.0.0/28"), WithPerHostCIDRAllocation(""))
+	mockStorage.setFailure("BulkAllocateIP", "mock failure")
+	if err := mockGuardian.AllocateSpecificCIDR(ctx, "10.0.0.4/30", "db"); err == nil {
+		t.Error("Expected error when member allocation fails")
+	}
+	if _, ok := mockStorage.allocated["10.0.0.4"]; ok {
+		t.Error("Expected the network address allocation to be rolled back")
+	}
+}
+
+// TestCIDRGuardian_ReleaseCIDRWithMembers 测试释放块时一并释放单独分配的成员并报告
+func TestCIDRGuardian_ReleaseCIDRWithMembers(t *testing.T) {
+	ctx := context.Background()
+	newGuardian := func() (*CIDRGuardian, *MemoryIPStorage) {
+		storage := NewMemoryIPStorage()
+		guardian, _ := NewCIDRGuardian(ctx, storage, "10.0.0.0/28")
+		if err := guardian.AllocateSpecificCIDR(ctx, "10.0.0.4/30", "block"); err != nil {
+			t.Fatalf("AllocateSpecificCIDR failed: %v", err)
+		}
+		// 运维人员单独分配了块内的成员
+		storage.allocated["10.0.0.6"] = "manual"
+		return guardian, storage
+	}
+
+	// ReleaseCIDR 保留单独分配的成员
+	guardian, _ := newGuardian()
+	if err := guardian.ReleaseCIDR(ctx, "10.0.0.4/30"); err != nil {
+		t.Fatalf("ReleaseCIDR failed: %v", err)
+	}
+	if allocated, _ := guardian.storage.GetAllocatedIPs(ctx); !reflect.DeepEqual(allocated, map[string]string{"10.0.0.6": "manual"}) {
+		t.Errorf("Expected the member to stay allocated, got %v", allocated)
+	}
+
+	// ReleaseCIDRWithMembers 一并释放并报告
+	guardian, _ = newGuardian()
+	freed, err := guardian.ReleaseCIDRWithMembers(ctx, "10.0.0.4/30")
+	if err != nil {
+		t.Fatalf("ReleaseCIDRWithMembers failed: %v", err)
+	}
+	if !reflect.DeepEqual(freed, []string{"10.0.0.6"}) {
+		t.Errorf("Expected freed members [10.0.0.6], got %v", freed)
+	}
+	if count, _ := guardian.AllocatedCount(ctx); count != 0 {
+		t.Errorf("Expected no allocated IPs, got %d", count)
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 16 {
+		t.Errorf("Expected 16 available IPs, got %d", count)
+	}
+
+	// 没有单独分配的成员时返回空列表
+	guardian, storage := newGuardian()
+	delete(storage.allocated, "10.0.0.6")
+	if freed, err := guardian.ReleaseCIDRWithMembers(ctx, "10.0.0.4/30"); err != nil || len(freed) != 0 {
+		t.Errorf("Expected no freed members, got %v, %v", freed, err)
+	}
+
+	// 块未被分配时返回错误
+	if _, err := guardian.ReleaseCIDRWithMembers(ctx, "10.0.0.4/30"); err == nil {
+		t.Error("ReleaseCIDRWithMembers should fail when the CIDR is not allocated")
+	}
+}
+
+// TestCIDRGuardian_CIDRsByUtilization 测试按使用率排序管理 CIDR
+func TestCIDRGuardian_CIDRsByUtilization(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.2.0/30", "10.0.0.0/30", "10.0.1.0/30", "10.0.3.0/30")
+	_ = guardian.AllocateIP(ctx, "10.0.1.1", "a")
+	_ = guardian.AllocateIP(ctx, "10.0.1.2", "b")
+	_ = guardian.AllocateIP(ctx, "10.0.3.1", "c")
+	_ = guardian.AllocateIP(ctx, "10.0.2.1", "d")
+
+	stats, err := guardian.CIDRsByUtilization(ctx)
+	if err != nil {
+		t.Fatalf("CIDRsByUtilization failed: %v", err)
+	}
+	order := make([]string, len(stats))
+	for i, s := range stats {
+		order[i] = s.CIDR
+	}
+	// 使用率相同的 10.0.2.0/30 和 10.0.3.0/30 按 CIDR 顺序排列
+	if want := []string{"10.0.1.0/30", "10.0.2.0/30", "10.0.3.0/30", "10.0.0.0/30"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected %v, got %v", want, order)
+	}
+	top := stats[0]
+	if top.Total.Int64() != 4 || top.Available != 2 || top.Used.Int64() != 2 || top.Percent != 50 {
+		t.Errorf("Unexpected stats for %s: %+v", top.CIDR, top)
+	}
+	if stats[3].Percent != 0 {
+		t.Errorf("Expected 0%% for the unused CIDR, got %v", stats[3].Percent)
+	}
+
+	// 存储错误时返回错误
+	mockStorage := newMockIPStorage()
+	mockGuardian, _ := NewCIDRGuardian(ctx, mockStorage)
+	mockStorage.setFailure("GetAvailableIPs", "mock failure")
+	if _, err := mockGuardian.CIDRsByUtilization(ctx); err == nil {
+		t.Error("Expected storage error")
+	}
+}
+
+// staleIPStorage 的 GetAvailableIPs 返回固定的快照，模拟查找之后IP被其他调用占用
+type staleIPStorage struct {
+	IPStorage
+	snapshot []string
+}
+
+func (s *staleIPStorage) GetAvailableIPs(ctx context.Context) ([]string, error) {
+	return append([]string(nil), s.snapshot...), nil
+}
+
+// TestCIDRGuardian_AllocateByKey 测试按键的哈希分配IP
+func TestCIDRGuardian_AllocateByKey(t *testing.T) {
+	ctx := context.Background()
+
+	// 相同的可用集合和键总是得到相同的IP
+	allocate := func(key string) string {
+		guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/24")
+		ip, err := guardian.AllocateByKey(ctx, key, "svc")
+		if err != nil {
+			t.Fatalf("AllocateByKey failed: %v", err)
+		}
+		return ip
+	}
+	first := allocate("web")
+	if again := allocate("web"); again != first {
+		t.Errorf("Expected key to map to %s again, got %s", first, again)
+	}
+
+	// 释放后再次分配回到同一个IP
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/24")
+	ip, _ := guardian.AllocateByKey(ctx, "web", "svc")
+	if ip != first {
+		t.Errorf("Expected %s, got %s", first, ip)
+	}
+	if err := guardian.ReleaseIP(ctx, ip); err != nil {
+		t.Fatalf("ReleaseIP failed: %v", err)
+	}
+	if again, _ := guardian.AllocateByKey(ctx, "web", "svc"); again != first {
+		t.Errorf("Expected %s after release, got %s", first, again)
+	}
+
+	// 选中的IP已被占用时向后探测，到末尾后从头继续
+	memory := NewMemoryIPStorage()
+	stale := &staleIPStorage{IPStorage: memory}
+	keyed, _ := NewCIDRGuardianWithOptions(ctx, stale,
+		WithInitialCIDRs("10.0.1.0/30"),
+		WithKeyHash(func(string) uint64 { return 3 }),
+	)
+	stale.snapshot, _ = memory.GetAvailableIPs(ctx)
+	sortIPStrings(stale.snapshot)
+	_ = memory.AllocateIP(ctx, "10.0.1.3", "taken")
+
+	ip, err := keyed.AllocateByKey(ctx, "db", "{ip}")
+	if err != nil {
+		t.Fatalf("AllocateByKey failed: %v", err)
+	}
+	if ip != "10.0.1.0" {
+		t.Errorf("Expected probing to wrap to 10.0.1.0, got %s", ip)
+	}
+	_ = memory.AllocateIP(ctx, "10.0.1.1", "taken")
+	if ip, _ := keyed.AllocateByKey(ctx, "db", "{ip}"); ip != "10.0.1.2" {
+		t.Errorf("Expected probing to skip to 10.0.1.2, got %s", ip)
+	}
+	if _, err := keyed.AllocateByKey(ctx, "db", "{ip}"); err == nil {
+		t.Error("Expected error when every probed IP is taken")
+	}
+
+	// 没有可用IP时返回错误
+	empty, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if _, err := empty.AllocateByKey(ctx, "web", "svc"); err == nil {
+		t.Error("Expected error with empty pool")
+	}
+}
+
+// TestCIDRGuardian_DistinctDescriptionCount 测试统计不同描述的数量
+func TestCIDRGuardian_DistinctDescriptionCount(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/24")
+	for ip, desc := range map[string]string{
+		"10.0.0.1": "tenant-a",
+		"10.0.0.2": "tenant-a",
+		"10.0.0.3": "tenant-b",
+		"10.0.0.4": "Tenant-B",
+	} {
+		if err := guardian.AllocateIP(ctx, ip, desc); err != nil {
+			t.Fatalf("AllocateIP failed: %v", err)
+		}
+	}
+
+	count, err := guardian.DistinctDescriptionCount(ctx)
+	if err != nil {
+		t.Fatalf("DistinctDescriptionCount failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 distinct descriptions, got %d", count)
+	}
+
+	// 不实现 DescriptionCountStorage 的存储读取全部分配记录计数
+	mockStorage := newMockIPStorage()
+	mockGuardian, _ := NewCIDRGuardian(ctx, mockStorage)
+	mockStorage.allocated["10.0.0.1"] = "x"
+	mockStorage.allocated["10.0.0.2"] = "x"
+	if count, _ := mockGuardian.DistinctDescriptionCount(ctx); count != 1 {
+		t.Errorf("Expected 1 distinct description, got %d", count)
+	}
+
+	// 忽略大小写时仅大小写不同的描述合并计数
+	folded, _ := NewCIDRGuardianWithOptions(ctx, guardian.storage, WithCaseInsensitiveDescriptions())
+	if count, _ := folded.DistinctDescriptionCount(ctx); count != 2 {
+		t.Errorf("Expected 2 case-insensitive descriptions, got %d", count)
+	}
+}
+
+// TestSQLIPStorage_DistinctDescriptionCount 测试 SQL 存储统计不同描述的数量
+func TestSQLIPStorage_DistinctDescriptionCount(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COUNT(DISTINCT description) FROM ip_allocated").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	count, err := storage.DistinctDescriptionCount(context.Background())
+	if err != nil {
+		t.Fatalf("DistinctDescriptionCount failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_AddCIDROverlayAllocated 测试 AddCIDR 遇到已分配成员时的处理
+func TestCIDRGuardian_AddCIDROverlayAllocated(t *testing.T) {
+	ctx := context.Background()
+
+	newStorage := func() IPStorage {
+		storage := NewMemoryIPStorage()
+		if err := storage.ImportAllocations(ctx, map[string]string{"10.0.0.5": "existing"}); err != nil {
+			t.Fatalf("ImportAllocations failed: %v", err)
+		}
+		return storage
+	}
+
+	// 默认返回错误，且不添加任何IP
+	guardian, _ := NewCIDRGuardian(ctx, newStorage())
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/29", "new"); err == nil {
+		t.Fatal("Expected error when a member is already allocated")
+	}
+	if count, _ := guardian.AvailableCount(ctx); count != 0 {
+		t.Errorf("Expected rollback to leave no available IPs, got %d", count)
+	}
+	if managed, _ := guardian.GetManagedCIDRs(ctx); len(managed) != 0 {
+		t.Errorf("Expected CIDR not to be managed, got %v", managed)
+	}
+	if _, err := NewCIDRGuardian(ctx, newStorage(), "10.0.0.0/29"); err == nil {
+		t.Error("Expected initial CIDR overlapping an allocation to fail")
+	}
+
+	// 批量添加路径同样拒绝已分配的成员
+	batch, _ := NewCIDRGuardian(ctx, newStorage())
+	if err := batch.AddCIDRs(ctx, map[string]string{"10.0.0.0/29": "new", "10.0.1.0/30": "other"}); err == nil {
+		t.Error("Expected AddCIDRs to fail when a member is already allocated")
+	}
+	if err := batch.AddCIDRWithProgress(ctx, "10.0.0.0/29", "new", nil); err == nil {
+		t.Error("Expected AddCIDRWithProgress to fail when a member is already allocated")
+	}
+	if count, _ := batch.AvailableCount(ctx); count != 0 {
+		t.Errorf("Expected failed batch adds to leave no available IPs, got %d", count)
+	}
+	if managed, _ := batch.GetManagedCIDRs(ctx); len(managed) != 0 {
+		t.Errorf("Expected no managed CIDRs after failed batch adds, got %v", managed)
+	}
+
+	// 启用叠加时跳过已分配的成员
+	overlay, err := NewCIDRGuardianWithOptions(ctx, newStorage(), WithAllowOverlayAllocated(), WithInitialCIDRs("10.0.0.0/29"))
+	if err != nil {
+		t.Fatalf("NewCIDRGuardianWithOptions failed: %v", err)
+	}
+	if count, _ := overlay.AvailableCount(ctx); count != 7 {
+		t.Errorf("Expected 7 available IPs, got %d", count)
+	}
+	if available, _ := overlay.storage.IsIPAvailable(ctx, "10.0.0.5"); available {
+		t.Error("Expected allocated member to stay out of the available pool")
+	}
+	overlayBatch, _ := NewCIDRGuardianWithOptions(ctx, newStorage(), WithAllowOverlayAllocated())
+	if err := overlayBatch.AddCIDRs(ctx, map[string]string{"10.0.0.0/29": "new"}); err != nil {
+		t.Errorf("AddCIDRs failed with overlay allowed: %v", err)
+	}
+	if count, _ := overlayBatch.AvailableCount(ctx); count != 7 {
+		t.Errorf("Expected AddCIDRs to skip the allocated member, got %d available", count)
+	}
+}
+
+// TestCIDRGuardian_AllocationPolicy 测试按 CIDR 的分配策略限制分配方式
+func TestCIDRGuardian_AllocationPolicy(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if err := guardian.AddCIDRWithPolicy(ctx, "10.0.0.0/29", "blocks", PolicyBlockOnly); err != nil {
+		t.Fatalf("AddCIDRWithPolicy failed: %v", err)
+	}
+	if err := guardian.AddCIDRWithPolicy(ctx, "10.0.1.0/29", "hosts", PolicySingleIPOnly); err != nil {
+		t.Fatalf("AddCIDRWithPolicy failed: %v", err)
+	}
+	if err := guardian.AddCIDRWithPolicy(ctx, "10.0.2.0/29", "x", AllocationPolicy(9)); err == nil {
+		t.Error("Expected error for invalid policy")
+	}
+	if policy, _ := guardian.GetCIDRPolicy(ctx, "10.0.0.0/29"); policy != PolicyBlockOnly {
+		t.Errorf("Expected block-only policy, got %v", policy)
+	}
+
+	// 只允许整块的 CIDR 拒绝分配单个IP
+	if err := guardian.AllocateIP(ctx, "10.0.0.1", "host"); !errors.Is(err, ErrAllocationPolicy) {
+		t.Errorf("Expected ErrAllocationPolicy from AllocateIP, got %v", err)
+	}
+	if _, err := guardian.BulkAllocate(ctx, map[string]string{"10.0.0.2": "host"}); !errors.Is(err, ErrAllocationPolicy) {
+		t.Errorf("Expected ErrAllocationPolicy from BulkAllocate, got %v", err)
+	}
+
+	// GetNextAvailableIP 跳过只允许整块的 CIDR
+	ip, err := guardian.GetNextAvailableIP(ctx, "host")
+	if err != nil {
+		t.Fatalf("GetNextAvailableIP failed: %v", err)
+	}
+	if ip != "10.0.1.0" {
+		t.Errorf("Expected 10.0.1.0 from the single-IP CIDR, got %s", ip)
+	}
+
+	// 只允许单个IP的 CIDR 拒绝划分块
+	if err := guardian.AllocateSpecificCIDR(ctx, "10.0.1.4/30", "block"); !errors.Is(err, ErrAllocationPolicy) {
+		t.Errorf("Expected ErrAllocationPolicy from AllocateSpecificCIDR, got %v", err)
+	}
+	cidr, err := guardian.AllocateCIDR(ctx, 30, "block")
+	if err != nil {
+		t.Fatalf("AllocateCIDR failed: %v", err)
+	}
+	if cidr != "10.0.0.0/30" {
+		t.Errorf("Expected block from the block-only CIDR, got %s", cidr)
+	}
+	_, _ = guardian.AllocateCIDR(ctx, 30, "block")
+	if _, err := guardian.AllocateCIDR(ctx, 30, "block"); err == nil {
+		t.Error("Expected AllocateCIDR to fail once only single-IP CIDRs remain")
+	}
+
+	// 单个IP耗尽后不会从只允许整块的 CIDR 中分配
+	for i := 0; i < 7; i++ {
+		_, _ = guardian.GetNextAvailableIP(ctx, "host")
+	}
+	if ip, err := guardian.GetNextAvailableIP(ctx, "host"); err == nil {
+		t.Errorf("Expected no single IP to be available, got %s", ip)
+	}
+}
+
+// TestCIDRGuardian_SoftCap 测试达到软上限的 CIDR 被自动分配跳过
+func TestCIDRGuardian_SoftCap(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if err := guardian.AddCIDR(ctx, "10.0.0.0/29", "critical", WithSoftCap(50)); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+	if err := guardian.AddCIDR(ctx, "10.0.1.0/30", "spare", WithSoftCap(50)); err != nil {
+		t.Fatalf("AddCIDR failed: %v", err)
+	}
+
+	// 前 4 个IP来自 10.0.0.0/29，达到 50% 后转到 10.0.1.0/30
+	expected := []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.1.0", "10.0.1.1"}
+	for _, want := range expected {
+		if ip, err := guardian.GetNextAvailableIP(ctx, "web"); err != nil || ip != want {
+			t.Fatalf("Expected %s, got %s, %v", want, ip, err)
+		}
+	}
+
+	// 所有 CIDR 都达到上限
+	if _, err := guardian.GetNextAvailableIP(ctx, "web"); !errors.Is(err, ErrSoftCapReached) {
+		t.Errorf("Expected ErrSoftCapReached, got %v", err)
+	}
+	if _, err := guardian.AllocateByKey(ctx, "svc", "web"); !errors.Is(err, ErrSoftCapReached) {
+		t.Errorf("AllocateByKey: expected ErrSoftCapReached, got %v", err)
+	}
+	if _, err := guardian.AllocateCIDR(ctx, 31, "block"); !errors.Is(err, ErrSoftCapReached) {
+		t.Errorf("AllocateCIDR: expected ErrSoftCapReached, got %v", err)
+	}
+
+	// 指定地址的分配不受软上限限制
+	if err := guardian.AllocateIP(ctx, "10.0.0.4", "manual"); err != nil {
+		t.Errorf("Expected explicit allocation to ignore the soft cap, got %v", err)
+	}
+
+	// 释放后使用率回落到上限以下，重新可以分配
+	_ = guardian.ReleaseIP(ctx, "10.0.1.1")
+	if ip, err := guardian.GetNextAvailableIP(ctx, "web"); err != nil || ip != "10.0.1.1" {
+		t.Errorf("Expected 10.0.1.1 after release, got %s, %v", ip, err)
+	}
+
+	if err := guardian.AddCIDR(ctx, "10.0.2.0/30", "x", WithSoftCap(150)); err == nil {
+		t.Error("Expected error for soft cap above 100")
+	}
+}
+
+// TestCIDRGuardian_CountAllocatableCIDRs 测试计算可划分的对齐块数量
+func TestCIDRGuardian_CountAllocatableCIDRs(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/27")
+	_ = guardian.AllocateIP(ctx, "10.0.0.8", "a")
+	_ = guardian.AllocateIP(ctx, "10.0.0.24", "b")
+
+	// 剩余 30 个IP，但碎片使可划分的块少于简单的除法结果
+	for bits, want := range map[int]int{32: 30, 29: 2, 28: 0, 27: 0} {
+		count, err := guardian.CountAllocatableCIDRs(ctx, bits)
+		if err != nil {
+			t.Fatalf("CountAllocatableCIDRs(%d) failed: %v", bits, err)
+		}
+		if count != want {
+			t.Errorf("Expected %d /%d blocks, got %d", want, bits, count)
+		}
+	}
+
+	// 与实际能分配的块数一致
+	allocated := 0
+	for {
+		if _, err := guardian.AllocateCIDR(ctx, 29, "block"); err != nil {
+			break
+		}
+		allocated++
+	}
+	if allocated != 2 {
+		t.Errorf("Expected to allocate 2 /29 blocks, got %d", allocated)
+	}
+	if count, _ := guardian.CountAllocatableCIDRs(ctx, 29); count != 0 {
+		t.Errorf("Expected no /29 blocks left, got %d", count)
+	}
+
+	if _, err := guardian.CountAllocatableCIDRs(ctx, 33); err == nil {
+		t.Error("Expected error for invalid bits")
+	}
+}
+
+// TestCIDRGuardian_FreeBlockHistogram 测试按前缀长度统计最大空闲块
+func TestCIDRGuardian_FreeBlockHistogram(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/28")
+
+	histogram, err := guardian.FreeBlockHistogram(ctx)
+	if err != nil {
+		t.Fatalf("FreeBlockHistogram failed: %v", err)
+	}
+	if !reflect.DeepEqual(histogram, map[int]int{28: 1}) {
+		t.Errorf("Expected a single free /28, got %v", histogram)
+	}
+
+	// 分配 .0 和 .5 后空闲块为 .1/32、.2/31、.4/32、.6/31 和 .8/29
+	for _, ip := range []string{"10.0.0.0", "10.0.0.5"} {
+		if err := guardian.AllocateIP(ctx, ip, "frag"); err != nil {
+			t.Fatalf("AllocateIP failed: %v", err)
+		}
+	}
+	histogram, err = guardian.FreeBlockHistogram(ctx)
+	if err != nil {
+		t.Fatalf("FreeBlockHistogram failed: %v", err)
+	}
+	if want := map[int]int{32: 2, 31: 2, 29: 1}; !reflect.DeepEqual(histogram, want) {
+		t.Errorf("Expected %v, got %v", want, histogram)
+	}
+
+	// 可用池为空时返回空映射
+	empty, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage())
+	if histogram, err := empty.FreeBlockHistogram(ctx); err != nil || len(histogram) != 0 {
+		t.Errorf("Expected empty histogram, got %v, %v", histogram, err)
+	}
+
+	// 存储失败时返回错误
+	mockStorage := newMockIPStorage()
+	mockGuardian, _ := NewCIDRGuardian(ctx, mockStorage)
+	mockStorage.setFailure("GetAvailableIPs", "mock failure")
+	if _, err := mockGuardian.FreeBlockHistogram(ctx); err == nil {
+		t.Error("FreeBlockHistogram should fail when GetAvailableIPs fails")
+	}
+}
+
+// TestCIDRGuardian_Metadata 测试为分配保存 JSON 元数据
+func TestCIDRGuardian_Metadata(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/29")
+
+	meta := json.RawMessage(`{"instance":"i-123","tags":{"zone":"a"},"ports":[22,443]}`)
+	if err := guardian.AllocateIPWithMetadata(ctx, "10.0.0.1", "vm", meta); err != nil {
+		t.Fatalf("AllocateIPWithMetadata failed: %v", err)
+	}
+	got, err := guardian.GetMetadata(ctx, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if string(got) != string(meta) {
+		t.Errorf("Expected %s, got %s", meta, got)
+	}
+
+	// 没有元数据时返回 nil，未分配时返回错误
+	_ = guardian.AllocateIP(ctx, "10.0.0.2", "plain")
+	if got, err := guardian.GetMetadata(ctx, "10.0.0.2"); err != nil || got != nil {
+		t.Errorf("Expected no metadata, got %s (err=%v)", got, err)
+	}
+	if _, err := guardian.GetMetadata(ctx, "10.0.0.3"); err == nil {
+		t.Error("Expected error for unallocated IP")
+	}
+
+	// 无效的 JSON 不做分配
+	for _, invalid := range []json.RawMessage{json.RawMessage(`{"instance":`), nil} {
+		if err := guardian.AllocateIPWithMetadata(ctx, "10.0.0.4", "vm", invalid); err == nil {
+			t.Errorf("Expected error for invalid JSON %q", invalid)
+		}
+	}
+	if available, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.4"); !available {
+		t.Error("Expected IP to stay available after invalid metadata")
+	}
+
+	// 释放后元数据一并删除
+	_ = guardian.ReleaseIP(ctx, "10.0.0.1")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "again")
+	if got, _ := guardian.GetMetadata(ctx, "10.0.0.1"); got != nil {
+		t.Errorf("Expected metadata to be cleared on release, got %s", got)
+	}
+
+	// 存储不支持元数据时返回错误
+	mockGuardian, _ := NewCIDRGuardian(ctx, newMockIPStorage())
+	if err := mockGuardian.AllocateIPWithMetadata(ctx, "10.0.0.1", "vm", meta); err == nil {
+		t.Error("Expected error when storage does not support metadata")
+	}
+}
+
+// TestSQLIPStorage_Metadata 测试 SQL 存储的分配元数据
+func TestSQLIPStorage_Metadata(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	meta := json.RawMessage(`{"instance":"i-123"}`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE ip_allocated SET metadata = ? WHERE ip = ?").
+		WithArgs(string(meta), "10.0.0.1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := storage.SetAllocationMetadata(ctx, "10.0.0.1", meta); err != nil {
+		t.Fatalf("SetAllocationMetadata failed: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.2").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+	if err := storage.SetAllocationMetadata(ctx, "10.0.0.2", meta); err == nil {
+		t.Error("Expected error for unallocated IP")
+	}
+
+	mock.ExpectQuery("SELECT metadata FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"metadata"}).AddRow([]byte(meta)))
+	if got, err := storage.GetAllocationMetadata(ctx, "10.0.0.1"); err != nil || string(got) != string(meta) {
+		t.Errorf("Expected %s, got %s (err=%v)", meta, got, err)
+	}
+	mock.ExpectQuery("SELECT metadata FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.3").WillReturnRows(sqlmock.NewRows([]string{"metadata"}).AddRow(nil))
+	if got, err := storage.GetAllocationMetadata(ctx, "10.0.0.3"); err != nil || got != nil {
+		t.Errorf("Expected no metadata, got %s (err=%v)", got, err)
+	}
+	mock.ExpectQuery("SELECT metadata FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.4").WillReturnRows(sqlmock.NewRows([]string{"metadata"}))
+	if _, err := storage.GetAllocationMetadata(ctx, "10.0.0.4"); err == nil {
+		t.Error("Expected error for unallocated IP")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+// TestCIDRGuardian_ForEachAllocatedIP 测试逐条遍历已分配IP
+func TestCIDRGuardian_ForEachAllocatedIP(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/29")
+	_, _ = guardian.AllocateCIDR(ctx, 30, "block")
+	_ = guardian.AllocateIP(ctx, "10.0.0.5", "a")
+	_ = guardian.AllocateIP(ctx, "10.0.0.6", "b")
+
+	seen := map[string]string{}
+	if err := guardian.ForEachAllocatedIP(ctx, func(ip, desc string) error {
+		seen[ip] = desc
+		return nil
+	}); err != nil {
+		t.Fatalf("ForEachAllocatedIP failed: %v", err)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if !reflect.DeepEqual(seen, allocated) {
+		t.Errorf("Expected %v, got %v", allocated, seen)
+	}
+
+	// fn 返回的错误原样返回并停止遍历
+	stop := errors.New("stop")
+	calls := 0
+	if err := guardian.ForEachAllocatedIP(ctx, func(ip, desc string) error {
+		calls++
+		return stop
+	}); err != stop || calls != 1 {
+		t.Errorf("Expected stop after one call, got err=%v calls=%d", err, calls)
+	}
+
+	// 遍历中途取消上下文
+	cancelCtx, cancel := context.WithCancel(ctx)
+	calls = 0
+	err := guardian.ForEachAllocatedIP(cancelCtx, func(ip, desc string) error {
+		calls++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("Expected cancellation after one call, got err=%v calls=%d", err, calls)
+	}
+
+	// 报告使用遍历的结果
+	if used, _ := guardian.GetUsedCIDRs(ctx); len(used) != 1 || used["10.0.0.0/30"] != "block" {
+		t.Errorf("Unexpected used CIDRs: %v", used)
+	}
+}
+
+// TestSQLIPStorage_ForEachAllocatedIP 测试 SQL 存储通过游标遍历时中途取消
+func TestSQLIPStorage_ForEachAllocatedIP(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rows := sqlmock.NewRows([]string{"ip", "description"}).
+		AddRow("10.0.0.1", "a").
+		AddRow("10.0.0.2", "b").
+		AddRow("10.0.0.3", "c")
+	mock.ExpectQuery("SELECT ip, description FROM ip_allocated").WillReturnRows(rows)
+
+	var seen []string
+	err := storage.ForEachAllocatedIP(ctx, func(ip, desc string) error {
+		seen = append(seen, ip)
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "10.0.0.1" {
+		t.Errorf("Expected to stop after the first row, got %v", seen)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestCIDRGuardian_SwapIP 测试原子地将分配移到新的IP
+func TestCIDRGuardian_SwapIP(t *testing.T) {
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/29")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "svc")
+	_ = guardian.AllocateIP(ctx, "10.0.0.3", "other")
+
+	if err := guardian.SwapIP(ctx, "10.0.0.1", "10.0.0.2", "svc"); err != nil {
+		t.Fatalf("SwapIP failed: %v", err)
+	}
+	allocated, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if _, exists := allocated["10.0.0.1"]; exists || allocated["10.0.0.2"] != "svc" {
+		t.Errorf("Unexpected allocations after swap: %v", allocated)
+	}
+	if available, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.1"); !available {
+		t.Error("Expected old IP to be available after swap")
+	}
+
+	// 旧IP未分配时不做任何修改
+	if err := guardian.SwapIP(ctx, "10.0.0.4", "10.0.0.5", "svc"); err == nil {
+		t.Error("Expected error when old IP is not allocated")
+	}
+	if available, _ := guardian.storage.IsIPAvailable(ctx, "10.0.0.5"); !available {
+		t.Error("Expected new IP to stay available after failed swap")
+	}
+
+	// 新IP不可用时旧IP保持分配
+	if err := guardian.SwapIP(ctx, "10.0.0.2", "10.0.0.3", "svc"); !errors.Is(err, ErrIPUnavailable) {
+		t.Errorf("Expected ErrIPUnavailable, got %v", err)
+	}
+	after, _ := guardian.storage.GetAllocatedIPs(ctx)
+	if after["10.0.0.2"] != "svc" || after["10.0.0.3"] != "other" {
+		t.Errorf("Expected allocations to be unchanged, got %v", after)
+	}
+
+	if err := guardian.SwapIP(ctx, "10.0.0.2", "10.0.0.2", "svc"); err == nil {
+		t.Error("Expected error when old and new IP are the same")
+	}
+
+	// 存储不支持时返回错误
+	mockGuardian, _ := NewCIDRGuardian(ctx, newMockIPStorage())
+	if err := mockGuardian.SwapIP(ctx, "10.0.0.1", "10.0.0.2", "svc"); err == nil {
+		t.Error("Expected error when storage does not support swapping")
+	}
+}
+
+// TestSQLIPStorage_SwapIP 测试 SQL 存储在一个事务中交换IP
+func TestSQLIPStorage_SwapIP(t *testing.T) {
+	db, mock, storage := setupMockDB(t)
+	defer db.Close()
+	ctx := context.Background()
+
+	expectDeallocate := func(ip string) {
+		mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+			WithArgs(ip).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("DELETE FROM ip_allocated WHERE ip = ?").
+			WithArgs(ip).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO ip_available (ip) VALUES (?)").
+			WithArgs(ip).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	// 成功交换
+	mock.ExpectBegin()
+	expectDeallocate("10.0.0.1")
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("10.0.0.2").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("DELETE FROM ip_available WHERE ip = ?").
+		WithArgs("10.0.0.2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ip_allocated (ip, description) VALUES (?, ?)").
+		WithArgs("10.0.0.2", "svc").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := storage.SwapIP(ctx, "10.0.0.1", "10.0.0.2", "svc"); err != nil {
+		t.Fatalf("SwapIP failed: %v", err)
+	}
+
+	// 旧IP未分配时回滚
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_allocated WHERE ip = ?").
+		WithArgs("10.0.0.1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+	if err := storage.SwapIP(ctx, "10.0.0.1", "10.0.0.2", "svc"); err == nil {
+		t.Error("Expected error when old IP is not allocated")
+	}
+
+	// 新IP不可用时回滚，已执行的释放一并撤销
+	mock.ExpectBegin()
+	expectDeallocate("10.0.0.1")
+	mock.ExpectQuery("SELECT COUNT(*) FROM ip_available WHERE ip = ?").
+		WithArgs("10.0.0.2").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectRollback()
+	if err := storage.SwapIP(ctx, "10.0.0.1", "10.0.0.2", "svc"); !errors.Is(err, ErrIPUnavailable) {
+		t.Errorf("Expected ErrIPUnavailable, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("有未满足的预期: %s", err)
+	}
+}
+
+// TestDiffState 测试比较两个快照中的各类变化
+func TestDiffState(t *testing.T) {
+	old := []byte(`{
+		"managed_cidrs": {"10.0.0.0/24": "office", "10.0.1.0/24": "lab"},
+		"allocations": {"10.0.0.1": "web", "10.0.0.2": "db", "10.0.0.10": "cache"},
+		"blocks": {"10.0.0.16/30": "k8s", "10.0.0.32/30": "old"}
+	}`)
+	new := []byte(`{
+		"managed_cidrs": {"10.0.0.0/24": "office-2", "10.0.2.0/24": "dmz"},
+		"allocations": {"10.0.0.1": "web", "10.0.0.2": "db-primary", "10.0.0.3": "mq", "10.0.0.20": "printer"},
+		"blocks": {"10.0.0.16/30": "k8s-prod", "10.0.0.48/30": "new"}
+	}`)
+
+	diff, err := DiffState(old, new)
+	if err != nil {
+		t.Fatalf("DiffState failed: %v", err)
+	}
+	expected := StateDiff{
+		AddedCIDRs:   []string{"10.0.2.0/24"},
+		RemovedCIDRs: []string{"10.0.1.0/24"},
+		Allocated:    []string{"10.0.0.3", "10.0.0.20", "10.0.0.48/30"},
+		Released:     []string{"10.0.0.10", "10.0.0.32/30"},
+		DescriptionChanges: map[string]DescriptionChange{
+			"10.0.0.2":     {Old: "db", New: "db-primary"},
+			"10.0.0.16/30": {Old: "k8s", New: "k8s-prod"},
+		},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diff)
+	}
+	if diff.Empty() {
+		t.Error("Expected diff to be non-empty")
+	}
+
+	if diff, err := DiffState(old, old); err != nil || !diff.Empty() {
+		t.Errorf("Expected empty diff for identical snapshots, got %+v, %v", diff, err)
+	}
+	if _, err := DiffState([]byte("not json"), new); err == nil {
+		t.Error("Expected error for invalid old snapshot")
+	}
+	if _, err := DiffState(old, []byte("{")); err == nil {
+		t.Error("Expected error for invalid new snapshot")
+	}
+
+	// 比较 ExportState 导出的快照
+	ctx := context.Background()
+	guardian, _ := NewCIDRGuardian(ctx, NewMemoryIPStorage(), "10.0.0.0/28")
+	_ = guardian.AllocateIP(ctx, "10.0.0.1", "web")
+	before, err := guardian.ExportState(ctx)
+	if err != nil {
+		t.Fatalf("ExportState failed: %v", err)
+	}
+	_ = guardian.ReleaseIP(ctx, "10.0.0.1")
+	_ = guardian.AllocateSpecificCIDR(ctx, "10.0.0.4/30", "k8s")
+	_ = guardian.AddCIDR(ctx, "10.0.1.0/30", "lab")
+	after, _ := guardian.ExportState(ctx)
+
+	diff, err = DiffState(before, after)
+	expected = StateDiff{
+		AddedCIDRs:         []string{"10.0.1.0/30"},
+		RemovedCIDRs:       []string{},
+		Allocated:          []string{"10.0.0.4/30"},
+		Released:           []string{"10.0.0.1"},
+		DescriptionChanges: map[string]DescriptionChange{},
+	}
+	if err != nil || !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %+v, got %+v, %v", expected, diff, err)
+	}
+}
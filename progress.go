@@ -0,0 +1,123 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// progressChunkSize 是 AddCIDRWithProgress 每次批量存储调用添加的IP数量
+const progressChunkSize = 1024
+
+// addCheckpoint 记录 AddCIDRWithProgress 中途失败时已提交的进度
+type addCheckpoint struct {
+	done  int // 已加入可用池的IP数量
+	total int // 需要加入可用池的IP总数，与重新运行时不一致说明排除列表已变化
+}
+
+// checkpoints 以 CIDR 为键保存 AddCIDRWithProgress 的检查点
+type checkpoints map[string]addCheckpoint
+
+// AddCIDRWithProgress 与 AddCIDR 相同，但按每批 progressChunkSize 个IP分批通过 BulkAddIP 提交，
+// 每批提交后调用 progress 报告已添加和总共需要添加的IP数量。中途失败时已提交的批次不回滚，并记录检查点，
+// 之后以相同参数重新调用会从检查点继续；排除列表变化导致总数不同时从头开始（BulkAddIP 对已可用的IP是幂等的）。
+// 全部提交后才将 CIDR 登记到管理池。成员已被分配时与 AddCIDR 一样默认失败，启用 WithAllowOverlayAllocated 时跳过；progress 可以为 nil
+func (g *CIDRGuardian) AddCIDRWithProgress(ctx context.Context, cidr, description string, progress func(done, total int)) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 解析CIDR并规范化为网络形式
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+	if canonical := ipNet.String(); canonical != cidr {
+		if g.strictCIDR {
+			return fmt.Errorf("CIDR %s 设置了主机位，应为 %s", cidr, canonical)
+		}
+		cidr = canonical
+	}
+	if err := g.checkSpecialUse(ipNet); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.managedCIDRs.load()[cidr]; exists {
+		return fmt.Errorf("CIDR %s 已在管理池中", cidr)
+	}
+
+	excluded, err := g.exclusions(ctx, "AddCIDRWithProgress")
+	if err != nil {
+		return err
+	}
+
+	allocated, err := g.allocatedMembers(ctx, "AddCIDRWithProgress")
+	if err != nil {
+		return err
+	}
+
+	ipStrs := []string{}
+	for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+		ipStr := ip.String()
+		if excluded[ipStr] {
+			continue
+		}
+		if _, ok := allocated[ipStr]; ok {
+			return fmt.Errorf("CIDR %s 中的 IP %s 已被分配", cidr, ipStr)
+		}
+		ipStrs = append(ipStrs, ipStr)
+	}
+
+	// 从上次失败时的检查点继续
+	total := len(ipStrs)
+	done := 0
+	if checkpoint, ok := g.addProgress[cidr]; ok && checkpoint.total == total {
+		done = checkpoint.done
+	}
+	for done < total {
+		// 检查上下文是否已取消
+		if err := ctx.Err(); err != nil {
+			g.saveCheckpoint(cidr, done, total)
+			return err
+		}
+
+		end := done + progressChunkSize
+		if end > total {
+			end = total
+		}
+		if _, err := g.storage.BulkAddIP(ctx, ipStrs[done:end]); err != nil {
+			g.saveCheckpoint(cidr, done, total)
+			return fmt.Errorf("添加 CIDR %s 失败（已完成 %d/%d）: %w", cidr, done, total, g.wrapErr(ctx, "AddCIDRWithProgress", err))
+		}
+		done = end
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+	delete(g.addProgress, cidr)
+
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		m[cidr] = &CIDRInfo{
+			CIDR:        cidr,
+			Description: description,
+			IPNet:       ipNet,
+		}
+	})
+	return nil
+}
+
+// saveCheckpoint 记录 AddCIDRWithProgress 的进度，调用方需持有写锁
+func (g *CIDRGuardian) saveCheckpoint(cidr string, done, total int) {
+	if g.addProgress == nil {
+		g.addProgress = make(checkpoints)
+	}
+	g.addProgress[cidr] = addCheckpoint{done: done, total: total}
+}
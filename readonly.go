@@ -0,0 +1,40 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrReadOnly 表示 CIDRGuardian 处于只读模式，拒绝修改操作
+var ErrReadOnly = errors.New("CIDRGuardian 处于只读模式")
+
+// registerCIDR 只将 CIDR 登记到管理池而不写入存储，用于只读模式下描述已有存储中的网段
+func (g *CIDRGuardian) registerCIDR(ctx context.Context, cidr, description string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+	cidr = ipNet.String()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.managedCIDRs.load()[cidr]; exists {
+		return fmt.Errorf("CIDR %s 已在管理池中", cidr)
+	}
+	g.managedCIDRs.update(func(m map[string]*CIDRInfo) {
+		m[cidr] = &CIDRInfo{
+			CIDR:        cidr,
+			Description: description,
+			IPNet:       ipNet,
+		}
+	})
+	return nil
+}
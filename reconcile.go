@@ -0,0 +1,92 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Reconcile 调用 Verify 检查存储状态并修正可以安全修正的不一致，返回已修正的记录
+// 同时可用且已分配、预留但仍可用的 IP 会从可用池中移除；不属于管理 CIDR 的分配需要人工判断，不做处理。
+// 多次调用会依次执行，不会并发
+func (g *CIDRGuardian) Reconcile(ctx context.Context) ([]Inconsistency, error) {
+	if g.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	g.reconcileMu.Lock()
+	defer g.reconcileMu.Unlock()
+
+	return g.reconcile(ctx)
+}
+
+// reconcile 执行一次校正，调用方需持有 reconcileMu
+func (g *CIDRGuardian) reconcile(ctx context.Context) ([]Inconsistency, error) {
+	inconsistencies, err := g.Verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	corrected := []Inconsistency{}
+	for _, item := range inconsistencies {
+		switch item.Kind {
+		case InconsistencyAvailableAndAllocated, InconsistencyReservedAndAvailable:
+			if err := g.storage.RemoveIP(ctx, item.IP); err != nil {
+				return corrected, g.wrapErr(ctx, "Reconcile", err)
+			}
+			corrected = append(corrected, item)
+			if g.logger != nil {
+				g.logger.InfoContext(ctx, "已修正存储不一致", "ip", item.IP, "kind", string(item.Kind))
+			}
+		}
+	}
+	return corrected, nil
+}
+
+// StartReconciler 在后台按 interval 周期调用 Reconcile，直到 ctx 取消或调用返回的 stop
+// 上一次校正（包括手动调用的 Reconcile）尚未结束时跳过本次执行；失败只记录日志，不会停止校正。
+// stop 会等待后台 goroutine 退出，可以重复调用。interval 不为正数时返回错误，不启动后台任务
+func (g *CIDRGuardian) StartReconciler(ctx context.Context, interval time.Duration) (stop func(), err error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("无效的校正间隔: %v", interval)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				g.reconcileTick(ctx)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}, nil
+}
+
+// reconcileTick 执行一次后台校正，已有校正在进行时直接返回
+func (g *CIDRGuardian) reconcileTick(ctx context.Context) {
+	if g.readOnly || !g.reconcileMu.TryLock() {
+		return
+	}
+	defer g.reconcileMu.Unlock()
+
+	if _, err := g.reconcile(ctx); err != nil && ctx.Err() == nil && g.logger != nil {
+		g.logger.WarnContext(ctx, "定期校正失败", "error", err)
+	}
+}
@@ -0,0 +1,247 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// reserver 返回存储后端的预留接口
+func (g *CIDRGuardian) reserver() (IPReservationStorage, error) {
+	reserver, ok := storageAs[IPReservationStorage](g.storage)
+	if !ok {
+		return nil, fmt.Errorf("存储后端不支持 IP 预留")
+	}
+	return reserver, nil
+}
+
+// 自动预留的网络地址和广播地址的默认原因
+const (
+	defaultNetworkReason   = "network"
+	defaultBroadcastReason = "broadcast"
+)
+
+// AddCIDROption 配置 AddCIDR 添加 CIDR 的方式
+type AddCIDROption func(*addCIDRConfig)
+
+// addCIDRConfig AddCIDR 配置
+type addCIDRConfig struct {
+	reserve         bool    // 预留网络地址和广播地址
+	networkReason   string  // 网络地址的预留原因，为空时使用 defaultNetworkReason
+	broadcastReason string  // 广播地址的预留原因，为空时使用 defaultBroadcastReason
+	softCap         float64 // 软上限使用率百分比，0 表示不限制
+}
+
+// WithReserveNetworkBroadcast 添加 IPv4 CIDR 时预留其网络地址和广播地址，预留原因分别为 "network" 和 "broadcast"
+// /31、/32 和 IPv6 CIDR 没有网络地址和广播地址之分，不预留任何地址；需要存储实现 IPReservationStorage
+func WithReserveNetworkBroadcast() AddCIDROption {
+	return func(c *addCIDRConfig) {
+		c.reserve = true
+	}
+}
+
+// WithReserveReasons 与 WithReserveNetworkBroadcast 相同，但使用指定的预留原因，传入空字符串时使用默认原因
+func WithReserveReasons(network, broadcast string) AddCIDROption {
+	return func(c *addCIDRConfig) {
+		c.reserve = true
+		c.networkReason = network
+		c.broadcastReason = broadcast
+	}
+}
+
+// WithSoftCap 为 CIDR 设置软上限：使用率（不可用地址占比）达到 percent 后，GetNextAvailableIP、AllocateCIDR 等
+// 自动选择地址的方法跳过该 CIDR 而从其他 CIDR 分配，所有 CIDR 都达到上限时返回 ErrSoftCapReached；
+// 指定具体地址的 AllocateIP 等不受影响。percent 取值为 0 到 100，0 表示不限制
+func WithSoftCap(percent float64) AddCIDROption {
+	return func(c *addCIDRConfig) {
+		c.softCap = percent
+	}
+}
+
+// reserveNetworkBroadcast 预留刚加入可用池的网络地址和广播地址，不在 added 中的地址（已分配或被排除）跳过
+// 任一预留失败时取消已完成的预留
+func (g *CIDRGuardian) reserveNetworkBroadcast(ctx context.Context, reserver IPReservationStorage, ipNet *net.IPNet, added []string, cfg addCIDRConfig) error {
+	broadcast, err := BroadcastAddress(ipNet.String())
+	if err != nil {
+		return nil // 没有广播地址的 CIDR 不预留
+	}
+
+	networkReason, broadcastReason := cfg.networkReason, cfg.broadcastReason
+	if networkReason == "" {
+		networkReason = defaultNetworkReason
+	}
+	if broadcastReason == "" {
+		broadcastReason = defaultBroadcastReason
+	}
+
+	isAdded := make(map[string]bool, len(added))
+	for _, ipStr := range added {
+		isAdded[ipStr] = true
+	}
+
+	reserved := []string{}
+	for _, r := range []struct{ ip, reason string }{{ipNet.IP.String(), networkReason}, {broadcast, broadcastReason}} {
+		if !isAdded[r.ip] {
+			continue
+		}
+		if err := reserver.ReserveIP(ctx, r.ip, r.reason); err != nil {
+			for _, ipStr := range reserved {
+				_ = reserver.UnreserveIP(ctx, ipStr)
+			}
+			return g.wrapErr(ctx, "AddCIDR", err)
+		}
+		reserved = append(reserved, r.ip)
+	}
+	return nil
+}
+
+// ReserveIP 预留一个可用IP，预留期间它不会被分配，也不计入可用数量
+func (g *CIDRGuardian) ReserveIP(ctx context.Context, ip, reason string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	reserver, err := g.reserver()
+	if err != nil {
+		return err
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return fmt.Errorf("无效的IP地址格式: %s", ip)
+	}
+
+	return g.wrapErr(ctx, "ReserveIP", reserver.ReserveIP(ctx, parsedIP.String(), reason))
+}
+
+// UnreserveIP 取消预留，将IP放回可用池
+func (g *CIDRGuardian) UnreserveIP(ctx context.Context, ip string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	reserver, err := g.reserver()
+	if err != nil {
+		return err
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return fmt.Errorf("无效的IP地址格式: %s", ip)
+	}
+
+	return g.wrapErr(ctx, "UnreserveIP", reserver.UnreserveIP(ctx, parsedIP.String()))
+}
+
+// GetReservedIPs 获取所有预留的IP及预留原因
+func (g *CIDRGuardian) GetReservedIPs(ctx context.Context) (map[string]string, error) {
+	reserver, err := g.reserver()
+	if err != nil {
+		return nil, err
+	}
+
+	reserved, err := reserver.GetReservedIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "GetReservedIPs", err)
+	}
+	return reserved, nil
+}
+
+// ReserveCIDR 预留整个 CIDR 块，所有成员地址都必须可用；任一地址预留失败时回滚
+func (g *CIDRGuardian) ReserveCIDR(ctx context.Context, cidr, reason string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	reserver, err := g.reserver()
+	if err != nil {
+		return err
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+
+	reserved := []string{}
+	rollback := func() {
+		for _, ipStr := range reserved {
+			_ = reserver.UnreserveIP(ctx, ipStr)
+		}
+	}
+
+	for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+		// 检查上下文是否已取消
+		if err := ctx.Err(); err != nil {
+			rollback()
+			return err
+		}
+
+		ipStr := ip.String()
+		if err := reserver.ReserveIP(ctx, ipStr, reason); err != nil {
+			rollback()
+			return g.wrapErr(ctx, "ReserveCIDR", err)
+		}
+		reserved = append(reserved, ipStr)
+	}
+
+	return nil
+}
+
+// UnreserveCIDR 取消 CIDR 块内所有预留地址的预留，将它们放回可用池
+// 块内没有任何预留地址时返回错误；中途失败时恢复已取消的预留
+func (g *CIDRGuardian) UnreserveCIDR(ctx context.Context, cidr string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	reserver, err := g.reserver()
+	if err != nil {
+		return err
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+
+	all, err := reserver.GetReservedIPs(ctx)
+	if err != nil {
+		return g.wrapErr(ctx, "UnreserveCIDR", err)
+	}
+
+	members := []string{}
+	for ipStr := range all {
+		if ip := net.ParseIP(ipStr); ip != nil && ipNet.Contains(ip) {
+			members = append(members, ipStr)
+		}
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("CIDR %s 中没有预留的地址", ipNet.String())
+	}
+	sortIPStrings(members)
+
+	released := []string{}
+	for _, ipStr := range members {
+		if err := reserver.UnreserveIP(ctx, ipStr); err != nil {
+			// 恢复已取消的预留
+			for _, releasedIP := range released {
+				_ = reserver.ReserveIP(ctx, releasedIP, all[releasedIP])
+			}
+			return g.wrapErr(ctx, "UnreserveCIDR", err)
+		}
+		released = append(released, ipStr)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package CIDRGuardian
+
+import (
+	"sync"
+	"time"
+)
+
+// releaseTimes 记录单个IP最近一次被释放的时间，用于 WithAvoidRecentReuse
+type releaseTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+// record 记录 ip 在 now 被释放，并清理早于 window 的记录，避免无限增长
+func (r *releaseTimes) record(ip string, now time.Time, window time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.times == nil {
+		r.times = make(map[string]time.Time)
+	}
+	for k, t := range r.times {
+		if now.Sub(t) >= window {
+			delete(r.times, k)
+		}
+	}
+	r.times[ip] = now
+}
+
+// pick 返回 ips 中第一个在 window 内未被释放的IP；全部都在 window 内被释放过时，返回释放时间最早的IP
+func (r *releaseTimes) pick(ips []string, now time.Time, window time.Duration) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	best := ""
+	var bestTime time.Time
+	for _, ip := range ips {
+		t, ok := r.times[ip]
+		if !ok || now.Sub(t) >= window {
+			return ip
+		}
+		if best == "" || t.Before(bestTime) {
+			best, bestTime = ip, t
+		}
+	}
+	return best
+}
+
+// recordRelease 在启用 WithAvoidRecentReuse 时记录单个IP的释放时间
+func (g *CIDRGuardian) recordRelease(ip string) {
+	if g.reuseWindow > 0 {
+		g.released.record(ip, g.clock.Now(), g.reuseWindow)
+	}
+}
@@ -0,0 +1,131 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrStoragePanic 表示存储后端的方法发生了 panic，SafeStorage 将其转换为错误
+var ErrStoragePanic = errors.New("存储后端发生 panic")
+
+// SafeStorage 包装另一个 IPStorage，恢复其每个方法中的 panic 并转换为包装 ErrStoragePanic 的错误，
+// 避免有缺陷的自定义存储后端使整个服务崩溃
+// SafeStorage 只实现 IPStorage；CIDRGuardian 检查可选接口（如 IPReservationStorage）时会通过 Unwrap 查找被包装的存储，
+// 这些可选方法直接调用被包装的存储，不做 panic 恢复
+type SafeStorage struct {
+	storage IPStorage
+}
+
+// NewSafeStorage 创建一个包装 storage 的 SafeStorage，storage 已是 SafeStorage 时直接返回
+func NewSafeStorage(storage IPStorage) *SafeStorage {
+	if safe, ok := storage.(*SafeStorage); ok {
+		return safe
+	}
+	return &SafeStorage{storage: storage}
+}
+
+// Unwrap 返回被包装的存储
+func (s *SafeStorage) Unwrap() IPStorage {
+	return s.storage
+}
+
+// storageAs 对存储做可选接口的类型断言，存储本身未实现而实现了 Unwrap() IPStorage（如 SafeStorage）时继续检查被包装的存储
+func storageAs[T any](storage IPStorage) (T, bool) {
+	for {
+		if t, ok := storage.(T); ok {
+			return t, true
+		}
+		wrapper, ok := storage.(interface{ Unwrap() IPStorage })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		storage = wrapper.Unwrap()
+	}
+}
+
+// recoverPanic 在方法返回前恢复 panic，并将其记录到 err 中
+func recoverPanic(method string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w: %s: %v", ErrStoragePanic, method, r)
+	}
+}
+
+// AddIP 实现 IPStorage 接口
+func (s *SafeStorage) AddIP(ctx context.Context, ip string) (err error) {
+	defer recoverPanic("AddIP", &err)
+	return s.storage.AddIP(ctx, ip)
+}
+
+// RemoveIP 实现 IPStorage 接口
+func (s *SafeStorage) RemoveIP(ctx context.Context, ip string) (err error) {
+	defer recoverPanic("RemoveIP", &err)
+	return s.storage.RemoveIP(ctx, ip)
+}
+
+// IsIPAvailable 实现 IPStorage 接口
+func (s *SafeStorage) IsIPAvailable(ctx context.Context, ip string) (available bool, err error) {
+	defer recoverPanic("IsIPAvailable", &err)
+	return s.storage.IsIPAvailable(ctx, ip)
+}
+
+// GetAvailableIPs 实现 IPStorage 接口
+func (s *SafeStorage) GetAvailableIPs(ctx context.Context) (ips []string, err error) {
+	defer recoverPanic("GetAvailableIPs", &err)
+	return s.storage.GetAvailableIPs(ctx)
+}
+
+// AllocateIP 实现 IPStorage 接口
+func (s *SafeStorage) AllocateIP(ctx context.Context, ip string, description string) (err error) {
+	defer recoverPanic("AllocateIP", &err)
+	return s.storage.AllocateIP(ctx, ip, description)
+}
+
+// DeallocateIP 实现 IPStorage 接口
+func (s *SafeStorage) DeallocateIP(ctx context.Context, ip string) (err error) {
+	defer recoverPanic("DeallocateIP", &err)
+	return s.storage.DeallocateIP(ctx, ip)
+}
+
+// GetAllocatedIPs 实现 IPStorage 接口
+func (s *SafeStorage) GetAllocatedIPs(ctx context.Context) (allocated map[string]string, err error) {
+	defer recoverPanic("GetAllocatedIPs", &err)
+	return s.storage.GetAllocatedIPs(ctx)
+}
+
+// AvailableCount 实现 IPStorage 接口
+func (s *SafeStorage) AvailableCount(ctx context.Context) (count int, err error) {
+	defer recoverPanic("AvailableCount", &err)
+	return s.storage.AvailableCount(ctx)
+}
+
+// AllocatedCount 实现 IPStorage 接口
+func (s *SafeStorage) AllocatedCount(ctx context.Context) (count int, err error) {
+	defer recoverPanic("AllocatedCount", &err)
+	return s.storage.AllocatedCount(ctx)
+}
+
+// ImportAllocations 实现 IPStorage 接口
+func (s *SafeStorage) ImportAllocations(ctx context.Context, allocations map[string]string) (err error) {
+	defer recoverPanic("ImportAllocations", &err)
+	return s.storage.ImportAllocations(ctx, allocations)
+}
+
+// BulkAllocateIP 实现 IPStorage 接口
+func (s *SafeStorage) BulkAllocateIP(ctx context.Context, allocations map[string]string, skipUnavailable bool) (ips []string, err error) {
+	defer recoverPanic("BulkAllocateIP", &err)
+	return s.storage.BulkAllocateIP(ctx, allocations, skipUnavailable)
+}
+
+// UpdateDescription 实现 IPStorage 接口
+func (s *SafeStorage) UpdateDescription(ctx context.Context, ip string, description string) (err error) {
+	defer recoverPanic("UpdateDescription", &err)
+	return s.storage.UpdateDescription(ctx, ip, description)
+}
+
+// BulkAddIP 实现 IPStorage 接口
+func (s *SafeStorage) BulkAddIP(ctx context.Context, ips []string) (added []string, err error) {
+	defer recoverPanic("BulkAddIP", &err)
+	return s.storage.BulkAddIP(ctx, ips)
+}
@@ -0,0 +1,130 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+)
+
+// selfTestIP 是存储自检使用的临时地址（RFC 5737 文档保留地址）
+const selfTestIP = "192.0.2.254"
+
+// selfTestDescription 是存储自检分配临时地址时使用的描述
+const selfTestDescription = "CIDRGuardian 存储自检"
+
+// ValidateStorage 对存储后端做一次快速自检，验证 IPStorage 接口约定
+// 依次添加、分配、释放并移除一个临时地址（192.0.2.254），检查每一步后的可用和已分配状态；
+// 该地址已存在于存储中时直接返回错误。自检结束或失败时都会尽量清理临时地址
+func ValidateStorage(ctx context.Context, storage IPStorage) (err error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fail := func(step, format string, args ...any) error {
+		return fmt.Errorf("存储自检失败（%s）: %s", step, fmt.Sprintf(format, args...))
+	}
+
+	// 检查临时地址的初始状态
+	state := func() (available, allocated bool, desc string, err error) {
+		if available, err = storage.IsIPAvailable(ctx, selfTestIP); err != nil {
+			return false, false, "", err
+		}
+		all, err := storage.GetAllocatedIPs(ctx)
+		if err != nil {
+			return false, false, "", err
+		}
+		desc, allocated = all[selfTestIP]
+		return available, allocated, desc, nil
+	}
+
+	available, allocated, _, err := state()
+	if err != nil {
+		return fail("检查初始状态", "%v", err)
+	}
+	if available || allocated {
+		return fail("检查初始状态", "自检地址 %s 已存在于存储中", selfTestIP)
+	}
+
+	// 清理临时地址，忽略错误
+	defer func() {
+		_ = storage.DeallocateIP(ctx, selfTestIP)
+		_ = storage.RemoveIP(ctx, selfTestIP)
+	}()
+
+	before, err := storage.AvailableCount(ctx)
+	if err != nil {
+		return fail("统计可用数量", "%v", err)
+	}
+
+	// 添加到可用池
+	if err := storage.AddIP(ctx, selfTestIP); err != nil {
+		return fail("AddIP", "%v", err)
+	}
+	if available, allocated, _, err = state(); err != nil {
+		return fail("AddIP", "%v", err)
+	}
+	if !available || allocated {
+		return fail("AddIP", "添加后应可用且未分配，实际可用=%v 已分配=%v", available, allocated)
+	}
+	if after, err := storage.AvailableCount(ctx); err != nil {
+		return fail("AddIP", "%v", err)
+	} else if after != before+1 {
+		return fail("AddIP", "可用数量应为 %d，实际为 %d", before+1, after)
+	}
+	ips, err := storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return fail("GetAvailableIPs", "%v", err)
+	}
+	found := false
+	for _, ip := range ips {
+		if ip == selfTestIP {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fail("GetAvailableIPs", "可用列表中缺少 %s", selfTestIP)
+	}
+
+	// 分配
+	if err := storage.AllocateIP(ctx, selfTestIP, selfTestDescription); err != nil {
+		return fail("AllocateIP", "%v", err)
+	}
+	available, allocated, desc, err := state()
+	if err != nil {
+		return fail("AllocateIP", "%v", err)
+	}
+	if available || !allocated {
+		return fail("AllocateIP", "分配后应不可用且已分配，实际可用=%v 已分配=%v", available, allocated)
+	}
+	if desc != selfTestDescription {
+		return fail("AllocateIP", "描述应为 %q，实际为 %q", selfTestDescription, desc)
+	}
+	if err := storage.AllocateIP(ctx, selfTestIP, selfTestDescription); err == nil {
+		return fail("AllocateIP", "重复分配同一地址应返回错误")
+	}
+
+	// 释放
+	if err := storage.DeallocateIP(ctx, selfTestIP); err != nil {
+		return fail("DeallocateIP", "%v", err)
+	}
+	if available, allocated, _, err = state(); err != nil {
+		return fail("DeallocateIP", "%v", err)
+	}
+	if !available || allocated {
+		return fail("DeallocateIP", "释放后应可用且未分配，实际可用=%v 已分配=%v", available, allocated)
+	}
+
+	// 移除
+	if err := storage.RemoveIP(ctx, selfTestIP); err != nil {
+		return fail("RemoveIP", "%v", err)
+	}
+	if available, allocated, _, err = state(); err != nil {
+		return fail("RemoveIP", "%v", err)
+	}
+	if available || allocated {
+		return fail("RemoveIP", "移除后应不可用且未分配，实际可用=%v 已分配=%v", available, allocated)
+	}
+
+	return nil
+}
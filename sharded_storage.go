@@ -0,0 +1,698 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sort"
+	"time"
+)
+
+// ShardedIPStorage 将 IP 按哈希分散到多个存储后端
+//
+// 以单个 IP 为键的操作路由到 backends[hash(ip) % N]，列表与计数操作汇总所有分片。
+// AllocateCIDR 分配的块可能跨越多个分片：CIDRGuardian 对块内每个 IP 单独调用
+// AllocateIP/RemoveIP，因此每个成员都会被路由到其所属分片，无需额外处理。
+// 跨分片的批量操作不具备数据库级别的原子性，只能在执行前尽量检查冲突。
+type ShardedIPStorage struct {
+	backends []IPStorage
+}
+
+// NewShardedIPStorage 创建一个新的分片 IP 存储
+func NewShardedIPStorage(backends ...IPStorage) (*ShardedIPStorage, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("至少需要一个存储后端")
+	}
+	for i, backend := range backends {
+		if backend == nil {
+			return nil, fmt.Errorf("第 %d 个存储后端为空", i)
+		}
+	}
+
+	return &ShardedIPStorage{
+		backends: append([]IPStorage(nil), backends...),
+	}, nil
+}
+
+// shardIndex 计算 IP 所属分片的下标
+func (s *ShardedIPStorage) shardIndex(ip string) int {
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return int(h.Sum32() % uint32(len(s.backends)))
+}
+
+// shardFor 返回 IP 所属的存储后端
+func (s *ShardedIPStorage) shardFor(ip string) IPStorage {
+	return s.backends[s.shardIndex(ip)]
+}
+
+// AddIP 实现 IPStorage 接口
+func (s *ShardedIPStorage) AddIP(ctx context.Context, ip string) error {
+	return s.shardFor(ip).AddIP(ctx, ip)
+}
+
+// RemoveIP 实现 IPStorage 接口
+func (s *ShardedIPStorage) RemoveIP(ctx context.Context, ip string) error {
+	return s.shardFor(ip).RemoveIP(ctx, ip)
+}
+
+// IsIPAvailable 实现 IPStorage 接口
+func (s *ShardedIPStorage) IsIPAvailable(ctx context.Context, ip string) (bool, error) {
+	return s.shardFor(ip).IsIPAvailable(ctx, ip)
+}
+
+// AreIPsAvailable 实现 BulkAvailabilityStorage 接口，按分片分组后批量检查，分片不支持批量检查时逐个检查
+func (s *ShardedIPStorage) AreIPsAvailable(ctx context.Context, ips []string) (map[string]bool, error) {
+	groups := make(map[int][]string)
+	for _, ip := range ips {
+		idx := s.shardIndex(ip)
+		groups[idx] = append(groups[idx], ip)
+	}
+
+	result := make(map[string]bool, len(ips))
+	for idx, group := range groups {
+		available, err := areIPsAvailable(ctx, s.backends[idx], group)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 检查 IP 是否可用失败: %w", idx, err)
+		}
+		for ip, ok := range available {
+			result[ip] = ok
+		}
+	}
+	return result, nil
+}
+
+// GetAvailableIPs 实现 IPStorage 接口
+func (s *ShardedIPStorage) GetAvailableIPs(ctx context.Context) ([]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var ips []string
+	for i, backend := range s.backends {
+		shardIPs, err := backend.GetAvailableIPs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 获取可用 IP 失败: %w", i, err)
+		}
+		ips = append(ips, shardIPs...)
+	}
+
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// AllocateIP 实现 IPStorage 接口
+func (s *ShardedIPStorage) AllocateIP(ctx context.Context, ip string, description string) error {
+	return s.shardFor(ip).AllocateIP(ctx, ip, description)
+}
+
+// DeallocateIP 实现 IPStorage 接口
+func (s *ShardedIPStorage) DeallocateIP(ctx context.Context, ip string) error {
+	return s.shardFor(ip).DeallocateIP(ctx, ip)
+}
+
+// UpdateDescription 实现 IPStorage 接口
+func (s *ShardedIPStorage) UpdateDescription(ctx context.Context, ip string, description string) error {
+	return s.shardFor(ip).UpdateDescription(ctx, ip, description)
+}
+
+// GetAllocatedIPs 实现 IPStorage 接口
+func (s *ShardedIPStorage) GetAllocatedIPs(ctx context.Context) (map[string]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for i, backend := range s.backends {
+		shardAllocated, err := backend.GetAllocatedIPs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 获取已分配 IP 失败: %w", i, err)
+		}
+		for ip, desc := range shardAllocated {
+			result[ip] = desc
+		}
+	}
+
+	return result, nil
+}
+
+// ForEachAllocatedIP 实现 AllocationStreamStorage 接口，依次遍历每个分片
+// 分片不支持 AllocationStreamStorage 时读取该分片的全部分配记录
+func (s *ShardedIPStorage) ForEachAllocatedIP(ctx context.Context, fn func(ip, desc string) error) error {
+	for i, backend := range s.backends {
+		if streamer, ok := storageAs[AllocationStreamStorage](backend); ok {
+			if err := streamer.ForEachAllocatedIP(ctx, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		shardAllocated, err := backend.GetAllocatedIPs(ctx)
+		if err != nil {
+			return fmt.Errorf("分片 %d 获取已分配 IP 失败: %w", i, err)
+		}
+		for ip, desc := range shardAllocated {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(ip, desc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AvailableCount 实现 IPStorage 接口
+func (s *ShardedIPStorage) AvailableCount(ctx context.Context) (int, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for i, backend := range s.backends {
+		count, err := backend.AvailableCount(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("分片 %d 获取可用 IP 数量失败: %w", i, err)
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+// AllocatedCount 实现 IPStorage 接口
+func (s *ShardedIPStorage) AllocatedCount(ctx context.Context) (int, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for i, backend := range s.backends {
+		count, err := backend.AllocatedCount(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("分片 %d 获取已分配 IP 数量失败: %w", i, err)
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+// ImportAllocations 实现 IPStorage 接口
+// 先在所有相关分片上检查冲突，再逐个分片导入
+func (s *ShardedIPStorage) ImportAllocations(ctx context.Context, allocations map[string]string) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 按分片分组
+	groups := make(map[int]map[string]string)
+	for ip, desc := range allocations {
+		idx := s.shardIndex(ip)
+		if groups[idx] == nil {
+			groups[idx] = make(map[string]string)
+		}
+		groups[idx][ip] = desc
+	}
+
+	// 预先检查冲突，尽量避免部分分片导入成功
+	for idx, group := range groups {
+		allocated, err := s.backends[idx].GetAllocatedIPs(ctx)
+		if err != nil {
+			return fmt.Errorf("分片 %d 获取已分配 IP 失败: %w", idx, err)
+		}
+		for ip := range group {
+			if _, exists := allocated[ip]; exists {
+				return fmt.Errorf("IP %s 已被分配", ip)
+			}
+		}
+	}
+
+	// 按分片下标顺序导入
+	indexes := make([]int, 0, len(groups))
+	for idx := range groups {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		if err := s.backends[idx].ImportAllocations(ctx, groups[idx]); err != nil {
+			return fmt.Errorf("分片 %d 导入已分配 IP 失败: %w", idx, err)
+		}
+	}
+
+	return nil
+}
+
+// BulkAllocateIP 实现 IPStorage 接口
+// 非跳过模式下先在所有相关分片上检查可用性，后续分片失败时释放之前分片已分配的 IP
+func (s *ShardedIPStorage) BulkAllocateIP(ctx context.Context, allocations map[string]string, skipUnavailable bool) ([]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 按分片分组
+	groups := make(map[int]map[string]string)
+	for ip, desc := range allocations {
+		idx := s.shardIndex(ip)
+		if groups[idx] == nil {
+			groups[idx] = make(map[string]string)
+		}
+		groups[idx][ip] = desc
+	}
+
+	// 预先检查可用性，尽量避免部分分片分配成功
+	if !skipUnavailable {
+		for idx, group := range groups {
+			for ip := range group {
+				available, err := s.backends[idx].IsIPAvailable(ctx, ip)
+				if err != nil {
+					return nil, fmt.Errorf("分片 %d 检查 IP 是否可用失败: %w", idx, err)
+				}
+				if !available {
+					return nil, fmt.Errorf("IP %s %w", ip, ErrIPUnavailable)
+				}
+			}
+		}
+	}
+
+	// 按分片下标顺序分配
+	indexes := make([]int, 0, len(groups))
+	for idx := range groups {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	result := []string{}
+	for _, idx := range indexes {
+		ips, err := s.backends[idx].BulkAllocateIP(ctx, groups[idx], skipUnavailable)
+		if err != nil {
+			if !skipUnavailable {
+				// 释放之前分片已分配的 IP
+				for _, ip := range result {
+					_ = s.shardFor(ip).DeallocateIP(ctx, ip)
+				}
+				return nil, fmt.Errorf("分片 %d 批量分配 IP 失败: %w", idx, err)
+			}
+			return result, fmt.Errorf("分片 %d 批量分配 IP 失败: %w", idx, err)
+		}
+		result = append(result, ips...)
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// BulkAddIP 实现 IPStorage 接口
+// 各分片分别添加，任一分片失败时移除之前分片新添加的 IP
+func (s *ShardedIPStorage) BulkAddIP(ctx context.Context, ips []string) ([]string, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 按分片分组
+	groups := make(map[int][]string)
+	for _, ip := range ips {
+		idx := s.shardIndex(ip)
+		groups[idx] = append(groups[idx], ip)
+	}
+
+	// 按分片下标顺序添加
+	indexes := make([]int, 0, len(groups))
+	for idx := range groups {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	result := []string{}
+	for _, idx := range indexes {
+		added, err := s.backends[idx].BulkAddIP(ctx, groups[idx])
+		if err != nil {
+			for _, ip := range result {
+				_ = s.shardFor(ip).RemoveIP(ctx, ip)
+			}
+			return nil, fmt.Errorf("分片 %d 批量添加 IP 失败: %w", idx, err)
+		}
+		result = append(result, added...)
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// GetIPHistory 实现 IPHistoryStorage 接口，委托给 IP 所属分片
+func (s *ShardedIPStorage) GetIPHistory(ctx context.Context, ip string) ([]HistoryEntry, error) {
+	idx := s.shardIndex(ip)
+	historian, ok := storageAs[IPHistoryStorage](s.backends[idx])
+	if !ok {
+		return nil, fmt.Errorf("分片 %d 的存储后端不支持 IP 历史记录", idx)
+	}
+	return historian.GetIPHistory(ctx, ip)
+}
+
+// reserverFor 返回 IP 所属分片的预留接口
+func (s *ShardedIPStorage) reserverFor(ip string) (IPReservationStorage, error) {
+	idx := s.shardIndex(ip)
+	reserver, ok := storageAs[IPReservationStorage](s.backends[idx])
+	if !ok {
+		return nil, fmt.Errorf("分片 %d 的存储后端不支持 IP 预留", idx)
+	}
+	return reserver, nil
+}
+
+// ReserveIP 实现 IPReservationStorage 接口
+func (s *ShardedIPStorage) ReserveIP(ctx context.Context, ip string, reason string) error {
+	reserver, err := s.reserverFor(ip)
+	if err != nil {
+		return err
+	}
+	return reserver.ReserveIP(ctx, ip, reason)
+}
+
+// UnreserveIP 实现 IPReservationStorage 接口
+func (s *ShardedIPStorage) UnreserveIP(ctx context.Context, ip string) error {
+	reserver, err := s.reserverFor(ip)
+	if err != nil {
+		return err
+	}
+	return reserver.UnreserveIP(ctx, ip)
+}
+
+// GetReservedIPs 实现 IPReservationStorage 接口
+func (s *ShardedIPStorage) GetReservedIPs(ctx context.Context) (map[string]string, error) {
+	result := make(map[string]string)
+	for i, backend := range s.backends {
+		reserver, ok := storageAs[IPReservationStorage](backend)
+		if !ok {
+			return nil, fmt.Errorf("分片 %d 的存储后端不支持 IP 预留", i)
+		}
+		reserved, err := reserver.GetReservedIPs(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 获取预留 IP 失败: %w", i, err)
+		}
+		for ip, reason := range reserved {
+			result[ip] = reason
+		}
+	}
+	return result, nil
+}
+
+// AllocateBlock 实现 BlockAllocationStorage 接口，委托给网络地址所属分片
+// 分片不支持块记录时按 "CIDR - 描述" 的旧格式写入网络地址
+func (s *ShardedIPStorage) AllocateBlock(ctx context.Context, cidr string, description string) error {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+	networkAddr := ipNet.IP.String()
+	backend := s.backends[s.shardIndex(networkAddr)]
+	if blocker, ok := storageAs[BlockAllocationStorage](backend); ok {
+		return blocker.AllocateBlock(ctx, cidr, description)
+	}
+	return backend.AllocateIP(ctx, networkAddr, packBlockDescription(ipNet.String(), description))
+}
+
+// GetBlockAllocations 实现 BlockAllocationStorage 接口
+func (s *ShardedIPStorage) GetBlockAllocations(ctx context.Context) (map[string]string, error) {
+	result := make(map[string]string)
+	for i, backend := range s.backends {
+		// 不支持块记录的分片中的块保存在描述里，由调用方解析
+		blocker, ok := storageAs[BlockAllocationStorage](backend)
+		if !ok {
+			continue
+		}
+		blocks, err := blocker.GetBlockAllocations(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 获取块分配失败: %w", i, err)
+		}
+		for cidr, desc := range blocks {
+			result[cidr] = desc
+		}
+	}
+	return result, nil
+}
+
+// excluderFor 返回 IP 所属分片的排除列表接口
+func (s *ShardedIPStorage) excluderFor(ip string) (IPExclusionStorage, error) {
+	idx := s.shardIndex(ip)
+	excluder, ok := storageAs[IPExclusionStorage](s.backends[idx])
+	if !ok {
+		return nil, fmt.Errorf("分片 %d 的存储后端不支持 IP 排除列表", idx)
+	}
+	return excluder, nil
+}
+
+// AddExclusion 实现 IPExclusionStorage 接口
+func (s *ShardedIPStorage) AddExclusion(ctx context.Context, ip string) error {
+	excluder, err := s.excluderFor(ip)
+	if err != nil {
+		return err
+	}
+	return excluder.AddExclusion(ctx, ip)
+}
+
+// RemoveExclusion 实现 IPExclusionStorage 接口
+func (s *ShardedIPStorage) RemoveExclusion(ctx context.Context, ip string) error {
+	excluder, err := s.excluderFor(ip)
+	if err != nil {
+		return err
+	}
+	return excluder.RemoveExclusion(ctx, ip)
+}
+
+// GetExclusions 实现 IPExclusionStorage 接口
+func (s *ShardedIPStorage) GetExclusions(ctx context.Context) ([]string, error) {
+	var result []string
+	for i, backend := range s.backends {
+		excluder, ok := storageAs[IPExclusionStorage](backend)
+		if !ok {
+			return nil, fmt.Errorf("分片 %d 的存储后端不支持 IP 排除列表", i)
+		}
+		excluded, err := excluder.GetExclusions(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 获取排除列表失败: %w", i, err)
+		}
+		result = append(result, excluded...)
+	}
+	return result, nil
+}
+
+// SetClaim 实现 IPClaimStorage 接口，委托给 IP 所属分片
+func (s *ShardedIPStorage) SetClaim(ctx context.Context, ip, token string, expiresAt time.Time) error {
+	idx := s.shardIndex(ip)
+	claimer, ok := storageAs[IPClaimStorage](s.backends[idx])
+	if !ok {
+		return fmt.Errorf("分片 %d 的存储后端不支持认领", idx)
+	}
+	return claimer.SetClaim(ctx, ip, token, expiresAt)
+}
+
+// GetClaim 实现 IPClaimStorage 接口，依次在各分片中查找令牌
+func (s *ShardedIPStorage) GetClaim(ctx context.Context, token string) (IPClaim, bool, error) {
+	for i, backend := range s.backends {
+		claimer, ok := storageAs[IPClaimStorage](backend)
+		if !ok {
+			return IPClaim{}, false, fmt.Errorf("分片 %d 的存储后端不支持认领", i)
+		}
+		claim, ok, err := claimer.GetClaim(ctx, token)
+		if err != nil {
+			return IPClaim{}, false, fmt.Errorf("分片 %d 获取认领失败: %w", i, err)
+		}
+		if ok {
+			return claim, true, nil
+		}
+	}
+	return IPClaim{}, false, nil
+}
+
+// ClearClaim 实现 IPClaimStorage 接口，委托给认领所在的分片
+func (s *ShardedIPStorage) ClearClaim(ctx context.Context, token string) error {
+	claim, ok, err := s.GetClaim(ctx, token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("认领 %s 不存在", token)
+	}
+	claimer, _ := storageAs[IPClaimStorage](s.backends[s.shardIndex(claim.IP)])
+	return claimer.ClearClaim(ctx, token)
+}
+
+// GetExpiredClaims 实现 IPClaimStorage 接口，合并所有分片的结果
+func (s *ShardedIPStorage) GetExpiredClaims(ctx context.Context, t time.Time) ([]IPClaim, error) {
+	result := []IPClaim{}
+	for i, backend := range s.backends {
+		claimer, ok := storageAs[IPClaimStorage](backend)
+		if !ok {
+			return nil, fmt.Errorf("分片 %d 的存储后端不支持认领", i)
+		}
+		claims, err := claimer.GetExpiredClaims(ctx, t)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 获取到期认领失败: %w", i, err)
+		}
+		result = append(result, claims...)
+	}
+	return result, nil
+}
+
+// SetAllocationSource 实现 AllocationSourceStorage 接口，委托给 IP 所属分片
+func (s *ShardedIPStorage) SetAllocationSource(ctx context.Context, ip string, source string) error {
+	idx := s.shardIndex(ip)
+	sourcer, ok := storageAs[AllocationSourceStorage](s.backends[idx])
+	if !ok {
+		return fmt.Errorf("分片 %d 的存储后端不支持分配来源", idx)
+	}
+	return sourcer.SetAllocationSource(ctx, ip, source)
+}
+
+// GetAllocationSources 实现 AllocationSourceStorage 接口，合并所有分片的结果
+func (s *ShardedIPStorage) GetAllocationSources(ctx context.Context) (map[string]string, error) {
+	result := make(map[string]string)
+	for i, backend := range s.backends {
+		sourcer, ok := storageAs[AllocationSourceStorage](backend)
+		if !ok {
+			return nil, fmt.Errorf("分片 %d 的存储后端不支持分配来源", i)
+		}
+		sources, err := sourcer.GetAllocationSources(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 获取分配来源失败: %w", i, err)
+		}
+		for ip, source := range sources {
+			result[ip] = source
+		}
+	}
+	return result, nil
+}
+
+// GetAllocationsBefore 实现 AllocationTimeStorage 接口，合并所有分片的结果
+func (s *ShardedIPStorage) GetAllocationsBefore(ctx context.Context, t time.Time) (map[string]string, error) {
+	return s.allocationsByTime(func(timer AllocationTimeStorage) (map[string]string, error) {
+		return timer.GetAllocationsBefore(ctx, t)
+	})
+}
+
+// GetAllocationsAfter 实现 AllocationTimeStorage 接口，合并所有分片的结果
+func (s *ShardedIPStorage) GetAllocationsAfter(ctx context.Context, t time.Time) (map[string]string, error) {
+	return s.allocationsByTime(func(timer AllocationTimeStorage) (map[string]string, error) {
+		return timer.GetAllocationsAfter(ctx, t)
+	})
+}
+
+// allocationsByTime 对每个分片执行按分配时间的查询并合并结果
+func (s *ShardedIPStorage) allocationsByTime(query func(AllocationTimeStorage) (map[string]string, error)) (map[string]string, error) {
+	result := make(map[string]string)
+	for i, backend := range s.backends {
+		timer, ok := storageAs[AllocationTimeStorage](backend)
+		if !ok {
+			return nil, fmt.Errorf("分片 %d 的存储后端不支持分配时间查询", i)
+		}
+		allocations, err := query(timer)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 按分配时间查询失败: %w", i, err)
+		}
+		for ip, desc := range allocations {
+			result[ip] = desc
+		}
+	}
+	return result, nil
+}
+
+// GetAllocationTimes 实现 AllocationTimestampStorage 接口，合并所有分片的结果
+func (s *ShardedIPStorage) GetAllocationTimes(ctx context.Context) (map[string]time.Time, error) {
+	result := make(map[string]time.Time)
+	for i, backend := range s.backends {
+		timer, ok := storageAs[AllocationTimestampStorage](backend)
+		if !ok {
+			return nil, fmt.Errorf("分片 %d 的存储后端不支持读取分配时间", i)
+		}
+		times, err := timer.GetAllocationTimes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("分片 %d 获取分配时间失败: %w", i, err)
+		}
+		for ip, at := range times {
+			result[ip] = at
+		}
+	}
+	return result, nil
+}
+
+// SetAllocationTime 实现 AllocationTimestampStorage 接口，委托给 IP 所属分片
+func (s *ShardedIPStorage) SetAllocationTime(ctx context.Context, ip string, t time.Time) error {
+	idx := s.shardIndex(ip)
+	timer, ok := storageAs[AllocationTimestampStorage](s.backends[idx])
+	if !ok {
+		return fmt.Errorf("分片 %d 的存储后端不支持设置分配时间", idx)
+	}
+	return timer.SetAllocationTime(ctx, ip, t)
+}
+
+// SetAllocationMetadata 实现 AllocationMetadataStorage 接口，委托给 IP 所属分片
+func (s *ShardedIPStorage) SetAllocationMetadata(ctx context.Context, ip string, meta json.RawMessage) error {
+	idx := s.shardIndex(ip)
+	metadater, ok := storageAs[AllocationMetadataStorage](s.backends[idx])
+	if !ok {
+		return fmt.Errorf("分片 %d 的存储后端不支持分配元数据", idx)
+	}
+	return metadater.SetAllocationMetadata(ctx, ip, meta)
+}
+
+// GetAllocationMetadata 实现 AllocationMetadataStorage 接口，委托给 IP 所属分片
+func (s *ShardedIPStorage) GetAllocationMetadata(ctx context.Context, ip string) (json.RawMessage, error) {
+	idx := s.shardIndex(ip)
+	metadater, ok := storageAs[AllocationMetadataStorage](s.backends[idx])
+	if !ok {
+		return nil, fmt.Errorf("分片 %d 的存储后端不支持分配元数据", idx)
+	}
+	return metadater.GetAllocationMetadata(ctx, ip)
+}
+
+// SwapIP 实现 IPSwapStorage 接口
+// 两个 IP 位于同一分片时委托给该分片；位于不同分片时无法保证原子性，直接返回错误
+func (s *ShardedIPStorage) SwapIP(ctx context.Context, oldIP, newIP, description string) error {
+	idx := s.shardIndex(oldIP)
+	if other := s.shardIndex(newIP); other != idx {
+		return fmt.Errorf("IP %s 和 %s 位于不同分片（%d、%d），无法原子交换", oldIP, newIP, idx, other)
+	}
+	swapper, ok := storageAs[IPSwapStorage](s.backends[idx])
+	if !ok {
+		return fmt.Errorf("分片 %d 的存储后端不支持原子交换", idx)
+	}
+	return swapper.SwapIP(ctx, oldIP, newIP, description)
+}
+
+// leaserFor 返回 IP 所属分片的租约接口
+func (s *ShardedIPStorage) leaserFor(ip string) (LeaseStorage, error) {
+	idx := s.shardIndex(ip)
+	leaser, ok := storageAs[LeaseStorage](s.backends[idx])
+	if !ok {
+		return nil, fmt.Errorf("分片 %d 的存储后端不支持租约", idx)
+	}
+	return leaser, nil
+}
+
+// SetLeaseExpiry 实现 LeaseStorage 接口
+func (s *ShardedIPStorage) SetLeaseExpiry(ctx context.Context, ip string, expiresAt time.Time) error {
+	leaser, err := s.leaserFor(ip)
+	if err != nil {
+		return err
+	}
+	return leaser.SetLeaseExpiry(ctx, ip, expiresAt)
+}
+
+// GetLeaseExpiry 实现 LeaseStorage 接口
+func (s *ShardedIPStorage) GetLeaseExpiry(ctx context.Context, ip string) (time.Time, bool, error) {
+	leaser, err := s.leaserFor(ip)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return leaser.GetLeaseExpiry(ctx, ip)
+}
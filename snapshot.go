@@ -0,0 +1,29 @@
+package CIDRGuardian
+
+import "sync/atomic"
+
+// cidrSnapshot 以写时复制的方式保存管理的 CIDR
+// 读取时原子地加载当前的不可变映射，不需要持有 g.mu，也不会阻塞写入；
+// 写入时复制出新映射、修改后整体替换，映射和其中的 CIDRInfo 发布后都不再修改
+type cidrSnapshot struct {
+	p atomic.Pointer[map[string]*CIDRInfo]
+}
+
+// load 返回当前的管理 CIDR 映射，调用方不能修改它
+func (s *cidrSnapshot) load() map[string]*CIDRInfo {
+	if m := s.p.Load(); m != nil {
+		return *m
+	}
+	return nil
+}
+
+// update 复制当前映射，由 fn 修改副本后替换；调用方需持有 g.mu 的写锁，保证写入之间不会互相覆盖
+func (s *cidrSnapshot) update(fn func(m map[string]*CIDRInfo)) {
+	current := s.load()
+	next := make(map[string]*CIDRInfo, len(current)+1)
+	for cidr, info := range current {
+		next[cidr] = info
+	}
+	fn(next)
+	s.p.Store(&next)
+}
@@ -0,0 +1,160 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+)
+
+// allocationSourceKey 是分配来源在上下文中的键
+type allocationSourceKey struct{}
+
+// WithAllocationSource 返回携带分配来源的上下文，对单次调用覆盖 WithSource 设置的默认来源
+func WithAllocationSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, allocationSourceKey{}, source)
+}
+
+// Allocation 描述一个已分配IP的详细信息
+type Allocation struct {
+	IP          string // 已分配的IP，CIDR 块为其网络地址
+	Description string // 分配描述
+	Source      string // 分配来源，未记录时为空
+	CIDR        string // CIDR 块的范围，单个IP为空
+}
+
+// sourceFor 返回本次调用的分配来源，上下文中的来源优先于 WithSource 设置的默认来源
+func (g *CIDRGuardian) sourceFor(ctx context.Context) string {
+	if source, ok := ctx.Value(allocationSourceKey{}).(string); ok && source != "" {
+		return source
+	}
+	return g.source
+}
+
+// stampSource 为刚分配的IP记录来源
+// 没有来源或存储不支持 AllocationSourceStorage 时不做任何事；来源只是元数据，
+// 写入失败时只记录日志，不影响已完成的分配
+func (g *CIDRGuardian) stampSource(ctx context.Context, op string, ips ...string) {
+	source := g.sourceFor(ctx)
+	if source == "" {
+		return
+	}
+	sourcer, ok := storageAs[AllocationSourceStorage](g.storage)
+	if !ok {
+		return
+	}
+	for _, ip := range ips {
+		_ = g.wrapErr(ctx, op, sourcer.SetAllocationSource(ctx, ip, source))
+	}
+}
+
+// GetAllocation 获取一个已分配IP的描述和来源
+// 通过 AllocateCIDR 等分配的块可以传入网络地址查询，此时 CIDR 为块的范围，描述不含 "CIDR - " 前缀
+func (g *CIDRGuardian) GetAllocation(ctx context.Context, ip string) (Allocation, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return Allocation{}, err
+	}
+
+	ip = normalizeIP(ip)
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return Allocation{}, g.wrapErr(ctx, "GetAllocation", err)
+	}
+	desc, exists := allocated[ip]
+	if !exists {
+		return Allocation{}, fmt.Errorf("IP %s 未被分配", ip)
+	}
+
+	blocks, err := g.blockIndex(ctx, "GetAllocation")
+	if err != nil {
+		return Allocation{}, err
+	}
+	allocation := Allocation{IP: ip, Description: desc}
+	if cidr, blockDesc, ok := blocks.lookup(ip, desc); ok {
+		allocation.CIDR, allocation.Description = g.formatIP(cidr), blockDesc
+	}
+	sources, err := g.allocationSources(ctx, "GetAllocation")
+	if err != nil {
+		return Allocation{}, err
+	}
+	allocation.Source = sources[ip]
+	return allocation, nil
+}
+
+// ListAllocations 按IP排序分页返回已分配的IP及其描述和来源，offset 从 0 开始，limit 必须大于 0
+// 存储实现 AllocationPageStorage 时由存储分页（SQL 存储按 ip 列的字典序），否则读取全部分配后按数值顺序分页；
+// 块的网络地址与 GetAllocation 一样返回块的范围和不含前缀的描述；offset 超出总数时返回空切片
+func (g *CIDRGuardian) ListAllocations(ctx context.Context, offset, limit int) ([]Allocation, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if offset < 0 || limit <= 0 {
+		return nil, fmt.Errorf("无效的分页参数: offset=%d, limit=%d", offset, limit)
+	}
+
+	var page []Allocation
+	if pager, ok := storageAs[AllocationPageStorage](g.storage); ok {
+		var err error
+		if page, err = pager.ListAllocations(ctx, offset, limit); err != nil {
+			return nil, g.wrapErr(ctx, "ListAllocations", err)
+		}
+	} else {
+		allocated, err := g.storage.GetAllocatedIPs(ctx)
+		if err != nil {
+			return nil, g.wrapErr(ctx, "ListAllocations", err)
+		}
+		sources, err := g.allocationSources(ctx, "ListAllocations")
+		if err != nil {
+			return nil, err
+		}
+		blocks, err := g.blockIndex(ctx, "ListAllocations")
+		if err != nil {
+			return nil, err
+		}
+
+		ips := make([]string, 0, len(allocated))
+		for ip := range allocated {
+			ips = append(ips, ip)
+		}
+		sortIPStrings(ips)
+		if offset >= len(ips) {
+			ips = nil
+		} else if ips = ips[offset:]; len(ips) > limit {
+			ips = ips[:limit]
+		}
+
+		page = make([]Allocation, 0, len(ips))
+		for _, ip := range ips {
+			allocation := Allocation{IP: ip, Description: allocated[ip], Source: sources[ip]}
+			if block, ok := blocks[ip]; ok {
+				allocation.CIDR, allocation.Description = block.cidr, block.desc
+			}
+			page = append(page, allocation)
+		}
+	}
+
+	for i := range page {
+		// 兼容旧版 "cidr - 描述" 格式的块记录
+		if page[i].CIDR == "" {
+			if cidr, desc, ok := splitBlockDescription(page[i].Description); ok {
+				page[i].CIDR, page[i].Description = cidr, desc
+			}
+		}
+		page[i].IP, page[i].CIDR = g.formatIP(page[i].IP), g.formatIP(page[i].CIDR)
+	}
+	return page, nil
+}
+
+// allocationSources 获取所有已分配IP的来源，存储不支持时返回空结果
+func (g *CIDRGuardian) allocationSources(ctx context.Context, op string) (map[string]string, error) {
+	sourcer, ok := storageAs[AllocationSourceStorage](g.storage)
+	if !ok {
+		return map[string]string{}, nil
+	}
+	sources, err := sourcer.GetAllocationSources(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, op, err)
+	}
+	return sources, nil
+}
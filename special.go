@@ -0,0 +1,70 @@
+package CIDRGuardian
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// ErrSpecialUse 表示地址属于特殊用途范围，由 WithRejectSpecialUse 拒绝
+var ErrSpecialUse = errors.New("属于特殊用途地址范围")
+
+// specialUseRanges 是不应作为普通主机地址分配的特殊用途范围（RFC 6890 等）
+// 私有地址（如 10.0.0.0/8、fc00::/7）和共享地址 100.64.0.0/10 常被用作地址池，不在其中
+var specialUseRanges = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // 本网络
+	netip.MustParsePrefix("127.0.0.0/8"),     // 环回
+	netip.MustParsePrefix("169.254.0.0/16"),  // 链路本地
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF 协议分配
+	netip.MustParsePrefix("192.0.2.0/24"),    // 文档 TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // 基准测试
+	netip.MustParsePrefix("198.51.100.0/24"), // 文档 TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // 文档 TEST-NET-3
+	netip.MustParsePrefix("224.0.0.0/4"),     // 组播
+	netip.MustParsePrefix("240.0.0.0/4"),     // 保留，含受限广播地址
+	netip.MustParsePrefix("::/128"),          // 未指定地址
+	netip.MustParsePrefix("::1/128"),         // 环回
+	netip.MustParsePrefix("100::/64"),        // 丢弃
+	netip.MustParsePrefix("2001:db8::/32"),   // 文档
+	netip.MustParsePrefix("fe80::/10"),       // 链路本地
+	netip.MustParsePrefix("ff00::/8"),        // 组播
+}
+
+// IsSpecialUse 判断 IP 是否属于环回、组播、文档等特殊用途范围，IPv4 映射的 IPv6 地址按 IPv4 判断
+func IsSpecialUse(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range specialUseRanges {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSpecialUse 启用 WithRejectSpecialUse 时检查网络是否与特殊用途范围重叠，重叠时返回包装 ErrSpecialUse 的错误
+func (g *CIDRGuardian) checkSpecialUse(ipNet *net.IPNet) error {
+	if !g.specialUse {
+		return nil
+	}
+
+	addr, ok := netip.AddrFromSlice(ipNet.IP)
+	if !ok {
+		return nil
+	}
+	ones, _ := ipNet.Mask.Size()
+	if addr.Is4In6() {
+		addr, ones = addr.Unmap(), ones-96
+	}
+	p := netip.PrefixFrom(addr, ones).Masked()
+	for _, r := range specialUseRanges {
+		if r.Overlaps(p) {
+			return fmt.Errorf("%s 与 %s 重叠，%w", ipNet.String(), r, ErrSpecialUse)
+		}
+	}
+	return nil
+}
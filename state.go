@@ -0,0 +1,121 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PoolState 是 ExportState 导出的IP池状态快照
+type PoolState struct {
+	ManagedCIDRs map[string]string `json:"managed_cidrs"` // 管理的 CIDR 及描述
+	Allocations  map[string]string `json:"allocations"`   // 单个已分配IP及描述
+	Blocks       map[string]string `json:"blocks"`        // 已分配的 CIDR 块及描述（不含 "CIDR - " 前缀）
+}
+
+// DescriptionChange 是一条分配在两个快照之间的描述变化
+type DescriptionChange struct {
+	Old string // 旧快照中的描述
+	New string // 新快照中的描述
+}
+
+// StateDiff 是两个IP池状态快照之间的差异
+// 列表中单个IP在前、CIDR 块在后，均按数值顺序排列
+type StateDiff struct {
+	AddedCIDRs         []string                     // 新增的管理 CIDR
+	RemovedCIDRs       []string                     // 移除的管理 CIDR
+	Allocated          []string                     // 新分配的IP或 CIDR 块
+	Released           []string                     // 已释放的IP或 CIDR 块
+	DescriptionChanges map[string]DescriptionChange // 两个快照中都已分配但描述不同的IP或 CIDR 块
+}
+
+// Empty 判断两个快照是否没有差异
+func (d StateDiff) Empty() bool {
+	return len(d.AddedCIDRs) == 0 && len(d.RemovedCIDRs) == 0 && len(d.Allocated) == 0 &&
+		len(d.Released) == 0 && len(d.DescriptionChanges) == 0
+}
+
+// ExportState 将管理的 CIDR 和所有分配导出为 JSON 快照，可与之后的快照一起传给 DiffState
+func (g *CIDRGuardian) ExportState(ctx context.Context) ([]byte, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	state := PoolState{
+		ManagedCIDRs: make(map[string]string),
+		Allocations:  make(map[string]string),
+		Blocks:       make(map[string]string),
+	}
+	for cidr, cidrInfo := range g.managedCIDRs.load() {
+		state.ManagedCIDRs[cidr] = cidrInfo.Description
+	}
+
+	blocks, err := g.blockIndex(ctx, "ExportState")
+	if err != nil {
+		return nil, err
+	}
+	err = g.forEachAllocated(ctx, "ExportState", func(ip, desc string) error {
+		if cidr, blockDesc, ok := blocks.lookup(ip, desc); ok {
+			state.Blocks[canonicalCIDR(cidr)] = blockDesc
+		} else {
+			state.Allocations[ip] = desc
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(state)
+}
+
+// DiffState 比较两个 ExportState 导出的 JSON 快照，返回从 old 到 new 的变化
+func DiffState(old, new []byte) (StateDiff, error) {
+	var before, after PoolState
+	if err := json.Unmarshal(old, &before); err != nil {
+		return StateDiff{}, fmt.Errorf("解析旧快照失败: %v", err)
+	}
+	if err := json.Unmarshal(new, &after); err != nil {
+		return StateDiff{}, fmt.Errorf("解析新快照失败: %v", err)
+	}
+
+	diff := StateDiff{DescriptionChanges: make(map[string]DescriptionChange)}
+	diff.AddedCIDRs = missingKeys(after.ManagedCIDRs, before.ManagedCIDRs)
+	diff.RemovedCIDRs = missingKeys(before.ManagedCIDRs, after.ManagedCIDRs)
+	sortCIDRStrings(diff.AddedCIDRs)
+	sortCIDRStrings(diff.RemovedCIDRs)
+
+	// 单个IP和 CIDR 块分别比较，单个IP排在前面
+	allocated := missingKeys(after.Allocations, before.Allocations)
+	released := missingKeys(before.Allocations, after.Allocations)
+	sortIPStrings(allocated)
+	sortIPStrings(released)
+	addedBlocks := missingKeys(after.Blocks, before.Blocks)
+	releasedBlocks := missingKeys(before.Blocks, after.Blocks)
+	sortCIDRStrings(addedBlocks)
+	sortCIDRStrings(releasedBlocks)
+	diff.Allocated = append(allocated, addedBlocks...)
+	diff.Released = append(released, releasedBlocks...)
+
+	for _, pair := range [][2]map[string]string{{before.Allocations, after.Allocations}, {before.Blocks, after.Blocks}} {
+		for key, oldDesc := range pair[0] {
+			if newDesc, ok := pair[1][key]; ok && newDesc != oldDesc {
+				diff.DescriptionChanges[key] = DescriptionChange{Old: oldDesc, New: newDesc}
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// missingKeys 返回在 a 中但不在 b 中的键，顺序不确定
+func missingKeys(a, b map[string]string) []string {
+	keys := []string{}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,46 @@
+package CIDRGuardian
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// AllocatorStats 是分配并发冲突的统计快照
+// 统计 GetNextAvailableIP、GetNextAvailableIPTyped、GetLastAvailableIP 和 AllocateCIDR 的调用
+type AllocatorStats struct {
+	Total            uint64 // 进入分配流程的调用次数
+	Retried          uint64 // 至少因并发冲突重试过一次的调用次数
+	FailedAfterRetry uint64 // 用尽重试次数后仍因并发冲突失败的调用次数
+}
+
+// allocatorCounters 保存 AllocatorStats 的原子计数
+type allocatorCounters struct {
+	total   atomic.Uint64
+	retried atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// AllocatorStats 返回分配并发冲突的统计计数，用于观察并发调用方的冲突频率
+func (g *CIDRGuardian) AllocatorStats() AllocatorStats {
+	return AllocatorStats{
+		Total:            g.allocStats.total.Load(),
+		Retried:          g.allocStats.retried.Load(),
+		FailedAfterRetry: g.allocStats.failed.Load(),
+	}
+}
+
+// shouldRetry 判断第 attempt 次分配的结果是否需要重试，并更新统计计数
+// 只有并发冲突（ErrIPUnavailable）且未用尽 allocRetries 时重试
+func (g *CIDRGuardian) shouldRetry(err error, attempt int) bool {
+	if err == nil || !errors.Is(err, ErrIPUnavailable) {
+		return false
+	}
+	if attempt >= g.allocRetries {
+		g.allocStats.failed.Add(1)
+		return false
+	}
+	if attempt == 0 {
+		g.allocStats.retried.Add(1)
+	}
+	return true
+}
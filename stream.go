@@ -0,0 +1,48 @@
+package CIDRGuardian
+
+import "context"
+
+// ForEachAllocatedIP 依次对每个已分配IP及其描述调用 fn，顺序不确定
+// 存储实现 AllocationStreamStorage 时逐条读取，不会一次性构建完整的映射；否则退回到 GetAllocatedIPs。
+// fn 返回错误或上下文被取消时停止遍历并原样返回该错误；fn 中不应再调用 CIDRGuardian 的方法
+func (g *CIDRGuardian) ForEachAllocatedIP(ctx context.Context, fn func(ip, desc string) error) error {
+	return g.forEachAllocated(ctx, "ForEachAllocatedIP", fn)
+}
+
+// forEachAllocated 遍历所有已分配记录，存储错误按 op 包装，fn 和上下文的错误原样返回
+func (g *CIDRGuardian) forEachAllocated(ctx context.Context, op string, fn func(ip, desc string) error) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if streamer, ok := storageAs[AllocationStreamStorage](g.storage); ok {
+		var fnErr error
+		err := streamer.ForEachAllocatedIP(ctx, func(ip, desc string) error {
+			fnErr = fn(ip, desc)
+			return fnErr
+		})
+		switch {
+		case fnErr != nil:
+			return fnErr
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		}
+		return g.wrapErr(ctx, op, err)
+	}
+
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return g.wrapErr(ctx, op, err)
+	}
+	for ip, desc := range allocated {
+		// 检查上下文是否已取消
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(ip, desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
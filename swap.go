@@ -0,0 +1,52 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+)
+
+// SwapIP 将分配从 oldIP 原子地移到 newIP（如服务在线迁移），newIP 以 description 分配
+// oldIP 必须已分配、newIP 必须可用，任一条件不满足时不做任何修改；需要存储后端实现 IPSwapStorage。
+// oldIP 直接放回可用池，不按 WithOrphanPolicy 处理
+func (g *CIDRGuardian) SwapIP(ctx context.Context, oldIP, newIP, description string) error {
+	if g.readOnly {
+		return ErrReadOnly
+	}
+
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		return err
+	}
+
+	swapper, ok := storageAs[IPSwapStorage](g.storage)
+	if !ok {
+		return fmt.Errorf("存储后端不支持原子交换")
+	}
+
+	for _, ip := range []string{oldIP, newIP} {
+		if _, err := ValidateIP(ip); err != nil {
+			return err
+		}
+	}
+	oldIP, newIP = normalizeIP(oldIP), normalizeIP(newIP)
+	if oldIP == newIP {
+		return fmt.Errorf("新旧 IP 相同: %s", oldIP)
+	}
+	if err := g.checkSingleIPPolicy(newIP); err != nil {
+		return err
+	}
+
+	description = g.expandIPDescription(description, newIP)
+	if err := g.validateDescription(description); err != nil {
+		return err
+	}
+	if err := swapper.SwapIP(ctx, oldIP, newIP, description); err != nil {
+		return g.wrapErr(ctx, "SwapIP", err)
+	}
+	g.stampSource(ctx, "SwapIP", newIP)
+	return nil
+}
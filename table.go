@@ -0,0 +1,63 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// StatusTable 以对齐的表格形式返回IP池状态，适合在终端中显示
+// 包括每个管理 CIDR 的使用率和所有分配记录（含分配来源）；String 的输出格式保持不变
+func (g *CIDRGuardian) StatusTable(ctx context.Context) (string, error) {
+	managedCIDRs, err := g.GetManagedCIDRs(ctx)
+	if err != nil {
+		return "", err
+	}
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return "", g.wrapErr(ctx, "StatusTable", err)
+	}
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return "", g.wrapErr(ctx, "StatusTable", err)
+	}
+	sources, err := g.allocationSources(ctx, "StatusTable")
+	if err != nil {
+		return "", err
+	}
+	blocks, err := g.blockIndex(ctx, "StatusTable")
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+
+	// 管理的CIDR及使用率
+	fmt.Fprintln(tw, "CIDR\t描述\t总数\t可用\t已用\t使用率")
+	for _, u := range cidrUtilizations(managedCIDRs, availableIPs) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%.1f%%\n", g.formatIP(u.CIDR), u.Description, u.Total, u.Available, u.Used, u.Percent)
+	}
+
+	// 分配记录，CIDR 块按网络地址排序显示
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "分配\t类型\t描述\t来源")
+	ips := make([]string, 0, len(allocated))
+	for ip := range allocated {
+		ips = append(ips, ip)
+	}
+	sortIPStrings(ips)
+	for _, ip := range ips {
+		if cidr, desc, ok := blocks.lookup(ip, allocated[ip]); ok {
+			fmt.Fprintf(tw, "%s\tCIDR\t%s\t%s\n", g.formatIP(cidr), desc, sources[ip])
+		} else {
+			fmt.Fprintf(tw, "%s\tIP\t%s\t%s\n", g.formatIP(ip), allocated[ip], sources[ip])
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
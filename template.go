@@ -0,0 +1,66 @@
+package CIDRGuardian
+
+import (
+	"net"
+	"strings"
+)
+
+// 描述模板中支持的占位符
+const (
+	templateIP       = "{ip}"        // 分配的地址，CIDR 块为网络地址
+	templateIPDashed = "{ip-dashed}" // 分配的地址，分隔符替换为 "-"
+	templateCIDR     = "{cidr}"      // 分配的 CIDR 块，单个 IP 为所属的管理 CIDR
+)
+
+// expandDescription 在启用 WithDescriptionTemplate 时展开描述中的占位符
+func (g *CIDRGuardian) expandDescription(description string, ip net.IP, cidr string) string {
+	if !g.descTemplate {
+		return description
+	}
+	return expandTemplate(description, ip, cidr)
+}
+
+// expandTemplate 展开描述中的占位符
+func expandTemplate(description string, ip net.IP, cidr string) string {
+	if !strings.Contains(description, "{") {
+		return description
+	}
+
+	ipStr := ip.String()
+	dashed := strings.NewReplacer(".", "-", ":", "-").Replace(ipStr)
+	return strings.NewReplacer(
+		templateIPDashed, dashed,
+		templateIP, ipStr,
+		templateCIDR, cidr,
+	).Replace(description)
+}
+
+// expandIPDescription 展开单个 IP 分配的描述，{cidr} 为包含该 IP 的管理 CIDR
+func (g *CIDRGuardian) expandIPDescription(description, ipStr string) string {
+	if !g.descTemplate || !strings.Contains(description, "{") {
+		return description
+	}
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return description
+	}
+	return g.expandDescription(description, ip, g.managedCIDRFor(ip))
+}
+
+// managedCIDRFor 返回包含指定 IP 的管理 CIDR，不存在时返回空字符串
+func (g *CIDRGuardian) managedCIDRFor(ip net.IP) string {
+	matched := []string{}
+	for cidr, cidrInfo := range g.managedCIDRs.load() {
+		if cidrInfo.IPNet.Contains(ip) {
+			matched = append(matched, cidr)
+		}
+	}
+	if len(matched) == 0 {
+		return ""
+	}
+
+	// 排序后取第一个，保证 CIDR 重叠时结果确定
+	sortCIDRStrings(matched)
+	return matched[0]
+}
@@ -0,0 +1,48 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// requestIDKey 是请求 ID 在上下文中的键
+type requestIDKey struct{}
+
+// WithRequestID 返回携带请求 ID 的上下文，用于将错误和日志与请求关联
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext 从上下文中获取请求 ID
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// wrapErr 为存储错误附加请求 ID，并在配置了日志记录器时记录日志
+// 存储调用因上下文取消或超时而失败时，错误会注明进行中的操作，仍可用 errors.Is 匹配
+// context.Canceled 和 context.DeadlineExceeded；上下文中没有请求 ID 时不附加请求 ID
+func (g *CIDRGuardian) wrapErr(ctx context.Context, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%s 在存储调用中被取消: %w", op, err)
+	}
+
+	id, ok := RequestIDFromContext(ctx)
+	if g.logger != nil {
+		if ok {
+			g.logger.ErrorContext(ctx, "存储操作失败", "op", op, "request_id", id, "error", err)
+		} else {
+			g.logger.ErrorContext(ctx, "存储操作失败", "op", op, "error", err)
+		}
+	}
+
+	if !ok {
+		return err
+	}
+	return fmt.Errorf("%w (request_id=%s)", err, id)
+}
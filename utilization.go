@@ -0,0 +1,76 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"math/big"
+	"net"
+	"sort"
+)
+
+// CIDRUtilization 是单个管理 CIDR 的使用情况
+type CIDRUtilization struct {
+	CIDR        string   // CIDR 字符串表示
+	Description string   // CIDR 描述
+	Total       *big.Int // 包含的地址数量
+	Available   int64    // 可用的地址数量
+	Used        *big.Int // 不可用（已分配、预留或缺失）的地址数量
+	Percent     float64  // 使用率，0 到 100
+}
+
+// cidrUtilizations 计算每个管理 CIDR 的使用情况，结果按 CIDR 数值顺序排列
+func cidrUtilizations(managedCIDRs map[string]string, availableIPs []string) []CIDRUtilization {
+	// 预先解析可用IP，避免对每个 CIDR 重复解析
+	freeIPs := make([]net.IP, 0, len(availableIPs))
+	for _, ipStr := range availableIPs {
+		if ip := net.ParseIP(ipStr); ip != nil {
+			freeIPs = append(freeIPs, ip)
+		}
+	}
+
+	result := make([]CIDRUtilization, 0, len(managedCIDRs))
+	for _, cidr := range sortedCIDRKeys(managedCIDRs) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+
+		free := int64(0)
+		for _, ip := range freeIPs {
+			if ipNet.Contains(ip) {
+				free++
+			}
+		}
+		total := cidrSize(ipNet)
+		used := new(big.Int).Sub(total, big.NewInt(free))
+		ratio, _ := new(big.Float).Quo(new(big.Float).SetInt(used), new(big.Float).SetInt(total)).Float64()
+
+		result = append(result, CIDRUtilization{
+			CIDR:        cidr,
+			Description: managedCIDRs[cidr],
+			Total:       total,
+			Available:   free,
+			Used:        used,
+			Percent:     ratio * 100,
+		})
+	}
+	return result
+}
+
+// CIDRsByUtilization 返回每个管理 CIDR 的使用情况，按使用率从高到低排列，便于优先查看最满的网络
+// 使用率相同时按 CIDR 数值顺序排列
+func (g *CIDRGuardian) CIDRsByUtilization(ctx context.Context) ([]CIDRUtilization, error) {
+	managedCIDRs, err := g.GetManagedCIDRs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "CIDRsByUtilization", err)
+	}
+
+	result := cidrUtilizations(managedCIDRs, availableIPs)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Percent > result[j].Percent
+	})
+	return result, nil
+}
@@ -0,0 +1,132 @@
+package CIDRGuardian
+
+import (
+	"fmt"
+	"iter"
+	"math/big"
+	"net"
+)
+
+// 地址族
+const (
+	FamilyIPv4 = 4
+	FamilyIPv6 = 6
+)
+
+// ParseAndValidateCIDR 解析并校验 CIDR，返回规范的网络形式、地址族和包含的地址数量
+func ParseAndValidateCIDR(s string) (network string, family int, hostCount *big.Int, err error) {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("无效的CIDR格式 %s: %v", s, err)
+	}
+
+	family = FamilyIPv6
+	if ipNet.IP.To4() != nil {
+		family = FamilyIPv4
+	}
+	return ipNet.String(), family, cidrSize(ipNet), nil
+}
+
+// ValidateIP 校验 IP 地址并返回其地址族
+func ValidateIP(s string) (family int, err error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return 0, fmt.Errorf("无效的IP地址: %s", s)
+	}
+
+	if ip.To4() != nil {
+		return FamilyIPv4, nil
+	}
+	return FamilyIPv6, nil
+}
+
+// NetworkAddress 返回 CIDR 的网络地址，忽略传入的主机位
+func NetworkAddress(cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+	return ipNet.IP.String(), nil
+}
+
+// BroadcastAddress 返回 IPv4 CIDR 的广播地址
+// IPv6 没有广播地址；按 RFC 3021 处理的 /31 和单地址的 /32 也没有广播地址，均返回错误
+func BroadcastAddress(cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+
+	ip4 := ipNet.IP.To4()
+	if ip4 == nil {
+		return "", fmt.Errorf("IPv6 CIDR %s 没有广播地址", cidr)
+	}
+	if ones, _ := ipNet.Mask.Size(); ones >= 31 {
+		return "", fmt.Errorf("/%d 的 CIDR %s 没有广播地址", ones, cidr)
+	}
+
+	mask := net.IP(ipNet.Mask).To4()
+	broadcast := make(net.IP, net.IPv4len)
+	for i := range broadcast {
+		broadcast[i] = ip4[i] | ^mask[i]
+	}
+	return broadcast.String(), nil
+}
+
+// HostsSeq 返回按顺序逐个产生 CIDR 中地址的序列，不会一次性加载所有地址，可以直接用于 range
+// 每次产生的 net.IP 都是独立的副本，yield 返回 false 时立即停止。传入的 CIDR 设置了主机位时从网络地址开始枚举
+func HostsSeq(cidr string) (iter.Seq[net.IP], error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+
+	return func(yield func(net.IP) bool) {
+		for ip, more := cloneIP(ipNet.IP), true; more && ipNet.Contains(ip); more = !nextIP(ip) {
+			if !yield(cloneIP(ip)) {
+				return
+			}
+		}
+	}, nil
+}
+
+// WithoutNetworkBroadcast 包装 HostsSeq 返回的序列，跳过 IPv4 CIDR 的网络地址（第一个地址）和广播地址（最后一个地址）
+// 与 BroadcastAddress 一致，/31、/32（不超过两个地址）和 IPv6 CIDR 没有网络地址和广播地址之分，不跳过任何地址。
+// 为判断最后一个地址，IPv4 地址会延后一个产生
+func WithoutNetworkBroadcast(seq iter.Seq[net.IP]) iter.Seq[net.IP] {
+	return func(yield func(net.IP) bool) {
+		var first, pending net.IP
+		count := 0
+		passthrough, stopped := false, false
+		seq(func(ip net.IP) bool {
+			count++
+			if count == 1 {
+				if ip.To4() != nil {
+					first = ip
+					return true
+				}
+				passthrough = true
+			}
+			if passthrough {
+				stopped = !yield(ip)
+				return !stopped
+			}
+			if count == 2 {
+				pending = ip
+				return true
+			}
+			// 至少有三个地址，第一个是网络地址，pending 不是最后一个地址
+			stopped = !yield(pending)
+			pending = ip
+			return !stopped
+		})
+		if stopped || passthrough || count > 2 {
+			return
+		}
+		for _, ip := range []net.IP{first, pending} {
+			if ip != nil && !yield(ip) {
+				return
+			}
+		}
+	}
+}
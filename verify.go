@@ -0,0 +1,206 @@
+package CIDRGuardian
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+)
+
+// maxPopulationHosts 是逐个处理 CIDR 中每个地址的操作（VerifyCIDRPopulation、AllocateEntireCIDR）允许的最大地址数量
+const maxPopulationHosts = 1 << 20
+
+// InconsistencyKind 表示 Verify 发现的不一致类型
+type InconsistencyKind string
+
+const (
+	// InconsistencyAvailableAndAllocated IP 同时存在于可用池和已分配池
+	InconsistencyAvailableAndAllocated InconsistencyKind = "available_and_allocated"
+	// InconsistencyUnmanagedAllocation 已分配的 IP 不属于任何管理的 CIDR
+	InconsistencyUnmanagedAllocation InconsistencyKind = "unmanaged_allocation"
+	// InconsistencyReservedAndAvailable 预留的 IP 同时存在于可用池
+	InconsistencyReservedAndAvailable InconsistencyKind = "reserved_and_available"
+)
+
+// Inconsistency 描述一条存储状态不一致记录
+type Inconsistency struct {
+	IP   string            // 出现不一致的 IP
+	Kind InconsistencyKind // 不一致类型
+}
+
+// Verify 交叉检查可用池、已分配池和预留记录，返回发现的所有不一致
+// 每个集合只读取一次并在内存中求交集，不会逐个 IP 查询存储；存储不支持预留时跳过预留检查。
+// 结果按 IP 数值顺序排列，同一 IP 的多条记录按类型排列
+func (g *CIDRGuardian) Verify(ctx context.Context) ([]Inconsistency, error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "Verify", err)
+	}
+	available := make(map[string]bool, len(availableIPs))
+	for _, ip := range availableIPs {
+		available[ip] = true
+	}
+
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "Verify", err)
+	}
+
+	var reserved map[string]string
+	if reserver, ok := storageAs[IPReservationStorage](g.storage); ok {
+		if reserved, err = reserver.GetReservedIPs(ctx); err != nil {
+			return nil, g.wrapErr(ctx, "Verify", err)
+		}
+	}
+
+	cidrs := g.managedCIDRs.load()
+	managed := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidrInfo := range cidrs {
+		managed = append(managed, cidrInfo.IPNet)
+	}
+
+	result := []Inconsistency{}
+	for ipStr := range allocated {
+		if available[ipStr] {
+			result = append(result, Inconsistency{IP: ipStr, Kind: InconsistencyAvailableAndAllocated})
+		}
+
+		inManaged := false
+		if ip := net.ParseIP(ipStr); ip != nil {
+			for _, ipNet := range managed {
+				if ipNet.Contains(ip) {
+					inManaged = true
+					break
+				}
+			}
+		}
+		if !inManaged {
+			result = append(result, Inconsistency{IP: ipStr, Kind: InconsistencyUnmanagedAllocation})
+		}
+	}
+	for ipStr := range reserved {
+		if available[ipStr] {
+			result = append(result, Inconsistency{IP: ipStr, Kind: InconsistencyReservedAndAvailable})
+		}
+	}
+
+	// 按 IP 数值顺序排列，保证结果确定
+	ips := make([]string, len(result))
+	for i, item := range result {
+		ips[i] = item.IP
+	}
+	sortIPStrings(ips)
+	order := make(map[string]int, len(ips))
+	for i, ip := range ips {
+		if _, exists := order[ip]; !exists {
+			order[ip] = i
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].IP != result[j].IP {
+			return order[result[i].IP] < order[result[j].IP]
+		}
+		return result[i].Kind < result[j].Kind
+	})
+
+	return result, nil
+}
+
+// VerifyCIDRPopulation 检查管理 CIDR 中的每个地址是否存在于可用池、已分配记录或预留记录中，
+// 返回缺失的地址（按数值顺序），用于在导入状态或崩溃恢复后确认 CIDR 完整。
+// 通过 AllocateCIDR 等分配的块成员视为已分配；CIDR 包含的地址超过 maxPopulationHosts 时返回错误
+func (g *CIDRGuardian) VerifyCIDRPopulation(ctx context.Context, cidr string) (missing []string, err error) {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的CIDR格式 %s: %v", cidr, err)
+	}
+	prefix = prefix.Masked()
+	if hostBits := prefix.Addr().BitLen() - prefix.Bits(); hostBits > 20 {
+		return nil, fmt.Errorf("CIDR %s 包含的地址超过检查上限 %d", cidr, maxPopulationHosts)
+	}
+
+	_, managed := g.managedCIDRs.load()[prefix.String()]
+	if !managed {
+		return nil, fmt.Errorf("CIDR %s 不在管理池中", prefix.String())
+	}
+
+	// 一次性读取各个集合
+	present := make(map[netip.Addr]bool)
+	availableIPs, err := g.storage.GetAvailableIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "VerifyCIDRPopulation", err)
+	}
+	for _, ipStr := range availableIPs {
+		if addr, err := netip.ParseAddr(ipStr); err == nil {
+			present[addr.Unmap()] = true
+		}
+	}
+
+	allocated, err := g.storage.GetAllocatedIPs(ctx)
+	if err != nil {
+		return nil, g.wrapErr(ctx, "VerifyCIDRPopulation", err)
+	}
+	index, err := g.blockIndex(ctx, "VerifyCIDRPopulation")
+	if err != nil {
+		return nil, err
+	}
+	var blocks []netip.Prefix
+	for ipStr, desc := range allocated {
+		if addr, err := netip.ParseAddr(ipStr); err == nil {
+			present[addr.Unmap()] = true
+		}
+		// 块的其他成员不在任何集合中，按块范围计入
+		if blockCIDR, _, ok := index.lookup(ipStr, desc); ok {
+			if block, err := netip.ParsePrefix(blockCIDR); err == nil && block.Overlaps(prefix) {
+				blocks = append(blocks, block.Masked())
+			}
+		}
+	}
+
+	if reserver, ok := storageAs[IPReservationStorage](g.storage); ok {
+		reserved, err := reserver.GetReservedIPs(ctx)
+		if err != nil {
+			return nil, g.wrapErr(ctx, "VerifyCIDRPopulation", err)
+		}
+		for ipStr := range reserved {
+			if addr, err := netip.ParseAddr(ipStr); err == nil {
+				present[addr.Unmap()] = true
+			}
+		}
+	}
+
+	missing = []string{}
+	for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+		// 检查上下文是否已取消
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if present[addr] || inAnyPrefix(blocks, addr) {
+			continue
+		}
+		missing = append(missing, addr.String())
+	}
+	return missing, nil
+}
+
+// inAnyPrefix 检查地址是否属于任一前缀
+func inAnyPrefix(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}